@@ -14,8 +14,9 @@ import (
 //
 // 検出パターン:
 //  1. RS 急上昇: 直近の RS - 過去5営業日の RS が +15以上
-//  2. 業績修正開示: TDNET 当日開示で「修正」「上方」「下方」を含むもの
+//  2. 業績修正開示: TDNET 当日開示のうち業績予想修正・配当カテゴリ (tdnet_classify.go)
 //  3. 出来高急増: 当日出来高が直近5営業日平均の 3倍超 かつ 株価上昇
+//  4. 自社株買い: TDNET 当日開示のうち自己株式取得の決定 (取得状況の報告は除く)
 func detectAlerts(targetDate string) {
 	db, err := openServerDB()
 	if err != nil {
@@ -38,20 +39,23 @@ func detectAlerts(targetDate string) {
 		fmt.Println()
 	}
 
-	// 2. 業績修正開示
+	// 2. 業績修正開示 (旧バージョンで取得した未分類の行も分類してから抽出)
+	if _, err := classifyTdnetDisclosures(db, targetDate, false); err != nil {
+		log.Printf("⚠️ classify failed: %v", err)
+	}
 	revAlerts := detectRevisionDisclosures(db, targetDate)
 	if len(revAlerts) > 0 {
 		fmt.Printf("## ⚠️ 業績修正開示\n\n")
-		fmt.Println("| コード | 銘柄名 | 開示時刻 | 表題 | PDF |")
-		fmt.Println("|---|---|---|---|---|")
+		fmt.Println("| コード | 銘柄名 | 開示時刻 | 種別 | 表題 | PDF |")
+		fmt.Println("|---|---|---|---|---|---|")
 		for _, a := range revAlerts {
 			pdfLink := "-"
 			if a.PdfURL != "" {
 				pdfLink = "[📄](" + a.PdfURL + ")"
 			}
-			fmt.Printf("| %s | %s | %s | %s | %s |\n",
+			fmt.Printf("| %s | %s | %s | %s | %s | %s |\n",
 				a.Code, a.Name, strings.TrimPrefix(a.DateTime, targetDate+" "),
-				a.Title, pdfLink)
+				disclosureCategoryLabels[a.Category], a.Title, pdfLink)
 		}
 		fmt.Println()
 	}
@@ -69,13 +73,31 @@ func detectAlerts(targetDate string) {
 		fmt.Println()
 	}
 
+	// 4. 自社株買い (parse-tanshin 済みなら取得枠も表示)
+	buybackAlerts := detectBuybackAnnouncements(db, targetDate)
+	if len(buybackAlerts) > 0 {
+		fmt.Printf("## 🔁 自社株買い\n\n")
+		fmt.Println("| コード | 銘柄名 | 開示時刻 | 取得枠 | 取得期間 | 表題 | PDF |")
+		fmt.Println("|---|---|---|---|---|---|---|")
+		for _, a := range buybackAlerts {
+			pdfLink := "-"
+			if a.PdfURL != "" {
+				pdfLink = "[📄](" + a.PdfURL + ")"
+			}
+			fmt.Printf("| %s | %s | %s | %s | %s | %s | %s |\n",
+				a.Code, a.Name, strings.TrimPrefix(a.DateTime, targetDate+" "),
+				a.authorizationText(), a.periodText(), a.Title, pdfLink)
+		}
+		fmt.Println()
+	}
+
 	// サマリ
-	total := len(rsAlerts) + len(revAlerts) + len(volAlerts)
+	total := len(rsAlerts) + len(revAlerts) + len(volAlerts) + len(buybackAlerts)
 	if total == 0 {
 		fmt.Println("_本日のアラートはありません_")
 	} else {
-		fmt.Printf("---\n_合計 %d 件: RS急上昇 %d件 / 業績修正 %d件 / 出来高急増 %d件_\n",
-			total, len(rsAlerts), len(revAlerts), len(volAlerts))
+		fmt.Printf("---\n_合計 %d 件: RS急上昇 %d件 / 業績修正 %d件 / 出来高急増 %d件 / 自社株買い %d件_\n",
+			total, len(rsAlerts), len(revAlerts), len(volAlerts), len(buybackAlerts))
 	}
 }
 
@@ -88,7 +110,7 @@ type rsAlert struct {
 func detectRSSurge(db *sql.DB, targetDate string, minDelta int) []rsAlert {
 	// 当日の RS
 	rsNow := make(map[string]int)
-	if rows, err := db.Query(`SELECT code, rs_rank FROM rs_db.rs_scores WHERE date = ?`, targetDate); err == nil {
+	if rows, err := db.Query(`SELECT code, rs_rank FROM rs_db.rs_scores WHERE profile = ? AND date = ?`, defaultRSProfileID, targetDate); err == nil {
 		for rows.Next() {
 			var c string
 			var r int
@@ -102,14 +124,15 @@ func detectRSSurge(db *sql.DB, targetDate string, minDelta int) []rsAlert {
 		return nil
 	}
 
-	// 5営業日前あたりの RS (最も近い過去日)
+	// 5営業日前の RS (その日に無ければ最も近い過去日)
 	pastDate, _ := time.Parse("2006-01-02", targetDate)
-	pastDateStr := pastDate.AddDate(0, 0, -7).Format("2006-01-02")
+	pastDateStr := tradingCalendar.AddTradingDays(pastDate, -5).Format("2006-01-02")
 	rsPast := make(map[string]int)
 	if rows, err := db.Query(`
-		SELECT code, rs_rank FROM rs_db.rs_scores rs1
-		WHERE date = (SELECT MAX(date) FROM rs_db.rs_scores rs2 WHERE rs2.code = rs1.code AND rs2.date <= ?)`,
-		pastDateStr); err == nil {
+		SELECT code, rs_rank FROM (
+			SELECT code, rs_rank, MAX(date) FROM rs_db.rs_scores
+			WHERE profile = ? AND date <= ? GROUP BY code)`,
+		defaultRSProfileID, pastDateStr); err == nil {
 		for rows.Next() {
 			var c string
 			var r int
@@ -147,15 +170,25 @@ func detectRSSurge(db *sql.DB, targetDate string, minDelta int) []rsAlert {
 
 type revisionAlert struct {
 	Code, Name, DateTime, Title, PdfURL string
+	Category                            string
 }
 
+// revisionAlertCategories は業績修正アラートの対象カテゴリ
+var revisionAlertCategories = append(append([]string{}, forecastCategories...), CategoryDividend)
+
 func detectRevisionDisclosures(db *sql.DB, targetDate string) []revisionAlert {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(revisionAlertCategories)), ",")
+	args := []any{targetDate}
+	for _, c := range revisionAlertCategories {
+		args = append(args, c)
+	}
 	rows, err := db.Query(`
-		SELECT code, name, disclosure_datetime, title, COALESCE(pdf_url,'')
+		SELECT code, name, disclosure_datetime, title, COALESCE(pdf_url,''), doc_category
 		FROM tdnet_disclosures
 		WHERE disclosure_datetime LIKE ? || '%'
-		  AND (title LIKE '%修正%' OR title LIKE '%上方%' OR title LIKE '%下方%')
-		ORDER BY disclosure_datetime DESC`, targetDate)
+		  AND doc_category IN (`+placeholders+`)
+		  AND COALESCE(is_correction, 0) = 0
+		ORDER BY disclosure_datetime DESC`, args...)
 	if err != nil {
 		return nil
 	}
@@ -164,7 +197,67 @@ func detectRevisionDisclosures(db *sql.DB, targetDate string) []revisionAlert {
 	var alerts []revisionAlert
 	for rows.Next() {
 		var a revisionAlert
-		if err := rows.Scan(&a.Code, &a.Name, &a.DateTime, &a.Title, &a.PdfURL); err == nil {
+		if err := rows.Scan(&a.Code, &a.Name, &a.DateTime, &a.Title, &a.PdfURL, &a.Category); err == nil {
+			alerts = append(alerts, a)
+		}
+	}
+	return alerts
+}
+
+type buybackAlert struct {
+	Code, Name, DateTime, Title, PdfURL string
+	AuthorizedShares, AuthorizedAmount  int64
+	PeriodStart, PeriodEnd              string
+}
+
+func (a buybackAlert) authorizationText() string {
+	var parts []string
+	if a.AuthorizedShares > 0 {
+		parts = append(parts, fmt.Sprintf("%g万株", float64(a.AuthorizedShares)/1e4))
+	}
+	if a.AuthorizedAmount > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f億円", float64(a.AuthorizedAmount)/1e8))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, " / ")
+}
+
+func (a buybackAlert) periodText() string {
+	if a.PeriodStart == "" {
+		return "-"
+	}
+	return a.PeriodStart + "〜" + a.PeriodEnd
+}
+
+// detectBuybackAnnouncements は当日の自己株式取得の決定を抽出する。
+// buybacks にパース済みの取得枠があれば併せて返す
+func detectBuybackAnnouncements(db *sql.DB, targetDate string) []buybackAlert {
+	rows, err := db.Query(`
+		SELECT t.code, t.name, t.disclosure_datetime, t.title, COALESCE(t.pdf_url,''),
+		       COALESCE(b.authorized_shares, 0), COALESCE(b.authorized_amount, 0),
+		       COALESCE(b.period_start, ''), COALESCE(b.period_end, '')
+		FROM tdnet_disclosures t
+		LEFT JOIN buybacks b
+		  ON b.code = t.code AND b.announced_at = t.disclosure_datetime AND b.title = t.title
+		WHERE t.disclosure_datetime LIKE ? || '%'
+		  AND t.doc_category = ?
+		  AND COALESCE(t.is_correction, 0) = 0
+		ORDER BY t.disclosure_datetime DESC`, targetDate, CategoryBuyback)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var alerts []buybackAlert
+	for rows.Next() {
+		var a buybackAlert
+		if err := rows.Scan(&a.Code, &a.Name, &a.DateTime, &a.Title, &a.PdfURL,
+			&a.AuthorizedShares, &a.AuthorizedAmount, &a.PeriodStart, &a.PeriodEnd); err != nil {
+			continue
+		}
+		if isBuybackAuthorization(a.Title) {
 			alerts = append(alerts, a)
 		}
 	}
@@ -184,7 +277,11 @@ func detectVolumeSurge(db *sql.DB, targetDate string, minMultiple float64) []vol
 	if err != nil {
 		return nil
 	}
-	pastStart := td.AddDate(0, 0, -7).Format("2006-01-02")
+	pastStart := tradingCalendar.AddTradingDays(td, -5).Format("2006-01-02")
+
+	// 直前日との比較は分割・併合を調整した値で行う (権利落ち日の出来高増・株価下落を誤検出しない)。
+	// 接続が1本のこともあるので、株価のクエリを開く前に読んでおく
+	adjuster := loadPriceAdjuster(db, "price_db.")
 
 	// 当日の株価
 	type tp struct{ close, volume float64 }
@@ -198,7 +295,8 @@ func detectVolumeSurge(db *sql.DB, targetDate string, minMultiple float64) []vol
 		var c string
 		var cl, v float64
 		if rows.Scan(&c, &cl, &v) == nil {
-			today[c] = tp{close: cl, volume: v}
+			f := adjuster.factor(c, targetDate)
+			today[c] = tp{close: cl / f, volume: v * f}
 		}
 	}
 	rows.Close()
@@ -233,11 +331,12 @@ func detectVolumeSurge(db *sql.DB, targetDate string, minMultiple float64) []vol
 			s = &stat{}
 			stats[c] = s
 		}
-		s.avgVol += v
+		f := adjuster.factor(c, d)
+		s.avgVol += v * f
 		s.cnt++
 		if d > s.yMaxDay {
 			s.yMaxDay = d
-			s.yClose = cl
+			s.yClose = cl / f
 		}
 	}
 	rows.Close()
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TDNET の自己株式取得 (自社株買い) 開示のパース
+//
+//   自己株式取得に係る事項の決定 (event_type=authorization): 取得し得る株式の総数・取得価額の総額 (上限)・取得期間
+//   自己株式の取得状況           (event_type=progress): 当該期間の取得実績 + (ご参考) 決議内容 + 決議以降の累計
+//
+// 取得状況の開示は決議内容を再掲するので、progress 行にも authorized_* と期間が入る。
+
+const (
+	BuybackEventAuthorization = "authorization"
+	BuybackEventProgress      = "progress"
+)
+
+// buybackEvent は buybacks テーブルの1行 (0 は未記載)
+type buybackEvent struct {
+	Code             string
+	AnnouncedAt      string
+	Title            string
+	EventType        string
+	AuthorizedShares int64
+	AuthorizedAmount int64 // 円
+	PeriodStart      string
+	PeriodEnd        string
+	AcquiredShares   int64 // 当該報告期間の取得 (progress のみ)
+	AcquiredAmount   int64
+	CumulativeShares int64 // 決議以降の累計 (progress のみ)
+	CumulativeAmount int64
+}
+
+var (
+	buybackSharesRegex = regexp.MustCompile(`([0-9][0-9,]*(?:\.[0-9]+)?)\s*(万)?\s*株`)
+	buybackAmountRegex = regexp.MustCompile(`([0-9][0-9,]*(?:\.[0-9]+)?)\s*(億|百万|千|万)?\s*円`)
+	buybackUnit        = map[string]float64{"": 1, "千": 1e3, "万": 1e4, "百万": 1e6, "億": 1e8}
+)
+
+// isBuybackAuthorization は表題が自己株式取得の決定 (新規の取得枠) か判定する。
+// 取得状況・取得結果・取得終了の報告や消却・処分は対象外
+func isBuybackAuthorization(title string) bool {
+	if !strings.Contains(title, "自己株式") && !strings.Contains(title, "自社株") {
+		return false
+	}
+	if containsAny(title, []string{"取得状況", "取得結果", "取得終了", "消却", "処分"}) {
+		return false
+	}
+	return strings.Contains(title, "取得") || strings.Contains(title, "買付")
+}
+
+// parseBuybackShares / parseBuybackAmount は「5,000,000株」「500万株」「10,000,000,000円」「100億円」を読む
+func parseBuybackShares(s string) (int64, bool) {
+	m := buybackSharesRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", ""), 64)
+	if err != nil {
+		return 0, false
+	}
+	if m[2] == "万" {
+		v *= 1e4
+	}
+	return int64(v + 0.5), true
+}
+
+func parseBuybackAmount(s string) (int64, bool) {
+	m := buybackAmountRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", ""), 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(v*buybackUnit[m[2]] + 0.5), true
+}
+
+// parseBuybackText は自己株式取得の決定・取得状況の本文を読む。
+// 項目名は決定と取得状況で共通なので、本文の区画 (当該報告 / 決議内容 / 累計) で振り分ける
+func parseBuybackText(text string) (buybackEvent, bool) {
+	var ev buybackEvent
+	lines := strings.Split(fullWidthDigits.Replace(text), "\n")
+
+	const (
+		sectionReport = iota
+		sectionAuth
+		sectionCumulative
+	)
+	section := sectionReport
+
+	// 値が項目名の行に無ければ次の行を見る (pdftotext の折り返し対策)
+	valueLine := func(i int, label string) string {
+		line := lines[i]
+		rest := line[strings.Index(line, label)+len(label):]
+		if strings.TrimSpace(rest) == "" && i+1 < len(lines) {
+			return lines[i+1]
+		}
+		return rest
+	}
+
+	for i, line := range lines {
+		switch {
+		case strings.Contains(line, "決議内容"):
+			section = sectionAuth
+		case strings.Contains(line, "累計"):
+			section = sectionCumulative
+		}
+
+		switch {
+		case strings.Contains(line, "取得し得る株式の総数"):
+			section = sectionAuth
+			ev.AuthorizedShares, _ = parseBuybackShares(valueLine(i, "取得し得る株式の総数"))
+		case strings.Contains(line, "取得価額の総額"):
+			v, _ := parseBuybackAmount(valueLine(i, "取得価額の総額"))
+			switch section {
+			case sectionAuth:
+				ev.AuthorizedAmount = v
+			case sectionCumulative:
+				ev.CumulativeAmount = v
+			default:
+				ev.AcquiredAmount = v
+			}
+		case strings.Contains(line, "取得した株式の総数"):
+			v, _ := parseBuybackShares(valueLine(i, "取得した株式の総数"))
+			if section == sectionCumulative {
+				ev.CumulativeShares = v
+			} else {
+				ev.AcquiredShares = v
+			}
+		case strings.Contains(line, "取得期間") && section == sectionAuth && ev.PeriodStart == "":
+			dates := dividendDateRegex.FindAllStringSubmatch(valueLine(i, "取得期間"), 2)
+			if len(dates) == 2 {
+				ev.PeriodStart = formatJPDate(dates[0])
+				ev.PeriodEnd = formatJPDate(dates[1])
+			}
+		}
+	}
+
+	if ev.AuthorizedShares == 0 && ev.AuthorizedAmount == 0 && ev.AcquiredShares == 0 && ev.CumulativeShares == 0 {
+		return ev, false
+	}
+	// 決議後の初回報告は累計欄が無く、当該期間の取得がそのまま累計
+	if ev.CumulativeShares == 0 && ev.CumulativeAmount == 0 {
+		ev.CumulativeShares, ev.CumulativeAmount = ev.AcquiredShares, ev.AcquiredAmount
+	}
+	return ev, true
+}
+
+// formatJPDate は dividendDateRegex のマッチ (年・月・日) を YYYY-MM-DD にする
+func formatJPDate(m []string) string {
+	mo, _ := strconv.Atoi(m[2])
+	d, _ := strconv.Atoi(m[3])
+	return fmt.Sprintf("%s-%02d-%02d", m[1], mo, d)
+}
+
+// saveBuybackEvent は buybacks に保存する (同じ開示の再パースは上書き)
+func saveBuybackEvent(db *sql.DB, ev buybackEvent) error {
+	_, err := db.Exec(`
+		INSERT INTO buybacks (
+			code, announced_at, title, event_type,
+			authorized_shares, authorized_amount, period_start, period_end,
+			acquired_shares, acquired_amount, cumulative_shares, cumulative_amount
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(code, announced_at, title) DO UPDATE SET
+			event_type = excluded.event_type,
+			authorized_shares = excluded.authorized_shares,
+			authorized_amount = excluded.authorized_amount,
+			period_start = excluded.period_start,
+			period_end = excluded.period_end,
+			acquired_shares = excluded.acquired_shares,
+			acquired_amount = excluded.acquired_amount,
+			cumulative_shares = excluded.cumulative_shares,
+			cumulative_amount = excluded.cumulative_amount`,
+		ev.Code, ev.AnnouncedAt, ev.Title, ev.EventType,
+		nullIfZero(ev.AuthorizedShares), nullIfZero(ev.AuthorizedAmount), ev.PeriodStart, ev.PeriodEnd,
+		nullIfZero(ev.AcquiredShares), nullIfZero(ev.AcquiredAmount),
+		nullIfZero(ev.CumulativeShares), nullIfZero(ev.CumulativeAmount))
+	return err
+}
+
+// parseBuybackDisclosuresForDate は指定日の自己株式取得の決定・取得状況を PDF からパースして buybacks に保存する
+func parseBuybackDisclosuresForDate(db *sql.DB, targetDate string) (saved, failed int) {
+	rows, err := db.Query(`
+		SELECT code, disclosure_datetime, title, pdf_url
+		FROM tdnet_disclosures
+		WHERE disclosure_datetime LIKE ? || '%'
+		  AND doc_category = ?
+		  AND COALESCE(is_correction, 0) = 0
+		  AND COALESCE(pdf_url, '') != ''`, targetDate, CategoryBuyback)
+	if err != nil {
+		fmt.Printf("⚠️ 自己株式取得の開示の取得失敗: %v\n", err)
+		return 0, 0
+	}
+	type target struct {
+		code, dt, title, url string
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if rows.Scan(&t.code, &t.dt, &t.title, &t.url) == nil {
+			targets = append(targets, t)
+		}
+	}
+	rows.Close()
+
+	if len(targets) == 0 {
+		return 0, 0
+	}
+	fmt.Printf("\n🔁 %s の自己株式取得 %d件をパース...\n", targetDate, len(targets))
+
+	for i, t := range targets {
+		fmt.Printf("  [%d/%d] %s %s ... ", i+1, len(targets), t.code, t.title)
+		pdfPath, err := downloadPDF(t.url)
+		if err != nil {
+			fmt.Printf("DL失敗: %v\n", err)
+			failed++
+			continue
+		}
+		text, err := extractPDFText(pdfPath)
+		os.Remove(pdfPath) // 一時ファイル削除
+		if err != nil {
+			fmt.Printf("テキスト抽出失敗: %v\n", err)
+			failed++
+			continue
+		}
+
+		ev, ok := parseBuybackText(text)
+		if !ok {
+			fmt.Println("取得内容が見つかりません")
+			failed++
+			continue
+		}
+		ev.Code, ev.AnnouncedAt, ev.Title = t.code, t.dt, t.title
+		ev.EventType = BuybackEventProgress
+		if isBuybackAuthorization(t.title) {
+			ev.EventType = BuybackEventAuthorization
+			ev.AcquiredShares, ev.AcquiredAmount, ev.CumulativeShares, ev.CumulativeAmount = 0, 0, 0, 0
+		}
+
+		if err := saveBuybackEvent(db, ev); err != nil {
+			fmt.Printf("保存失敗: %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf("✅ %s 上限=%d株/%d円 累計=%d株/%d円\n", ev.EventType,
+			ev.AuthorizedShares, ev.AuthorizedAmount, ev.CumulativeShares, ev.CumulativeAmount)
+		saved++
+		time.Sleep(500 * time.Millisecond)
+	}
+	return saved, failed
+}
+
+// buybackSummary は銘柄ごとの自社株買いの状況
+type buybackSummary struct {
+	TTMAmount int64 // 直近1年の取得実績 (取得状況の開示の合計、円)
+	TTMShares int64
+	Active    *buybackEvent // 取得期間中の最新の取得枠 (累計は最新の取得状況)
+}
+
+// BuybackMetrics は /api/stocks 用の自社株買い指標
+type BuybackMetrics struct {
+	BuybackYield        *float64 `json:"BuybackYield"`        // 直近1年の取得額 / 時価総額 (%)
+	BuybackRemainingPct *float64 `json:"BuybackRemainingPct"` // 実施中の取得枠の未執行分 / 時価総額 (%)
+}
+
+// loadBuybackSummaries は buybacks を全件読み、銘柄ごとに summarizeBuybacks で集計する
+func loadBuybackSummaries(db *sql.DB, asOf time.Time) (map[string]buybackSummary, error) {
+	rows, err := db.Query(`
+		SELECT code, announced_at, COALESCE(event_type, ''),
+		       COALESCE(authorized_shares, 0), COALESCE(authorized_amount, 0),
+		       COALESCE(period_start, ''), COALESCE(period_end, ''),
+		       COALESCE(acquired_shares, 0), COALESCE(acquired_amount, 0),
+		       COALESCE(cumulative_shares, 0), COALESCE(cumulative_amount, 0)
+		FROM buybacks
+		ORDER BY code ASC, announced_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byCode := make(map[string][]buybackEvent)
+	for rows.Next() {
+		var ev buybackEvent
+		if err := rows.Scan(&ev.Code, &ev.AnnouncedAt, &ev.EventType,
+			&ev.AuthorizedShares, &ev.AuthorizedAmount, &ev.PeriodStart, &ev.PeriodEnd,
+			&ev.AcquiredShares, &ev.AcquiredAmount, &ev.CumulativeShares, &ev.CumulativeAmount); err != nil {
+			continue
+		}
+		byCode[ev.Code] = append(byCode[ev.Code], ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]buybackSummary, len(byCode))
+	for code, events := range byCode {
+		result[code] = summarizeBuybacks(events, asOf)
+	}
+	return result, nil
+}
+
+// summarizeBuybacks は開示日時の昇順に並んだ1銘柄の履歴から、asOf までの1年の取得実績と
+// asOf 時点で取得期間中の最新の取得枠を求める
+func summarizeBuybacks(events []buybackEvent, asOf time.Time) buybackSummary {
+	var s buybackSummary
+	yearAgo := asOf.AddDate(-1, 0, 0).Format("2006-01-02")
+	today := asOf.Format("2006-01-02")
+	for _, ev := range events {
+		date := ev.AnnouncedAt
+		if len(date) > 10 {
+			date = date[:10]
+		}
+		if date > today {
+			break
+		}
+		if ev.EventType == BuybackEventProgress && date > yearAgo {
+			s.TTMAmount += ev.AcquiredAmount
+			s.TTMShares += ev.AcquiredShares
+		}
+
+		// 後の開示ほど新しい状態。取得状況で決議内容が読めなかった場合は直前の取得枠に累計だけ反映
+		switch {
+		case ev.AuthorizedShares > 0 || ev.AuthorizedAmount > 0:
+			e := ev
+			s.Active = &e
+		case s.Active != nil && ev.EventType == BuybackEventProgress:
+			e := *s.Active
+			e.CumulativeShares, e.CumulativeAmount = ev.CumulativeShares, ev.CumulativeAmount
+			s.Active = &e
+		}
+	}
+
+	// 取得期間が終わった枠は実施中に数えない
+	if s.Active != nil && s.Active.PeriodEnd != "" && s.Active.PeriodEnd < today {
+		s.Active = nil
+	}
+	return s
+}
+
+// calcBuybackMetrics は時価総額に対する直近1年の取得額と、実施中の取得枠の残り (金額枠が無ければ株数 × 株価) を求める
+func calcBuybackMetrics(s buybackSummary, lastPrice float64, marketCap int64) BuybackMetrics {
+	var m BuybackMetrics
+	if marketCap <= 0 {
+		return m
+	}
+	if s.TTMAmount > 0 {
+		v := float64(s.TTMAmount) / float64(marketCap) * 100
+		m.BuybackYield = &v
+	}
+	if a := s.Active; a != nil {
+		var remaining float64
+		switch {
+		case a.AuthorizedAmount > 0:
+			remaining = float64(a.AuthorizedAmount - a.CumulativeAmount)
+		case a.AuthorizedShares > 0:
+			remaining = float64(a.AuthorizedShares-a.CumulativeShares) * lastPrice
+		}
+		if remaining < 0 {
+			remaining = 0
+		}
+		v := remaining / float64(marketCap) * 100
+		m.BuybackRemainingPct = &v
+	}
+	return m
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseBuybackText(t *testing.T) {
+	cases := []struct {
+		file string
+		want buybackEvent
+	}{
+		{
+			// 取得期間・取得方法の列に全角数字、(上限) の注記付き
+			file: "authorization.txt",
+			want: buybackEvent{
+				AuthorizedShares: 5_000_000, AuthorizedAmount: 10_000_000_000,
+				PeriodStart: "2025-05-15", PeriodEnd: "2026-03-31",
+			},
+		},
+		{
+			// 当該期間の実績 (金額は次の行)・決議内容 (万株・億円)・累計の3区画
+			file: "progress.txt",
+			want: buybackEvent{
+				AuthorizedShares: 5_000_000, AuthorizedAmount: 10_000_000_000,
+				PeriodStart: "2025-05-15", PeriodEnd: "2026-03-31",
+				AcquiredShares: 850_000, AcquiredAmount: 1_725_300_000,
+				CumulativeShares: 2_150_000, CumulativeAmount: 4_312_800_000,
+			},
+		},
+	}
+	for _, c := range cases {
+		b, err := os.ReadFile(filepath.Join("testdata", "buyback", c.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := parseBuybackText(string(b))
+		if !ok {
+			t.Errorf("%s: 取得内容が見つからない", c.file)
+			continue
+		}
+		// 決定の開示には取得実績が無いので、累計の補完も起きない
+		if got != c.want {
+			t.Errorf("%s:\n got  %+v\n want %+v", c.file, got, c.want)
+		}
+	}
+}
+
+func TestIsBuybackAuthorization(t *testing.T) {
+	cases := []struct {
+		title string
+		want  bool
+	}{
+		{"自己株式取得に係る事項の決定に関するお知らせ", true},
+		{"自己株式の取得及び自己株式立会外買付取引(ToSTNeT-3)による自己株式の買付けに関するお知らせ", true},
+		{"自己株式の取得状況に関するお知らせ", false},
+		{"自己株式の取得結果及び取得終了に関するお知らせ", false},
+		{"自己株式の消却に関するお知らせ", false},
+		{"剰余金の配当に関するお知らせ", false},
+	}
+	for _, c := range cases {
+		if got := isBuybackAuthorization(c.title); got != c.want {
+			t.Errorf("isBuybackAuthorization(%q) = %v, want %v", c.title, got, c.want)
+		}
+	}
+}
+
+func TestCalcBuybackMetrics(t *testing.T) {
+	amountBased := buybackSummary{
+		TTMAmount: 4_000_000_000,
+		Active:    &buybackEvent{AuthorizedAmount: 10_000_000_000, CumulativeAmount: 4_000_000_000},
+	}
+	m := calcBuybackMetrics(amountBased, 2000, 200_000_000_000)
+	if m.BuybackYield == nil || *m.BuybackYield != 2 {
+		t.Errorf("BuybackYield = %v, want 2", m.BuybackYield)
+	}
+	if m.BuybackRemainingPct == nil || *m.BuybackRemainingPct != 3 {
+		t.Errorf("BuybackRemainingPct = %v, want 3", m.BuybackRemainingPct)
+	}
+
+	// 金額枠の無い株数ベースの取得枠は未取得株数 × 株価
+	sharesBased := buybackSummary{
+		Active: &buybackEvent{AuthorizedShares: 1_000_000, CumulativeShares: 500_000},
+	}
+	m = calcBuybackMetrics(sharesBased, 2000, 100_000_000_000)
+	if m.BuybackYield != nil {
+		t.Errorf("BuybackYield = %v, want nil", *m.BuybackYield)
+	}
+	if m.BuybackRemainingPct == nil || *m.BuybackRemainingPct != 1 {
+		t.Errorf("BuybackRemainingPct = %v, want 1", m.BuybackRemainingPct)
+	}
+
+	if m := calcBuybackMetrics(amountBased, 0, 0); m.BuybackYield != nil || m.BuybackRemainingPct != nil {
+		t.Errorf("時価総額 0 で指標が出ている: %+v", m)
+	}
+}
+
+func TestSummarizeBuybacks(t *testing.T) {
+	events := []buybackEvent{
+		// 前年の取得枠 (期間終了) と、1年より前の取得実績
+		{Code: "9999", AnnouncedAt: "2024-05-14 15:00", Title: "決定", EventType: BuybackEventAuthorization,
+			AuthorizedAmount: 5_000_000_000, PeriodStart: "2024-05-15", PeriodEnd: "2025-03-31"},
+		{Code: "9999", AnnouncedAt: "2024-08-01 15:00", Title: "状況", EventType: BuybackEventProgress,
+			AcquiredAmount: 1_000_000_000, CumulativeAmount: 1_000_000_000},
+		// 今期の取得枠と2回の取得状況 (2回目は決議内容が読めなかった)
+		{Code: "9999", AnnouncedAt: "2025-05-14 15:00", Title: "決定", EventType: BuybackEventAuthorization,
+			AuthorizedAmount: 10_000_000_000, PeriodStart: "2025-05-15", PeriodEnd: "2026-03-31"},
+		{Code: "9999", AnnouncedAt: "2025-07-01 15:00", Title: "状況", EventType: BuybackEventProgress,
+			AuthorizedAmount: 10_000_000_000, PeriodStart: "2025-05-15", PeriodEnd: "2026-03-31",
+			AcquiredAmount: 2_000_000_000, CumulativeAmount: 2_000_000_000},
+		{Code: "9999", AnnouncedAt: "2025-08-01 15:00", Title: "状況", EventType: BuybackEventProgress,
+			AcquiredAmount: 1_500_000_000, CumulativeAmount: 3_500_000_000},
+	}
+	asOf := time.Date(2025, 9, 1, 0, 0, 0, 0, jst)
+
+	s := summarizeBuybacks(events, asOf)
+	if s.TTMAmount != 3_500_000_000 {
+		t.Errorf("TTMAmount = %d, want 3500000000", s.TTMAmount)
+	}
+	if s.Active == nil || s.Active.AuthorizedAmount != 10_000_000_000 || s.Active.CumulativeAmount != 3_500_000_000 {
+		t.Errorf("Active = %+v, want 上限100億・累計35億", s.Active)
+	}
+
+	// 期間終了済みの取得枠だけなら実施中の枠は無い
+	if s := summarizeBuybacks(events[:2], asOf); s.Active != nil || s.TTMAmount != 0 {
+		t.Errorf("期間終了済み: %+v", s)
+	}
+}
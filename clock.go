@@ -0,0 +1,50 @@
+package main
+
+import (
+	"time"
+	_ "time/tzdata" // tzdata の無い実行環境 (distroless 等) でも Asia/Tokyo を読めるように埋め込む
+)
+
+// 日付の基準となる時計
+//
+// 東証・TDNET・EDINET の日付はすべて日本時間。GitHub Actions は UTC で動くため、time.Now() の日付を
+// そのまま使うと早朝 (JST 0:00〜9:00) の実行が前日扱いになる。「今日」「現在時刻」は必ず nowJST / todayJST で取る。
+// 経過時間・キャッシュの期限のようにタイムゾーンに依らない計測は time.Now() のままでよい。
+
+// jst は日本時間 (Asia/Tokyo)
+var jst = loadJST()
+
+func loadJST() *time.Location {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		return time.FixedZone("JST", 9*60*60)
+	}
+	return loc
+}
+
+// clock は現在時刻の取得元。テストでは fixedClock に差し替えて「今」を固定する
+type clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// fixedClock は常に同じ時刻を返す
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// appClock は全モード共通の時計
+var appClock clock = systemClock{}
+
+// nowJST は現在時刻 (日本時間)
+func nowJST() time.Time {
+	return appClock.Now().In(jst)
+}
+
+// todayJST は日本時間の今日 (YYYY-MM-DD)
+func todayJST() string {
+	return nowJST().Format("2006-01-02")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// setTestClock は appClock を now に固定し、テスト終了時に戻す
+func setTestClock(t *testing.T, now time.Time) {
+	t.Helper()
+	prev := appClock
+	appClock = fixedClock(now)
+	t.Cleanup(func() { appClock = prev })
+}
+
+// setLocalZone は time.Local を name のタイムゾーンにし、テスト終了時に戻す (実行環境のタイムゾーンに依存しないことの確認用)
+func setLocalZone(t *testing.T, name string) {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = prev })
+}
+
+func TestTodayJST(t *testing.T) {
+	cases := []struct {
+		zone string
+		now  time.Time
+		want string
+	}{
+		// UTC のランナーで JST 早朝に動いた場合 (UTC ではまだ前日)
+		{"UTC", time.Date(2025, 5, 15, 23, 30, 0, 0, time.UTC), "2025-05-16"},
+		{"America/Los_Angeles", time.Date(2025, 5, 15, 23, 30, 0, 0, time.UTC), "2025-05-16"},
+		{"Asia/Tokyo", time.Date(2025, 5, 15, 14, 59, 0, 0, time.UTC), "2025-05-15"},
+	}
+	for _, c := range cases {
+		setLocalZone(t, c.zone)
+		setTestClock(t, c.now)
+		if got := todayJST(); got != c.want {
+			t.Errorf("%s: todayJST() = %s, want %s", c.zone, got, c.want)
+		}
+		if got := nowJST(); got.Location() != jst || !got.Equal(c.now) {
+			t.Errorf("%s: nowJST() = %v", c.zone, got)
+		}
+	}
+}
+
+func TestYahooBarDate(t *testing.T) {
+	// 東証の日足は JST 09:00 (= UTC 00:00) のタイムスタンプ。米国時間で変換すると前日になる
+	ts := time.Date(2025, 5, 16, 9, 0, 0, 0, jst).Unix()
+	for _, zone := range []string{"UTC", "America/New_York", "Asia/Tokyo"} {
+		setLocalZone(t, zone)
+		if got := yahooBarDate(ts); got != "2025-05-16" {
+			t.Errorf("%s: yahooBarDate = %s, want 2025-05-16", zone, got)
+		}
+	}
+}
@@ -35,9 +35,9 @@ func runBatch(fromStr, toStr string) {
 
 	for d := fromDate; !d.After(toDate); d = d.AddDate(0, 0, 1) {
 		dateStr := d.Format("2006-01-02")
-		// 土日はEDINET提出なしのためスキップ
-		if d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
-			fmt.Printf("⏭️ %s (%s) スキップ（休日）\n", dateStr, d.Weekday())
+		// 土日・祝日・年末年始は提出なしのためスキップ (取引所だけの休場日は EDINET が動くので取得する)
+		if reason, closed := tradingCalendar.HolidayReason(d); closed {
+			fmt.Printf("⏭️ %s (%s) スキップ（%s）\n", dateStr, d.Weekday(), reason)
 			continue
 		}
 
@@ -208,6 +208,15 @@ func runCollector(targetDate string) {
 		}
 	}
 
+	// 新しい報告書を先行する決算短信と突合 (成長指標は報告書の値を優先する)
+	if processedCount > 0 {
+		if linked, _, flagged, err := reconcileFinancials(db, defaultReconcileThreshold); err != nil {
+			log.Printf("⚠️ Reconcile failed: %v", err)
+		} else {
+			fmt.Printf("🔗 決算短信との突合: %d件 (差異 %d件、詳細は -mode=reconcile-financials)\n", linked, len(flagged))
+		}
+	}
+
 	// データが更新されたので、API レスポンスキャッシュを破棄
 	cacheClear()
 }
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 株式分割・併合 (コーポレートアクション) と調整後株価
+//
+// stock_prices には取得元が返した生の値をそのまま保存し、分割・併合は corporate_actions に
+// 「権利落ち日と旧1株あたりの新株数」として持つ。RS・アラート・/api/prices は読み出し時に
+// priceAdjuster で権利落ち日より前の値を割り戻す (株価は ÷比率、出来高は ×比率)。
+//
+// corporate_actions の出所は2つ:
+//   - tdnet: 株式分割・併合の開示 PDF から比率と基準日を読み、権利落ち日 (基準日の前営業日) を予定として登録
+//   - gap:   株価系列の前日比が値幅制限を超え、かつ分割比率の逆数に一致する日を検出
+//
+// 取得元によっては過去の株価を分割調整済みで返すため、実際の系列に段差があるかを毎回確かめる。
+// 段差がある → adjust (調整に使う)、段差が無い → no_gap、権利落ち日以降の株価がまだ無い → pending。
+const (
+	CorporateActionAdjust  = "adjust"
+	CorporateActionPending = "pending"
+	CorporateActionNoGap   = "no_gap"
+
+	corporateActionSourceTDNET = "tdnet"
+	corporateActionSourceGap   = "gap"
+
+	// splitGapTolerance は前日比と分割比率の逆数のずれの許容幅 (相対)
+	splitGapTolerance = 0.05
+	// splitConfirmRows は予定の権利落ち日の前後何営業日まで段差を探すか
+	splitConfirmRows = 3
+	// splitGapMaxCalendarDays は前日比を見る2行の間隔の上限 (欠損で離れた行の騰落は分割と区別できない)
+	splitGapMaxCalendarDays = 7
+)
+
+// splitRatioCandidates は価格の段差から推定する分割比率の候補 (1未満は併合)
+var splitRatioCandidates = []float64{1.5, 2, 3, 4, 5, 10, 0.5, 0.2, 0.1}
+
+// corporateAction は corporate_actions の1行
+type corporateAction struct {
+	Code        string
+	ExDate      string  // 権利落ち日 (YYYY-MM-DD)
+	Ratio       float64 // 旧1株あたりの新株数
+	Source      string  // tdnet / gap
+	Status      string  // adjust / pending / no_gap
+	RecordDate  string
+	Title       string
+	AnnouncedAt string
+}
+
+var (
+	// 「1株につき2株の割合」「10株につき1株の割合で併合」「1株を3株に分割」
+	splitRatioRegex = regexp.MustCompile(`([0-9]+(?:\.[0-9]+)?)\s*株\s*(?:につき|を)\s*([0-9]+(?:\.[0-9]+)?)\s*株`)
+	recordDateRegex = regexp.MustCompile(`基準日`)
+)
+
+// parseStockSplitText は株式分割・併合の開示テキストから比率 (旧1株あたりの新株数) と基準日を読む
+func parseStockSplitText(text string) (ratio float64, recordDate string, ok bool) {
+	t := fullWidthDigits.Replace(text)
+	t = strings.ReplaceAll(t, "　", " ")
+
+	for _, m := range splitRatioRegex.FindAllStringSubmatch(t, -1) {
+		from, err1 := strconv.ParseFloat(m[1], 64)
+		to, err2 := strconv.ParseFloat(m[2], 64)
+		if err1 != nil || err2 != nil || from <= 0 || to <= 0 || from == to {
+			continue
+		}
+		r := to / from
+		if r < 0.01 || r > 100 {
+			continue
+		}
+		ratio, ok = r, true
+		break
+	}
+	if !ok {
+		return 0, "", false
+	}
+
+	// 「基準日公告日」は飛ばし、「基準日」の直後 (改行をまたいでも数十文字以内) の日付を取る
+	for _, loc := range recordDateRegex.FindAllStringIndex(t, -1) {
+		rest := t[loc[1]:]
+		if strings.HasPrefix(rest, "公告") {
+			continue
+		}
+		if len(rest) > 120 {
+			rest = rest[:120]
+		}
+		if m := dividendDateRegex.FindStringSubmatch(rest); m != nil {
+			recordDate = formatJPDate(m)
+			break
+		}
+	}
+	return ratio, recordDate, true
+}
+
+// exDateFromRecordDate は基準日の前営業日 (権利落ち日) を返す
+func exDateFromRecordDate(recordDate string) (string, bool) {
+	t, err := time.Parse("2006-01-02", recordDate)
+	if err != nil {
+		return "", false
+	}
+	return tradingCalendar.PrevTradingDay(t).Format("2006-01-02"), true
+}
+
+// dailyPriceLimit は東証の制限値幅 (基準値段 → 円)
+func dailyPriceLimit(price float64) float64 {
+	limits := []struct{ below, limit float64 }{
+		{100, 30}, {200, 50}, {500, 80}, {700, 100}, {1000, 150},
+		{1500, 300}, {2000, 400}, {3000, 500}, {5000, 700}, {7000, 1000},
+		{10000, 1500}, {15000, 3000}, {20000, 4000}, {30000, 5000}, {50000, 7000},
+		{70000, 10000}, {100000, 15000}, {150000, 30000}, {200000, 40000}, {300000, 50000},
+		{500000, 70000}, {700000, 100000}, {1000000, 150000},
+	}
+	for _, l := range limits {
+		if price < l.below {
+			return l.limit
+		}
+	}
+	return 300000
+}
+
+// splitGapMatches は前日終値 → 当日終値の比が 1/ratio に一致するか
+func splitGapMatches(prevClose, close, ratio float64) bool {
+	if prevClose <= 0 || close <= 0 || ratio <= 0 {
+		return false
+	}
+	return math.Abs(close/prevClose*ratio-1) <= splitGapTolerance
+}
+
+// withinGapWindow は2つの日付の間隔が splitGapMaxCalendarDays 以内か
+func withinGapWindow(prevDate, date string) bool {
+	p, err1 := time.Parse("2006-01-02", prevDate)
+	d, err2 := time.Parse("2006-01-02", date)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return d.Sub(p) <= splitGapMaxCalendarDays*24*time.Hour
+}
+
+// detectSplitGaps は日付昇順の株価から分割・併合とみられる段差を返す。
+// 前日比が値幅制限を超え (通常の値動きではありえない)、かつ比率の候補の逆数に一致する日を権利落ち日とみなす
+func detectSplitGaps(code string, prices []StockPrice) []corporateAction {
+	var actions []corporateAction
+	for i := 1; i < len(prices); i++ {
+		prev, cur := prices[i-1], prices[i]
+		if prev.Close <= 0 || cur.Close <= 0 || !withinGapWindow(prev.Date, cur.Date) {
+			continue
+		}
+		if math.Abs(cur.Close-prev.Close) <= dailyPriceLimit(prev.Close) {
+			continue
+		}
+		for _, r := range splitRatioCandidates {
+			if splitGapMatches(prev.Close, cur.Close, r) {
+				actions = append(actions, corporateAction{
+					Code: code, ExDate: cur.Date, Ratio: r,
+					Source: corporateActionSourceGap, Status: CorporateActionAdjust,
+				})
+				break
+			}
+		}
+	}
+	return actions
+}
+
+// confirmSplitGap は予定の権利落ち日の前後 splitConfirmRows 営業日に比率どおりの段差があるかを調べ、
+// 実際の権利落ち日と状態を返す。権利落ち日以降の株価が揃っていなければ pending
+func confirmSplitGap(prices []StockPrice, a corporateAction) (exDate, status string) {
+	j := sort.Search(len(prices), func(i int) bool { return prices[i].Date >= a.ExDate })
+	if j == len(prices) {
+		return a.ExDate, CorporateActionPending
+	}
+	for i := max(j-splitConfirmRows, 1); i <= j+splitConfirmRows && i < len(prices); i++ {
+		prev, cur := prices[i-1], prices[i]
+		if withinGapWindow(prev.Date, cur.Date) && splitGapMatches(prev.Close, cur.Close, a.Ratio) {
+			return cur.Date, CorporateActionAdjust
+		}
+	}
+	if j+splitConfirmRows < len(prices) {
+		return a.ExDate, CorporateActionNoGap
+	}
+	return a.ExDate, CorporateActionPending
+}
+
+// reconcileCorporateActions は1銘柄の登録済みアクションを株価系列と突き合わせ、検出した段差を加えて
+// 書き戻す行の一覧を返す。同じ権利落ち日では tdnet を gap より優先する
+func reconcileCorporateActions(code string, prices []StockPrice, existing []corporateAction) []corporateAction {
+	byDate := make(map[string]corporateAction)
+	put := func(a corporateAction) {
+		if cur, ok := byDate[a.ExDate]; ok && cur.Source == corporateActionSourceTDNET && a.Source != corporateActionSourceTDNET {
+			return
+		}
+		byDate[a.ExDate] = a
+	}
+
+	// tdnet を先に確定させ、gap はその後 (同じ日に確定した tdnet があれば捨てる)
+	sorted := append([]corporateAction(nil), existing...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Source == corporateActionSourceTDNET && sorted[j].Source != corporateActionSourceTDNET
+	})
+	for _, a := range sorted {
+		a.ExDate, a.Status = confirmSplitGap(prices, a)
+		put(a)
+	}
+	for _, g := range detectSplitGaps(code, prices) {
+		if _, ok := byDate[g.ExDate]; ok {
+			continue
+		}
+		put(g)
+	}
+
+	out := make([]corporateAction, 0, len(byDate))
+	for _, a := range byDate {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ExDate < out[j].ExDate })
+	return out
+}
+
+// loadCorporateActions は corporate_actions を銘柄ごとに読む (schema は "" か "price_db.")。
+// status が空でなければその状態の行だけを返す
+func loadCorporateActions(db *sql.DB, schema, status string) (map[string][]corporateAction, error) {
+	query := `
+		SELECT code, ex_date, ratio, COALESCE(source, ''), COALESCE(status, ''),
+		       COALESCE(record_date, ''), COALESCE(title, ''), COALESCE(announced_at, '')
+		FROM ` + schema + `corporate_actions`
+	var args []any
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY code, ex_date`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	m := make(map[string][]corporateAction)
+	for rows.Next() {
+		var a corporateAction
+		if err := rows.Scan(&a.Code, &a.ExDate, &a.Ratio, &a.Source, &a.Status, &a.RecordDate, &a.Title, &a.AnnouncedAt); err != nil {
+			continue
+		}
+		m[a.Code] = append(m[a.Code], a)
+	}
+	return m, rows.Err()
+}
+
+// replaceCorporateActions は1銘柄の corporate_actions を actions で置き換える
+func replaceCorporateActions(tx *sql.Tx, code string, actions []corporateAction) error {
+	if _, err := tx.Exec(`DELETE FROM corporate_actions WHERE code = ?`, code); err != nil {
+		return err
+	}
+	for _, a := range actions {
+		_, err := tx.Exec(`
+			INSERT INTO corporate_actions (code, ex_date, ratio, source, status, record_date, title, announced_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?)`,
+			a.Code, a.ExDate, a.Ratio, a.Source, a.Status, a.RecordDate, a.Title, a.AnnouncedAt, nowJST().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadClosesByCode は銘柄ごとの終値系列 (日付昇順) を読む。codes が空なら全銘柄
+func loadClosesByCode(db *sql.DB, codes []string) (map[string][]StockPrice, error) {
+	query := `SELECT code, date, close FROM stock_prices`
+	var args []any
+	if len(codes) > 0 {
+		query += ` WHERE code IN (?` + strings.Repeat(",?", len(codes)-1) + `)`
+		for _, c := range codes {
+			args = append(args, c)
+		}
+	}
+	query += ` ORDER BY code, date`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	m := make(map[string][]StockPrice)
+	for rows.Next() {
+		var p StockPrice
+		var cl sql.NullFloat64
+		if rows.Scan(&p.Code, &p.Date, &cl) != nil {
+			continue
+		}
+		p.Close = cl.Float64
+		m[p.Code] = append(m[p.Code], p)
+	}
+	return m, rows.Err()
+}
+
+// refreshCorporateActions は stock_price.db の株価と corporate_actions を突き合わせて状態を更新し、
+// 新しい段差を gap として登録する。codes が空なら全銘柄。adjust の件数と新規検出の件数を返す
+func refreshCorporateActions(priceDB *sql.DB, codes []string) (adjusted, detected int, err error) {
+	existing, err := loadCorporateActions(priceDB, "", "")
+	if err != nil {
+		return 0, 0, err
+	}
+	series, err := loadClosesByCode(priceDB, codes)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tx, err := priceDB.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	for code, prices := range series {
+		known := make(map[string]bool, len(existing[code]))
+		for _, a := range existing[code] {
+			known[a.ExDate] = true
+		}
+		actions := reconcileCorporateActions(code, prices, existing[code])
+		for _, a := range actions {
+			if a.Status == CorporateActionAdjust {
+				adjusted++
+			}
+			if a.Source == corporateActionSourceGap && !known[a.ExDate] {
+				detected++
+			}
+		}
+		if err := replaceCorporateActions(tx, code, actions); err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", code, err)
+		}
+	}
+	return adjusted, detected, tx.Commit()
+}
+
+// saveTDNETCorporateAction は開示から読んだ分割・併合を予定 (pending) として登録する。
+// 同じ権利落ち日の行が既にあれば比率と開示情報だけを更新し、状態は次の突き合わせに任せる
+func saveTDNETCorporateAction(priceDB *sql.DB, a corporateAction) error {
+	_, err := priceDB.Exec(`
+		INSERT INTO corporate_actions (code, ex_date, ratio, source, status, record_date, title, announced_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?)
+		ON CONFLICT(code, ex_date) DO UPDATE SET
+			ratio = excluded.ratio,
+			source = excluded.source,
+			record_date = excluded.record_date,
+			title = excluded.title,
+			announced_at = excluded.announced_at,
+			updated_at = excluded.updated_at`,
+		a.Code, a.ExDate, a.Ratio, corporateActionSourceTDNET, CorporateActionPending,
+		a.RecordDate, a.Title, a.AnnouncedAt, nowJST().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+// parseStockSplitDisclosuresForDate は指定日の株式分割・併合の開示を PDF からパースして corporate_actions に登録する
+func parseStockSplitDisclosuresForDate(db *sql.DB, targetDate string) (saved, failed int) {
+	rows, err := db.Query(`
+		SELECT code, disclosure_datetime, title, pdf_url
+		FROM tdnet_disclosures
+		WHERE disclosure_datetime LIKE ? || '%'
+		  AND doc_category = ?
+		  AND COALESCE(is_correction, 0) = 0
+		  AND COALESCE(pdf_url, '') != ''`, targetDate, CategoryStockSplit)
+	if err != nil {
+		fmt.Printf("⚠️ 株式分割の開示の取得失敗: %v\n", err)
+		return 0, 0
+	}
+	type target struct {
+		code, dt, title, url string
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if rows.Scan(&t.code, &t.dt, &t.title, &t.url) == nil {
+			targets = append(targets, t)
+		}
+	}
+	rows.Close()
+
+	if len(targets) == 0 {
+		return 0, 0
+	}
+	fmt.Printf("\n✂️ %s の株式分割・併合 %d件をパース...\n", targetDate, len(targets))
+
+	priceDB, err := initPriceDB()
+	if err != nil {
+		fmt.Printf("⚠️ stock_price.db初期化失敗: %v\n", err)
+		return 0, len(targets)
+	}
+	defer priceDB.Close()
+
+	var codes []string
+	for i, t := range targets {
+		fmt.Printf("  [%d/%d] %s %s ... ", i+1, len(targets), t.code, t.title)
+		pdfPath, err := downloadPDF(t.url)
+		if err != nil {
+			fmt.Printf("DL失敗: %v\n", err)
+			failed++
+			continue
+		}
+		text, err := extractPDFText(pdfPath)
+		os.Remove(pdfPath) // 一時ファイル削除
+		if err != nil {
+			fmt.Printf("テキスト抽出失敗: %v\n", err)
+			failed++
+			continue
+		}
+
+		ratio, recordDate, ok := parseStockSplitText(text)
+		if !ok {
+			fmt.Println("分割比率が見つかりません")
+			failed++
+			continue
+		}
+		exDate, ok := exDateFromRecordDate(recordDate)
+		if !ok {
+			fmt.Printf("基準日が見つかりません (比率 %g)\n", ratio)
+			failed++
+			continue
+		}
+
+		a := corporateAction{
+			Code: t.code, ExDate: exDate, Ratio: ratio, RecordDate: recordDate,
+			Title: t.title, AnnouncedAt: t.dt,
+		}
+		if err := saveTDNETCorporateAction(priceDB, a); err != nil {
+			fmt.Printf("保存失敗: %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf("✅ 比率 %g 基準日 %s 権利落ち %s\n", ratio, recordDate, exDate)
+		codes = append(codes, t.code)
+		saved++
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	if len(codes) > 0 {
+		if _, _, err := refreshCorporateActions(priceDB, codes); err != nil {
+			fmt.Printf("⚠️ 株価との突き合わせ失敗: %v\n", err)
+		}
+	}
+	return saved, failed
+}
+
+// runDetectCorporateActions は -mode=detect-corporate-actions の本体。全銘柄の株価系列を見直す
+func runDetectCorporateActions() {
+	priceDB, err := initPriceDB()
+	if err != nil {
+		log.Fatalf("stock_price.db初期化失敗: %v", err)
+	}
+	defer priceDB.Close()
+
+	fmt.Println("✂️ 株式分割・併合の検出...")
+	adjusted, detected, err := refreshCorporateActions(priceDB, nil)
+	if err != nil {
+		log.Fatalf("コーポレートアクションの更新失敗: %v", err)
+	}
+	printCorporateActionSummary(priceDB, adjusted, detected)
+}
+
+// printCorporateActionSummary は状態ごとの件数を表示する
+func printCorporateActionSummary(priceDB *sql.DB, adjusted, detected int) {
+	counts := make(map[string]int)
+	rows, err := priceDB.Query(`SELECT status, COUNT(*) FROM corporate_actions GROUP BY status`)
+	if err == nil {
+		for rows.Next() {
+			var s string
+			var n int
+			if rows.Scan(&s, &n) == nil {
+				counts[s] = n
+			}
+		}
+		rows.Close()
+	}
+	fmt.Printf("📊 調整に使用 %d件 (うち今回検出 %d件), 予定 %d件, 段差なし %d件\n",
+		adjusted, detected, counts[CorporateActionPending], counts[CorporateActionNoGap])
+}
+
+// priceAdjuster は銘柄 → 調整に使う分割・併合 (権利落ち日の昇順)
+type priceAdjuster map[string][]corporateAction
+
+// loadPriceAdjuster は status=adjust の行を読む。テーブルが無い (古い stock_price.db) 場合は調整なし
+func loadPriceAdjuster(db *sql.DB, schema string) priceAdjuster {
+	m, err := loadCorporateActions(db, schema, CorporateActionAdjust)
+	if err != nil {
+		return priceAdjuster{}
+	}
+	return priceAdjuster(m)
+}
+
+// factor は date の株価を最新の株数基準に揃えるための比率 (date より後の権利落ちの累積)
+func (a priceAdjuster) factor(code, date string) float64 {
+	f := 1.0
+	for _, ca := range a[code] {
+		if ca.ExDate > date && ca.Ratio > 0 {
+			f *= ca.Ratio
+		}
+	}
+	return f
+}
+
+// adjustClose は1つの終値を調整する
+func (a priceAdjuster) adjustClose(code, date string, close float64) float64 {
+	return close / a.factor(code, date)
+}
+
+// adjust は OHLCV を調整する (株価は ÷比率、出来高は ×比率)
+func (a priceAdjuster) adjust(p StockPrice) StockPrice {
+	f := a.factor(p.Code, p.Date)
+	if f == 1 {
+		return p
+	}
+	p.Open /= f
+	p.High /= f
+	p.Low /= f
+	p.Close /= f
+	p.Volume = int64(math.Round(float64(p.Volume) * f))
+	return p
+}
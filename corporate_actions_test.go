@@ -0,0 +1,196 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// priceSeries は start から平日ごとに終値を並べた系列を作る
+func priceSeries(t *testing.T, code, start string, closes ...float64) []StockPrice {
+	t.Helper()
+	d := mustDate(t, start)
+	var prices []StockPrice
+	for _, c := range closes {
+		for d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+			d = d.AddDate(0, 0, 1)
+		}
+		prices = append(prices, StockPrice{Code: code, Date: d.Format("2006-01-02"), Close: c, Volume: 1000})
+		d = d.AddDate(0, 0, 1)
+	}
+	return prices
+}
+
+func TestParseStockSplitText(t *testing.T) {
+	cases := []struct {
+		name       string
+		text       string
+		wantRatio  float64
+		wantRecord string
+		wantOK     bool
+	}{
+		{
+			name: "分割 (全角数字・基準日の日付が次の行)",
+			text: "１．株式分割の方法\n２０２５年９月３０日（火曜日）を基準日として、同日最終の株主名簿に記録された株主の所有する" +
+				"普通株式を、１株につき２株の割合をもって分割いたします。\n(3) 分割の日程\n基準日公告日 2025年9月12日\n基準日\n2025年9月30日\n効力発生日 2025年10月1日",
+			wantRatio: 2, wantRecord: "2025-09-30", wantOK: true,
+		},
+		{
+			name:      "1株を3株に分割",
+			text:      "当社普通株式1株を3株に分割します。 基準日 2026年3月31日",
+			wantRatio: 3, wantRecord: "2026-03-31", wantOK: true,
+		},
+		{
+			name:      "株式併合",
+			text:      "普通株式10株につき1株の割合で併合いたします。\n株式併合の効力発生日 2025年10月1日\n基準日　2025年9月30日",
+			wantRatio: 0.1, wantRecord: "2025-09-30", wantOK: true,
+		},
+		{
+			name:      "1.5倍",
+			text:      "普通株式1株につき1.5株の割合をもって分割 基準日：2025年12月31日",
+			wantRatio: 1.5, wantRecord: "2025-12-31", wantOK: true,
+		},
+		{
+			name:   "比率なし (配当予想の修正)",
+			text:   "株式分割に伴い、1株当たり配当金を10円に修正します。",
+			wantOK: false,
+		},
+	}
+	for _, c := range cases {
+		ratio, record, ok := parseStockSplitText(c.text)
+		if ok != c.wantOK || math.Abs(ratio-c.wantRatio) > 1e-9 || record != c.wantRecord {
+			t.Errorf("%s: got (%g, %q, %v), want (%g, %q, %v)", c.name, ratio, record, ok, c.wantRatio, c.wantRecord, c.wantOK)
+		}
+	}
+}
+
+func TestExDateFromRecordDate(t *testing.T) {
+	cases := map[string]string{
+		"2025-09-30": "2025-09-29", // 火 → 月
+		"2025-09-29": "2025-09-26", // 月 → 金
+		"2025-03-31": "2025-03-28",
+		"2025-09-24": "2025-09-22", // 秋分の日 (9/23) を飛ばす
+		"2026-01-05": "2025-12-30", // 年末年始の休業を飛ばす
+	}
+	for record, want := range cases {
+		if got, ok := exDateFromRecordDate(record); !ok || got != want {
+			t.Errorf("exDateFromRecordDate(%s) = %s, want %s", record, got, want)
+		}
+	}
+	if _, ok := exDateFromRecordDate(""); ok {
+		t.Error("空の基準日を受け付けた")
+	}
+}
+
+func TestDetectSplitGaps(t *testing.T) {
+	cases := []struct {
+		name   string
+		closes []float64
+		want   map[string]float64 // 権利落ち日 → 比率
+	}{
+		{
+			name:   "1:2 分割",
+			closes: []float64{3000, 3050, 1520, 1540},
+			want:   map[string]float64{"2025-09-03": 2},
+		},
+		{
+			name:   "10→1 併合",
+			closes: []float64{120, 118, 1190, 1200},
+			want:   map[string]float64{"2025-09-03": 0.1},
+		},
+		{
+			// 値幅制限内の下落 (ストップ安) は分割とみなさない
+			name:   "ストップ安",
+			closes: []float64{1000, 850, 700},
+			want:   map[string]float64{},
+		},
+		{
+			// 制限超えでも比率に一致しない段差 (取得元の異常値など) は無視
+			name:   "比率に一致しない段差",
+			closes: []float64{3000, 1800, 1810},
+			want:   map[string]float64{},
+		},
+	}
+	for _, c := range cases {
+		got := detectSplitGaps("9999", priceSeries(t, "9999", "2025-09-01", c.closes...))
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %d gaps %+v, want %v", c.name, len(got), got, c.want)
+			continue
+		}
+		for _, a := range got {
+			if r, ok := c.want[a.ExDate]; !ok || r != a.Ratio {
+				t.Errorf("%s: unexpected gap %s ratio %g", c.name, a.ExDate, a.Ratio)
+			}
+		}
+	}
+}
+
+func TestReconcileCorporateActions(t *testing.T) {
+	// 2025-09-01 (月) 〜。09-04 に 1:2 の段差
+	withGap := priceSeries(t, "9999", "2025-09-01", 3000, 3010, 3020, 1500, 1510, 1505, 1500, 1490)
+	adjustedBySource := priceSeries(t, "9999", "2025-09-01", 1500, 1505, 1510, 1500, 1510, 1505, 1500, 1490)
+	short := withGap[:2]
+
+	tdnet := corporateAction{Code: "9999", ExDate: "2025-09-03", Ratio: 2, Source: corporateActionSourceTDNET, Status: CorporateActionPending}
+	cases := []struct {
+		name       string
+		prices     []StockPrice
+		existing   []corporateAction
+		wantDate   string
+		wantStatus string
+		wantSource string
+	}{
+		{"予定の翌日に段差 → 実際の日付で adjust", withGap, []corporateAction{tdnet}, "2025-09-04", CorporateActionAdjust, corporateActionSourceTDNET},
+		{"取得元が調整済み → no_gap", adjustedBySource, []corporateAction{tdnet}, "2025-09-03", CorporateActionNoGap, corporateActionSourceTDNET},
+		{"権利落ち前 → pending", short, []corporateAction{tdnet}, "2025-09-03", CorporateActionPending, corporateActionSourceTDNET},
+		{"開示なしでも段差を検出", withGap, nil, "2025-09-04", CorporateActionAdjust, corporateActionSourceGap},
+		{
+			"同じ日の gap は tdnet に統合",
+			withGap,
+			[]corporateAction{{Code: "9999", ExDate: "2025-09-04", Ratio: 2, Source: corporateActionSourceGap, Status: CorporateActionAdjust}, tdnet},
+			"2025-09-04", CorporateActionAdjust, corporateActionSourceTDNET,
+		},
+	}
+	for _, c := range cases {
+		got := reconcileCorporateActions("9999", c.prices, c.existing)
+		if len(got) != 1 {
+			t.Errorf("%s: got %d actions %+v, want 1", c.name, len(got), got)
+			continue
+		}
+		a := got[0]
+		if a.ExDate != c.wantDate || a.Status != c.wantStatus || a.Source != c.wantSource {
+			t.Errorf("%s: got (%s, %s, %s), want (%s, %s, %s)", c.name,
+				a.ExDate, a.Status, a.Source, c.wantDate, c.wantStatus, c.wantSource)
+		}
+	}
+}
+
+func TestPriceAdjuster(t *testing.T) {
+	adj := priceAdjuster{"9999": {
+		{Code: "9999", ExDate: "2025-06-02", Ratio: 2},
+		{Code: "9999", ExDate: "2025-10-01", Ratio: 3},
+	}}
+	cases := []struct {
+		date string
+		want float64
+	}{
+		{"2025-05-30", 6},
+		{"2025-06-02", 3}, // 権利落ち日当日は新しい株数
+		{"2025-09-30", 3},
+		{"2025-10-01", 1},
+	}
+	for _, c := range cases {
+		if got := adj.factor("9999", c.date); got != c.want {
+			t.Errorf("factor(%s) = %g, want %g", c.date, got, c.want)
+		}
+	}
+	if got := adj.factor("1111", "2025-01-01"); got != 1 {
+		t.Errorf("アクションの無い銘柄の factor = %g, want 1", got)
+	}
+
+	p := adj.adjust(StockPrice{Code: "9999", Date: "2025-05-30", Open: 600, High: 660, Low: 540, Close: 630, Volume: 1000})
+	want := StockPrice{Code: "9999", Date: "2025-05-30", Open: 100, High: 110, Low: 90, Close: 105, Volume: 6000}
+	if p != want {
+		t.Errorf("adjust = %+v, want %+v", p, want)
+	}
+}
@@ -101,6 +101,22 @@ func initXbrlDB() (*sql.DB, error) {
 		"ALTER TABLE stock_financials ADD COLUMN operating_cash_flow INTEGER",
 		"ALTER TABLE stock_financials ADD COLUMN gross_profit INTEGER",
 		"ALTER TABLE stock_financials ADD COLUMN dividend_per_share REAL",
+		// 決算短信 (SHORT_REPORT) 由来の追加項目 (tdnet_xbrl.go)
+		"ALTER TABLE stock_financials ADD COLUMN source TEXT", // xbrl / pdf
+		"ALTER TABLE stock_financials ADD COLUMN eps REAL",
+		"ALTER TABLE stock_financials ADD COLUMN forecast_net_sales INTEGER",
+		"ALTER TABLE stock_financials ADD COLUMN forecast_operating_income INTEGER",
+		"ALTER TABLE stock_financials ADD COLUMN forecast_net_income INTEGER",
+		"ALTER TABLE stock_financials ADD COLUMN forecast_eps REAL",
+		"ALTER TABLE stock_financials ADD COLUMN forecast_dividend_per_share REAL",
+		// 決算短信の対象期間 (四半期は期首からの累計) と前年同期の比較値
+		"ALTER TABLE stock_financials ADD COLUMN fiscal_year_end TEXT", // YYYY-MM
+		"ALTER TABLE stock_financials ADD COLUMN fiscal_period TEXT",   // Q1 / Q2 / Q3 / FY
+		"ALTER TABLE stock_financials ADD COLUMN prior_net_sales INTEGER",
+		"ALTER TABLE stock_financials ADD COLUMN prior_operating_income INTEGER",
+		"ALTER TABLE stock_financials ADD COLUMN prior_net_income INTEGER",
+		"ALTER TABLE stock_financials ADD COLUMN evidence TEXT",        // 決算短信の項目別の信頼度・根拠 (JSON, tanshin_evidence.go)
+		"ALTER TABLE stock_financials ADD COLUMN reconciled_date TEXT", // 決算短信のみ: 突合した報告書の提出日 (reconcile.go)
 	} {
 		db.Exec(alt)
 	}
@@ -125,14 +141,246 @@ func initXbrlDB() (*sql.DB, error) {
 	if err != nil {
 		log.Printf("⚠️ tdnet_disclosures table: %v", err)
 	}
+	// 開示分類 (tdnet_classify.go): doc_category にカテゴリ、決算期・訂正フラグを別カラムで保持
+	for _, alt := range []string{
+		"ALTER TABLE tdnet_disclosures ADD COLUMN history TEXT",
+		"ALTER TABLE tdnet_disclosures ADD COLUMN fiscal_year_end TEXT",
+		"ALTER TABLE tdnet_disclosures ADD COLUMN fiscal_period TEXT",
+		"ALTER TABLE tdnet_disclosures ADD COLUMN is_correction INTEGER DEFAULT 0",
+		"ALTER TABLE tdnet_disclosures ADD COLUMN xbrl_url TEXT", // 決算短信サマリー XBRL (ZIP)
+	} {
+		db.Exec(alt)
+	}
+	db.Exec(`CREATE INDEX IF NOT EXISTS idx_tdnet_category ON tdnet_disclosures(doc_category, disclosure_datetime)`)
+
+	// 会社業績予想の履歴 (forecasts.go)。prev_* は同じ決算期の前回予想
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS forecasts (
+		code TEXT NOT NULL,
+		announced_at TEXT NOT NULL,
+		fiscal_year_end TEXT NOT NULL,
+		source TEXT,
+		title TEXT,
+		net_sales INTEGER,
+		operating_income INTEGER,
+		net_income INTEGER,
+		eps REAL,
+		dividend_per_share REAL,
+		prev_net_sales INTEGER,
+		prev_operating_income INTEGER,
+		prev_net_income INTEGER,
+		prev_eps REAL,
+		prev_dividend_per_share REAL,
+		PRIMARY KEY (code, announced_at, fiscal_year_end)
+	);`)
+	if err != nil {
+		log.Printf("⚠️ forecasts table: %v", err)
+	}
+
+	// 配当予想の修正・剰余金の配当 (dividends.go)
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS dividend_events (
+		code TEXT NOT NULL,
+		announced_at TEXT NOT NULL,
+		title TEXT NOT NULL,
+		event_type TEXT,
+		fiscal_year_end TEXT,
+		record_date TEXT,
+		interim_dps REAL,
+		year_end_dps REAL,
+		annual_dps REAL,
+		prev_annual_dps REAL,
+		is_commemorative INTEGER DEFAULT 0,
+		is_special INTEGER DEFAULT 0,
+		special_dps REAL,
+		PRIMARY KEY (code, announced_at, title)
+	);`)
+	if err != nil {
+		log.Printf("⚠️ dividend_events table: %v", err)
+	}
+
+	// 自己株式取得 (決定・取得状況) の履歴
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS buybacks (
+		code TEXT NOT NULL,
+		announced_at TEXT NOT NULL,
+		title TEXT NOT NULL,
+		event_type TEXT,
+		authorized_shares INTEGER,
+		authorized_amount INTEGER,
+		period_start TEXT,
+		period_end TEXT,
+		acquired_shares INTEGER,
+		acquired_amount INTEGER,
+		cumulative_shares INTEGER,
+		cumulative_amount INTEGER,
+		PRIMARY KEY (code, announced_at, title)
+	);`)
+	if err != nil {
+		log.Printf("⚠️ buybacks table: %v", err)
+	}
+
+	// 決算短信の低信頼度の抽出値 (stock_financials に書かずに人手確認を待つ)
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS tanshin_review_queue (
+		code TEXT NOT NULL,
+		submission_date TEXT NOT NULL,
+		field TEXT NOT NULL,
+		value INTEGER,
+		confidence REAL,
+		rule TEXT,
+		span TEXT,
+		source TEXT,
+		status TEXT DEFAULT 'pending', -- pending / accepted / rejected
+		created_at TEXT,
+		PRIMARY KEY (code, submission_date, field)
+	);`)
+	if err != nil {
+		log.Printf("⚠️ tanshin_review_queue table: %v", err)
+	}
+
+	// 決算短信と同じ期の報告書の項目別の差 (reconcile-financials で再計算)
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS financial_reconciliations (
+		code TEXT NOT NULL,
+		short_date TEXT NOT NULL,   -- 決算短信の提出日
+		field TEXT NOT NULL,        -- NetSales / OperatingIncome / NetIncome / TotalAssets / NetAssets
+		report_date TEXT NOT NULL,  -- 報告書の提出日
+		report_doc_type TEXT,
+		fiscal_period TEXT,
+		short_value INTEGER,
+		report_value INTEGER,
+		diff_pct REAL,
+		flagged INTEGER DEFAULT 0,  -- 乖離率が閾値超
+		reconciled_at TEXT,
+		PRIMARY KEY (code, short_date, field)
+	);`)
+	if err != nil {
+		log.Printf("⚠️ financial_reconciliations table: %v", err)
+	}
+
+	if err := migrateTdnetTimes(db); err != nil {
+		log.Printf("⚠️ 開示時刻の移行失敗: %v", err)
+	}
+	if err := migrateTdnetCorrections(db); err != nil {
+		log.Printf("⚠️ 訂正フラグの移行失敗: %v", err)
+	}
 
 	return db, nil
 }
 
+// tdnetTimeColumns は TDNET の開示日時 (YYYY-MM-DD HH:MM) を主キーに含むテーブルと列
+var tdnetTimeColumns = []struct{ table, column string }{
+	{"tdnet_disclosures", "disclosure_datetime"},
+	{"stock_financials", "submission_date"}, // SHORT_REPORT の行
+	{"forecasts", "announced_at"},
+	{"dividend_events", "announced_at"},
+	{"buybacks", "announced_at"},
+	{"tanshin_review_queue", "submission_date"},
+	{"financial_reconciliations", "short_date"},
+}
+
+// xbrlSchemaTdnetTimes は migrateTdnetTimes を済ませた xbrl.db の PRAGMA user_version
+const xbrlSchemaTdnetTimes = 1
+
+// migrateTdnetTimes は以前の取得で時刻をゼロ埋めせずに保存した開示日時 (9:15) を 09:15 に揃える。
+// 揃えると再取得で入った行と主キーが重なるものは、再取得した行 (新しい方) を残して消す。
+// 済んだら PRAGMA user_version を上げ、次に開いたときは何もしない (以降の取得はゼロ埋めして保存する)
+func migrateTdnetTimes(db *sql.DB) error {
+	const unpadded = `GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9] [0-9]:[0-9][0-9]*'`
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var version int
+	if err := tx.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version >= xbrlSchemaTdnetTimes {
+		return nil
+	}
+	for _, c := range tdnetTimeColumns {
+		if _, err := tx.Exec(`UPDATE OR IGNORE ` + c.table + ` SET ` + c.column + ` = substr(` + c.column + `, 1, 11) || '0' || substr(` + c.column + `, 12)
+			WHERE ` + c.column + ` ` + unpadded); err != nil {
+			return fmt.Errorf("%s: %w", c.table, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM ` + c.table + ` WHERE ` + c.column + ` ` + unpadded); err != nil {
+			return fmt.Errorf("%s: %w", c.table, err)
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, xbrlSchemaTdnetTimes)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// priceSchemaIndexPrices は migrateIndexPrices を済ませた stock_price.db の PRAGMA user_version
+const priceSchemaIndexPrices = 1
+
+// migrateIndexPrices は以前 stock_prices に銘柄と混ぜて保存していた指数 ('^' で始まるコード) を index_prices に移す。
+// 範囲指定で主キーを使う。済んだら PRAGMA user_version を上げ、次に開いたときは何もしない (以降の取得は index_prices に保存する)
+func migrateIndexPrices(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var version int
+	if err := tx.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version >= priceSchemaIndexPrices {
+		return nil
+	}
+	if _, err := tx.Exec(`
+		INSERT OR IGNORE INTO index_prices (code, date, open, high, low, close, volume, source)
+		SELECT code, date, open, high, low, close, volume, source FROM stock_prices
+		WHERE code >= '^' AND code < '_'`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM stock_prices WHERE code >= '^' AND code < '_'`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, priceSchemaIndexPrices)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// xbrlSchemaTdnetCorrections は migrateTdnetCorrections を済ませた xbrl.db の PRAGMA user_version
+const xbrlSchemaTdnetCorrections = 2
+
+// migrateTdnetCorrections は以前の分類で更新履歴があるだけの原本に付けた訂正フラグを外す
+// (訂正・差替は表題で判定する。classifyDisclosure)。済んだら PRAGMA user_version を上げ、次に開いたときは何もしない
+func migrateTdnetCorrections(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var version int
+	if err := tx.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version >= xbrlSchemaTdnetCorrections {
+		return nil
+	}
+	if _, err := tx.Exec(`
+		UPDATE tdnet_disclosures SET is_correction = 0
+		WHERE is_correction = 1 AND title NOT LIKE '%訂正%' AND title NOT LIKE '%差替%'`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, xbrlSchemaTdnetCorrections)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // initPriceDB は株価データ用DB（stock_price.db）を初期化する
 func initPriceDB() (*sql.DB, error) {
 	ensureDir()
-	db, err := sql.Open("sqlite", "./data/stock_price.db")
+	db, err := sql.Open("sqlite", priceDBPath)
 	if err != nil {
 		return nil, err
 	}
@@ -151,6 +399,110 @@ func initPriceDB() (*sql.DB, error) {
 	if _, err = db.Exec(sqlStmt); err != nil {
 		return nil, fmt.Errorf("株価テーブル作成失敗: %w", err)
 	}
+	// 取得元 (price_sources.go)。追加前の行は NULL
+	db.Exec("ALTER TABLE stock_prices ADD COLUMN source TEXT")
+
+	// 取得元ごとの健全性 (次回の実行でクールダウンを引き継ぐ)
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS price_source_health (
+		name TEXT PRIMARY KEY,
+		attempts INTEGER,
+		successes INTEGER,
+		last_block_at TEXT,  -- RFC3339
+		cooldown_until TEXT, -- RFC3339
+		updated_at TEXT
+	);`)
+	if err != nil {
+		return nil, fmt.Errorf("取得元テーブル作成失敗: %w", err)
+	}
+
+	// backfill-prices で要求済みの開始日 (取得元に古いデータが無い銘柄を毎回要求しない)
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS price_history_coverage (
+		code TEXT PRIMARY KEY,
+		requested_from TEXT,
+		updated_at TEXT
+	);`)
+	if err != nil {
+		return nil, fmt.Errorf("履歴カバレッジテーブル作成失敗: %w", err)
+	}
+
+	// 株式分割・併合 (corporate_actions.go)。stock_prices は生の値のまま、読み出し時に status='adjust' の行で調整する
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS corporate_actions (
+		code TEXT,
+		ex_date TEXT,      -- 権利落ち日 (この日から新しい株数で取引)
+		ratio REAL,        -- 旧1株あたりの新株数 (1:2 の分割は 2、10株→1株の併合は 0.1)
+		source TEXT,       -- tdnet / gap
+		status TEXT,       -- adjust / pending / no_gap
+		record_date TEXT,  -- 基準日 (TDNET のみ)
+		title TEXT,
+		announced_at TEXT,
+		updated_at TEXT,
+		PRIMARY KEY (code, ex_date)
+	);`)
+	if err != nil {
+		return nil, fmt.Errorf("コーポレートアクションテーブル作成失敗: %w", err)
+	}
+
+	// 市場指数の日足 (indices.go)。列は stock_prices と同じ
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS index_prices (
+		code TEXT,  -- ^NKX / ^TPX など (marketIndices)
+		date TEXT,
+		open REAL,
+		high REAL,
+		low REAL,
+		close REAL,
+		volume INTEGER,
+		source TEXT,
+		PRIMARY KEY (code, date)
+	);`)
+	if err != nil {
+		return nil, fmt.Errorf("指数テーブル作成失敗: %w", err)
+	}
+	if err := migrateIndexPrices(db); err != nil {
+		return nil, fmt.Errorf("指数の移行失敗: %w", err)
+	}
+
+	// 株価CSVの取り込み結果 (import_prices.go)。1ファイル1行
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS price_import_reports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		file TEXT,
+		imported_at TEXT,
+		encoding TEXT,     -- utf-8 / shift_jis
+		rows INTEGER,      -- データ行数
+		imported INTEGER,  -- 保存した行数
+		rejected INTEGER,  -- 検証で却下した行数
+		duplicates INTEGER,
+		codes TEXT,        -- カンマ区切り
+		from_date TEXT,
+		to_date TEXT,
+		detail TEXT,       -- 却下の理由別の行数と例 (JSON)
+		error TEXT         -- ファイル全体を読めなかった理由
+	);`)
+	if err != nil {
+		return nil, fmt.Errorf("取り込みレポートテーブル作成失敗: %w", err)
+	}
+
+	// 株価の品質チェック結果 (price_quality.go)
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS price_quality_issues (
+		code TEXT,         -- 全銘柄に共通の欠損は '*'
+		date TEXT,
+		kind TEXT,         -- bad_ohlc / high_low / duplicate_date / gap / spike
+		end_date TEXT,     -- gap の最終日
+		detail TEXT,
+		source TEXT,       -- 問題の行の取得元
+		status TEXT,       -- open / fixed
+		checked_at TEXT,
+		fixed_at TEXT,
+		PRIMARY KEY (code, date, kind)
+	);`)
+	if err != nil {
+		return nil, fmt.Errorf("品質チェックテーブル作成失敗: %w", err)
+	}
 
 	return db, nil
 }
@@ -163,21 +515,72 @@ func initRsDB() (*sql.DB, error) {
 		return nil, err
 	}
 
+	// profile は RS プロファイル (rs_profiles.go) の ID。プロファイルごとに順位を持つ
 	sqlStmt := `
 	CREATE TABLE IF NOT EXISTS rs_scores (
+		profile TEXT NOT NULL DEFAULT 'default',
 		code TEXT,
 		date TEXT,
 		rs_score REAL,
 		rs_rank INTEGER,
-		PRIMARY KEY (code, date)
+		PRIMARY KEY (profile, code, date)
 	);`
 	if _, err = db.Exec(sqlStmt); err != nil {
 		return nil, fmt.Errorf("RSテーブル作成失敗: %w", err)
 	}
+	// ベンチマーク指数 (-rs-benchmark) の加重騰落率との差 (ポイント)。指数データが無ければ NULL
+	db.Exec("ALTER TABLE rs_scores ADD COLUMN excess_score REAL")
+	// profile 列の無い rs_scores (主キーが code, date) は作り直して default に移す
+	if _, err := db.Exec(`SELECT profile FROM rs_scores LIMIT 0`); err != nil {
+		if err := migrateRSScoresProfile(db); err != nil {
+			return nil, fmt.Errorf("rs_scores 移行失敗: %w", err)
+		}
+	}
+
+	// 計算に使った RS プロファイルの定義 (/api/rs-profiles)
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS rs_profiles (
+		id TEXT PRIMARY KEY,
+		name TEXT,
+		definition TEXT,  -- rsProfile の JSON
+		updated_at TEXT
+	);`)
+	if err != nil {
+		return nil, fmt.Errorf("RSプロファイルテーブル作成失敗: %w", err)
+	}
 
 	return db, nil
 }
 
+// migrateRSScoresProfile は rs_scores を profile 列入りの主キーで作り直す (既存の行は default)
+func migrateRSScoresProfile(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		`CREATE TABLE rs_scores_new (
+			profile TEXT NOT NULL DEFAULT 'default',
+			code TEXT,
+			date TEXT,
+			rs_score REAL,
+			rs_rank INTEGER,
+			excess_score REAL,
+			PRIMARY KEY (profile, code, date)
+		)`,
+		`INSERT INTO rs_scores_new (profile, code, date, rs_score, rs_rank, excess_score)
+			SELECT 'default', code, date, rs_score, rs_rank, excess_score FROM rs_scores`,
+		`DROP TABLE rs_scores`,
+		`ALTER TABLE rs_scores_new RENAME TO rs_scores`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 // openServerDB はサーバー用に全DBをATTACHした接続を返す
 //
 // 重要: ATTACH DATABASE は SQLite の接続単位の操作。
@@ -298,7 +701,7 @@ func migrateFromLegacyDB() {
 	for pRows.Next() {
 		var p StockPrice
 		pRows.Scan(&p.Code, &p.Date, &p.Open, &p.High, &p.Low, &p.Close, &p.Volume)
-		savePricesToDB(priceDB, p.Code, []StockPrice{p})
+		savePricesToDB(priceDB, p.Code, []StockPrice{p}, "")
 		priceCount++
 	}
 	fmt.Printf("  ✅ Migrated %d price records to stock_price.db\n", priceCount)
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TDNET の配当関連開示 (配当予想の修正・剰余金の配当) のパース
+//
+// 年次 XBRL の dividend_per_share は有報提出まで更新されないため、期中の増配・記念配当を
+// dividend_events に取り込み、高配当ランキングの予想配当 (forward DPS) に使う。
+//
+//   配当予想の修正 (event_type=forecast): 「前回予想 / 今回修正予想 / 当期実績 / 前期実績」× 四半期末・期末・合計の表
+//   剰余金の配当   (event_type=resolution): 「決定額 / 直近の配当予想 / 前期実績」× 基準日・1株当たり配当金 の表
+
+const (
+	DividendEventForecast   = "forecast"
+	DividendEventResolution = "resolution"
+)
+
+// dividendEvent は dividend_events テーブルの1行 (1株当たりの金額は円、0 は未記載)
+type dividendEvent struct {
+	Code            string
+	AnnouncedAt     string
+	Title           string
+	EventType       string
+	FiscalYearEnd   string // YYYY-MM
+	RecordDate      string // 基準日 YYYY-MM-DD
+	InterimDPS      float64
+	YearEndDPS      float64
+	AnnualDPS       float64 // 年間合計 (表に合計がある場合のみ)
+	PrevAnnualDPS   float64 // 前回予想の年間合計 (剰余金の配当は直近予想の当該配当)
+	IsCommemorative bool
+	IsSpecial       bool
+	SpecialDPS      float64 // 記念・特別配当の金額
+}
+
+var (
+	dividendYenRegex     = regexp.MustCompile(`([0-9][0-9,]*)(?:[.．]([0-9]+))?\s*円(?:\s*([0-9]{1,2})\s*銭)?`)
+	dividendNumRegex     = regexp.MustCompile(`[0-9][0-9,]*(?:\.[0-9]+)?|[－―‐]|未定`)
+	dividendSpecialRegex = regexp.MustCompile(`(記念配当|特別配当)[^0-9\n]{0,8}([0-9][0-9,]*(?:[.．][0-9]+)?\s*円(?:\s*[0-9]{1,2}\s*銭)?)`)
+	dividendParenRegex   = regexp.MustCompile(`（[^）]*）|\([^)]*\)`)
+	dividendDateRegex    = regexp.MustCompile(`(\d{4})年\s*(\d{1,2})月\s*(\d{1,2})日`)
+	dividendRowLabels    = map[string]*regexp.Regexp{
+		"prev":  regexp.MustCompile(`^[\s　]*前回(?:発表)?予想`),
+		"cur":   regexp.MustCompile(`^[\s　]*(?:今回(?:修正|発表)?予想|今回修正|修正後予想)`),
+		"act":   regexp.MustCompile(`^[\s　]*当期実績`),
+		"prior": regexp.MustCompile(`^[\s　]*前期実績`),
+	}
+	// 配当表の列見出し
+	dividendColumnLabels = []struct {
+		field  string
+		labels []string
+	}{
+		{"Q1", []string{"第1四半期末", "第１四半期末"}},
+		{"Q2", []string{"第2四半期末", "第２四半期末", "中間期末"}},
+		{"Q3", []string{"第3四半期末", "第３四半期末"}},
+		{"YE", []string{"期末"}},
+		{"Total", []string{"合計", "年間"}},
+	}
+)
+
+// parseYenAmount は "45円00銭" "45.00円" "45円" を円単位の float64 に変換する
+func parseYenAmount(s string) (float64, bool) {
+	m := dividendYenRegex.FindStringSubmatch(fullWidthDigits.Replace(s))
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", ""), 64)
+	if err != nil {
+		return 0, false
+	}
+	if m[2] != "" {
+		frac, _ := strconv.ParseFloat("0."+m[2], 64)
+		v += frac
+	} else if m[3] != "" {
+		sen, _ := strconv.ParseFloat(m[3], 64)
+		v += sen / 100
+	}
+	return v, true
+}
+
+// detectSpecialDividend は記念配当・特別配当の有無と金額を本文から拾う
+func detectSpecialDividend(text string) (commemorative, special bool, amount float64) {
+	commemorative = strings.Contains(text, "記念配当")
+	special = strings.Contains(text, "特別配当")
+	if m := dividendSpecialRegex.FindStringSubmatch(text); m != nil {
+		amount, _ = parseYenAmount(m[2])
+	}
+	return commemorative, special, amount
+}
+
+// parseDividendForecastText は配当予想の修正の表を読む。
+// 行 (前回予想・今回修正予想・当期実績) の数値は、見出し (第2四半期末・期末・合計 等) の桁位置に最も近い列に割り当てる
+// (今回修正予想の行は変更のある列だけが埋まることが多いため、出現順では対応付けられない)
+func parseDividendForecastText(text string) (dividendEvent, bool) {
+	var ev dividendEvent
+	lines := strings.Split(fullWidthDigits.Replace(text), "\n")
+
+	type col struct {
+		field  string
+		center int
+	}
+	var cols []col
+	rows := map[string]map[string]float64{}
+	pending := "" // 行ラベルだけで数値が次行に折り返された行
+	for _, line := range lines {
+		// 「（2024年11月8日発表）」等の括弧書きは桁位置を保ったまま空白にする
+		line = dividendParenRegex.ReplaceAllStringFunc(line, func(m string) string {
+			return strings.Repeat(" ", displayWidth(m))
+		})
+
+		rowKey := ""
+		labelEnd := 0
+		for key, rx := range dividendRowLabels {
+			if loc := rx.FindStringIndex(line); loc != nil {
+				rowKey, labelEnd = key, loc[1]
+				break
+			}
+		}
+		if rowKey == "" && pending != "" && strings.TrimSpace(line) != "" {
+			rowKey = pending
+		}
+
+		if rowKey == "" {
+			// 見出し候補 (列ラベルを含む行)。数値行が始まる前の最新の見出しを使う
+			var found []col
+			for _, c := range dividendColumnLabels {
+				for _, l := range c.labels {
+					for off := 0; ; {
+						i := strings.Index(line[off:], l)
+						if i < 0 {
+							break
+						}
+						start := off + i
+						off = start + len(l)
+						// 「第2四半期末」「中間期末」中の「期末」は期末列として拾わない
+						if c.field == "YE" && (strings.HasSuffix(line[:start], "四半") || strings.HasSuffix(line[:start], "中間")) {
+							continue
+						}
+						// 表全体の見出し「年間配当金」は合計列ではない
+						if c.field == "Total" && strings.HasPrefix(line[off:], "配当金") {
+							continue
+						}
+						found = append(found, col{c.field, displayWidth(line[:start]) + displayWidth(l)/2})
+					}
+				}
+			}
+			if len(found) >= 2 && len(rows) == 0 {
+				cols = found
+			}
+			continue
+		}
+		if len(cols) == 0 {
+			continue
+		}
+
+		// 行ラベル部分を除いた数値トークンを最寄りの列へ
+		vals := map[string]float64{}
+		rest := line[labelEnd:]
+		for _, loc := range dividendNumRegex.FindAllStringIndex(rest, -1) {
+			tok := rest[loc[0]:loc[1]]
+			center := displayWidth(line[:labelEnd+loc[0]]) + displayWidth(tok)/2
+			best, bestDist := "", 1<<30
+			for _, c := range cols {
+				d := center - c.center
+				if d < 0 {
+					d = -d
+				}
+				if d < bestDist {
+					best, bestDist = c.field, d
+				}
+			}
+			v, err := strconv.ParseFloat(strings.ReplaceAll(tok, ",", ""), 64)
+			if err != nil {
+				continue // －・未定
+			}
+			vals[best] = v
+		}
+		pending = ""
+		if len(vals) == 0 && labelEnd > 0 && dividendNumRegex.FindString(line[labelEnd:]) == "" {
+			pending = rowKey
+			continue
+		}
+		if _, seen := rows[rowKey]; !seen {
+			rows[rowKey] = vals
+		}
+	}
+
+	cur, ok := rows["cur"]
+	if !ok || len(cur) == 0 {
+		return ev, false
+	}
+	act := rows["act"]
+	prev := rows["prev"]
+
+	ev.YearEndDPS = cur["YE"]
+	ev.InterimDPS = cur["Q2"]
+	if ev.InterimDPS == 0 {
+		ev.InterimDPS = act["Q2"]
+	}
+	ev.AnnualDPS = cur["Total"]
+	if ev.AnnualDPS == 0 && ev.YearEndDPS > 0 {
+		// 合計欄が無い/空欄なら四半期末 (当期実績・今回予想) と期末を積み上げる
+		for _, q := range []string{"Q1", "Q2", "Q3"} {
+			if v := cur[q]; v > 0 {
+				ev.AnnualDPS += v
+			} else {
+				ev.AnnualDPS += act[q]
+			}
+		}
+		ev.AnnualDPS += ev.YearEndDPS
+	}
+	ev.PrevAnnualDPS = prev["Total"]
+	ev.IsCommemorative, ev.IsSpecial, ev.SpecialDPS = detectSpecialDividend(text)
+	return ev, true
+}
+
+// parseDividendResolutionText は剰余金の配当 (取締役会決議) の「基準日」「1株当たり配当金」行を読む。
+// 各行の1番目の値が決定額、2番目が直近の配当予想。
+func parseDividendResolutionText(text string) (dividendEvent, bool) {
+	var ev dividendEvent
+	text = fullWidthDigits.Replace(text)
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimLeft(line, " 　\t")
+		switch {
+		case ev.RecordDate == "" && strings.HasPrefix(trimmed, "基準日"):
+			if m := dividendDateRegex.FindStringSubmatch(trimmed); m != nil {
+				mo, _ := strconv.Atoi(m[2])
+				d, _ := strconv.Atoi(m[3])
+				ev.RecordDate = fmt.Sprintf("%s-%02d-%02d", m[1], mo, d)
+			}
+		case ev.YearEndDPS == 0 && strings.HasPrefix(trimmed, "1株当たり配当金"):
+			amounts := dividendYenRegex.FindAllString(trimmed, -1)
+			if len(amounts) == 0 {
+				continue
+			}
+			ev.YearEndDPS, _ = parseYenAmount(amounts[0])
+			if len(amounts) > 1 {
+				ev.PrevAnnualDPS, _ = parseYenAmount(amounts[1])
+			}
+		}
+	}
+	if ev.YearEndDPS == 0 {
+		return ev, false
+	}
+	ev.IsCommemorative, ev.IsSpecial, ev.SpecialDPS = detectSpecialDividend(text)
+	return ev, true
+}
+
+// assignDividendPeriod は剰余金の配当の決定額を、基準日と決算期から期末配当か中間配当に振り分ける
+func assignDividendPeriod(ev *dividendEvent) {
+	if ev.EventType != DividendEventResolution || ev.RecordDate == "" || ev.FiscalYearEnd == "" {
+		return
+	}
+	if !strings.HasPrefix(ev.RecordDate, ev.FiscalYearEnd) {
+		ev.InterimDPS, ev.YearEndDPS = ev.YearEndDPS, 0
+	}
+}
+
+// saveDividendEvent は dividend_events に保存する (同じ開示の再パースは上書き)
+func saveDividendEvent(db *sql.DB, ev dividendEvent) error {
+	_, err := db.Exec(`
+		INSERT INTO dividend_events (
+			code, announced_at, title, event_type, fiscal_year_end, record_date,
+			interim_dps, year_end_dps, annual_dps, prev_annual_dps,
+			is_commemorative, is_special, special_dps
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(code, announced_at, title) DO UPDATE SET
+			event_type = excluded.event_type,
+			fiscal_year_end = excluded.fiscal_year_end,
+			record_date = excluded.record_date,
+			interim_dps = excluded.interim_dps,
+			year_end_dps = excluded.year_end_dps,
+			annual_dps = excluded.annual_dps,
+			prev_annual_dps = excluded.prev_annual_dps,
+			is_commemorative = excluded.is_commemorative,
+			is_special = excluded.is_special,
+			special_dps = excluded.special_dps`,
+		ev.Code, ev.AnnouncedAt, ev.Title, ev.EventType, ev.FiscalYearEnd, ev.RecordDate,
+		nullIfZeroFloat(ev.InterimDPS), nullIfZeroFloat(ev.YearEndDPS), nullIfZeroFloat(ev.AnnualDPS),
+		nullIfZeroFloat(ev.PrevAnnualDPS), ev.IsCommemorative, ev.IsSpecial, nullIfZeroFloat(ev.SpecialDPS))
+	return err
+}
+
+// dividendTarget はパース対象の配当関連開示
+type dividendTarget struct {
+	code, dt, title, url, fye string
+}
+
+// loadDividendTargets は指定日の配当関連開示。「業績予想及び配当予想の修正」は業績予想の修正に分類されるが
+// 配当予想の表も載っているので、表題に「配当予想」を含む業績予想の修正も対象にする
+func loadDividendTargets(db *sql.DB, targetDate string) ([]dividendTarget, error) {
+	rows, err := db.Query(`
+		SELECT code, disclosure_datetime, title, pdf_url, COALESCE(fiscal_year_end, '')
+		FROM tdnet_disclosures
+		WHERE disclosure_datetime LIKE ? || '%'
+		  AND (doc_category = ? OR (doc_category IN (?, ?, ?) AND title LIKE '%配当予想%'))
+		  AND COALESCE(is_correction, 0) = 0
+		  AND COALESCE(pdf_url, '') != ''
+		ORDER BY disclosure_datetime, code`,
+		targetDate, CategoryDividend, CategoryForecastUp, CategoryForecastDown, CategoryForecastRevision)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var targets []dividendTarget
+	for rows.Next() {
+		var t dividendTarget
+		if rows.Scan(&t.code, &t.dt, &t.title, &t.url, &t.fye) == nil {
+			targets = append(targets, t)
+		}
+	}
+	return targets, rows.Err()
+}
+
+// parseDividendDisclosuresForDate は指定日の配当関連開示を PDF からパースして dividend_events に保存する
+func parseDividendDisclosuresForDate(db *sql.DB, targetDate string) (saved, failed int) {
+	targets, err := loadDividendTargets(db, targetDate)
+	if err != nil {
+		fmt.Printf("⚠️ 配当関連開示の取得失敗: %v\n", err)
+		return 0, 0
+	}
+
+	if len(targets) == 0 {
+		return 0, 0
+	}
+	fmt.Printf("\n💴 %s の配当関連開示 %d件をパース...\n", targetDate, len(targets))
+
+	for i, t := range targets {
+		fmt.Printf("  [%d/%d] %s %s ... ", i+1, len(targets), t.code, t.title)
+		pdfPath, err := downloadPDF(t.url)
+		if err != nil {
+			fmt.Printf("DL失敗: %v\n", err)
+			failed++
+			continue
+		}
+		text, err := extractPDFText(pdfPath)
+		os.Remove(pdfPath) // 一時ファイル削除
+		if err != nil {
+			fmt.Printf("テキスト抽出失敗: %v\n", err)
+			failed++
+			continue
+		}
+
+		var ev dividendEvent
+		var ok bool
+		if strings.Contains(t.title, "剰余金の配当") {
+			ev, ok = parseDividendResolutionText(text)
+			ev.EventType = DividendEventResolution
+		} else {
+			ev, ok = parseDividendForecastText(text)
+			ev.EventType = DividendEventForecast
+		}
+		if !ok {
+			fmt.Println("配当表が見つかりません")
+			failed++
+			continue
+		}
+		ev.Code, ev.AnnouncedAt, ev.Title = t.code, t.dt, t.title
+		ev.FiscalYearEnd = t.fye
+		if ev.FiscalYearEnd == "" {
+			ev.FiscalYearEnd = detectFiscalYearEnd(text)
+		}
+		assignDividendPeriod(&ev)
+
+		if err := saveDividendEvent(db, ev); err != nil {
+			fmt.Printf("保存失敗: %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf("✅ 中間=%.2f 期末=%.2f 年間=%.2f\n", ev.InterimDPS, ev.YearEndDPS, ev.AnnualDPS)
+		saved++
+		time.Sleep(500 * time.Millisecond)
+	}
+	return saved, failed
+}
+
+// forwardDividend は銘柄の予想年間配当 (最新の開示を採用)
+type forwardDividend struct {
+	DPS         float64
+	AnnouncedAt string
+	Source      string // dividend_event / forecast
+}
+
+// loadForwardDividends は配当予想の修正 (dividend_events) と決算短信の配当予想 (forecasts) のうち、
+// 今期・来期 (決算期末が今月〜2年以内) の予想で、銘柄ごとに最も新しく開示された年間配当予想を返す。
+// 終わった期の予想・決算期の読めない予想は使わない (長く開示の無い銘柄に古い配当で利回りを付けない)
+func loadForwardDividends(db *sql.DB) (map[string]forwardDividend, error) {
+	now := nowJST()
+	from := now.Format("2006-01")
+	to := time.Date(now.Year()+2, now.Month(), 1, 0, 0, 0, 0, jst).Format("2006-01")
+
+	result := make(map[string]forwardDividend)
+	for _, q := range []struct{ source, query string }{
+		{"dividend_event", `SELECT code, announced_at, annual_dps FROM dividend_events
+			WHERE annual_dps > 0 AND fiscal_year_end >= ? AND fiscal_year_end < ?`},
+		{"forecast", `SELECT code, announced_at, dividend_per_share FROM forecasts
+			WHERE dividend_per_share > 0 AND fiscal_year_end >= ? AND fiscal_year_end < ?`},
+	} {
+		rows, err := db.Query(q.query, from, to)
+		if err != nil {
+			return result, err
+		}
+		for rows.Next() {
+			var code string
+			var f forwardDividend
+			if rows.Scan(&code, &f.AnnouncedAt, &f.DPS) != nil {
+				continue
+			}
+			f.Source = q.source
+			if cur, ok := result[code]; !ok || f.AnnouncedAt > cur.AnnouncedAt {
+				result[code] = f
+			}
+		}
+		rows.Close()
+	}
+	return result, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func readDividendFixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", "dividend", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestParseDividendForecastText(t *testing.T) {
+	cases := []struct {
+		file string
+		want dividendEvent
+	}{
+		{
+			// 今回修正予想は期末・合計だけ、中間は当期実績から。記念配当あり
+			file: "forecast_revision.txt",
+			want: dividendEvent{
+				InterimDPS: 20, YearEndDPS: 40, AnnualDPS: 60, PrevAnnualDPS: 50,
+				IsCommemorative: true, SpecialDPS: 5,
+			},
+		},
+		{
+			// 四半期配当・合計欄が空 → 当期実績の中間 + 今回の期末を積み上げ
+			file: "forecast_quarterly.txt",
+			want: dividendEvent{
+				InterimDPS: 12.5, YearEndDPS: 17.5, AnnualDPS: 30, PrevAnnualDPS: 25,
+			},
+		},
+		{
+			// 業績予想及び配当予想の修正: 業績予想の表の後に配当予想の表がある
+			file: "combined_forecast_revision.txt",
+			want: dividendEvent{
+				InterimDPS: 15, YearEndDPS: 20, AnnualDPS: 35, PrevAnnualDPS: 30,
+			},
+		},
+	}
+	for _, c := range cases {
+		got, ok := parseDividendForecastText(readDividendFixture(t, c.file))
+		if !ok {
+			t.Errorf("%s: 配当表が見つからない", c.file)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s:\n got  %+v\n want %+v", c.file, got, c.want)
+		}
+	}
+}
+
+func TestParseDividendResolutionText(t *testing.T) {
+	got, ok := parseDividendResolutionText(readDividendFixture(t, "resolution.txt"))
+	if !ok {
+		t.Fatal("1株当たり配当金が見つからない")
+	}
+	want := dividendEvent{
+		RecordDate: "2025-03-31", YearEndDPS: 45, PrevAnnualDPS: 40,
+		IsSpecial: true, SpecialDPS: 5,
+	}
+	if got != want {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	// 基準日が決算期末でなければ中間配当
+	ev := got
+	ev.EventType, ev.FiscalYearEnd = DividendEventResolution, "2025-09"
+	assignDividendPeriod(&ev)
+	if ev.InterimDPS != 45 || ev.YearEndDPS != 0 {
+		t.Errorf("中間配当への振り分け: interim=%v year_end=%v", ev.InterimDPS, ev.YearEndDPS)
+	}
+}
+
+func TestParseYenAmount(t *testing.T) {
+	cases := map[string]float64{
+		"45円00銭": 45,
+		"12円50銭": 12.5,
+		"17.50円": 17.5,
+		"１００円":   100,
+		"1,200円": 1200,
+	}
+	for in, want := range cases {
+		if got, ok := parseYenAmount(in); !ok || got != want {
+			t.Errorf("parseYenAmount(%q) = %v, %v; want %v", in, got, ok, want)
+		}
+	}
+}
+
+func TestLoadDividendTargets(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "xbrl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE tdnet_disclosures (code TEXT, disclosure_datetime TEXT, title TEXT, pdf_url TEXT,
+		fiscal_year_end TEXT, doc_category TEXT, is_correction INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []struct{ code, dt, title string }{
+		{"7203", "2026-02-05 15:00", "配当予想の修正に関するお知らせ"},
+		{"6758", "2026-02-05 15:30", "通期業績予想及び配当予想の修正に関するお知らせ"},
+		{"9432", "2026-02-05 16:00", "業績予想並びに配当予想の修正（上方修正）に関するお知らせ"},
+		{"9984", "2026-02-05 16:00", "業績予想の修正に関するお知らせ"},     // 配当予想の表は無い
+		{"4063", "2026-02-05 16:30", "（訂正）配当予想の修正に関するお知らせ"}, // 訂正は対象外
+		{"8306", "2026-02-06 15:00", "剰余金の配当に関するお知らせ"},      // 別の日
+	} {
+		c := classifyDisclosure(d.title)
+		if _, err := db.Exec(`INSERT INTO tdnet_disclosures VALUES (?, ?, ?, 'https://example.com/a.pdf', ?, ?, ?)`,
+			d.code, d.dt, d.title, c.FiscalYearEnd, c.Category, c.IsCorrection); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	targets, err := loadDividendTargets(db, "2026-02-05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tg := range targets {
+		got = append(got, tg.code)
+	}
+	want := []string{"7203", "6758", "9432"}
+	if !slices.Equal(got, want) {
+		t.Errorf("loadDividendTargets = %v, want %v", got, want)
+	}
+}
+
+func TestLoadForwardDividends(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "xbrl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE dividend_events (code TEXT, announced_at TEXT, title TEXT, fiscal_year_end TEXT, annual_dps REAL)`,
+		`CREATE TABLE forecasts (code TEXT, announced_at TEXT, fiscal_year_end TEXT, dividend_per_share REAL)`,
+		// 今期の配当予想の修正より、後から出た来期の決算短信の予想を使う
+		`INSERT INTO dividend_events VALUES ('7203', '2026-02-05 15:00', '配当予想の修正', '2026-03', 90)`,
+		`INSERT INTO forecasts VALUES ('7203', '2026-05-08 13:30', '2027-03', 100)`,
+		// 最新の開示が終わった期の予想しか無い (長く開示が無い)
+		`INSERT INTO forecasts VALUES ('6758', '2024-05-14 15:00', '2025-03', 50)`,
+		// 最新の開示が決算期の読めない修正なら、その前の今期の予想
+		`INSERT INTO forecasts VALUES ('9432', '2026-05-12 15:00', '2026-12', 5)`,
+		`INSERT INTO dividend_events VALUES ('9432', '2026-08-01 15:00', '配当予想の修正', '', 6)`,
+		// 今月が決算期末の予想はまだ今期
+		`INSERT INTO dividend_events VALUES ('9984', '2026-04-20 15:00', '配当予想の修正', '2026-06', 44)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setTestClock(t, time.Date(2026, 6, 15, 12, 0, 0, 0, jst))
+
+	got, err := loadForwardDividends(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]forwardDividend{
+		"7203": {DPS: 100, AnnouncedAt: "2026-05-08 13:30", Source: "forecast"},
+		"9432": {DPS: 5, AnnouncedAt: "2026-05-12 15:00", Source: "forecast"},
+		"9984": {DPS: 44, AnnouncedAt: "2026-04-20 15:00", Source: "dividend_event"},
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d銘柄 %+v, want %d銘柄", len(got), got, len(want))
+	}
+	for code, w := range want {
+		if got[code] != w {
+			t.Errorf("%s = %+v, want %+v", code, got[code], w)
+		}
+	}
+}
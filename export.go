@@ -33,8 +33,8 @@ func exportJSON() {
 	// RS値を一括取得
 	rsMap := make(map[string]float64)
 	rsRows, rsErr := db.Query(`
-		SELECT code, rs_rank FROM rs_db.rs_scores rs1
-		WHERE date = (SELECT MAX(date) FROM rs_db.rs_scores rs2 WHERE rs2.code = rs1.code)`)
+		SELECT code, rs_rank FROM (
+			SELECT code, rs_rank, MAX(date) FROM rs_db.rs_scores WHERE profile = ? GROUP BY code)`, defaultRSProfileID)
 	if rsErr == nil {
 		for rsRows.Next() {
 			var code string
@@ -49,6 +49,12 @@ func exportJSON() {
 	// 成長指標用の時系列データを一括ロード
 	financialsMap, _ := loadAllFinancials(db)
 
+	// 会社予想 (予想PER・修正率用)
+	forecastMap, _ := loadLatestForecasts(db)
+
+	// 自社株買い (取得実績・実施中の取得枠)
+	buybackMap, _ := loadBuybackSummaries(db, nowJST())
+
 	// メインクエリ (補助データロード後)
 	rows, err := db.Query(`
 		SELECT s.code, s.name, COALESCE(s.updated_at, ''),
@@ -86,6 +92,8 @@ func exportJSON() {
 		NetNetRatio *float64 `json:"NetNetRatio"`
 		RS          *float64 `json:"RS"`
 		GrowthMetrics
+		ForecastMetrics
+		BuybackMetrics
 	}
 
 	var stocks []StockJSON
@@ -127,6 +135,12 @@ func exportJSON() {
 		if records, ok := financialsMap[s.Code]; ok {
 			s.GrowthMetrics = calcGrowthMetrics(records)
 		}
+		if f, ok := forecastMap[s.Code]; ok {
+			s.ForecastMetrics = calcForecastMetrics(f, s.LastPrice, s.SharesIssued)
+		}
+		if b, ok := buybackMap[s.Code]; ok {
+			s.BuybackMetrics = calcBuybackMetrics(b, s.LastPrice, s.MarketCap)
+		}
 
 		stocks = append(stocks, s)
 	}
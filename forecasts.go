@@ -0,0 +1,558 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 会社業績予想 (ガイダンス) の履歴
+//
+// 取り込み元:
+//   - 決算短信サマリーの業績予想 (source=earnings)。通期決算短信は来期、四半期決算短信は今期の予想。
+//     XBRL が無い短信は PDF の「業績予想」の表の通期の行を読む
+//   - 業績予想の修正 (上方・下方修正) 開示 PDF の「前回発表予想(A) / 今回修正予想(B)」表 (source=revision)
+//
+// forecasts は (code, announced_at, fiscal_year_end) 単位で1行。prev_* には同じ決算期の
+// 直前の予想 (修正開示なら表中の前回発表予想) を保持し、修正率の算出に使う。
+
+// forecastValues は業績予想1回分の数値 (金額は円、EPS・DPS は円/株。0 は未開示)
+type forecastValues struct {
+	NetSales         int64
+	OperatingIncome  int64
+	NetIncome        int64
+	EPS              float64
+	DividendPerShare float64
+}
+
+func (v forecastValues) isEmpty() bool {
+	return v == forecastValues{}
+}
+
+// mergeMissing は v の未開示項目 (0) を base の値で埋める。
+// 修正開示は変わった項目しか載せないことが多いため、前回予想を引き継いで現在のガイダンス全体を表す
+func (v forecastValues) mergeMissing(base forecastValues) forecastValues {
+	if v.NetSales == 0 {
+		v.NetSales = base.NetSales
+	}
+	if v.OperatingIncome == 0 {
+		v.OperatingIncome = base.OperatingIncome
+	}
+	if v.NetIncome == 0 {
+		v.NetIncome = base.NetIncome
+	}
+	if v.EPS == 0 {
+		v.EPS = base.EPS
+	}
+	if v.DividendPerShare == 0 {
+		v.DividendPerShare = base.DividendPerShare
+	}
+	return v
+}
+
+// forecastRecord は forecasts テーブルの1行
+type forecastRecord struct {
+	Code          string
+	AnnouncedAt   string // 開示日時 (YYYY-MM-DD HH:MM)
+	FiscalYearEnd string // 予想対象の決算期 (YYYY-MM)
+	Source        string // earnings / revision
+	Title         string
+	Values        forecastValues
+	Prev          *forecastValues // 同じ決算期の前回予想 (初回は nil)
+}
+
+// saveForecast は業績予想を保存する。prev が nil なら forecasts 内の同じ決算期の直前の予想を前回値とする。
+// 未開示の項目は前回値を引き継ぐ。
+func saveForecast(db *sql.DB, f forecastRecord) error {
+	if f.FiscalYearEnd == "" {
+		return fmt.Errorf("決算期が不明")
+	}
+	if f.Prev == nil {
+		var p forecastValues
+		err := db.QueryRow(`
+			SELECT COALESCE(net_sales, 0), COALESCE(operating_income, 0), COALESCE(net_income, 0),
+			       COALESCE(eps, 0), COALESCE(dividend_per_share, 0)
+			FROM forecasts
+			WHERE code = ? AND fiscal_year_end = ? AND announced_at < ?
+			ORDER BY announced_at DESC LIMIT 1`,
+			f.Code, f.FiscalYearEnd, f.AnnouncedAt).Scan(
+			&p.NetSales, &p.OperatingIncome, &p.NetIncome, &p.EPS, &p.DividendPerShare)
+		if err == nil {
+			f.Prev = &p
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	v := f.Values
+	var prev forecastValues
+	if f.Prev != nil {
+		prev = *f.Prev
+		v = v.mergeMissing(prev)
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO forecasts (
+			code, announced_at, fiscal_year_end, source, title,
+			net_sales, operating_income, net_income, eps, dividend_per_share,
+			prev_net_sales, prev_operating_income, prev_net_income, prev_eps, prev_dividend_per_share
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(code, announced_at, fiscal_year_end) DO UPDATE SET
+			source = excluded.source,
+			title = excluded.title,
+			net_sales = excluded.net_sales,
+			operating_income = excluded.operating_income,
+			net_income = excluded.net_income,
+			eps = excluded.eps,
+			dividend_per_share = excluded.dividend_per_share,
+			prev_net_sales = excluded.prev_net_sales,
+			prev_operating_income = excluded.prev_operating_income,
+			prev_net_income = excluded.prev_net_income,
+			prev_eps = excluded.prev_eps,
+			prev_dividend_per_share = excluded.prev_dividend_per_share`,
+		f.Code, f.AnnouncedAt, f.FiscalYearEnd, f.Source, f.Title,
+		nullIfZero(v.NetSales), nullIfZero(v.OperatingIncome), nullIfZero(v.NetIncome),
+		nullIfZeroFloat(v.EPS), nullIfZeroFloat(v.DividendPerShare),
+		nullIfZero(prev.NetSales), nullIfZero(prev.OperatingIncome), nullIfZero(prev.NetIncome),
+		nullIfZeroFloat(prev.EPS), nullIfZeroFloat(prev.DividendPerShare))
+	return err
+}
+
+// loadForecasts は forecasts を開示日時の昇順で返す (code が空なら全銘柄)
+func loadForecasts(db *sql.DB, code string) ([]forecastRecord, error) {
+	rows, err := db.Query(`
+		SELECT code, announced_at, fiscal_year_end, COALESCE(source, ''), COALESCE(title, ''),
+		       COALESCE(net_sales, 0), COALESCE(operating_income, 0), COALESCE(net_income, 0),
+		       COALESCE(eps, 0), COALESCE(dividend_per_share, 0),
+		       prev_net_sales, prev_operating_income, prev_net_income, prev_eps, prev_dividend_per_share
+		FROM forecasts
+		WHERE ? = '' OR code = ?
+		ORDER BY code ASC, announced_at ASC, fiscal_year_end ASC`, code, code)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []forecastRecord
+	for rows.Next() {
+		var f forecastRecord
+		var pSales, pOp, pNet sql.NullInt64
+		var pEPS, pDPS sql.NullFloat64
+		if err := rows.Scan(&f.Code, &f.AnnouncedAt, &f.FiscalYearEnd, &f.Source, &f.Title,
+			&f.Values.NetSales, &f.Values.OperatingIncome, &f.Values.NetIncome,
+			&f.Values.EPS, &f.Values.DividendPerShare,
+			&pSales, &pOp, &pNet, &pEPS, &pDPS); err != nil {
+			continue
+		}
+		if pSales.Valid || pOp.Valid || pNet.Valid || pEPS.Valid || pDPS.Valid {
+			f.Prev = &forecastValues{
+				NetSales:         pSales.Int64,
+				OperatingIncome:  pOp.Int64,
+				NetIncome:        pNet.Int64,
+				EPS:              pEPS.Float64,
+				DividendPerShare: pDPS.Float64,
+			}
+		}
+		result = append(result, f)
+	}
+	return result, rows.Err()
+}
+
+// loadLatestForecasts は銘柄ごとの最新の業績予想 (最も新しい開示、同時刻なら先の決算期) を返す
+func loadLatestForecasts(db *sql.DB) (map[string]forecastRecord, error) {
+	all, err := loadForecasts(db, "")
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]forecastRecord)
+	for _, f := range all {
+		// 昇順に読むので後勝ちで最新になる
+		latest[f.Code] = f
+	}
+	return latest, nil
+}
+
+// ForecastMetrics は最新の会社予想から算出する指標 (/api/stocks, /api/oneil-ranking)
+type ForecastMetrics struct {
+	ForwardPER          *float64 `json:"ForwardPER"`          // 株価 / 予想EPS
+	GuidanceRevisionPct *float64 `json:"GuidanceRevisionPct"` // 直近の予想修正率 (%、営業利益。無ければ純利益)
+}
+
+// calcForecastMetrics は予想EPS (無ければ予想純利益 / 発行済株式数) から予想PERを、
+// 前回予想との比較から修正率を求める。前回予想が無い (期初予想) 場合の修正率は nil
+func calcForecastMetrics(f forecastRecord, lastPrice float64, sharesIssued int64) ForecastMetrics {
+	var m ForecastMetrics
+
+	eps := f.Values.EPS
+	if eps == 0 && f.Values.NetIncome != 0 && sharesIssued > 0 {
+		eps = float64(f.Values.NetIncome) / float64(sharesIssued)
+	}
+	if lastPrice > 0 && eps > 0 {
+		v := lastPrice / eps
+		m.ForwardPER = &v
+	}
+
+	if f.Prev != nil {
+		if pct, ok := revisionPct(f.Values.OperatingIncome, f.Prev.OperatingIncome); ok {
+			m.GuidanceRevisionPct = &pct
+		} else if pct, ok := revisionPct(f.Values.NetIncome, f.Prev.NetIncome); ok {
+			m.GuidanceRevisionPct = &pct
+		}
+	}
+	return m
+}
+
+// revisionPct は前回値に対する変化率 (%)。前回値が 0 以下 (赤字予想) の場合は率が意味を持たないため算出しない
+func revisionPct(cur, prev int64) (float64, bool) {
+	if cur == 0 || prev <= 0 {
+		return 0, false
+	}
+	return math.Round(float64(cur-prev)/float64(prev)*1000) / 10, true
+}
+
+// forecastYearEnd は決算短信の決算期と予想の向きから、予想対象の決算期 (YYYY-MM) を返す
+func forecastYearEnd(fiscalYearEnd string, nextYear bool) string {
+	if fiscalYearEnd == "" || !nextYear {
+		return fiscalYearEnd
+	}
+	t, err := time.Parse("2006-01", fiscalYearEnd)
+	if err != nil {
+		return ""
+	}
+	return t.AddDate(1, 0, 0).Format("2006-01")
+}
+
+var (
+	revisionPrevRowRegex = regexp.MustCompile(`(?m)^[\s　]*前回(?:発表)?予想[^\n]*$`)
+	revisionCurRowRegex  = regexp.MustCompile(`(?m)^[\s　]*(?:今回(?:修正|発表)?予想|今回修正値|修正後予想)[^\n]*$`)
+	revisionNumRegex     = regexp.MustCompile(`[△▲]?[0-9,]+(?:\.[0-9]+)?|[－―‐]`)
+	// 列見出し (出現順で列を対応付ける)
+	revisionColumnLabels = []struct {
+		field  string
+		labels []string
+	}{
+		{"NetSales", []string{"売上高", "売上収益", "営業収益", "経常収益"}},
+		{"OperatingIncome", []string{"営業利益", "事業利益"}},
+		{"OrdinaryIncome", []string{"経常利益", "税引前"}},
+		{"NetIncome", []string{"当期純利益", "当期利益"}},
+		{"EPS", []string{"1株当たり", "１株当たり"}},
+	}
+)
+
+// parseForecastRevisionText は業績予想の修正 PDF テキストの「前回発表予想(A)」「今回修正予想(B)」行を読む。
+// 第2四半期累計と通期の2表がある場合は通期 (後ろの表) を採用する。
+// 「業績予想及び配当予想の修正」は業績予想の表の後に配当予想の表 (前回予想・今回修正予想) が続くので、
+// 後ろの表から順に見て、列が業績予想の見出しと揃う最初の表を使う
+func parseForecastRevisionText(text string) (cur, prev forecastValues, ok bool) {
+	prevLocs := revisionPrevRowRegex.FindAllStringIndex(text, -1)
+	for i := len(prevLocs) - 1; i >= 0; i-- {
+		// 見出し: 前回行の直前 (前の表の末尾〜) の範囲
+		headerStart := 0
+		if i > 0 {
+			headerStart = prevLocs[i-1][1]
+		}
+		if cur, prev, ok = parseForecastRevisionTable(text, headerStart, prevLocs[i]); ok {
+			return cur, prev, true
+		}
+	}
+	return forecastValues{}, forecastValues{}, false
+}
+
+// parseForecastRevisionTable は text[loc[0]:loc[1]] の前回行とその後の今回行を、text[headerStart:loc[0]] を見出しとして読む
+func parseForecastRevisionTable(text string, headerStart int, loc []int) (cur, prev forecastValues, ok bool) {
+	prevLine := text[loc[0]:loc[1]]
+	curLoc := revisionCurRowRegex.FindStringIndex(text[loc[1]:])
+	if curLoc == nil {
+		return cur, prev, false
+	}
+	curLine := text[loc[1]+curLoc[0] : loc[1]+curLoc[1]]
+
+	if loc[0]-headerStart > 1200 {
+		headerStart = loc[0] - 1200
+	}
+	header := text[headerStart:loc[0]]
+
+	multiplier := forecastUnitMultiplier(header)
+	fields := forecastColumns(header)
+
+	parseRow := func(line string) (forecastValues, bool) {
+		// 行ラベル中の "(A)" "(B)" は数値に含めない
+		line = strings.NewReplacer("（A）", "", "(A)", "", "（B）", "", "(B)", "").Replace(fullWidthDigits.Replace(line))
+		tokens := revisionNumRegex.FindAllString(line, -1)
+		if len(tokens) != len(fields) {
+			return forecastValues{}, false
+		}
+		return forecastRowValues(fields, tokens, multiplier), true
+	}
+
+	prev, okPrev := parseRow(prevLine)
+	cur, okCur := parseRow(curLine)
+	if !okPrev || !okCur || cur.isEmpty() {
+		return forecastValues{}, forecastValues{}, false
+	}
+	return cur, prev, true
+}
+
+// forecastUnitMultiplier は表の見出しの単位 (百万円・千円) の倍率。書かれていなければ百万円
+func forecastUnitMultiplier(header string) int64 {
+	if strings.Contains(header, "千円") && !strings.Contains(header, "百万円") {
+		return 1_000
+	}
+	return 1_000_000
+}
+
+// forecastColumns は業績予想の表の見出しから列の並び (revisionColumnLabels の field) を返す。
+// 見出しの表示桁位置 (pdftotext -layout の列) の順に列を並べる。見出しは2〜3行に折り返されるため
+// 行をまたいで桁位置で比較する。見出しが読めなければ日本基準の標準順 (売上・営利・経常・純利・EPS)
+// 「1株当たり当期純利益」にも「当期純利益」が含まれるので、各見出しは最も左の出現位置を使う
+func forecastColumns(header string) []string {
+	type col struct {
+		field string
+		pos   int
+	}
+	var cols []col
+	for _, c := range revisionColumnLabels {
+		pos := -1
+		for _, line := range strings.Split(header, "\n") {
+			for _, l := range c.labels {
+				for off := 0; ; {
+					i := strings.Index(line[off:], l)
+					if i < 0 {
+						break
+					}
+					if w := displayWidth(line[:off+i]); pos < 0 || w < pos {
+						pos = w
+					}
+					off += i + len(l)
+				}
+			}
+		}
+		if pos >= 0 {
+			cols = append(cols, col{c.field, pos})
+		}
+	}
+	sort.SliceStable(cols, func(i, j int) bool { return cols[i].pos < cols[j].pos })
+	fields := make([]string, 0, len(cols))
+	for _, c := range cols {
+		fields = append(fields, c.field)
+	}
+	if len(fields) == 0 {
+		fields = []string{"NetSales", "OperatingIncome", "OrdinaryIncome", "NetIncome", "EPS"}
+	}
+	return fields
+}
+
+// forecastRowValues は列 fields に対応する数値 tokens を読む (金額は multiplier 倍、－ は未定・非開示で 0)
+func forecastRowValues(fields, tokens []string, multiplier int64) forecastValues {
+	var v forecastValues
+	for i, tok := range tokens {
+		if strings.ContainsAny(tok, "－―‐") {
+			continue // 未定・非開示
+		}
+		switch fields[i] {
+		case "NetSales":
+			v.NetSales = parseJPNumber(tok) * multiplier
+		case "OperatingIncome":
+			v.OperatingIncome = parseJPNumber(tok) * multiplier
+		case "NetIncome":
+			v.NetIncome = parseJPNumber(tok) * multiplier
+		case "EPS":
+			v.EPS = parseJPDecimal(tok)
+		}
+	}
+	return v
+}
+
+var (
+	// 決算短信サマリーの予想の見出し: 「3．2026年3月期の連結業績予想（2025年4月1日～2026年3月31日）」
+	tanshinForecastHeadingRegex = regexp.MustCompile(`(?m)^[\s　]*(?:\d+[．.][\s　]*)?(\d{4})年[\s　]*(\d{1,2})月期の(?:連結|個別)?業績予想`)
+	tanshinForecastRowRegex     = regexp.MustCompile(`(?m)^[\s　]*通[\s　]*期[^\n]*$`)
+)
+
+// parseTanshinForecastText は決算短信 PDF テキストのサマリーの業績予想の表から通期の予想と予想対象の決算期 (YYYY-MM) を読む。
+// 通期の行は金額と増減率 (％) が交互に並び、1株当たり当期純利益だけは増減率が無い。増減率を載せない表にも対応する
+func parseTanshinForecastText(text string) (v forecastValues, fiscalYearEnd string, ok bool) {
+	text = fullWidthDigits.Replace(text)
+	m := tanshinForecastHeadingRegex.FindStringSubmatchIndex(text)
+	if m == nil {
+		return v, "", false
+	}
+	year, month := text[m[2]:m[3]], text[m[4]:m[5]]
+	if len(month) == 1 {
+		month = "0" + month
+	}
+	section := text[m[1]:min(len(text), m[1]+1500)]
+	loc := tanshinForecastRowRegex.FindStringIndex(section)
+	if loc == nil {
+		return v, "", false
+	}
+	header := section[:loc[0]]
+	row := strings.Replace(section[loc[0]:loc[1]], "通", "", 1)
+	row = strings.Replace(row, "期", "", 1)
+	tokens := revisionNumRegex.FindAllString(row, -1)
+
+	fields := forecastColumns(header)
+	amounts := len(fields)
+	if slices.Contains(fields, "EPS") {
+		amounts--
+	}
+	switch len(tokens) {
+	case len(fields):
+	case len(fields) + amounts:
+		// 金額の後ろの増減率を除く
+		values := make([]string, 0, len(fields))
+		j := 0
+		for _, f := range fields {
+			values = append(values, tokens[j])
+			j++
+			if f != "EPS" {
+				j++
+			}
+		}
+		tokens = values
+	default:
+		return v, "", false
+	}
+	v = forecastRowValues(fields, tokens, forecastUnitMultiplier(header))
+	if v.isEmpty() {
+		return v, "", false
+	}
+	return v, year + "-" + month, true
+}
+
+// displayWidth は等幅表示での桁数 (全角=2) を返す
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		if r >= 0x1100 && (r <= 0x115F || r >= 0x2E80) && !(r >= 0xFF61 && r <= 0xFFDC) {
+			w += 2
+		} else {
+			w++
+		}
+	}
+	return w
+}
+
+// parseJPDecimal は "123.45" "△12.30" 等を float64 に変換する (1株当たり金額用)
+func parseJPDecimal(s string) float64 {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	sign := 1.0
+	if strings.HasPrefix(s, "△") || strings.HasPrefix(s, "▲") {
+		sign = -1
+		s = strings.TrimLeft(s, "△▲")
+	}
+	var v float64
+	if _, err := fmt.Sscanf(s, "%g", &v); err != nil {
+		return 0
+	}
+	return v * sign
+}
+
+// saveEarningsForecast は決算短信 (サマリー XBRL・PDF) の業績予想を forecasts に保存する (予想が無ければ何もしない)。
+// 予想対象の決算期は、PDF の見出しから読めればそれを、無ければ決算期 fiscalYearEnd と予想の向きから求める
+func saveEarningsForecast(db *sql.DB, code, announcedAt, title, fiscalYearEnd string, s tanshinSummary) error {
+	v := forecastValues{
+		NetSales:         s.ForecastNetSales,
+		OperatingIncome:  s.ForecastOperatingIncome,
+		NetIncome:        s.ForecastNetIncome,
+		EPS:              s.ForecastEPS,
+		DividendPerShare: s.ForecastDividendPerShare,
+	}
+	fye := s.ForecastFiscalYearEnd
+	if fye == "" {
+		fye = forecastYearEnd(fiscalYearEnd, s.ForecastNextYear)
+	}
+	if v.isEmpty() || fye == "" {
+		return nil
+	}
+	return saveForecast(db, forecastRecord{
+		Code: code, AnnouncedAt: announcedAt, FiscalYearEnd: fye,
+		Source: "earnings", Title: title, Values: v,
+	})
+}
+
+// parseForecastRevisionsForDate は指定日の業績予想の修正開示を PDF からパースして forecasts に保存する
+func parseForecastRevisionsForDate(db *sql.DB, targetDate string) (saved, failed int) {
+	rows, err := db.Query(`
+		SELECT t.code, t.disclosure_datetime, t.title, t.pdf_url, COALESCE(t.fiscal_year_end, '')
+		FROM tdnet_disclosures t
+		WHERE t.disclosure_datetime LIKE ? || '%'
+		  AND t.doc_category IN (?, ?, ?)
+		  AND COALESCE(t.is_correction, 0) = 0
+		  AND COALESCE(t.pdf_url, '') != ''`,
+		targetDate, CategoryForecastUp, CategoryForecastDown, CategoryForecastRevision)
+	if err != nil {
+		fmt.Printf("⚠️ 業績予想の修正の取得失敗: %v\n", err)
+		return 0, 0
+	}
+	type target struct {
+		code, dt, title, url, fye string
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if rows.Scan(&t.code, &t.dt, &t.title, &t.url, &t.fye) == nil {
+			targets = append(targets, t)
+		}
+	}
+	rows.Close()
+
+	if len(targets) == 0 {
+		return 0, 0
+	}
+	fmt.Printf("\n📈 %s の業績予想の修正 %d件をパース...\n", targetDate, len(targets))
+
+	for i, t := range targets {
+		fmt.Printf("  [%d/%d] %s %s ... ", i+1, len(targets), t.code, t.title)
+		pdfPath, err := downloadPDF(t.url)
+		if err != nil {
+			fmt.Printf("DL失敗: %v\n", err)
+			failed++
+			continue
+		}
+		text, err := extractPDFText(pdfPath)
+		os.Remove(pdfPath) // 一時ファイル削除
+		if err != nil {
+			fmt.Printf("テキスト抽出失敗: %v\n", err)
+			failed++
+			continue
+		}
+
+		cur, prev, ok := parseForecastRevisionText(text)
+		if !ok {
+			fmt.Println("修正表が見つかりません")
+			failed++
+			continue
+		}
+
+		// 決算期: 表題 → 本文 → 同銘柄の既存予想 の順に決める
+		fye := t.fye
+		if fye == "" {
+			fye = detectFiscalYearEnd(text)
+		}
+		if fye == "" {
+			db.QueryRow(`SELECT fiscal_year_end FROM forecasts WHERE code = ? AND announced_at < ?
+				ORDER BY announced_at DESC LIMIT 1`, t.code, t.dt).Scan(&fye)
+		}
+
+		err = saveForecast(db, forecastRecord{
+			Code: t.code, AnnouncedAt: t.dt, FiscalYearEnd: fye,
+			Source: "revision", Title: t.title, Values: cur, Prev: &prev,
+		})
+		if err != nil {
+			fmt.Printf("保存失敗: %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf("✅ %s 営利 %d → %d\n", fye, prev.OperatingIncome, cur.OperatingIncome)
+		saved++
+		time.Sleep(500 * time.Millisecond)
+	}
+	return saved, failed
+}
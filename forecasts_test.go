@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseForecastRevisionText(t *testing.T) {
+	cases := []struct {
+		file      string
+		cur, prev forecastValues
+	}{
+		{
+			// 第2四半期累計と通期の2表 → 通期を採用
+			file: "jgaap_two_tables.txt",
+			prev: forecastValues{NetSales: 100_000_000_000, OperatingIncome: 8_000_000_000, NetIncome: 5_000_000_000, EPS: 50},
+			cur:  forecastValues{NetSales: 110_000_000_000, OperatingIncome: 9_500_000_000, NetIncome: 6_000_000_000, EPS: 60},
+		},
+		{
+			// IFRS・千円単位、赤字転落、未定 (－) の項目は 0
+			file: "ifrs_undisclosed.txt",
+			prev: forecastValues{NetSales: 5_000_000_000, OperatingIncome: 600_000_000, NetIncome: 400_000_000, EPS: 40},
+			cur:  forecastValues{NetSales: 4_600_000_000, OperatingIncome: -150_000_000},
+		},
+		{
+			// 業績予想及び配当予想の修正 (配当の修正のテストと同じ開示): 後ろの配当予想の表ではなく業績予想の表
+			file: filepath.Join("..", "dividend", "combined_forecast_revision.txt"),
+			prev: forecastValues{NetSales: 80_000_000_000, OperatingIncome: 6_000_000_000, NetIncome: 4_000_000_000, EPS: 80},
+			cur:  forecastValues{NetSales: 86_000_000_000, OperatingIncome: 7_200_000_000, NetIncome: 4_900_000_000, EPS: 98},
+		},
+	}
+	for _, c := range cases {
+		text, err := os.ReadFile(filepath.Join("testdata", "forecast_revision", c.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cur, prev, ok := parseForecastRevisionText(string(text))
+		if !ok {
+			t.Errorf("%s: 修正表が見つからない", c.file)
+			continue
+		}
+		if cur != c.cur {
+			t.Errorf("%s: cur = %+v, want %+v", c.file, cur, c.cur)
+		}
+		if prev != c.prev {
+			t.Errorf("%s: prev = %+v, want %+v", c.file, prev, c.prev)
+		}
+	}
+
+	if _, _, ok := parseForecastRevisionText("代表取締役の異動に関するお知らせ"); ok {
+		t.Error("修正表の無いテキストで ok=true")
+	}
+}
+
+func TestParseTanshinForecastText(t *testing.T) {
+	cases := []struct {
+		file string
+		fye  string
+		want forecastValues
+	}{
+		{
+			// 第2四半期累計と通期 → 通期、増減率は読み飛ばす
+			file: "annual_jgaap.txt",
+			fye:  "2026-03",
+			want: forecastValues{NetSales: 130_000_000_000, OperatingIncome: 13_000_000_000, NetIncome: 9_000_000_000, EPS: 90.5},
+		},
+		{
+			// 千円単位・全角数字の見出し、赤字予想と未定 (－)
+			file: "quarterly_thousand_yen.txt",
+			fye:  "2026-06",
+			want: forecastValues{NetSales: 3_200_000_000, OperatingIncome: -50_000_000},
+		},
+	}
+	for _, c := range cases {
+		text, err := os.ReadFile(filepath.Join("testdata", "tanshin_forecast", c.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, fye, ok := parseTanshinForecastText(string(text))
+		if !ok {
+			t.Errorf("%s: 業績予想の表が見つからない", c.file)
+			continue
+		}
+		if got != c.want || fye != c.fye {
+			t.Errorf("%s: %+v (%s), want %+v (%s)", c.file, got, fye, c.want, c.fye)
+		}
+	}
+
+	if _, _, ok := parseTanshinForecastText("2026年3月期の業績予想につきましては、現時点で合理的な算定が困難なため未定とします。"); ok {
+		t.Error("表の無いテキストで ok=true")
+	}
+}
+
+func TestCalcForecastMetrics(t *testing.T) {
+	f := forecastRecord{
+		Values: forecastValues{OperatingIncome: 9_500_000_000, NetIncome: 6_000_000_000, EPS: 60},
+		Prev:   &forecastValues{OperatingIncome: 8_000_000_000, NetIncome: 5_000_000_000, EPS: 50},
+	}
+	m := calcForecastMetrics(f, 1200, 100_000_000)
+	if m.ForwardPER == nil || *m.ForwardPER != 20 {
+		t.Errorf("ForwardPER = %v, want 20", m.ForwardPER)
+	}
+	if m.GuidanceRevisionPct == nil || *m.GuidanceRevisionPct != 18.8 {
+		t.Errorf("GuidanceRevisionPct = %v, want 18.8", m.GuidanceRevisionPct)
+	}
+
+	// 予想EPSが無ければ予想純利益 / 発行済株式数、期初予想 (前回なし) は修正率なし
+	f = forecastRecord{Values: forecastValues{NetIncome: 6_000_000_000}}
+	m = calcForecastMetrics(f, 1200, 100_000_000)
+	if m.ForwardPER == nil || *m.ForwardPER != 20 {
+		t.Errorf("ForwardPER (純利益から) = %v, want 20", m.ForwardPER)
+	}
+	if m.GuidanceRevisionPct != nil {
+		t.Errorf("GuidanceRevisionPct = %v, want nil", *m.GuidanceRevisionPct)
+	}
+}
+
+func TestForecastYearEnd(t *testing.T) {
+	if got := forecastYearEnd("2025-03", true); got != "2026-03" {
+		t.Errorf("来期 = %q, want 2026-03", got)
+	}
+	if got := forecastYearEnd("2025-12", false); got != "2025-12" {
+		t.Errorf("今期 = %q, want 2025-12", got)
+	}
+}
@@ -1,10 +1,15 @@
 module stock-analyzer
 
-go 1.24.0
+go 1.24.1
 
 toolchain go1.24.11
 
-require modernc.org/sqlite v1.43.0
+require (
+	github.com/ledongthuc/pdf v0.0.0-20250511090121-5959a4027728
+	golang.org/x/net v0.43.0
+	golang.org/x/text v0.28.0
+	modernc.org/sqlite v1.43.0
+)
 
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
@@ -12,7 +12,11 @@ func registerCycleRanking() {
 	http.HandleFunc("/api/cycle-ranking", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 
-		if cached, ok := cacheGet("api:cycle-ranking"); ok {
+		// RS は ?rs_profile= のプロファイル (省略時は default)
+		rsProfile := rsProfileParam(r)
+		cacheKey := "api:cycle-ranking:" + rsProfile
+
+		if cached, ok := cacheGet(cacheKey); ok {
 			w.Header().Set("Content-Type", "application/json")
 			w.Header().Set("X-Cache", "HIT")
 			w.Write(cached)
@@ -45,8 +49,8 @@ func registerCycleRanking() {
 		// 1. 当日の最新 RS を一括取得
 		rsNow := make(map[string]int)
 		rows, err := db.Query(`
-			SELECT code, rs_rank FROM rs_db.rs_scores rs1
-			WHERE date = (SELECT MAX(date) FROM rs_db.rs_scores rs2 WHERE rs2.code = rs1.code)`)
+			SELECT code, rs_rank FROM (
+				SELECT code, rs_rank, MAX(date) FROM rs_db.rs_scores WHERE profile = ? GROUP BY code)`, rsProfile)
 		if err == nil {
 			for rows.Next() {
 				var c string
@@ -61,8 +65,8 @@ func registerCycleRanking() {
 		// 2. 約30日前の RS (各 code の最新日 - 30日 以前で最新)
 		// 簡易実装: 全 rs_scores から最大日付を取り、その30日前を target にして集計
 		var maxDate string
-		db.QueryRow("SELECT MAX(date) FROM rs_db.rs_scores").Scan(&maxDate)
-		past := time.Now().AddDate(0, 0, -30).Format("2006-01-02")
+		db.QueryRow("SELECT MAX(date) FROM rs_db.rs_scores WHERE profile = ?", rsProfile).Scan(&maxDate)
+		past := nowJST().AddDate(0, 0, -30).Format("2006-01-02")
 		if maxDate != "" {
 			t, perr := time.Parse("2006-01-02", maxDate)
 			if perr == nil {
@@ -71,8 +75,9 @@ func registerCycleRanking() {
 		}
 		rsPast := make(map[string]int)
 		rows, err = db.Query(`
-			SELECT code, rs_rank FROM rs_db.rs_scores rs1
-			WHERE date = (SELECT MAX(date) FROM rs_db.rs_scores rs2 WHERE rs2.code = rs1.code AND rs2.date <= ?)`, past)
+			SELECT code, rs_rank FROM (
+				SELECT code, rs_rank, MAX(date) FROM rs_db.rs_scores
+				WHERE profile = ? AND date <= ? GROUP BY code)`, rsProfile, past)
 		if err == nil {
 			for rows.Next() {
 				var c string
@@ -190,7 +195,7 @@ func registerCycleRanking() {
 			http.Error(w, "json marshal: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-		cacheSet("api:cycle-ranking", body, 60*time.Second)
+		cacheSet(cacheKey, body, 60*time.Second)
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("X-Cache", "MISS")
 		w.Write(body)
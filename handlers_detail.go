@@ -33,12 +33,20 @@ func registerDetailHandlers() {
 			TotalAssets     int64  `json:"total_assets"`
 			NetAssets       int64  `json:"net_assets"`
 			SharesIssued    int64  `json:"shares_issued"`
+			FiscalYearEnd   string `json:"fiscal_year_end"` // 決算短信のみ (YYYY-MM)
+			FiscalPeriod    string `json:"fiscal_period"`   // 決算短信のみ (Q1 / Q2 / Q3 / FY)
+			PriorNetSales   int64  `json:"prior_net_sales"`
+			PriorNetIncome  int64  `json:"prior_net_income"`
+			ReconciledDate  string `json:"reconciled_date"` // 決算短信のみ: 突合した報告書の提出日
 		}
 
 		rows, err := db.Query(`
 			SELECT doc_type, submission_date, COALESCE(doc_description, ''),
 			       COALESCE(net_sales, 0), COALESCE(operating_income, 0), COALESCE(net_income, 0),
-			       COALESCE(total_assets, 0), COALESCE(net_assets, 0), COALESCE(shares_issued, 0)
+			       COALESCE(total_assets, 0), COALESCE(net_assets, 0), COALESCE(shares_issued, 0),
+			       COALESCE(fiscal_year_end, ''), COALESCE(fiscal_period, ''),
+			       COALESCE(prior_net_sales, 0), COALESCE(prior_net_income, 0),
+			       COALESCE(reconciled_date, '')
 			FROM stock_financials
 			WHERE code = ?
 			ORDER BY submission_date ASC`, code)
@@ -54,7 +62,10 @@ func registerDetailHandlers() {
 			var p FinancialPoint
 			if err := rows.Scan(&p.DocType, &p.SubmissionDate, &p.DocDescription,
 				&p.NetSales, &p.OperatingIncome, &p.NetIncome,
-				&p.TotalAssets, &p.NetAssets, &p.SharesIssued); err != nil {
+				&p.TotalAssets, &p.NetAssets, &p.SharesIssued,
+				&p.FiscalYearEnd, &p.FiscalPeriod,
+				&p.PriorNetSales, &p.PriorNetIncome,
+				&p.ReconciledDate); err != nil {
 				continue
 			}
 			points = append(points, p)
@@ -84,15 +95,38 @@ func registerDetailHandlers() {
 			DisclosureDateTime string `json:"disclosure_datetime"`
 			Title              string `json:"title"`
 			DocCategory        string `json:"doc_category"`
+			CategoryLabel      string `json:"category_label"`
+			FiscalYearEnd      string `json:"fiscal_year_end,omitempty"`
+			FiscalPeriod       string `json:"fiscal_period,omitempty"`
+			IsCorrection       bool   `json:"is_correction"`
 			PdfURL             string `json:"pdf_url"`
 		}
 
-		rows, err := db.Query(`
-			SELECT disclosure_datetime, COALESCE(title,''), COALESCE(doc_category,''), COALESCE(pdf_url,'')
+		// ?category=earnings,forecast_up のようにカンマ区切りでカテゴリを絞り込める
+		query := `
+			SELECT disclosure_datetime, COALESCE(title,''), COALESCE(doc_category,''),
+			       COALESCE(fiscal_year_end,''), COALESCE(fiscal_period,''), COALESCE(is_correction,0),
+			       COALESCE(pdf_url,'')
 			FROM tdnet_disclosures
-			WHERE code = ?
+			WHERE code = ?`
+		args := []any{code}
+		if cats := r.URL.Query().Get("category"); cats != "" {
+			var placeholders []string
+			for _, c := range strings.Split(cats, ",") {
+				if c = strings.TrimSpace(c); c != "" {
+					placeholders = append(placeholders, "?")
+					args = append(args, c)
+				}
+			}
+			if len(placeholders) > 0 {
+				query += " AND doc_category IN (" + strings.Join(placeholders, ",") + ")"
+			}
+		}
+		query += `
 			ORDER BY disclosure_datetime DESC
-			LIMIT 50`, code)
+			LIMIT 50`
+
+		rows, err := db.Query(query, args...)
 		if err != nil {
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode([]Disclosure{})
@@ -103,9 +137,11 @@ func registerDetailHandlers() {
 		var items []Disclosure
 		for rows.Next() {
 			var d Disclosure
-			if err := rows.Scan(&d.DisclosureDateTime, &d.Title, &d.DocCategory, &d.PdfURL); err != nil {
+			if err := rows.Scan(&d.DisclosureDateTime, &d.Title, &d.DocCategory,
+				&d.FiscalYearEnd, &d.FiscalPeriod, &d.IsCorrection, &d.PdfURL); err != nil {
 				continue
 			}
+			d.CategoryLabel = disclosureCategoryLabels[d.DocCategory]
 			items = append(items, d)
 		}
 
@@ -113,12 +149,118 @@ func registerDetailHandlers() {
 		json.NewEncoder(w).Encode(items)
 	})
 
-	// 市場指数データAPI（市場天井検出用）
-	http.HandleFunc("/api/market-index/", func(w http.ResponseWriter, r *http.Request) {
+	// 個別銘柄の会社業績予想の履歴API (開示日時の昇順)
+	http.HandleFunc("/api/forecasts/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
+		code := strings.TrimPrefix(r.URL.Path, "/api/forecasts/")
+		if code == "" {
+			http.Error(w, "code required", http.StatusBadRequest)
+			return
+		}
+
+		db, err := openServerDB()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer db.Close()
+
+		type ForecastPoint struct {
+			AnnouncedAt          string   `json:"announced_at"`
+			FiscalYearEnd        string   `json:"fiscal_year_end"`
+			Source               string   `json:"source"`
+			Title                string   `json:"title"`
+			NetSales             int64    `json:"net_sales"`
+			OperatingIncome      int64    `json:"operating_income"`
+			NetIncome            int64    `json:"net_income"`
+			EPS                  float64  `json:"eps"`
+			DividendPerShare     float64  `json:"dividend_per_share"`
+			PrevNetSales         *int64   `json:"prev_net_sales"`
+			PrevOperatingIncome  *int64   `json:"prev_operating_income"`
+			PrevNetIncome        *int64   `json:"prev_net_income"`
+			PrevEPS              *float64 `json:"prev_eps"`
+			PrevDividendPerShare *float64 `json:"prev_dividend_per_share"`
+			RevisionPct          *float64 `json:"revision_pct"` // 営業利益 (無ければ純利益) の前回比
+		}
+
+		records, err := loadForecasts(db, code)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode([]ForecastPoint{})
+			return
+		}
+
+		points := make([]ForecastPoint, 0, len(records))
+		for _, f := range records {
+			p := ForecastPoint{
+				AnnouncedAt:      f.AnnouncedAt,
+				FiscalYearEnd:    f.FiscalYearEnd,
+				Source:           f.Source,
+				Title:            f.Title,
+				NetSales:         f.Values.NetSales,
+				OperatingIncome:  f.Values.OperatingIncome,
+				NetIncome:        f.Values.NetIncome,
+				EPS:              f.Values.EPS,
+				DividendPerShare: f.Values.DividendPerShare,
+			}
+			if f.Prev != nil {
+				prev := *f.Prev
+				p.PrevNetSales = &prev.NetSales
+				p.PrevOperatingIncome = &prev.OperatingIncome
+				p.PrevNetIncome = &prev.NetIncome
+				p.PrevEPS = &prev.EPS
+				p.PrevDividendPerShare = &prev.DividendPerShare
+				p.RevisionPct = calcForecastMetrics(f, 0, 0).GuidanceRevisionPct
+			}
+			points = append(points, p)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(points)
+	})
+
+	// 市場指数の一覧API (登録済みの指数と保存済みの期間)
+	marketIndexList := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		db, err := openServerDB()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer db.Close()
+		coverage := loadIndexCoverage(db, "price_db.")
+
+		type IndexInfo struct {
+			Code     string `json:"code"`
+			Name     string `json:"name"`
+			Note     string `json:"note,omitempty"`
+			Count    int    `json:"count"`
+			FromDate string `json:"from_date,omitempty"`
+			ToDate   string `json:"to_date,omitempty"`
+		}
+		list := make([]IndexInfo, 0, len(marketIndices))
+		for _, idx := range marketIndices {
+			c := coverage[idx.Code]
+			list = append(list, IndexInfo{Code: idx.Code, Name: idx.Name, Note: idx.Note, Count: c.Count, FromDate: c.FromDate, ToDate: c.ToDate})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+	http.HandleFunc("/api/market-index", marketIndexList)
+
+	// 市場指数データAPI（市場天井検出用）。登録外のコードは銘柄の株価を返す
+	http.HandleFunc("/api/market-index/", func(w http.ResponseWriter, r *http.Request) {
 		code := strings.TrimPrefix(r.URL.Path, "/api/market-index/")
 		if code == "" {
-			code = "^NKX" // デフォルトは日経225
+			marketIndexList(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		table := "price_db.stock_prices"
+		if _, ok := findMarketIndex(code); ok {
+			table = "price_db.index_prices"
 		}
 
 		db, err := openServerDB()
@@ -130,11 +272,11 @@ func registerDetailHandlers() {
 
 		// 直近2年分に制限 (市場天井検出には十分。全期間は数十万行で重い)
 		rows, err := db.Query(`
-			SELECT code, date, open, high, low, close, volume
-			FROM price_db.stock_prices
+			SELECT code, date, open, high, low, close, COALESCE(volume, 0)
+			FROM `+table+`
 			WHERE code = ?
-			  AND date >= date('now', '-730 days')
-			ORDER BY date ASC`, code)
+			  AND date >= ?
+			ORDER BY date ASC`, code, nowJST().AddDate(0, 0, -730).Format("2006-01-02"))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -10,6 +10,8 @@ import (
 func registerDividendRanking() {
 	// 高配当API: 配当利回り + 持続性 (100点満点)
 	// 配点: 配当利回り(40) + 配当性向(20) + 連続非減配年数(20) + 自己資本率(10) + ROE(10)
+	// 配当利回り・配当性向は会社の予想配当 (配当予想の修正・決算短信) があればそれを使い、無ければ年次実績
+	// 連続非減配年数は実績のみで判定する
 	http.HandleFunc("/api/dividend-ranking", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 
@@ -34,11 +36,14 @@ func registerDividendRanking() {
 			LastPrice        float64  `json:"LastPrice"`
 			MarketCap        int64    `json:"MarketCap"`
 			NetIncome        int64    `json:"NetIncome"`
-			DividendPerShare float64  `json:"DividendPerShare"`
-			DividendYield    *float64 `json:"DividendYield"` // DPS / 株価 * 100
-			PayoutRatio      *float64 `json:"PayoutRatio"`   // DPS / EPS * 100
-			NoCutYears       int      `json:"NoCutYears"`    // 連続非減配年数
-			DPSHistory       int      `json:"DPSHistory"`    // 過去年数 (連続性判定の母数)
+			DividendPerShare float64  `json:"DividendPerShare"` // 利回り計算に使った DPS (予想があれば予想)
+			TrailingDPS      float64  `json:"TrailingDPS"`      // 年次 XBRL の実績 DPS
+			ForwardDPS       *float64 `json:"ForwardDPS"`       // 会社予想の年間 DPS
+			DPSSource        string   `json:"DPSSource"`        // forecast / annual
+			DividendYield    *float64 `json:"DividendYield"`    // DPS / 株価 * 100
+			PayoutRatio      *float64 `json:"PayoutRatio"`      // DPS / EPS * 100
+			NoCutYears       int      `json:"NoCutYears"`       // 連続非減配年数
+			DPSHistory       int      `json:"DPSHistory"`       // 過去年数 (連続性判定の母数)
 			EPS              *float64 `json:"EPS"`
 			ROE              *float64 `json:"ROE"`
 			PER              *float64 `json:"PER"`
@@ -53,6 +58,10 @@ func registerDividendRanking() {
 		// 連続非減配年数を時系列から計算するため事前ロード
 		financialsMap, _ := loadAllFinancials(db)
 
+		// 予想配当・予想EPS (メインクエリ前にロード)
+		forwardDPSMap, _ := loadForwardDividends(db)
+		forecastMap, _ := loadLatestForecasts(db)
+
 		rows, err := db.Query(`
 			SELECT s.code, s.name, COALESCE(s.updated_at, ''),
 				   COALESCE(s.net_income, 0),
@@ -67,7 +76,6 @@ func registerDividendRanking() {
 				SELECT code, close FROM price_db.stock_prices sp1
 				WHERE date = (SELECT MAX(date) FROM price_db.stock_prices sp2 WHERE sp2.code = sp1.code)
 			) p ON s.code = p.code
-			WHERE s.dividend_per_share > 0
 			ORDER BY s.code ASC`)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -91,12 +99,26 @@ func registerDividendRanking() {
 				continue
 			}
 
+			// 予想配当があれば優先 (期中の増配・記念配当を反映)
+			trailingDPS := dps
+			source := "annual"
+			fwd, hasForward := forwardDPSMap[s.Code]
+			if hasForward {
+				dps = fwd.DPS
+				source = "forecast"
+			}
+			if dps <= 0 {
+				continue
+			}
+
 			ds := DivStock{
 				Code:             s.Code,
 				Name:             s.Name,
 				LastPrice:        lastPrice,
 				NetIncome:        s.NetIncome,
 				DividendPerShare: dps,
+				TrailingDPS:      trailingDPS,
+				DPSSource:        source,
 				MarketSegment:    marketSegment,
 				Sector33:         sector33,
 				Sector17:         sector17,
@@ -117,9 +139,18 @@ func registerDividendRanking() {
 				ds.DividendYield = &v
 			}
 
-			// 配当性向
-			if ds.EPS != nil && *ds.EPS > 0 && dps > 0 {
-				v := dps / *ds.EPS * 100
+			if hasForward {
+				v := fwd.DPS
+				ds.ForwardDPS = &v
+			}
+
+			// 配当性向 (予想配当には予想EPSを対応させる。予想EPSが無ければ実績EPS)
+			eps := ds.EPS
+			if f, ok := forecastMap[s.Code]; ok && hasForward && f.Values.EPS > 0 {
+				eps = &f.Values.EPS
+			}
+			if eps != nil && *eps > 0 && dps > 0 {
+				v := dps / *eps * 100
 				ds.PayoutRatio = &v
 			}
 
@@ -13,8 +13,12 @@ func registerOneilRanking() {
 	http.HandleFunc("/api/oneil-ranking", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 
+		// RS は ?rs_profile= のプロファイル (省略時は default)
+		rsProfile := rsProfileParam(r)
+		cacheKey := "api:oneil-ranking:" + rsProfile
+
 		// キャッシュチェック (60秒TTL)
-		if cached, ok := cacheGet("api:oneil-ranking"); ok {
+		if cached, ok := cacheGet(cacheKey); ok {
 			w.Header().Set("Content-Type", "application/json")
 			w.Header().Set("X-Cache", "HIT")
 			w.Write(cached)
@@ -46,6 +50,7 @@ func registerOneilRanking() {
 			Sector33      string   `json:"Sector33,omitempty"`
 			Sector17      string   `json:"Sector17,omitempty"`
 			GrowthMetrics
+			ForecastMetrics
 			UpdatedAt string `json:"UpdatedAt"`
 		}
 
@@ -53,8 +58,8 @@ func registerOneilRanking() {
 		// RS値を一括取得
 		rsMap := make(map[string]float64)
 		rsRows, rsErr := db.Query(`
-			SELECT code, rs_rank FROM rs_db.rs_scores rs1
-			WHERE date = (SELECT MAX(date) FROM rs_db.rs_scores rs2 WHERE rs2.code = rs1.code)`)
+			SELECT code, rs_rank FROM (
+				SELECT code, rs_rank, MAX(date) FROM rs_db.rs_scores WHERE profile = ? GROUP BY code)`, rsProfile)
 		if rsErr == nil {
 			for rsRows.Next() {
 				var code string
@@ -69,6 +74,9 @@ func registerOneilRanking() {
 		// 成長指標用の時系列データを一括ロード
 		financialsMap, _ := loadAllFinancials(db)
 
+		// 会社予想 (予想PER・修正率用)
+		forecastMap, _ := loadLatestForecasts(db)
+
 		// メインクエリ (補助データロード後)
 		rows, err := db.Query(`
 			SELECT s.code, s.name, COALESCE(s.updated_at, ''),
@@ -137,6 +145,9 @@ func registerOneilRanking() {
 			if records, ok := financialsMap[s.Code]; ok {
 				os.GrowthMetrics = calcGrowthMetrics(records)
 			}
+			if f, ok := forecastMap[s.Code]; ok {
+				os.ForecastMetrics = calcForecastMetrics(f, lastPrice, s.SharesIssued)
+			}
 
 			// スコア計算（オニール成長株に近いウェイト付け）
 			// ROE, PER, PBR, EquityRatio, RS に加え Q0 EPS YoY を重視
@@ -229,7 +240,7 @@ func registerOneilRanking() {
 			http.Error(w, "json marshal: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-		cacheSet("api:oneil-ranking", body, 60*time.Second)
+		cacheSet(cacheKey, body, 60*time.Second)
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("X-Cache", "MISS")
 		w.Write(body)
@@ -5,14 +5,19 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 )
 
 func registerStockHandlers() {
 	http.HandleFunc("/api/stocks", func(w http.ResponseWriter, r *http.Request) {
+		// RS は ?rs_profile= のプロファイル (省略時は default)
+		rsProfile := rsProfileParam(r)
+		cacheKey := "api:stocks:" + rsProfile
+
 		// キャッシュチェック (60秒TTL)
-		if cached, ok := cacheGet("api:stocks"); ok {
+		if cached, ok := cacheGet(cacheKey); ok {
 			w.Header().Set("Content-Type", "application/json")
 			w.Header().Set("X-Cache", "HIT")
 			w.Write(cached)
@@ -39,6 +44,8 @@ func registerStockHandlers() {
 			NetNetRatio *float64 `json:"NetNetRatio"`
 			RS          *float64 `json:"RS"`
 			GrowthMetrics
+			ForecastMetrics
+			BuybackMetrics
 		}
 
 		// 重要: SetMaxOpenConns(1) のため、メインの rows を開く前に
@@ -48,8 +55,8 @@ func registerStockHandlers() {
 		// RS値を一括取得してマップに格納
 		rsMap := make(map[string]float64)
 		rsRows, rsErr := db.Query(`
-			SELECT code, rs_rank FROM rs_db.rs_scores rs1
-			WHERE date = (SELECT MAX(date) FROM rs_db.rs_scores rs2 WHERE rs2.code = rs1.code)`)
+			SELECT code, rs_rank FROM (
+				SELECT code, rs_rank, MAX(date) FROM rs_db.rs_scores WHERE profile = ? GROUP BY code)`, rsProfile)
 		if rsErr != nil {
 			log.Printf("⚠️ /api/stocks RS query error: %v", rsErr)
 		} else {
@@ -73,6 +80,18 @@ func registerStockHandlers() {
 		// 成長指標用の時系列データを一括ロード (内部で Query→Close 完結)
 		financialsMap, _ := loadAllFinancials(db)
 
+		// 会社予想 (予想PER・修正率用)
+		forecastMap, err := loadLatestForecasts(db)
+		if err != nil {
+			log.Printf("⚠️ /api/stocks forecasts query error: %v", err)
+		}
+
+		// 自社株買い (取得実績・実施中の取得枠)
+		buybackMap, err := loadBuybackSummaries(db, nowJST())
+		if err != nil {
+			log.Printf("⚠️ /api/stocks buybacks query error: %v", err)
+		}
+
 		// メインクエリ (補助データロード後に実行)
 		rows, err := db.Query(`
 			SELECT s.code, s.name, COALESCE(s.updated_at, ''),
@@ -137,6 +156,12 @@ func registerStockHandlers() {
 			if records, ok := financialsMap[s.Code]; ok {
 				s.GrowthMetrics = calcGrowthMetrics(records)
 			}
+			if f, ok := forecastMap[s.Code]; ok {
+				s.ForecastMetrics = calcForecastMetrics(f, s.LastPrice, s.SharesIssued)
+			}
+			if b, ok := buybackMap[s.Code]; ok {
+				s.BuybackMetrics = calcBuybackMetrics(b, s.LastPrice, s.MarketCap)
+			}
 
 			stocks = append(stocks, s)
 		}
@@ -146,13 +171,13 @@ func registerStockHandlers() {
 			http.Error(w, "json marshal: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-		cacheSet("api:stocks", body, 60*time.Second)
+		cacheSet(cacheKey, body, 60*time.Second)
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("X-Cache", "MISS")
 		w.Write(body)
 	})
 
-	// 個別銘柄の株価履歴API
+	// 個別銘柄の株価履歴API (日足・週足・月足)
 	http.HandleFunc("/api/prices/", func(w http.ResponseWriter, r *http.Request) {
 		code := strings.TrimPrefix(r.URL.Path, "/api/prices/")
 		if code == "" {
@@ -167,29 +192,63 @@ func registerStockHandlers() {
 		}
 		defer db.Close()
 
-		rows, err := db.Query(`
-			SELECT code, date, open, high, low, close, volume
-			FROM price_db.stock_prices
-			WHERE code = ?
-			ORDER BY date DESC
-			LIMIT 365`, code)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		// ?interval=1w|1mo で週足・月足 (既定は日足)、?from=&to= で期間 (YYYY-MM-DD)
+		q := r.URL.Query()
+		interval := q.Get("interval")
+		if interval == "" {
+			interval = PriceInterval1d
+		}
+		if !validPriceInterval(interval) {
+			http.Error(w, "interval must be 1d, 1w or 1mo", http.StatusBadRequest)
 			return
 		}
-		defer rows.Close()
+		from, to := q.Get("from"), q.Get("to")
+		for _, d := range []string{from, to} {
+			if _, err := time.Parse("2006-01-02", d); d != "" && err != nil {
+				http.Error(w, "from/to must be YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
 
-		var prices []StockPrice
-		for rows.Next() {
-			var p StockPrice
-			if err := rows.Scan(&p.Code, &p.Date, &p.Open, &p.High, &p.Low, &p.Close, &p.Volume); err != nil {
-				continue
+		// 既定は分割・併合の調整後。?adjusted=0 で取得元の生の値 (接続が1本なので株価のクエリより先に読む)
+		var adjuster priceAdjuster
+		if q.Get("adjusted") != "0" {
+			adjuster = loadPriceAdjuster(db, "price_db.")
+		}
+
+		// 期間の指定が無ければ日足は直近365本、週足は2年、月足は10年
+		if from == "" && to == "" && interval != PriceInterval1d {
+			years := 2
+			if interval == PriceInterval1mo {
+				years = 10
+			}
+			from = nowJST().AddDate(-years, 0, 0).Format("2006-01-02")
+		}
+
+		var result any
+		if interval == PriceInterval1d {
+			prices, err := loadDailyPrices(db, "price_db.", code, from, to, adjuster)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
-			prices = append(prices, p)
+			if from == "" && to == "" && len(prices) > 365 {
+				prices = prices[len(prices)-365:]
+			}
+			slices.Reverse(prices) // 従来どおり新しい順
+			result = prices
+		} else {
+			bars, err := loadPriceBars(db, "price_db.", code, interval, from, to, adjuster, tradingCalendar)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			slices.Reverse(bars)
+			result = bars
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(prices)
+		json.NewEncoder(w).Encode(result)
 	})
 
 	// RS推移履歴API
@@ -213,11 +272,14 @@ func registerStockHandlers() {
 			RSRank float64 `json:"rs_rank"`
 		}
 
+		// 直近365日分 (calc-rs -from で過去分を埋めると1年より長くなる)
 		rows, err := db.Query(`
-			SELECT date, rs_rank FROM rs_db.rs_scores
-			WHERE code = ?
-			ORDER BY date ASC
-			LIMIT 365`, code)
+			SELECT date, rs_rank FROM (
+				SELECT date, rs_rank FROM rs_db.rs_scores
+				WHERE profile = ? AND code = ?
+				ORDER BY date DESC
+				LIMIT 365)
+			ORDER BY date ASC`, rsProfileParam(r), code)
 		if err != nil {
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode([]RSPoint{})
@@ -238,6 +300,51 @@ func registerStockHandlers() {
 		json.NewEncoder(w).Encode(points)
 	})
 
+	// RS プロファイル一覧API (calc-rs で計算したもの)。各 API の ?rs_profile= に id を渡す
+	http.HandleFunc("/api/rs-profiles", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		db, err := openServerDB()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer db.Close()
+
+		type ProfileInfo struct {
+			rsProfile
+			UpdatedAt  string `json:"updated_at"`
+			LatestDate string `json:"latest_date,omitempty"`
+		}
+		latest := make(map[string]string)
+		if rows, err := db.Query(`SELECT profile, MAX(date) FROM rs_db.rs_scores GROUP BY profile`); err == nil {
+			for rows.Next() {
+				var id, d string
+				if rows.Scan(&id, &d) == nil {
+					latest[id] = d
+				}
+			}
+			rows.Close()
+		}
+
+		list := []ProfileInfo{}
+		rows, err := db.Query(`SELECT definition, COALESCE(updated_at, '') FROM rs_db.rs_profiles ORDER BY id = 'default' DESC, id`)
+		if err == nil {
+			defer rows.Close()
+			for rows.Next() {
+				var def string
+				var p ProfileInfo
+				if rows.Scan(&def, &p.UpdatedAt) != nil || json.Unmarshal([]byte(def), &p.rsProfile) != nil {
+					continue
+				}
+				p.LatestDate = latest[p.ID]
+				list = append(list, p)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	})
+
 	// 特定日基準のスナップショットAPI（ネットネット分析の遡及計算用）
 	// 指定日以前の最新株価を採用し、ネットネット比率等を再計算する
 	http.HandleFunc("/api/stocks-as-of/", func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,567 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+// 証券会社・データベンダーの CSV からの株価取り込み (-mode=import-prices)
+//
+// Stooq・Yahoo が両方ブロックされた日のデータを、手元でダウンロードした CSV で埋めるためのもの。
+// 列はヘッダ名で探し (日付/始値/高値/安値/終値/出来高 や Date/Open/... の既定の候補、-import-config の JSON で追加・変更)、
+// 文字コードは UTF-8 (BOM 可) でなければ Shift_JIS として読む。銘柄コードの列が無いファイルは
+// ファイル名の4桁コード (7203_daily.csv など) か -code を使う。
+// 検証を通った行だけを savePricesToDB で保存し、ファイルごとの結果を price_import_reports に残す。
+
+const (
+	// priceImportSource は取り込んだ行の stock_prices.source の既定値
+	priceImportSource = "import"
+	// priceImportHeaderScanRows はヘッダ行を探す行数 (ヘッダの前に銘柄名などの説明行がある形式のため)
+	priceImportHeaderScanRows = 10
+	// priceImportMaxExamples はレポートに残す却下行の例の数
+	priceImportMaxExamples = 5
+)
+
+// priceImportColumns は列の種類 (priceImportMapping.Columns のキー)
+var priceImportColumns = []string{"date", "code", "open", "high", "low", "close", "volume"}
+
+// defaultPriceImportColumns は列の種類 → ヘッダ名の候補 (大文字小文字・前後の空白・(円) などの単位は無視して比べる)
+var defaultPriceImportColumns = map[string][]string{
+	"date":   {"日付", "年月日", "取引日", "date"},
+	"code":   {"コード", "銘柄コード", "証券コード", "code", "ticker", "symbol"},
+	"open":   {"始値", "open"},
+	"high":   {"高値", "high"},
+	"low":    {"安値", "low"},
+	"close":  {"終値", "close"},
+	"volume": {"出来高", "売買高", "volume"},
+}
+
+// priceImportDateFormats は date_format が空のときに試す日付の書式
+var priceImportDateFormats = []string{"2006-01-02", "2006/01/02", "2006/1/2", "20060102", "2006年1月2日", "2006.01.02"}
+
+// priceImportMapping は -import-config の JSON
+type priceImportMapping struct {
+	Encoding   string              `json:"encoding"`    // auto (既定) / utf-8 / shift_jis
+	Delimiter  string              `json:"delimiter"`   // 既定 ","。タブ区切りは "\t"
+	DateFormat string              `json:"date_format"` // Go の書式 ("2006/01/02")。空なら priceImportDateFormats を順に試す
+	Source     string              `json:"source"`      // stock_prices.source (既定 "import")
+	Columns    map[string][]string `json:"columns"`     // 列の種類 → ヘッダ名の候補 (指定した種類だけ既定を置き換える)
+}
+
+// loadPriceImportMapping は JSON を読み、未指定の項目を既定値で埋める。path が空なら既定値だけ
+func loadPriceImportMapping(path string) (priceImportMapping, error) {
+	var m priceImportMapping
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return m, err
+		}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return m, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for k := range m.Columns {
+		if _, ok := defaultPriceImportColumns[k]; !ok {
+			return m, fmt.Errorf("unknown column %q (%s)", k, strings.Join(priceImportColumns, ", "))
+		}
+	}
+	cols := make(map[string][]string, len(defaultPriceImportColumns))
+	for k, v := range defaultPriceImportColumns {
+		cols[k] = v
+	}
+	for k, v := range m.Columns {
+		cols[k] = v
+	}
+	m.Columns = cols
+	switch strings.ToLower(strings.ReplaceAll(m.Encoding, "-", "_")) {
+	case "", "auto":
+		m.Encoding = "auto"
+	case "utf_8", "utf8":
+		m.Encoding = "utf-8"
+	case "shift_jis", "sjis", "cp932":
+		m.Encoding = "shift_jis"
+	default:
+		return m, fmt.Errorf("unknown encoding %q (auto, utf-8, shift_jis)", m.Encoding)
+	}
+	if m.Delimiter == "" {
+		m.Delimiter = ","
+	}
+	if m.Source == "" {
+		m.Source = priceImportSource
+	}
+	return m, nil
+}
+
+// decodePriceCSV は UTF-8 (BOM を除く) か Shift_JIS のバイト列を UTF-8 にし、使った文字コードを返す
+func decodePriceCSV(data []byte, encoding string) (string, string, error) {
+	if encoding == "auto" {
+		encoding = "shift_jis"
+		if utf8.Valid(data) {
+			encoding = "utf-8"
+		}
+	}
+	if encoding == "utf-8" {
+		return strings.TrimPrefix(string(data), "\ufeff"), encoding, nil
+	}
+	b, _, err := transform.Bytes(japanese.ShiftJIS.NewDecoder(), data)
+	if err != nil {
+		return "", encoding, fmt.Errorf("shift_jis: %w", err)
+	}
+	return string(b), encoding, nil
+}
+
+// normalizeImportHeader はヘッダ名を比較用にそろえる (小文字・空白除去・末尾の (円) などの単位を除く)
+func normalizeImportHeader(h string) string {
+	h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+	for _, open := range []string{"(", "（"} {
+		if i := strings.Index(h, open); i > 0 {
+			h = h[:i]
+		}
+	}
+	return strings.Join(strings.Fields(h), "")
+}
+
+// findImportColumns はヘッダから列の種類 → 位置を返す。日付と終値が無ければ ok=false
+func findImportColumns(header []string, columns map[string][]string) (map[string]int, bool) {
+	idx := make(map[string]int)
+	for i, h := range header {
+		h = normalizeImportHeader(h)
+		for _, kind := range priceImportColumns {
+			if _, done := idx[kind]; done {
+				continue
+			}
+			for _, cand := range columns[kind] {
+				if h == normalizeImportHeader(cand) {
+					idx[kind] = i
+					break
+				}
+			}
+		}
+	}
+	_, hasDate := idx["date"]
+	_, hasClose := idx["close"]
+	return idx, hasDate && hasClose
+}
+
+// normalizeImportCode は 72030 / 7203.T / 7203.jp のような表記を4桁 (130A などの英字入りも可) にする
+func normalizeImportCode(s string) (string, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if i := strings.IndexByte(s, '.'); i > 0 {
+		s = s[:i]
+	}
+	if len(s) == 5 && strings.HasSuffix(s, "0") {
+		s = s[:4]
+	}
+	if len(s) != 4 || s[0] < '0' || s[0] > '9' {
+		return "", false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'A' && r <= 'Z') {
+			return "", false
+		}
+	}
+	return s, true
+}
+
+// codeFromFileName はファイル名の最初の4桁の数字を銘柄コードとして返す (7203_daily.csv, prices-7203.csv)
+func codeFromFileName(name string) string {
+	base := filepath.Base(name)
+	run := 0
+	for i := 0; i < len(base); i++ {
+		if base[i] >= '0' && base[i] <= '9' {
+			run++
+			continue
+		}
+		if run == 4 {
+			return base[i-4 : i]
+		}
+		run = 0
+	}
+	if run == 4 {
+		return base[len(base)-4:]
+	}
+	return ""
+}
+
+// parseImportNumber は "1,234.5" / " 1234 " を読む。空や "-" はエラー
+func parseImportNumber(s string) (float64, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	if s == "" || s == "-" || s == "--" {
+		return 0, fmt.Errorf("値なし")
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseImportDate は date_format か既知の書式で日付を読む
+func parseImportDate(s, format string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	formats := priceImportDateFormats
+	if format != "" {
+		formats = []string{format}
+	}
+	for _, f := range formats {
+		if t, err := time.Parse(f, s); err == nil {
+			return t, nil
+		}
+	}
+	// "2025/05/16 15:00" のような時刻付きは日付部分だけ読む
+	if i := strings.IndexAny(s, " T"); i > 0 {
+		return parseImportDate(s[:i], format)
+	}
+	return time.Time{}, fmt.Errorf("日付を読めません: %q", s)
+}
+
+// priceImportReport は1ファイルの取り込み結果
+type priceImportReport struct {
+	File       string
+	Encoding   string
+	Rows       int            // ヘッダ以降のデータ行数
+	Imported   int            // 保存した行数
+	Duplicates int            // 同じ銘柄・日付の行 (後の行を使う)
+	Rejected   map[string]int // 却下の理由 → 行数
+	Examples   []string       // 却下した行の例 ("12行目: 高値 < 安値")
+	Codes      []string
+	FromDate   string
+	ToDate     string
+	Err        error // ファイル全体を読めなかった・保存に失敗した
+}
+
+func (r *priceImportReport) reject(line int, reason, detail string) {
+	if r.Rejected == nil {
+		r.Rejected = make(map[string]int)
+	}
+	r.Rejected[reason]++
+	if len(r.Examples) < priceImportMaxExamples {
+		r.Examples = append(r.Examples, fmt.Sprintf("%d行目: %s %s", line, reason, detail))
+	}
+}
+
+func (r *priceImportReport) rejectedCount() int {
+	n := 0
+	for _, c := range r.Rejected {
+		n += c
+	}
+	return n
+}
+
+// validateImportedPrice は1行の四本値・日付を検証し、却下の理由を返す (問題なければ "")
+func validateImportedPrice(p StockPrice, today string) string {
+	switch {
+	case p.Open <= 0 || p.High <= 0 || p.Low <= 0 || p.Close <= 0:
+		return "四本値が0以下"
+	case p.High < p.Low:
+		return "高値 < 安値"
+	case p.Open > p.High || p.Open < p.Low || p.Close > p.High || p.Close < p.Low:
+		return "始値・終値が高安の範囲外"
+	case p.Volume < 0:
+		return "出来高が負"
+	case p.Date > today:
+		return "未来の日付"
+	case !tradingCalendar.IsTradingDay(mustParseDate(p.Date)):
+		return "休場日"
+	}
+	return ""
+}
+
+// mustParseDate は検証済みの YYYY-MM-DD を time.Time にする
+func mustParseDate(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+// parsePriceImport は1ファイルを読み、銘柄 → 日付順の株価とレポートを返す (DB には書かない)。
+// defaultCode はコード列もファイル名のコードも無いときに使う
+func parsePriceImport(name string, data []byte, m priceImportMapping, defaultCode, today string) (map[string][]StockPrice, priceImportReport) {
+	report := priceImportReport{File: name}
+	text, enc, err := decodePriceCSV(data, m.Encoding)
+	report.Encoding = enc
+	if err != nil {
+		report.Err = err
+		return nil, report
+	}
+
+	r := csv.NewReader(strings.NewReader(text))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.Comma, _ = utf8.DecodeRuneInString(m.Delimiter)
+	records, err := r.ReadAll()
+	if err != nil {
+		report.Err = fmt.Errorf("CSV: %w", err)
+		return nil, report
+	}
+
+	// ヘッダ行を探す (前に説明行があってもよい)
+	headerRow := -1
+	var cols map[string]int
+	for i := 0; i < len(records) && i < priceImportHeaderScanRows; i++ {
+		if c, ok := findImportColumns(records[i], m.Columns); ok {
+			headerRow, cols = i, c
+			break
+		}
+	}
+	if headerRow < 0 {
+		report.Err = fmt.Errorf("日付・終値の列が見つかりません (先頭 %d 行)。-import-config で列名を指定してください", priceImportHeaderScanRows)
+		return nil, report
+	}
+
+	fileCode := codeFromFileName(name)
+	if fileCode == "" {
+		fileCode = defaultCode
+	}
+	_, hasCodeCol := cols["code"]
+	if !hasCodeCol && fileCode == "" {
+		report.Err = fmt.Errorf("銘柄コードの列が無く、ファイル名にもコードがありません (-code で指定)")
+		return nil, report
+	}
+
+	field := func(row []string, kind string) (string, bool) {
+		i, ok := cols[kind]
+		if !ok || i >= len(row) {
+			return "", false
+		}
+		return row[i], true
+	}
+
+	byCode := make(map[string]map[string]StockPrice)
+	for i, row := range records[headerRow+1:] {
+		line := headerRow + i + 2 // 1始まりの行番号
+		if len(row) == 0 || (len(row) == 1 && strings.TrimSpace(row[0]) == "") {
+			continue
+		}
+		report.Rows++
+
+		code := fileCode
+		if hasCodeCol {
+			s, _ := field(row, "code")
+			c, ok := normalizeImportCode(s)
+			if !ok {
+				report.reject(line, "銘柄コード不正", fmt.Sprintf("%q", s))
+				continue
+			}
+			code = c
+		}
+
+		ds, _ := field(row, "date")
+		d, err := parseImportDate(ds, m.DateFormat)
+		if err != nil {
+			report.reject(line, "日付不正", fmt.Sprintf("%q", ds))
+			continue
+		}
+		p := StockPrice{Code: code, Date: d.Format("2006-01-02")}
+
+		var bad string
+		for _, f := range []struct {
+			kind string
+			dst  *float64
+		}{{"open", &p.Open}, {"high", &p.High}, {"low", &p.Low}, {"close", &p.Close}} {
+			s, ok := field(row, f.kind)
+			if !ok && f.kind != "close" {
+				continue // 終値だけの形式は始値・高値・安値を終値で埋める
+			}
+			v, err := parseImportNumber(s)
+			if err != nil {
+				bad = fmt.Sprintf("%s=%q", f.kind, s)
+				break
+			}
+			*f.dst = v
+		}
+		if bad != "" {
+			report.reject(line, "数値不正", bad)
+			continue
+		}
+		for _, v := range []*float64{&p.Open, &p.High, &p.Low} {
+			if *v == 0 {
+				*v = p.Close
+			}
+		}
+		if s, ok := field(row, "volume"); ok {
+			if v, err := parseImportNumber(s); err == nil {
+				p.Volume = int64(v)
+			}
+		}
+
+		if reason := validateImportedPrice(p, today); reason != "" {
+			report.reject(line, reason, fmt.Sprintf("%s O=%g H=%g L=%g C=%g", p.Date, p.Open, p.High, p.Low, p.Close))
+			continue
+		}
+		if byCode[code] == nil {
+			byCode[code] = make(map[string]StockPrice)
+		}
+		if _, dup := byCode[code][p.Date]; dup {
+			report.Duplicates++
+		}
+		byCode[code][p.Date] = p
+	}
+
+	prices := make(map[string][]StockPrice, len(byCode))
+	for code, days := range byCode {
+		for _, p := range days {
+			prices[code] = append(prices[code], p)
+			if report.FromDate == "" || p.Date < report.FromDate {
+				report.FromDate = p.Date
+			}
+			if p.Date > report.ToDate {
+				report.ToDate = p.Date
+			}
+		}
+		sort.Slice(prices[code], func(i, j int) bool { return prices[code][i].Date < prices[code][j].Date })
+		report.Codes = append(report.Codes, code)
+	}
+	sort.Strings(report.Codes)
+	return prices, report
+}
+
+// expandImportFiles は -file (ファイル・ディレクトリ・glob、カンマ区切り可) を CSV ファイルの一覧にする
+func expandImportFiles(spec string) ([]string, error) {
+	var files []string
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if fi, err := os.Stat(part); err == nil && fi.IsDir() {
+			for _, ext := range []string{"*.csv", "*.CSV", "*.tsv", "*.txt"} {
+				m, _ := filepath.Glob(filepath.Join(part, ext))
+				files = append(files, m...)
+			}
+			continue
+		}
+		m, err := filepath.Glob(part)
+		if err != nil {
+			return nil, err
+		}
+		if len(m) == 0 {
+			return nil, fmt.Errorf("%s: ファイルがありません", part)
+		}
+		files = append(files, m...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// savePriceImportReport は1ファイルの結果を price_import_reports に残す
+func savePriceImportReport(priceDB *sql.DB, r priceImportReport) error {
+	detail, _ := json.Marshal(map[string]any{"rejected": r.Rejected, "examples": r.Examples})
+	errText := ""
+	if r.Err != nil {
+		errText = r.Err.Error()
+	}
+	_, err := priceDB.Exec(`
+		INSERT INTO price_import_reports
+			(file, imported_at, encoding, rows, imported, rejected, duplicates, codes, from_date, to_date, detail, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, ''))`,
+		r.File, nowJST().Format("2006-01-02 15:04:05"), r.Encoding, r.Rows, r.Imported, r.rejectedCount(), r.Duplicates, strings.Join(r.Codes, ","),
+		r.FromDate, r.ToDate, string(detail), errText)
+	return err
+}
+
+// printPriceImportReport は1ファイルの結果を表示する
+func printPriceImportReport(r priceImportReport) {
+	if r.Err != nil {
+		fmt.Printf("  ❌ %s: %v\n", r.File, r.Err)
+		return
+	}
+	codes := strings.Join(r.Codes, ",")
+	if len(r.Codes) > 5 {
+		codes = fmt.Sprintf("%s ほか %d銘柄", strings.Join(r.Codes[:5], ","), len(r.Codes)-5)
+	}
+	fmt.Printf("  ✅ %s (%s): %d行中 %d行保存, 却下 %d, 重複 %d, %s〜%s [%s]\n",
+		r.File, r.Encoding, r.Rows, r.Imported, r.rejectedCount(), r.Duplicates, r.FromDate, r.ToDate, codes)
+	reasons := make([]string, 0, len(r.Rejected))
+	for reason := range r.Rejected {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Printf("     ⚠️ %s: %d行\n", reason, r.Rejected[reason])
+	}
+	for _, ex := range r.Examples {
+		fmt.Printf("       %s\n", ex)
+	}
+}
+
+// runImportPrices は -mode=import-prices の本体。fileSpec の CSV を取り込み、取り込んだ銘柄の分割・併合を見直す
+func runImportPrices(fileSpec, configPath, defaultCode string) {
+	if fileSpec == "" {
+		log.Fatalf("-file=path/to/prices.csv が必要 (ディレクトリ・glob・カンマ区切りも可)")
+	}
+	mapping, err := loadPriceImportMapping(configPath)
+	if err != nil {
+		log.Fatalf("-import-config の読み込み失敗: %v", err)
+	}
+	files, err := expandImportFiles(fileSpec)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	priceDB, err := initPriceDB()
+	if err != nil {
+		log.Fatalf("stock_price.db初期化失敗: %v", err)
+	}
+	defer priceDB.Close()
+
+	fmt.Printf("📥 株価CSVを取り込み (%dファイル)...\n", len(files))
+	today := todayJST()
+	touched := make(map[string]bool)
+	totalRows, failedFiles := 0, 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		var report priceImportReport
+		var prices map[string][]StockPrice
+		if err != nil {
+			report = priceImportReport{File: file, Err: err}
+		} else {
+			prices, report = parsePriceImport(file, data, mapping, defaultCode, today)
+		}
+		for _, code := range report.Codes {
+			n, err := savePricesToDB(priceDB, code, prices[code], mapping.Source)
+			report.Imported += n
+			if err != nil {
+				if report.Rejected == nil {
+					report.Rejected = make(map[string]int)
+				}
+				report.Rejected["DB保存失敗"] += len(prices[code]) - n
+				report.Examples = append(report.Examples, fmt.Sprintf("%s: DB保存失敗 %v", code, err))
+			}
+			if n > 0 {
+				touched[code] = true
+			}
+		}
+		printPriceImportReport(report)
+		if err := savePriceImportReport(priceDB, report); err != nil {
+			log.Printf("⚠️ price_import_reports 保存失敗: %v", err)
+		}
+		totalRows += report.Imported
+		if report.Err != nil {
+			failedFiles++
+		}
+	}
+
+	fmt.Printf("\n📊 完了: %dファイル (失敗 %d), %d行, %d銘柄\n", len(files), failedFiles, totalRows, len(touched))
+	if len(touched) == 0 {
+		return
+	}
+	codes := make([]string, 0, len(touched))
+	for code := range touched {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	// 取り込んだ CSV が分割調整済みかどうかで段差が変わるため、分割・併合を見直す
+	if adjusted, detected, err := refreshCorporateActions(priceDB, codes); err != nil {
+		log.Printf("⚠️ 株式分割・併合の更新失敗: %v", err)
+	} else {
+		printCorporateActionSummary(priceDB, adjusted, detected)
+	}
+}
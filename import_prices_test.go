@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParsePriceImport(t *testing.T) {
+	defaults, err := loadPriceImportMapping("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeOnly, err := loadPriceImportMapping("testdata/prices/import/close_only.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		file         string
+		mapping      priceImportMapping
+		defaultCode  string
+		wantEncoding string
+		want         map[string][][3]any // 銘柄 → {日付, 終値, 出来高}
+		wantRejected map[string]int
+		wantDup      int
+	}{
+		{
+			// ファイル名のコード、ヘッダの前の説明行、桁区切りのカンマ、同じ日付は後の行
+			file: "7203_broker_sjis.csv", mapping: defaults, wantEncoding: "shift_jis",
+			want: map[string][][3]any{"7203": {
+				{"2025-05-12", 2840.0, int64(12345600)},
+				{"2025-05-13", 2810.0, int64(9000000)},
+				{"2025-05-16", 2825.0, int64(8000000)},
+			}},
+			wantRejected: map[string]int{"高値 < 安値": 1, "数値不正": 1, "休場日": 1},
+			wantDup:      1,
+		},
+		{
+			// BOM 付き UTF-8、コード列 (7203.T / 67580)、使わない列 (Adj Close)
+			file: "vendor_utf8.csv", mapping: defaults, wantEncoding: "utf-8",
+			want: map[string][][3]any{
+				"7203": {{"2025-05-12", 2840.0, int64(12345600)}},
+				"6758": {{"2025-05-12", 3540.0, int64(500000)}, {"2025-05-13", 3510.0, int64(0)}},
+			},
+			wantRejected: map[string]int{"銘柄コード不正": 1, "未来の日付": 1},
+		},
+		{
+			// 設定ファイルの列名・区切り・日付書式。終値だけの形式は四本値を終値で埋める
+			file: "close_only.tsv", mapping: closeOnly, defaultCode: "9984", wantEncoding: "utf-8",
+			want: map[string][][3]any{"9984": {{"2025-05-12", 1234.0, int64(1000)}, {"2025-05-13", 1240.0, int64(0)}}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.file, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/prices/import/" + c.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prices, report := parsePriceImport(c.file, data, c.mapping, c.defaultCode, "2025-06-01")
+			if report.Err != nil {
+				t.Fatal(report.Err)
+			}
+			got := make(map[string][][3]any)
+			for code, ps := range prices {
+				got[code] = bars(ps)
+				for _, p := range ps {
+					if p.Code != code || p.Open <= 0 || p.High < p.Low {
+						t.Errorf("%s: 不正な行 %+v", code, p)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("prices = %v, want %v", got, c.want)
+			}
+			if report.Encoding != c.wantEncoding {
+				t.Errorf("encoding = %s, want %s", report.Encoding, c.wantEncoding)
+			}
+			if len(c.wantRejected) == 0 {
+				c.wantRejected = nil
+			}
+			if !reflect.DeepEqual(report.Rejected, c.wantRejected) || report.Duplicates != c.wantDup {
+				t.Errorf("rejected = %v dup = %d, want %v dup = %d (examples %v)", report.Rejected, report.Duplicates, c.wantRejected, c.wantDup, report.Examples)
+			}
+		})
+	}
+}
+
+func TestParsePriceImport_Errors(t *testing.T) {
+	m, _ := loadPriceImportMapping("")
+	if _, r := parsePriceImport("prices.csv", []byte("a,b,c\n1,2,3\n"), m, "", "2025-06-01"); r.Err == nil {
+		t.Error("日付・終値の列が無ければエラー")
+	}
+	if _, r := parsePriceImport("prices.csv", []byte("日付,終値\n2025/05/12,100\n"), m, "", "2025-06-01"); r.Err == nil {
+		t.Error("コードが分からなければエラー")
+	}
+	if _, err := loadPriceImportMapping("testdata/prices/import/vendor_utf8.csv"); err == nil {
+		t.Error("JSON でない設定はエラー")
+	}
+}
+
+func TestNormalizeImportCode(t *testing.T) {
+	for in, want := range map[string]string{"7203": "7203", "72030": "7203", "7203.T": "7203", "7203.jp": "7203", "130a": "130A", "ABCD": "", "720": "", "^NKX": ""} {
+		got, ok := normalizeImportCode(in)
+		if got != want || ok != (want != "") {
+			t.Errorf("normalizeImportCode(%q) = (%q, %v), want %q", in, got, ok, want)
+		}
+	}
+	for in, want := range map[string]string{"7203_daily.csv": "7203", "prices-6758.csv": "6758", "data/20250516.csv": "", "export.csv": ""} {
+		if got := codeFromFileName(in); got != want {
+			t.Errorf("codeFromFileName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// 市場指数 (日経平均・TOPIX など) の登録と取得
+//
+// 指数は stocks の銘柄ではないので fetch-prices の銘柄一覧には入らない。marketIndices に登録した指数を
+// 取得元ごとのシンボルで取り、stock_price.db の index_prices に銘柄とは分けて保存する。
+// fetch-prices の最後と -mode=fetch-indices で更新し、/api/market-index が一覧と日足を返す。
+// calc-rs は -rs-benchmark の指数 (既定は TOPIX) の騰落率との差も rs_scores に残す。
+
+// marketIndex は登録済みの指数
+type marketIndex struct {
+	Code    string            // index_prices.code
+	Name    string            // 表示名
+	Symbols map[string]string // 取得元 → その取得元でのシンボル (無い取得元からは取らない)
+	Note    string            // 代用などの注記
+}
+
+// marketIndices は取得する指数 (表示順)
+var marketIndices = []marketIndex{
+	{Code: "^NKX", Name: "日経平均株価", Symbols: map[string]string{"stooq": "^nkx", "yahoo": "^N225"}},
+	{Code: "^TPX", Name: "TOPIX", Symbols: map[string]string{"stooq": "^tpx", "yahoo": "998405.T"}},
+	// 東証グロース市場250指数は無料の取得元に無いため、連動 ETF の株価で代用する
+	{Code: "^TSEG", Name: "東証グロース市場250", Symbols: map[string]string{"stooq": "2516.jp", "yahoo": "2516.T"},
+		Note: "連動ETF (2516) の株価で代用"},
+	{Code: "^SPX", Name: "S&P 500", Symbols: map[string]string{"stooq": "^spx", "yahoo": "^GSPC"}},
+	{Code: "^DJI", Name: "NYダウ", Symbols: map[string]string{"stooq": "^dji", "yahoo": "^DJI"}},
+}
+
+const (
+	// defaultRSBenchmark は -rs-benchmark の既定値
+	defaultRSBenchmark = "^TPX"
+	// indexHistoryDays は指数を初めて取るときの日数の下限 (/api/market-index の2年窓)
+	indexHistoryDays = 730
+	// indexRefetchDays は2回目以降に取り直す直近の日数 (取りこぼし・速報値の修正を拾う)
+	indexRefetchDays = 7
+)
+
+// findMarketIndex は code の登録を返す
+func findMarketIndex(code string) (marketIndex, bool) {
+	for _, idx := range marketIndices {
+		if idx.Code == code {
+			return idx, true
+		}
+	}
+	return marketIndex{}, false
+}
+
+// indexFetcher は指数も取得できる取得元 (取得元ごとのシンボルで取る)
+type indexFetcher interface {
+	FetchIndex(ctx context.Context, symbol, code string, from, to time.Time) ([]StockPrice, error)
+}
+
+func (stooqSource) FetchIndex(ctx context.Context, symbol, code string, from, to time.Time) ([]StockPrice, error) {
+	return fetchStooqSymbol(ctx, symbol, code, from, to)
+}
+
+func (yahooSource) FetchIndex(ctx context.Context, symbol, code string, from, to time.Time) ([]StockPrice, error) {
+	return fetchYahooSymbol(ctx, symbol, code, from, to)
+}
+
+// fetchIndex は idx のシンボルがある取得元を順に試す (銘柄と同じく健全性・レート制限を共有する)
+func (set *priceSourceSet) fetchIndex(ctx context.Context, idx marketIndex, from, to, now time.Time) ([]StockPrice, string, error) {
+	set.mu.Lock()
+	ordered := set.ordered(now)
+	set.mu.Unlock()
+
+	var sources []*trackedSource
+	for _, s := range ordered {
+		if _, ok := s.PriceSource.(indexFetcher); ok && idx.Symbols[s.Name()] != "" {
+			sources = append(sources, s)
+		}
+	}
+	if len(sources) == 0 && len(ordered) > 0 {
+		return nil, "", fmt.Errorf("%s: 取得元 %s にシンボルがありません", idx.Code, strings.Join(set.names(), ", "))
+	}
+	return set.fetchFrom(ctx, sources, now, func(s *trackedSource) ([]StockPrice, error) {
+		return s.PriceSource.(indexFetcher).FetchIndex(ctx, idx.Symbols[s.Name()], idx.Code, from, to)
+	})
+}
+
+// indexCoverage は保存済みの指数の期間
+type indexCoverage struct {
+	Count    int
+	FromDate string
+	ToDate   string
+}
+
+// loadIndexCoverage は指数 → 保存済みの期間。schema は openServerDB の接続なら "price_db."、initPriceDB なら ""
+func loadIndexCoverage(db *sql.DB, schema string) map[string]indexCoverage {
+	m := make(map[string]indexCoverage)
+	rows, err := db.Query(`SELECT code, COUNT(*), MIN(date), MAX(date) FROM ` + schema + `index_prices GROUP BY code`)
+	if err != nil {
+		return m
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var code string
+		var c indexCoverage
+		if rows.Scan(&code, &c.Count, &c.FromDate, &c.ToDate) == nil {
+			m[code] = c
+		}
+	}
+	return m
+}
+
+// indexFetchRange は取得期間を返す。保存済みの最古の日付が target より新しければ target から全部、
+// そうでなければ最新の日付の indexRefetchDays 日前から today まで
+func indexFetchRange(c indexCoverage, target, today time.Time) (from, to time.Time) {
+	if c.Count == 0 || c.FromDate > target.Format("2006-01-02") {
+		return target, today
+	}
+	last, err := time.Parse("2006-01-02", c.ToDate)
+	if err != nil {
+		return target, today
+	}
+	return last.AddDate(0, 0, -indexRefetchDays), today
+}
+
+// saveIndexPricesToDB は1指数の日足を index_prices に保存する
+func saveIndexPricesToDB(db *sql.DB, code string, prices []StockPrice, source string) (int, error) {
+	w := newPriceBatchWriter(db, len(prices))
+	w.table = "index_prices"
+	w.add(code, prices, source)
+	if err := w.flush(); err != nil {
+		return w.Saved, err
+	}
+	if w.Failed > 0 {
+		return w.Saved, fmt.Errorf("%d/%d行の保存失敗: %w", w.Failed, len(prices), w.FailedCodes[code])
+	}
+	return w.Saved, nil
+}
+
+// fetchIndexPrices は登録済みの指数を取得して保存する (historyDays と indexHistoryDays の長いほうまで遡る)
+func fetchIndexPrices(priceDB *sql.DB, sources *priceSourceSet, historyDays int) {
+	now := nowJST()
+	target := now.AddDate(0, 0, -max(historyDays, indexHistoryDays))
+	coverage := loadIndexCoverage(priceDB, "")
+
+	fmt.Printf("\n📉 市場指数 %d件を取得...\n", len(marketIndices))
+	for _, idx := range marketIndices {
+		from, to := indexFetchRange(coverage[idx.Code], target, now)
+		prices, source, err := sources.fetchIndex(context.Background(), idx, from, to, now)
+		switch {
+		case errors.Is(err, errAllSourcesCoolingDown):
+			fmt.Printf("  ⚠️ 全ての取得元がクールダウン中のため指数の取得を中止します\n")
+			return
+		case err != nil:
+			fmt.Printf("  ❌ %s %s: %v\n", idx.Code, idx.Name, err)
+			continue
+		}
+		n, err := saveIndexPricesToDB(priceDB, idx.Code, prices, source)
+		if err != nil {
+			fmt.Printf("  ❌ %s %s: DB保存失敗 %v\n", idx.Code, idx.Name, err)
+			continue
+		}
+		fmt.Printf("  ✅ %s %s: %s〜%s を %s から %d件\n", idx.Code, idx.Name,
+			from.Format("2006-01-02"), to.Format("2006-01-02"), source, n)
+	}
+}
+
+// runFetchIndices は -mode=fetch-indices の本体 (銘柄は取らずに指数だけ更新する)
+func runFetchIndices(sourceNames, sourceConfigPath string, historyDays int) {
+	sources, err := newPriceSourceSetFromFlags(sourceNames, sourceConfigPath)
+	if err != nil {
+		log.Fatalf("株価取得元の設定エラー: %v", err)
+	}
+	priceDB, err := initPriceDB()
+	if err != nil {
+		log.Fatalf("stock_price.db初期化失敗: %v", err)
+	}
+	defer priceDB.Close()
+
+	sources.loadHealth(priceDB)
+	fetchIndexPrices(priceDB, sources, historyDays)
+	if err := sources.saveHealth(priceDB); err != nil {
+		log.Printf("⚠️ price_source_health 保存失敗: %v", err)
+	}
+}
+
+// indexPerformance は指数 code の基準日 (以前で最も近い日) の終値と各期間の開始日 (以降で最も近い日、基準日まで) の終値から
+// プロファイル prof の加重騰落率を返す。終値のある期間が prof.MinPeriods に満たなければ false
+func indexPerformance(priceDB *sql.DB, code, baseDate string, prof rsProfile, periodStarts []string) (float64, bool) {
+	var latest float64
+	if err := priceDB.QueryRow(`
+		SELECT close FROM index_prices WHERE code = ? AND date <= ?
+		ORDER BY date DESC LIMIT 1`, code, baseDate).Scan(&latest); err != nil || latest <= 0 {
+		return 0, false
+	}
+	past := make([]float64, len(periodStarts))
+	for i, d := range periodStarts {
+		priceDB.QueryRow(`
+			SELECT close FROM index_prices WHERE code = ? AND date >= ? AND date <= ?
+			ORDER BY date ASC LIMIT 1`, code, d, baseDate).Scan(&past[i])
+	}
+	return prof.performance(latest, past)
+}
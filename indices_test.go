@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndexFetchRange(t *testing.T) {
+	today := mustDate(t, "2026-01-20")
+	target := mustDate(t, "2024-01-20")
+	cases := []struct {
+		name     string
+		coverage indexCoverage
+		wantFrom string
+	}{
+		{"未取得なら target から", indexCoverage{}, "2024-01-20"},
+		{"保存済みが target より新しければ target から取り直す", indexCoverage{Count: 200, FromDate: "2025-03-01", ToDate: "2026-01-19"}, "2024-01-20"},
+		{"遡り済みなら最新の日付の少し前から", indexCoverage{Count: 500, FromDate: "2024-01-19", ToDate: "2026-01-16"}, "2026-01-09"},
+	}
+	for _, c := range cases {
+		from, to := indexFetchRange(c.coverage, target, today)
+		if got := from.Format("2006-01-02"); got != c.wantFrom || !to.Equal(today) {
+			t.Errorf("%s: from=%s to=%s, want from=%s", c.name, got, to.Format("2006-01-02"), c.wantFrom)
+		}
+	}
+}
+
+// fakeIndexSource は指数も返す fakePriceSource (受け取ったシンボルを覚える)
+type fakeIndexSource struct {
+	fakePriceSource
+	symbols []string
+}
+
+func (f *fakeIndexSource) FetchIndex(ctx context.Context, symbol, code string, from, to time.Time) ([]StockPrice, error) {
+	f.symbols = append(f.symbols, symbol)
+	return f.Fetch(ctx, code, from, to)
+}
+
+func TestPriceSourceSet_FetchIndex(t *testing.T) {
+	stooq := &fakeIndexSource{fakePriceSource: fakePriceSource{name: "stooq"}}
+	yahoo := &fakeIndexSource{fakePriceSource: fakePriceSource{name: "yahoo"}}
+	set := &priceSourceSet{}
+	for i, s := range []PriceSource{stooq, yahoo} {
+		set.sources = append(set.sources, &trackedSource{PriceSource: s, order: i, blockThreshold: 2, cooldown: time.Minute})
+	}
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+
+	// シンボルの無い取得元は飛ばす
+	idx := marketIndex{Code: "^X", Symbols: map[string]string{"yahoo": "^YX"}}
+	prices, source, err := set.fetchIndex(context.Background(), idx, now, now, now)
+	if err != nil || source != "yahoo" || len(prices) != 1 || prices[0].Code != "^X" {
+		t.Fatalf("fetchIndex = (%v, %q, %v)", prices, source, err)
+	}
+	if len(stooq.symbols) != 0 || len(yahoo.symbols) != 1 || yahoo.symbols[0] != "^YX" {
+		t.Errorf("symbols stooq=%v yahoo=%v", stooq.symbols, yahoo.symbols)
+	}
+
+	if _, _, err := set.fetchIndex(context.Background(), marketIndex{Code: "^Z"}, now, now, now); err == nil {
+		t.Error("どの取得元にもシンボルが無ければエラー")
+	}
+
+	// 登録済みの指数はどれも stooq か yahoo のシンボルを持つ
+	for _, idx := range marketIndices {
+		if idx.Symbols["stooq"] == "" && idx.Symbols["yahoo"] == "" {
+			t.Errorf("%s: シンボルがありません", idx.Code)
+		}
+	}
+	if _, ok := findMarketIndex(defaultRSBenchmark); !ok {
+		t.Errorf("既定のベンチマーク %s が未登録", defaultRSBenchmark)
+	}
+}
+
+func TestIndexPerformance(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "prices.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE index_prices (
+		code TEXT, date TEXT, open REAL, high REAL, low REAL, close REAL, volume INTEGER, source TEXT,
+		PRIMARY KEY (code, date))`); err != nil {
+		t.Fatal(err)
+	}
+	prices := []StockPrice{
+		{Date: "2025-01-06", Close: 2000}, // 12ヶ月前
+		{Date: "2025-07-01", Close: 2500}, // 6ヶ月前
+		{Date: "2026-01-05", Close: 3000}, // 基準日の前の営業日
+	}
+	if n, err := saveIndexPricesToDB(db, "^TPX", prices, "stooq"); err != nil || n != 3 {
+		t.Fatalf("saveIndexPricesToDB = (%d, %v)", n, err)
+	}
+
+	// 基準日に指数が無ければ直前の終値、期間の開始日は以降で最も近い終値
+	got, ok := indexPerformance(db, "^TPX", "2026-01-06", defaultRSProfile(), []string{"2025-10-01", "2025-06-30", "2025-04-01", "2025-01-05"})
+	// 3ヶ月: 3000/3000, 6ヶ月: 3000/2500, 9ヶ月: 3000/2500, 12ヶ月: 3000/2000
+	want := 0*0.4 + 20*0.2 + 20*0.2 + 50*0.2
+	if !ok || math.Abs(got-want) > 1e-9 {
+		t.Errorf("indexPerformance = (%v, %v), want %v", got, ok, want)
+	}
+	if _, ok := indexPerformance(db, "^NKX", "2026-01-06", defaultRSProfile(), make([]string, 4)); ok {
+		t.Error("データの無い指数は false")
+	}
+}
+
+func TestMigrateIndexPrices(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "stock_price.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, table := range []string{"stock_prices", "index_prices"} {
+		if _, err := db.Exec(`CREATE TABLE ` + table + ` (code TEXT, date TEXT, open REAL, high REAL, low REAL, close REAL,
+			volume INTEGER, source TEXT, PRIMARY KEY (code, date))`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Exec(`INSERT INTO stock_prices VALUES
+		('^NKX', '2025-05-08', 1, 1, 1, 36000, 0, 'stooq'),  -- 以前の形式
+		('^TPX', '2025-05-08', 1, 1, 1, 2700, 0, 'stooq'),
+		('7203', '2025-05-08', 1, 1, 1, 2800, 100, 'stooq')`)
+	db.Exec(`INSERT INTO index_prices VALUES ('^NKX', '2025-05-08', 1, 1, 1, 36100, 0, 'yahoo')`)
+
+	if err := migrateIndexPrices(db); err != nil {
+		t.Fatal(err)
+	}
+	// 2回目以降は user_version を見て何もしない
+	db.Exec(`INSERT INTO stock_prices VALUES ('^NKX', '2025-05-09', 1, 1, 1, 36200, 0, 'stooq')`)
+	if err := migrateIndexPrices(db); err != nil {
+		t.Fatal(err)
+	}
+	var version int
+	db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	if version != priceSchemaIndexPrices {
+		t.Errorf("user_version = %d, want %d", version, priceSchemaIndexPrices)
+	}
+
+	count := func(query string) (n int) {
+		db.QueryRow(query).Scan(&n)
+		return n
+	}
+	if n := count(`SELECT COUNT(*) FROM stock_prices WHERE code != '^NKX'`); n != 1 {
+		t.Errorf("stock_prices に銘柄以外が残った: %d行", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM stock_prices WHERE code = '^NKX'`); n != 1 {
+		t.Errorf("移行済みの DB で再度移行した: ^NKX %d行", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM index_prices`); n != 2 {
+		t.Errorf("index_prices = %d行, want 2", n)
+	}
+	if n := count(`SELECT close FROM index_prices WHERE code = '^NKX'`); n != 36100 {
+		t.Errorf("index_prices の既存の行を上書きした: close=%d", n)
+	}
+}
@@ -134,13 +134,34 @@ func calcMetrics(lastPrice float64, sharesIssued, netIncome, netAssets, totalAss
 }
 
 func main() {
-	mode := flag.String("mode", "run", "execution mode: run, batch, serve, fetch-prices, calc-rs, export-json, fetch-tdnet, parse-tanshin, debug-tanshin, import-jpx, detect-alerts, or test-parse")
-	dateFlag := flag.String("date", time.Now().Format("2006-01-02"), "target date for run mode (YYYY-MM-DD)")
-	fromFlag := flag.String("from", "", "start date for batch mode (YYYY-MM-DD)")
-	toFlag := flag.String("to", "", "end date for batch mode (YYYY-MM-DD)")
-	fileFlag := flag.String("file", "", "input file path (for import-jpx mode)")
-	codeFlag := flag.String("code", "", "stock code (for debug-tanshin mode)")
+	mode := flag.String("mode", "run", "execution mode: run, batch, serve, fetch-prices, calc-rs, export-json, fetch-tdnet, watch-tdnet, classify-tdnet, parse-tanshin, debug-tanshin, import-jpx, detect-alerts, reconcile-financials, tanshin-corpus-add, backfill-prices, detect-corporate-actions, check-prices, fetch-indices, import-prices, or test-parse")
+	dateFlag := flag.String("date", todayJST(), "target date for run mode (YYYY-MM-DD, default: today in JST)")
+	fromFlag := flag.String("from", "", "start date for batch / fetch-tdnet / calc-rs mode (YYYY-MM-DD)")
+	toFlag := flag.String("to", "", "end date for batch / fetch-tdnet / calc-rs mode (YYYY-MM-DD; fetch-tdnet: default today, calc-rs: default latest price date)")
+	fileFlag := flag.String("file", "", "input file path (for import-jpx mode; import-prices also takes a directory, glob or comma-separated list)")
+	importConfigFlag := flag.String("import-config", "", "JSON column mapping / encoding / date format for import-prices mode")
+	codeFlag := flag.String("code", "", "stock code (for debug-tanshin / tanshin-corpus-add / check-prices mode; import-prices: code of files without a code column)")
+	fixFlag := flag.Bool("fix", false, "check-prices mode: re-fetch the ranges with issues from another price source")
+	intervalFlag := flag.Duration("interval", 5*time.Minute, "polling interval (for watch-tdnet mode / serve -watch-tdnet)")
+	watchTdnetFlag := flag.Bool("watch-tdnet", false, "serve mode: poll TDNET in the same process and invalidate the API cache on new disclosures")
+	reconcileThresholdFlag := flag.Float64("reconcile-threshold", defaultReconcileThreshold, "difference (%) between 決算短信 and the later EDINET report to flag (for reconcile-financials mode)")
+	priceSourcesFlag := flag.String("price-sources", defaultPriceSources, "comma-separated price sources in failover order (for fetch-prices mode)")
+	priceSourcesConfigFlag := flag.String("price-sources-config", "", "JSON file with price sources, block thresholds and cooldowns; overrides -price-sources")
+	historyDaysFlag := flag.Int("history-days", defaultHistoryDays, "days of daily price history to keep fetched (for fetch-prices / backfill-prices mode)")
+	tradingCalendarFlag := flag.String("trading-calendar", defaultTradingCalendarPath, "CSV (date,name) of extra TSE holidays; name \"open\" reopens a date")
+	fetchDeadlineFlag := flag.Duration("fetch-deadline", defaultFetchDeadline, "overall deadline of fetch-prices and backfill-prices; unfinished codes are picked up by the next run")
+	progressEveryFlag := flag.Int("progress-every", defaultProgressEvery, "print fetch-prices and backfill-prices progress every N codes")
+	rsBenchmarkFlag := flag.String("rs-benchmark", defaultRSBenchmark, "index code to compare RS performance against (for calc-rs mode, empty = none)")
+	rsProfilesFlag := flag.String("rs-profiles", "", "JSON file with RS profiles (periods, weights, min_periods, markets) for calc-rs mode; empty = built-in default only")
+	rsProfileFlag := flag.String("rs-profile", "", "comma-separated RS profile ids to calculate (for calc-rs mode, empty = all)")
+	maxPriceDBMBFlag := flag.Int("max-price-db-mb", defaultMaxPriceDBMB, "size limit of stock_price.db in MB; backfill-prices stops when exceeded (0 = unlimited)")
+	pdfBackendFlag := flag.String("pdf-backend", PDFBackendAuto, "PDF text extraction backend: auto (pdftotext if installed), go, or pdftotext (for parse-tanshin / debug-tanshin)")
 	flag.Parse()
+	loadTradingCalendar(*tradingCalendarFlag)
+
+	if err := setPDFBackend(*pdfBackendFlag); err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	switch *mode {
 	case "test-parse":
@@ -150,15 +171,53 @@ func main() {
 	case "batch":
 		runBatch(*fromFlag, *toFlag)
 	case "serve":
+		if *watchTdnetFlag {
+			go func() {
+				if err := watchTdnet(*intervalFlag); err != nil {
+					log.Printf("⚠️ TDNET 監視を開始できません (サーバーは継続): %v", err)
+				}
+			}()
+		}
 		startServer()
 	case "fetch-prices":
-		fetchStockPrices()
+		fetchStockPrices(*priceSourcesFlag, *priceSourcesConfigFlag, *historyDaysFlag, *maxPriceDBMBFlag, *fetchDeadlineFlag, *progressEveryFlag)
+	case "backfill-prices":
+		backfillPrices(*priceSourcesFlag, *priceSourcesConfigFlag, *historyDaysFlag, *maxPriceDBMBFlag, *fetchDeadlineFlag, *progressEveryFlag)
+	case "detect-corporate-actions":
+		runDetectCorporateActions()
+	case "fetch-indices":
+		runFetchIndices(*priceSourcesFlag, *priceSourcesConfigFlag, *historyDaysFlag)
+	case "import-prices":
+		runImportPrices(*fileFlag, *importConfigFlag, *codeFlag)
+	case "check-prices":
+		runCheckPrices(*codeFlag, *fixFlag, *priceSourcesFlag, *priceSourcesConfigFlag)
 	case "calc-rs":
-		calculateRS()
+		profiles, err := loadRSProfiles(*rsProfilesFlag)
+		if err == nil {
+			profiles, err = selectRSProfiles(profiles, *rsProfileFlag)
+		}
+		if err != nil {
+			log.Fatalf("RS プロファイルの設定エラー: %v", err)
+		}
+		if *fromFlag != "" || *toFlag != "" {
+			calculateRSRange(*rsBenchmarkFlag, *fromFlag, *toFlag, profiles)
+		} else {
+			calculateRS(*rsBenchmarkFlag, profiles)
+		}
 	case "export-json":
 		exportJSON()
 	case "fetch-tdnet":
-		fetchTdnet(*dateFlag)
+		if *fromFlag != "" || *toFlag != "" {
+			fetchTdnetRange(*fromFlag, *toFlag)
+		} else {
+			fetchTdnet(*dateFlag)
+		}
+	case "watch-tdnet":
+		if err := watchTdnet(*intervalFlag); err != nil {
+			log.Fatalf("%v", err)
+		}
+	case "classify-tdnet":
+		runClassifyTdnet()
 	case "parse-tanshin":
 		parseTanshinForDate(*dateFlag)
 	case "debug-tanshin":
@@ -167,6 +226,10 @@ func main() {
 		importJPX(*fileFlag)
 	case "detect-alerts":
 		detectAlerts(*dateFlag)
+	case "reconcile-financials":
+		runReconcileFinancials(*reconcileThresholdFlag)
+	case "tanshin-corpus-add":
+		addTanshinCorpusCase(*codeFlag, *dateFlag)
 	default:
 		log.Fatalf("Unknown mode: %s", *mode)
 	}
@@ -28,15 +28,32 @@ type financialRecord struct {
 	operatingCashFlow     int64
 	grossProfit           int64
 	dividendPerShare      float64
+
+	// 決算短信 (SHORT_REPORT) のみ: 対象期間・開示 EPS・前年同期の値
+	fiscalPeriod   string // Q1 / Q2 / Q3 / FY (旧バージョンで保存した行は空)
+	reportedEPS    float64
+	priorNetSales  int64
+	priorNetIncome int64
+	reconciledDate string // 同じ期の報告書と突合済みならその提出日 (reconcile.go)
 }
 
 func (r financialRecord) eps() float64 {
 	if r.sharesIssued <= 0 {
-		return 0
+		// 決算短信は発行済株式数を持たないので開示 EPS を使う
+		return r.reportedEPS
 	}
 	return float64(r.netIncome) / float64(r.sharesIssued)
 }
 
+// priorYoY は決算短信に併記された前年同期の値から EPS・売上の前年比を求める。
+// 発行済株式数は前年同期と同じとみなし、EPS の前年比は純利益の前年比で代用する
+func (r financialRecord) priorYoY() (epsYoY, salesYoY *float64, ok bool) {
+	if r.docType != "SHORT_REPORT" || (r.priorNetIncome == 0 && r.priorNetSales == 0) {
+		return nil, nil, false
+	}
+	return yoyPctInt(r.netIncome, r.priorNetIncome), yoyPctInt(r.netSales, r.priorNetSales), true
+}
+
 // loadAllFinancials は全銘柄の財務時系列を一括ロードする
 // 返り値のマップ値は submission_date DESC でソート済み
 func loadAllFinancials(db *sql.DB) (map[string][]financialRecord, error) {
@@ -46,7 +63,10 @@ func loadAllFinancials(db *sql.DB) (map[string][]financialRecord, error) {
 		       COALESCE(total_assets, 0), COALESCE(non_current_liabilities, 0),
 		       COALESCE(current_assets, 0), COALESCE(current_liabilities, 0),
 		       COALESCE(operating_cash_flow, 0), COALESCE(gross_profit, 0),
-		       COALESCE(dividend_per_share, 0.0)
+		       COALESCE(dividend_per_share, 0.0),
+		       COALESCE(fiscal_period, ''), COALESCE(eps, 0.0),
+		       COALESCE(prior_net_sales, 0), COALESCE(prior_net_income, 0),
+		       COALESCE(reconciled_date, '')
 		FROM stock_financials
 		ORDER BY code ASC, submission_date DESC`)
 	if err != nil {
@@ -64,7 +84,10 @@ func loadAllFinancials(db *sql.DB) (map[string][]financialRecord, error) {
 			&r.totalAssets, &r.nonCurrentLiabilities,
 			&r.currentAssets, &r.currentLiabilities,
 			&r.operatingCashFlow, &r.grossProfit,
-			&r.dividendPerShare); err != nil {
+			&r.dividendPerShare,
+			&r.fiscalPeriod, &r.reportedEPS,
+			&r.priorNetSales, &r.priorNetIncome,
+			&r.reconciledDate); err != nil {
 			continue
 		}
 		if len(dateStr) < 10 {
@@ -82,23 +105,43 @@ func loadAllFinancials(db *sql.DB) (map[string][]financialRecord, error) {
 
 // calcGrowthMetrics は財務時系列から成長指標を計算する
 // records は submission_date DESC でソート済みであることを期待
+//
+// 決算短信 (SHORT_REPORT) は対象期間が分かるものだけ四半期/通期に振り分け、前年同期の値があれば
+// それで前年比を出す (EDINET の報告書より数週間早く成長率が出る)。
+// 同じ期の決算短信と報告書が両方あれば監査済みの報告書を使う。突合済み (reconciledDate) の短信は
+// 必ず除き、未突合のものは提出日の近さで同じ期とみなして新しい方 (通常は報告書) だけを残す
 func calcGrowthMetrics(records []financialRecord) GrowthMetrics {
 	var quarterly, annual []financialRecord
 	for _, r := range records {
+		if r.docType == "SHORT_REPORT" && r.reconciledDate != "" {
+			continue
+		}
 		switch r.docType {
 		case "140", "160": // 四半期報告書・半期報告書
 			quarterly = append(quarterly, r)
 		case "120", "130": // 有価証券報告書・訂正
 			annual = append(annual, r)
+		case "SHORT_REPORT": // 決算短信 (期間不明の旧データは通期と区別できないので使わない)
+			switch r.fiscalPeriod {
+			case "Q1", "Q2", "Q3":
+				quarterly = append(quarterly, r)
+			case "FY":
+				annual = append(annual, r)
+			}
 		}
 	}
+	// 決算短信 → 報告書の提出間隔は四半期で1か月前後、通期で1.5か月前後
+	quarterly = dedupeSamePeriod(quarterly, 45)
+	annual = dedupeSamePeriod(annual, 75)
 
 	var m GrowthMetrics
 
 	// Q0: 直近四半期 vs 約1年前の四半期
 	if len(quarterly) > 0 {
 		q0 := quarterly[0]
-		if prior := findNearestByDate(quarterly[1:], q0.submissionDate.AddDate(-1, 0, 0), 45); prior != nil {
+		if epsYoY, salesYoY, ok := q0.priorYoY(); ok {
+			m.Q0EPSYoY, m.Q0SalesYoY = epsYoY, salesYoY
+		} else if prior := findNearestByDate(quarterly[1:], q0.submissionDate.AddDate(-1, 0, 0), 45); prior != nil {
 			if pct := yoyPctFloat(q0.eps(), prior.eps()); pct != nil {
 				m.Q0EPSYoY = pct
 			}
@@ -111,7 +154,9 @@ func calcGrowthMetrics(records []financialRecord) GrowthMetrics {
 	// Q1: 1四半期前 vs 約1年前
 	if len(quarterly) >= 2 {
 		q1 := quarterly[1]
-		if prior := findNearestByDate(quarterly[2:], q1.submissionDate.AddDate(-1, 0, 0), 45); prior != nil {
+		if epsYoY, _, ok := q1.priorYoY(); ok {
+			m.Q1EPSYoY = epsYoY
+		} else if prior := findNearestByDate(quarterly[2:], q1.submissionDate.AddDate(-1, 0, 0), 45); prior != nil {
 			if pct := yoyPctFloat(q1.eps(), prior.eps()); pct != nil {
 				m.Q1EPSYoY = pct
 			}
@@ -121,7 +166,9 @@ func calcGrowthMetrics(records []financialRecord) GrowthMetrics {
 	// Y0: 最新通期 vs 前年通期
 	if len(annual) > 0 {
 		y0 := annual[0]
-		if prior := findNearestByDate(annual[1:], y0.submissionDate.AddDate(-1, 0, 0), 90); prior != nil {
+		if epsYoY, _, ok := y0.priorYoY(); ok {
+			m.Y0EPSYoY = epsYoY
+		} else if prior := findNearestByDate(annual[1:], y0.submissionDate.AddDate(-1, 0, 0), 90); prior != nil {
 			if pct := yoyPctFloat(y0.eps(), prior.eps()); pct != nil {
 				m.Y0EPSYoY = pct
 			}
@@ -138,6 +185,19 @@ func calcGrowthMetrics(records []financialRecord) GrowthMetrics {
 	return m
 }
 
+// dedupeSamePeriod は submission_date DESC の records から、直前に残したレコードと
+// windowDays 以内のもの (同じ期の決算短信と報告書) を除く
+func dedupeSamePeriod(records []financialRecord, windowDays int) []financialRecord {
+	var out []financialRecord
+	for _, r := range records {
+		if n := len(out); n > 0 && out[n-1].submissionDate.Sub(r.submissionDate) < time.Duration(windowDays)*24*time.Hour {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
 // findNearestByDate は records の中から target に最も近い日付のレコードを返す
 // toleranceDays を超える差がある場合は nil
 func findNearestByDate(records []financialRecord, target time.Time, toleranceDays int) *financialRecord {
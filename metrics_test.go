@@ -155,6 +155,55 @@ func TestCalcGrowthMetrics_QuarterlyYoY(t *testing.T) {
 	}
 }
 
+func TestCalcGrowthMetrics_ShortReport(t *testing.T) {
+	records := []financialRecord{
+		// 第1四半期決算短信: 前年同期の値から当日に前年比が出る
+		{docType: "SHORT_REPORT", fiscalPeriod: "Q1", submissionDate: mustDate(t, "2025-08-05"),
+			netIncome: 300_000_000, netSales: 2_400_000_000, priorNetIncome: 200_000_000, priorNetSales: 2_000_000_000},
+		// 同じ期の通期決算短信と有報は新しい有報を使う
+		{docType: "120", submissionDate: mustDate(t, "2025-06-25"), netIncome: 900_000_000, sharesIssued: 1_000_000},
+		{docType: "SHORT_REPORT", fiscalPeriod: "FY", submissionDate: mustDate(t, "2025-05-12"),
+			netIncome: 900_000_000, priorNetIncome: 100_000_000},
+		{docType: "120", submissionDate: mustDate(t, "2024-06-24"), netIncome: 600_000_000, sharesIssued: 1_000_000},
+		// 期間不明の旧データは使わない
+		{docType: "SHORT_REPORT", submissionDate: mustDate(t, "2025-02-10"), netIncome: 1, netSales: 1},
+	}
+
+	m := calcGrowthMetrics(records)
+
+	if m.Q0EPSYoY == nil || math.Abs(*m.Q0EPSYoY-50.0) > 0.1 {
+		t.Errorf("Q0EPSYoY = %v, want 50.0", m.Q0EPSYoY)
+	}
+	if m.Q0SalesYoY == nil || math.Abs(*m.Q0SalesYoY-20.0) > 0.1 {
+		t.Errorf("Q0SalesYoY = %v, want 20.0", m.Q0SalesYoY)
+	}
+	if m.Q1EPSYoY != nil {
+		t.Errorf("Q1EPSYoY = %v, want nil (前の四半期なし)", *m.Q1EPSYoY)
+	}
+	// 有報同士: 900 vs 600 → +50% (決算短信の前年値 100 は使わない)
+	if m.Y0EPSYoY == nil || math.Abs(*m.Y0EPSYoY-50.0) > 0.1 {
+		t.Errorf("Y0EPSYoY = %v, want 50.0", m.Y0EPSYoY)
+	}
+}
+
+func TestCalcGrowthMetrics_ReconciledShortReportUsesAuditedReport(t *testing.T) {
+	records := []financialRecord{
+		// 提出の遅れた有報 (短信の80日後、同一期の判定窓 75日の外)
+		{docType: "120", submissionDate: mustDate(t, "2025-07-31"), netIncome: 800_000_000, sharesIssued: 1_000_000},
+		// 突合済みの短信は使わない (純利益を誤読していても成長率に影響しない)
+		{docType: "SHORT_REPORT", fiscalPeriod: "FY", submissionDate: mustDate(t, "2025-05-12"),
+			netIncome: 8_000_000, priorNetIncome: 600_000_000, reconciledDate: "2025-07-31"},
+		{docType: "120", submissionDate: mustDate(t, "2024-06-24"), netIncome: 600_000_000, sharesIssued: 1_000_000},
+	}
+
+	m := calcGrowthMetrics(records)
+
+	// 有報同士: 800 vs 600 → +33.3%
+	if m.Y0EPSYoY == nil || math.Abs(*m.Y0EPSYoY-33.3) > 0.1 {
+		t.Errorf("Y0EPSYoY = %v, want 33.3", m.Y0EPSYoY)
+	}
+}
+
 func TestCalcGrowthMetrics_EmptyReturnsNoMetrics(t *testing.T) {
 	m := calcGrowthMetrics(nil)
 	if m.Q0EPSYoY != nil || m.Y0EPSYoY != nil || m.EPS3YCAGR != nil {
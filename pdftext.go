@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// PDF テキスト抽出のバックエンド
+//
+//	pdftotext: poppler-utils の pdftotext -layout (従来の方式、列位置の再現が最も正確)
+//	go:        ledongthuc/pdf による Go 実装。外部コマンド不要で go test でも動く
+//	auto:      pdftotext があればそれを、無ければ go を使う
+//
+// 後段のパーサー (extractFromPeriodRow・業績予想修正の列対応など) は -layout の
+// 「1行 = 表の1行、列は表示桁位置で揃う」出力を前提にしているため、go バックエンドも同じ形に整形する。
+const (
+	PDFBackendAuto      = "auto"
+	PDFBackendGo        = "go"
+	PDFBackendPdftotext = "pdftotext"
+)
+
+// pdfBackend は -pdf-backend で選択されたバックエンド
+var pdfBackend = PDFBackendAuto
+
+// setPDFBackend は -pdf-backend の値を検証して設定する
+func setPDFBackend(name string) error {
+	switch name {
+	case PDFBackendAuto, PDFBackendGo:
+	case PDFBackendPdftotext:
+		if _, err := exec.LookPath("pdftotext"); err != nil {
+			return fmt.Errorf("-pdf-backend=pdftotext ですが pdftotext が見つかりません (docker compose build で導入)")
+		}
+	default:
+		return fmt.Errorf("unknown -pdf-backend %q (auto, go, pdftotext)", name)
+	}
+	pdfBackend = name
+	return nil
+}
+
+// resolvePDFBackend は auto を実際のバックエンドに解決する
+func resolvePDFBackend() string {
+	if pdfBackend != PDFBackendAuto {
+		return pdfBackend
+	}
+	if _, err := exec.LookPath("pdftotext"); err == nil {
+		return PDFBackendPdftotext
+	}
+	return PDFBackendGo
+}
+
+// extractPDFText は選択中のバックエンドで PDF からテキストを抽出する
+func extractPDFText(pdfPath string) (string, error) {
+	if resolvePDFBackend() == PDFBackendPdftotext {
+		return extractPDFTextPdftotext(pdfPath)
+	}
+	return extractPDFTextGo(pdfPath)
+}
+
+// extractPDFTextPdftotext は pdftotext コマンドで PDF からテキストを抽出する
+func extractPDFTextPdftotext(pdfPath string) (string, error) {
+	cmd := exec.Command("pdftotext", "-layout", "-enc", "UTF-8", pdfPath, "-")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// pdfRun は同じ行に連続して描画された文字列 (Tj/TJ 1回分とは限らない)
+type pdfRun struct {
+	x, y, size float64
+	endX       float64 // 描画終端の推定 X
+	text       string
+}
+
+// extractPDFTextGo は ledongthuc/pdf で各ページの文字を座標付きで取り出し、
+// pdftotext -layout と同じく「行ごと・X 座標に応じた桁位置」のテキストに組み直す。
+// ページ間は pdftotext と同じく改ページ (\f) で区切る
+func extractPDFTextGo(pdfPath string) (text string, err error) {
+	// ledongthuc/pdf は壊れた PDF で panic するので error に変換する
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("pdf parse panic: %v", r)
+		}
+	}()
+
+	f, r, err := pdf.Open(pdfPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var sb strings.Builder
+	for i := 1; i <= r.NumPage(); i++ {
+		p := r.Page(i)
+		if p.V.IsNull() {
+			continue
+		}
+		sb.WriteString(layoutPDFPage(p.Content().Text))
+		sb.WriteString("\f")
+	}
+	return sb.String(), nil
+}
+
+// layoutPDFPage は1ページ分の文字を行にまとめ、桁位置を揃えたテキストにする。
+//
+// CID フォント (日本語 PDF の大半) では ledongthuc/pdf が文字幅を取れず、Tj 1回分の文字が
+// 同じ X 座標で返ってくる。そのため文字単位ではなく「直前の文字の終端に続く文字」を
+// 1つの run にまとめ、run の開始 X だけを桁位置の計算に使う
+func layoutPDFPage(chars []pdf.Text) string {
+	var runs []pdfRun
+	for _, c := range chars {
+		if c.S == "" || c.FontSize <= 0 {
+			continue
+		}
+		if n := len(runs); n > 0 {
+			last := &runs[n-1]
+			tol := last.size * 0.3
+			if math.Abs(c.Y-last.y) < tol && (c.X == last.x || math.Abs(c.X-last.endX) < tol) {
+				last.text += c.S
+				last.endX = math.Max(last.endX, c.X+c.W)
+				continue
+			}
+		}
+		runs = append(runs, pdfRun{x: c.X, y: c.Y, size: c.FontSize, endX: c.X + c.W, text: c.S})
+	}
+	if len(runs) == 0 {
+		return ""
+	}
+
+	// 幅の取れなかった run は文字数 × 字幅で終端を推定する。
+	// 日本語 PDF では記号 (△・※・①など) も全角グリフなので、ASCII と半角カナ以外は全角とみなす
+	for i := range runs {
+		cells := 0
+		for _, c := range runs[i].text {
+			if c < 0x80 || (c >= 0xFF61 && c <= 0xFF9F) {
+				cells++
+			} else {
+				cells += 2
+			}
+		}
+		if est := runs[i].x + float64(cells)*runs[i].size/2; runs[i].endX < est {
+			runs[i].endX = est
+		}
+	}
+
+	// 1桁の幅は本文で最も多いフォントサイズの半角1文字分
+	sizeCount := map[float64]int{}
+	minX := runs[0].x
+	for _, r := range runs {
+		sizeCount[math.Round(r.size)] += len([]rune(r.text))
+		minX = math.Min(minX, r.x)
+	}
+	bodySize, best := 10.0, 0
+	for s, n := range sizeCount {
+		if n > best || (n == best && s < bodySize) {
+			bodySize, best = s, n
+		}
+	}
+	cell := bodySize / 2
+
+	// 上から下 (Y 降順) に並べ、ベースラインの近い run を1行にまとめる
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].y > runs[j].y })
+
+	var lines [][]pdfRun
+	for _, r := range runs {
+		if n := len(lines); n > 0 && math.Abs(lines[n-1][0].y-r.y) < bodySize*0.4 {
+			lines[n-1] = append(lines[n-1], r)
+			continue
+		}
+		lines = append(lines, []pdfRun{r})
+	}
+
+	var sb strings.Builder
+	for _, line := range lines {
+		sort.SliceStable(line, func(i, j int) bool { return line[i].x < line[j].x })
+		col := 0
+		prevEnd := math.Inf(-1)
+		for _, r := range line {
+			target := int(math.Round((r.x - minX) / cell))
+			switch {
+			case math.Abs(r.x-prevEnd) < cell*0.5:
+				// 直前の run に続けて描画された文字 (「△」+「2.0」など) は詰めて出力する
+			case target > col:
+				sb.WriteString(strings.Repeat(" ", target-col))
+				col = target
+			case col > 0 && r.x-prevEnd > cell*0.5:
+				// 桁位置が詰まっていても、離れて描画された run 同士は最低1文字空ける
+				sb.WriteString(" ")
+				col++
+			}
+			sb.WriteString(r.text)
+			col += displayWidth(r.text)
+			prevEnd = r.endX
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// tanshinPDFFixtures は決算短信サマリーを模した PDF と、経営成績表から読めるべき値 (百万円)
+var tanshinPDFFixtures = []struct {
+	name           string
+	pages          int
+	fiscalYearEnd  string
+	fiscalPeriod   string
+	current, prior FinancialData
+}{
+	{
+		// 日本基準の通期: 売上・営利・経常・純利の4列
+		name: "summary_jgaap.pdf", pages: 2, fiscalYearEnd: "2025-03", fiscalPeriod: "FY",
+		current: FinancialData{NetSales: 123456, OperatingIncome: 12345, NetIncome: 8765},
+		prior:   FinancialData{NetSales: 117345, OperatingIncome: 11420, NetIncome: 8230},
+	},
+	{
+		// IFRS の通期: 売上収益・営利・税引前・当期利益・親会社の所有者に帰属する当期利益の5列
+		name: "summary_ifrs.pdf", pages: 2, fiscalYearEnd: "2025-12", fiscalPeriod: "FY",
+		current: FinancialData{NetSales: 254321, OperatingIncome: 21870, NetIncome: 15118},
+		prior:   FinancialData{NetSales: 243610, OperatingIncome: 19846, NetIncome: 13498},
+	},
+	{
+		// 日本基準の第1四半期: 前年同期の行が続く
+		name: "summary_quarterly.pdf", pages: 1, fiscalYearEnd: "2026-03", fiscalPeriod: "Q1",
+		current: FinancialData{NetSales: 45120, OperatingIncome: 3870, NetIncome: 2744},
+		prior:   FinancialData{NetSales: 42450, OperatingIncome: 3443, NetIncome: 2384},
+	},
+}
+
+func TestTanshinPDFFixtures(t *testing.T) {
+	for _, f := range tanshinPDFFixtures {
+		text, err := extractPDFTextGo(filepath.Join("testdata", "tanshin_pdf", f.name))
+		if err != nil {
+			t.Fatalf("%s: %v", f.name, err)
+		}
+		if n := strings.Count(text, "\f"); n != f.pages {
+			t.Errorf("%s: 改ページ数 = %d, want %d", f.name, n, f.pages)
+		}
+		if fye, period := detectTanshinHeader(text); fye != f.fiscalYearEnd || period != f.fiscalPeriod {
+			t.Errorf("%s: detectTanshinHeader = (%q, %q), want (%q, %q)", f.name, fye, period, f.fiscalYearEnd, f.fiscalPeriod)
+		}
+		idx := strings.Index(text, "(1)連結経営成績")
+		if idx < 0 {
+			t.Fatalf("%s: go: 「(1)連結経営成績」が抽出テキストにない\n%s", f.name, text)
+		}
+		if got := extractFromPeriodRow(text[idx:]); got == nil || *got != f.current {
+			t.Errorf("%s: extractFromPeriodRow = %+v, want %+v", f.name, got, f.current)
+		}
+		if got := extractPriorPeriodRow(text); got == nil || *got != f.prior {
+			t.Errorf("%s: extractPriorPeriodRow = %+v, want %+v", f.name, got, f.prior)
+		}
+	}
+}
+
+func TestExtractPDFTextGo(t *testing.T) {
+	text, err := extractPDFTextGo(filepath.Join("testdata", "tanshin_pdf", "summary_jgaap.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 表の1行が1行のまま、左から右の順に並ぶこと (△ は数値に詰める)
+	for _, pattern := range []string{
+		`(?m)^2025年3月期\s+123,456\s+5\.2\s+12,345\s+8\.1\s+12,900\s+7\.9\s+8,765\s+6\.5$`,
+		`(?m)^2024年3月期\s+117,345\s+3\.1\s+11,420\s+△2\.0\s+11,955\s+1\.5\s+8,230\s+△0\.4$`,
+		`(?m)^\s+売上高\s+営業利益\s+経常利益$`,
+		`(?m)^\f?売上高\s+117,345\s+123,456$`,
+	} {
+		if !regexp.MustCompile(pattern).MatchString(text) {
+			t.Errorf("行が見つからない: %s\n%s", pattern, text)
+		}
+	}
+}
+
+func TestLayoutPDFPage(t *testing.T) {
+	// CID フォントは幅が 0 で同じ X の文字が並ぶ。Y の僅かなズレは同じ行として扱う
+	chars := []pdf.Text{
+		{FontSize: 10, X: 100, Y: 700, S: "営"},
+		{FontSize: 10, X: 100, Y: 700, S: "業"},
+		{FontSize: 10, X: 100, Y: 700, S: "利"},
+		{FontSize: 10, X: 100, Y: 700, S: "益"},
+		// 幅付きのフォントは文字ごとに X が進む
+		{FontSize: 10, X: 200, Y: 700.8, W: 5, S: "1"},
+		{FontSize: 10, X: 205, Y: 700.8, W: 5, S: "2"},
+		{FontSize: 10, X: 210, Y: 700.8, W: 3, S: ","},
+		{FontSize: 10, X: 213, Y: 700.8, W: 5, S: "3"},
+		{FontSize: 10, X: 150, Y: 700, S: "百万円"},
+		// 描画順が前後しても上の行が先
+		{FontSize: 10, X: 100, Y: 720, S: "見出し"},
+	}
+	got := layoutPDFPage(chars)
+	want := "見出し\n" + "営業利益" + strings.Repeat(" ", 2) + "百万円" + strings.Repeat(" ", 4) + "12,3\n"
+	if got != want {
+		t.Errorf("layoutPDFPage:\n got  %q\n want %q", got, want)
+	}
+}
+
+// 両バックエンドのパース結果が一致することを確認する。CI (poppler-utils を入れている) では pdftotext が無ければ失敗にする
+func TestPDFBackendsAgree(t *testing.T) {
+	if _, err := exec.LookPath("pdftotext"); err != nil {
+		if os.Getenv("CI") != "" {
+			t.Fatal("pdftotext がありません (poppler-utils をインストールしてください)")
+		}
+		t.Skip("pdftotext が無いためスキップ")
+	}
+	for _, f := range tanshinPDFFixtures {
+		name := f.name
+		path := filepath.Join("testdata", "tanshin_pdf", name)
+		goText, err := extractPDFTextGo(path)
+		if err != nil {
+			t.Fatalf("%s: go: %v", name, err)
+		}
+		popplerText, err := extractPDFTextPdftotext(path)
+		if err != nil {
+			t.Fatalf("%s: pdftotext: %v", name, err)
+		}
+		if g, p := parseTanshinText(goText), parseTanshinText(popplerText); g != p {
+			t.Errorf("%s: parseTanshinText\n go        %+v\n pdftotext %+v", name, g, p)
+		}
+		g, p := extractFromPeriodRow(goText), extractFromPeriodRow(popplerText)
+		if (g == nil) != (p == nil) || (g != nil && *g != *p) {
+			t.Errorf("%s: extractFromPeriodRow\n go        %+v\n pdftotext %+v", name, g, p)
+		}
+		g, p = extractPriorPeriodRow(goText), extractPriorPeriodRow(popplerText)
+		if (g == nil) != (p == nil) || (g != nil && *g != *p) {
+			t.Errorf("%s: extractPriorPeriodRow\n go        %+v\n pdftotext %+v", name, g, p)
+		}
+		gf, gp := detectTanshinHeader(goText)
+		if pf, pp := detectTanshinHeader(popplerText); gf != pf || gp != pp {
+			t.Errorf("%s: detectTanshinHeader go (%s, %s) / pdftotext (%s, %s)", name, gf, gp, pf, pp)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// 株価履歴の遡り取得 (backfill-prices) と stock_price.db の容量チェック
+//
+// fetch-prices は直近 -history-days 日だけを取る。52週高値・複数年のベース・/api/market-index の
+// 730日窓のように長い履歴が要る場合は、backfill-prices で各銘柄の最古の日付より前だけを取り足す
+// (直近のデータは取り直さない)。取得元に古いデータが無い銘柄 (上場が新しい等) は
+// price_history_coverage に要求済みの開始日を残し、次回は同じ期間を要求しない。
+
+const (
+	// defaultHistoryDays は -history-days の既定値 (従来どおり1年)
+	defaultHistoryDays = 365
+	// defaultMaxPriceDBMB は -max-price-db-mb の既定値。GitHub Releases の1ファイル上限 (2GB) に余裕を持たせる
+	defaultMaxPriceDBMB = 1500
+
+	priceDBPath = "./data/stock_price.db"
+	// priceRowBytesFallback は行数が少なく実測できないときの1行あたりの推定サイズ (インデックス込み)
+	priceRowBytesFallback = 64
+	// tradingDaysPerYear は年間の営業日数の目安 (容量見積もり用)
+	tradingDaysPerYear = 245
+)
+
+// priceDBUsage は stock_price.db の使用量
+type priceDBUsage struct {
+	Bytes int64
+	Rows  int64
+	Codes int
+}
+
+// bytesPerRow は実測の1行あたりのサイズ
+func (u priceDBUsage) bytesPerRow() float64 {
+	if u.Rows < 10_000 {
+		return priceRowBytesFallback
+	}
+	return float64(u.Bytes) / float64(u.Rows)
+}
+
+// loadPriceDBUsage はファイルサイズと行数・銘柄数を返す
+func loadPriceDBUsage(db *sql.DB) priceDBUsage {
+	var u priceDBUsage
+	if fi, err := os.Stat(priceDBPath); err == nil {
+		u.Bytes = fi.Size()
+	}
+	db.QueryRow(`SELECT COUNT(*), COUNT(DISTINCT code) FROM stock_prices`).Scan(&u.Rows, &u.Codes)
+	return u
+}
+
+// printPriceDBUsage は使用量を表示し、maxMB (0 は無制限) を超えていれば警告する
+func printPriceDBUsage(db *sql.DB, maxMB int) {
+	u := loadPriceDBUsage(db)
+	fmt.Printf("💾 stock_price.db: %.1f MB (%d行, %d銘柄, %.0f B/行)\n",
+		float64(u.Bytes)/1e6, u.Rows, u.Codes, u.bytesPerRow())
+	if maxMB > 0 && u.Bytes > int64(maxMB)*1_000_000 {
+		fmt.Printf("⚠️ 上限 %d MB を超えています。-history-days を短くするか古い行の削除を検討してください\n", maxMB)
+	}
+}
+
+// planBackfill は target まで遡るための銘柄ごとの取得ジョブを返す。
+// earliest は銘柄 → 保存済みの最古の日付、requested は銘柄 → 要求済みの開始日 (price_history_coverage)。
+// 株価の無い銘柄は期間全体、ある銘柄は最古の日付の前日までを取る
+func planBackfill(codes []string, earliest, requested map[string]string, target, today time.Time) []priceFetchJob {
+	targetStr := target.Format("2006-01-02")
+	var tasks []priceFetchJob
+	for _, code := range codes {
+		if r, ok := requested[code]; ok && r <= targetStr {
+			continue // 要求済み (取得元にそれより古いデータが無い)
+		}
+		first, ok := earliest[code]
+		if !ok {
+			tasks = append(tasks, priceFetchJob{Code: code, From: target, To: today})
+			continue
+		}
+		if first <= targetStr {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", first)
+		if err != nil {
+			continue
+		}
+		tasks = append(tasks, priceFetchJob{Code: code, From: target, To: t.AddDate(0, 0, -1)})
+	}
+	return tasks
+}
+
+// estimateBackfillRows は取得期間の合計から増える行数を見積もる
+func estimateBackfillRows(tasks []priceFetchJob) int64 {
+	var rows int64
+	for _, t := range tasks {
+		days := t.To.Sub(t.From).Hours()/24 + 1
+		rows += int64(days * tradingDaysPerYear / 365)
+	}
+	return rows
+}
+
+// errPriceDBFull は stock_price.db が -max-price-db-mb に達したため遡り取得を打ち切ったことを表す
+var errPriceDBFull = errors.New("stock_price.db が上限に到達")
+
+// backfillPrices は -mode=backfill-prices の本体。直近 historyDays 日より古い株価のうち未取得の期間を取り足す。
+// 取得は fetch-prices と同じく並行に行い (runPriceFetchJobs)、deadline を過ぎるか
+// stock_price.db が maxMB (0 は無制限) を超えたら途中で止める
+func backfillPrices(sourceNames, sourceConfigPath string, historyDays, maxMB int, deadline time.Duration, progressEvery int) {
+	sources, err := newPriceSourceSetFromFlags(sourceNames, sourceConfigPath)
+	if err != nil {
+		log.Fatalf("株価取得元の設定エラー: %v", err)
+	}
+
+	xbrlDB, err := initXbrlDB()
+	if err != nil {
+		log.Fatalf("xbrl.db初期化失敗: %v", err)
+	}
+	defer xbrlDB.Close()
+
+	priceDB, err := initPriceDB()
+	if err != nil {
+		log.Fatalf("stock_price.db初期化失敗: %v", err)
+	}
+	defer priceDB.Close()
+
+	sources.loadHealth(priceDB)
+	defer func() {
+		if err := sources.saveHealth(priceDB); err != nil {
+			log.Printf("⚠️ price_source_health 保存失敗: %v", err)
+		}
+	}()
+
+	var codes []string
+	rows, err := xbrlDB.Query("SELECT code FROM stocks ORDER BY code")
+	if err != nil {
+		log.Fatalf("銘柄コード取得失敗: %v", err)
+	}
+	for rows.Next() {
+		var code string
+		if rows.Scan(&code) == nil {
+			codes = append(codes, code)
+		}
+	}
+	rows.Close()
+
+	earliest := loadStringMap(priceDB, `SELECT code, MIN(date) FROM stock_prices GROUP BY code`)
+	requested := loadStringMap(priceDB, `SELECT code, requested_from FROM price_history_coverage`)
+
+	now := nowJST()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, jst)
+	target := today.AddDate(0, 0, -historyDays)
+	tasks := planBackfill(codes, earliest, requested, target, today)
+
+	usage := loadPriceDBUsage(priceDB)
+	estRows := estimateBackfillRows(tasks)
+	estBytes := int64(float64(estRows) * usage.bytesPerRow())
+	names := sources.names()
+	workers := sources.concurrency()
+	fmt.Printf("⏪ 株価の遡り取得: %s まで (%d日), 対象 %d/%d 銘柄, 取得元 %s, %d workers, deadline %s\n",
+		target.Format("2006-01-02"), historyDays, len(tasks), len(codes), strings.Join(names, " → "), workers, deadline)
+	fmt.Printf("💾 現在 %.1f MB → 見積もり +%d行 (+%.1f MB)\n", float64(usage.Bytes)/1e6, estRows, float64(estBytes)/1e6)
+	limit := int64(maxMB) * 1_000_000
+	if maxMB > 0 && usage.Bytes+estBytes > limit {
+		fmt.Printf("⚠️ 見積もりが上限 %d MB を超えます。上限に達した時点で中止します\n", maxMB)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+
+	writer := newPriceBatchWriter(priceDB, priceWriteBatchRows)
+	var covered []priceFetchJob // 要求した開始日を記録する銘柄 (取得できた・取得元にデータが無い)
+	fetched, errorCount, noDataCount, done := 0, 0, 0, 0
+	start := time.Now()
+	remaining, err := runPriceFetchJobs(ctx, sources, tasks, workers, func(r priceFetchResult) {
+		done++
+		switch {
+		case errors.Is(r.Err, errNoPriceData):
+			// 上場前の期間など。取得元に無いので次回も要求しない
+			fmt.Printf("  ⏭️ %s: %s より前のデータなし\n", r.Job.Code, r.Job.To.AddDate(0, 0, 1).Format("2006-01-02"))
+			noDataCount++
+			covered = append(covered, r.Job)
+		case r.Err != nil:
+			fmt.Printf("  ❌ %s: %v\n", r.Job.Code, r.Err)
+			errorCount++
+		default:
+			if r.Source != names[0] {
+				fmt.Printf("  🔁 %s: %s から取得\n", r.Job.Code, r.Source)
+			}
+			if err := writer.add(r.Job.Code, r.Prices, r.Source); err != nil {
+				fmt.Printf("  ❌ DB保存失敗: %v\n", err)
+			}
+			fetched++
+			covered = append(covered, r.Job)
+			if maxMB > 0 {
+				if fi, err := os.Stat(priceDBPath); err == nil && fi.Size() > limit {
+					stop(errPriceDBFull)
+				}
+			}
+		}
+		if progressEvery > 0 && (done%progressEvery == 0 || done == len(tasks)) {
+			elapsed := time.Since(start)
+			rate := float64(done) / elapsed.Seconds()
+			eta := time.Duration(float64(len(tasks)-done)/rate) * time.Second
+			fmt.Printf("  ⏳ [%d/%d] 取得 %d, エラー %d, データなし %d (%.1f 銘柄/秒, 残り約 %s)\n",
+				done, len(tasks), fetched, errorCount, noDataCount, rate, eta.Round(time.Second))
+		}
+	})
+	if err := writer.flush(); err != nil {
+		fmt.Printf("  ❌ DB保存失敗: %v\n", err)
+	}
+	for code, err := range writer.FailedCodes {
+		fmt.Printf("  ❌ %s: DB保存失敗 %v\n", code, err)
+	}
+
+	// 要求した開始日を記録し、次回は同じ期間を要求しない (保存に失敗した銘柄は次回取り直す)
+	if err := saveHistoryCoverage(priceDB, covered, writer.FailedCodes); err != nil {
+		log.Printf("⚠️ price_history_coverage 保存失敗: %v", err)
+	}
+
+	switch {
+	case errors.Is(err, errPriceDBFull):
+		fmt.Printf("\n⚠️ stock_price.db が上限 %d MB に達したため中止します (残り %d 銘柄)\n", maxMB, remaining)
+	case errors.Is(err, errPriceSourcesBlocked):
+		fmt.Printf("\n⚠️ 全ての取得元がブロックを継続しています。しばらく時間をおいてから再実行してください（取得済みの期間は飛ばして再開します）\n")
+	case errors.Is(err, context.DeadlineExceeded):
+		fmt.Printf("\n⚠️ 期限 %s に達したため中止します (未処理 %d 銘柄、再実行で続きから再開します)\n", deadline, remaining)
+	}
+
+	successCount := fetched - len(writer.FailedCodes)
+	errorCount += len(writer.FailedCodes)
+	fmt.Printf("\n📊 完了: 成功 %d, エラー %d, データなし %d, 追加 %d行, 未処理 %d (%s)\n",
+		successCount, errorCount, noDataCount, writer.Saved, remaining, time.Since(start).Round(time.Second))
+	// 指数は銘柄一覧に無いので別に取る
+	fetchIndexPrices(priceDB, sources, historyDays)
+
+	sources.printSummary()
+	printPriceDBUsage(priceDB, maxMB)
+
+	// 取り直した期間は取得元の分割調整の有無で段差が変わるため、分割・併合を見直す
+	if adjusted, detected, err := refreshCorporateActions(priceDB, nil); err != nil {
+		log.Printf("⚠️ 株式分割・併合の更新失敗: %v", err)
+	} else {
+		printCorporateActionSummary(priceDB, adjusted, detected)
+	}
+}
+
+// saveHistoryCoverage は jobs の開始日を price_history_coverage に記録する。failed の銘柄は記録しない
+func saveHistoryCoverage(db *sql.DB, jobs []priceFetchJob, failed map[string]error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`
+		INSERT INTO price_history_coverage (code, requested_from, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(code) DO UPDATE SET requested_from = excluded.requested_from, updated_at = excluded.updated_at`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	updatedAt := nowJST().Format("2006-01-02 15:04:05")
+	for _, j := range jobs {
+		if _, ok := failed[j.Code]; ok {
+			continue
+		}
+		if _, err := stmt.Exec(j.Code, j.From.Format("2006-01-02"), updatedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// loadStringMap は2列 (キー, 値) のクエリ結果をマップにする
+func loadStringMap(db *sql.DB, query string) map[string]string {
+	m := make(map[string]string)
+	rows, err := db.Query(query)
+	if err != nil {
+		return m
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k, v sql.NullString
+		if rows.Scan(&k, &v) == nil && k.Valid && v.Valid {
+			m[k.String] = v.String
+		}
+	}
+	return m
+}
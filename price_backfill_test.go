@@ -0,0 +1,68 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanBackfill(t *testing.T) {
+	today := mustDate(t, "2026-10-16")
+	target := today.AddDate(0, 0, -1095) // 2023-10-17
+	codes := []string{"7203", "6758", "9984", "3000", "4000"}
+	earliest := map[string]string{
+		"7203": "2025-10-16", // 1年分のみ → 前日まで遡る
+		"6758": "2023-10-02", // 取得済み
+		"3000": "2025-04-01", // 上場が新しく、要求済み
+	}
+	requested := map[string]string{"3000": "2023-01-01"}
+
+	tasks := planBackfill(codes, earliest, requested, target, today)
+
+	want := []priceFetchJob{
+		{Code: "7203", From: target, To: mustDate(t, "2025-10-15")},
+		{Code: "9984", From: target, To: today}, // 株価が無い銘柄は全期間
+		{Code: "4000", From: target, To: today},
+	}
+	if len(tasks) != len(want) {
+		t.Fatalf("tasks = %+v, want %+v", tasks, want)
+	}
+	for i := range want {
+		if tasks[i].Code != want[i].Code || !tasks[i].From.Equal(want[i].From) || !tasks[i].To.Equal(want[i].To) {
+			t.Errorf("tasks[%d] = %+v, want %+v", i, tasks[i], want[i])
+		}
+	}
+
+	// 2年分 (730日) × 245/365 ≒ 490 行
+	rows := estimateBackfillRows([]priceFetchJob{{From: today.AddDate(0, 0, -729), To: today}})
+	if rows < 485 || rows > 495 {
+		t.Errorf("estimateBackfillRows = %d, want ~490", rows)
+	}
+	if got := (priceDBUsage{Bytes: 64_000_000, Rows: 1_000_000}).bytesPerRow(); got != 64 {
+		t.Errorf("bytesPerRow = %v, want 64", got)
+	}
+}
+
+func TestSaveHistoryCoverage(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "stock_price.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE price_history_coverage (code TEXT PRIMARY KEY, requested_from TEXT, updated_at TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec(`INSERT INTO price_history_coverage VALUES ('7203', '2024-10-16', '')`)
+
+	target := mustDate(t, "2023-10-17")
+	jobs := []priceFetchJob{{Code: "7203", From: target}, {Code: "9984", From: target}, {Code: "6758", From: target}}
+	if err := saveHistoryCoverage(db, jobs, map[string]error{"6758": errors.New("disk I/O error")}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := loadStringMap(db, `SELECT code, requested_from FROM price_history_coverage`)
+	if len(got) != 2 || got["7203"] != "2023-10-17" || got["9984"] != "2023-10-17" {
+		t.Errorf("coverage = %v (保存に失敗した 6758 は記録しない)", got)
+	}
+}
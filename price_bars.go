@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"stock-analyzer/tradingcal"
+)
+
+// 日足から週足・月足を作る
+//
+// /api/prices/{code}?interval=1w|1mo のほか、RS・アラートのように週や月の単位で見たい処理からも使う。
+// 週は月曜〜日曜、月は暦月で区切り、足の日付 (Date) は営業日カレンダー上の期間の最終営業日
+// (金曜が祝日なら木曜) にする。期間の途中までしか日足が無い最後の足は Partial になる。
+// 分割・併合の調整は集計の前に日足で行う (週の途中の権利落ちで高安・出来高がずれないように)。
+
+const (
+	PriceInterval1d  = "1d"
+	PriceInterval1w  = "1w"
+	PriceInterval1mo = "1mo"
+)
+
+// PriceBar は週足・月足の1本 (日足の四本値・出来高の集計)
+type PriceBar struct {
+	StockPrice
+	PeriodStart string `json:"PeriodStart"` // 期間の最初の営業日
+	Days        int    `json:"Days"`        // 集計した日足の本数
+	TradingDays int    `json:"TradingDays"` // 期間の営業日数 (Days が少なければ欠損がある)
+	Partial     bool   `json:"Partial"`     // 期間が終わっていない (asOf が期間の最終営業日より前)
+}
+
+// validPriceInterval は interval が 1d / 1w / 1mo か
+func validPriceInterval(interval string) bool {
+	switch interval {
+	case PriceInterval1d, PriceInterval1w, PriceInterval1mo:
+		return true
+	}
+	return false
+}
+
+// pricePeriodBounds は d を含む期間の暦日の最初と最後 (週は月曜〜日曜、月は1日〜末日、日足は d 自身)
+func pricePeriodBounds(interval string, d time.Time) (start, end time.Time) {
+	d = time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case PriceInterval1w:
+		offset := (int(d.Weekday()) + 6) % 7 // 月曜 = 0
+		start = d.AddDate(0, 0, -offset)
+		return start, start.AddDate(0, 0, 6)
+	case PriceInterval1mo:
+		start = time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, -1)
+	}
+	return d, d
+}
+
+// aggregatePriceBars は日付の昇順の日足 (1銘柄) を interval の足にまとめる。
+// asOf (YYYY-MM-DD) より後に期間の最終営業日がある足は Partial
+func aggregatePriceBars(daily []StockPrice, interval string, cal *tradingcal.Calendar, asOf string) []PriceBar {
+	var bars []PriceBar
+	var curEnd time.Time
+	for _, p := range daily {
+		d, err := time.Parse("2006-01-02", p.Date)
+		if err != nil {
+			continue
+		}
+		if n := len(bars); n > 0 && !d.After(curEnd) {
+			b := &bars[n-1]
+			b.High = max(b.High, p.High)
+			b.Low = min(b.Low, p.Low)
+			b.Close = p.Close
+			b.Volume += p.Volume
+			b.Days++
+			continue
+		}
+
+		start, end := pricePeriodBounds(interval, d)
+		curEnd = end
+		first := cal.NextTradingDay(start.AddDate(0, 0, -1))
+		last := cal.PrevTradingDay(end.AddDate(0, 0, 1))
+		if last.Before(first) {
+			// 期間中に営業日が無い (臨時の取引など)。日足の日付を使う
+			first, last = d, d
+		}
+		bar := PriceBar{
+			StockPrice:  p,
+			PeriodStart: first.Format("2006-01-02"),
+			Days:        1,
+			TradingDays: max(cal.TradingDaysBetween(start.AddDate(0, 0, -1), end), 1),
+		}
+		bar.Date = last.Format("2006-01-02")
+		bars = append(bars, bar)
+	}
+	for i := range bars {
+		bars[i].Partial = bars[i].Date > asOf
+	}
+	return bars
+}
+
+// loadDailyPrices は1銘柄の from〜to (空なら制限なし) の日足を日付の昇順で返す。
+// schema は openServerDB の接続なら "price_db."、initPriceDB なら ""。adjuster が nil でなければ分割・併合を調整する
+func loadDailyPrices(db *sql.DB, schema, code, from, to string, adjuster priceAdjuster) ([]StockPrice, error) {
+	query := `SELECT code, date, open, high, low, close, COALESCE(volume, 0) FROM ` + schema + `stock_prices WHERE code = ?`
+	args := []any{code}
+	if from != "" {
+		query += ` AND date >= ?`
+		args = append(args, from)
+	}
+	if to != "" {
+		query += ` AND date <= ?`
+		args = append(args, to)
+	}
+	rows, err := db.Query(query+` ORDER BY date`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []StockPrice
+	for rows.Next() {
+		var p StockPrice
+		if err := rows.Scan(&p.Code, &p.Date, &p.Open, &p.High, &p.Low, &p.Close, &p.Volume); err != nil {
+			continue
+		}
+		if adjuster != nil {
+			p = adjuster.adjust(p)
+		}
+		prices = append(prices, p)
+	}
+	return prices, rows.Err()
+}
+
+// loadPriceBars は1銘柄の interval の足を返す。from は期間の最初まで広げて読む (最初の足が途中からにならないように)
+func loadPriceBars(db *sql.DB, schema, code, interval, from, to string, adjuster priceAdjuster, cal *tradingcal.Calendar) ([]PriceBar, error) {
+	if !validPriceInterval(interval) {
+		return nil, fmt.Errorf("interval は %s / %s / %s", PriceInterval1d, PriceInterval1w, PriceInterval1mo)
+	}
+	readFrom := from
+	if from != "" {
+		if d, err := time.Parse("2006-01-02", from); err == nil {
+			start, _ := pricePeriodBounds(interval, d)
+			readFrom = start.Format("2006-01-02")
+		}
+	}
+	daily, err := loadDailyPrices(db, schema, code, readFrom, to, adjuster)
+	if err != nil || len(daily) == 0 {
+		return nil, err
+	}
+	// 最後の日足より後に期間が続く足は途中 (to で切った場合も同じ)
+	return aggregatePriceBars(daily, interval, cal, daily[len(daily)-1].Date), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// dailyBars は日付 → 終値の日足 (始値=終値、高値=終値+10、安値=終値-10、出来高100)
+func dailyBars(dates []string, closes []float64) []StockPrice {
+	var prices []StockPrice
+	for i, d := range dates {
+		c := closes[i]
+		prices = append(prices, StockPrice{Code: "7203", Date: d, Open: c, High: c + 10, Low: c - 10, Close: c, Volume: 100})
+	}
+	return prices
+}
+
+func TestAggregatePriceBars_Weekly(t *testing.T) {
+	// 2024-02-19 の週は金曜 (2/23 天皇誕生日) が休場、2024-02-26 の週は途中まで
+	daily := dailyBars(
+		[]string{"2024-02-19", "2024-02-20", "2024-02-21", "2024-02-22", "2024-02-26", "2024-02-27"},
+		[]float64{100, 120, 90, 110, 130, 125},
+	)
+	got := aggregatePriceBars(daily, PriceInterval1w, tradingCalendar, "2024-02-27")
+	want := []PriceBar{
+		{
+			StockPrice:  StockPrice{Code: "7203", Date: "2024-02-22", Open: 100, High: 130, Low: 80, Close: 110, Volume: 400},
+			PeriodStart: "2024-02-19", Days: 4, TradingDays: 4,
+		},
+		{
+			StockPrice:  StockPrice{Code: "7203", Date: "2024-03-01", Open: 130, High: 140, Low: 115, Close: 125, Volume: 200},
+			PeriodStart: "2024-02-26", Days: 2, TradingDays: 5, Partial: true,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("weekly =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestAggregatePriceBars_Monthly(t *testing.T) {
+	// 2025年5月はゴールデンウィーク (5/5, 5/6) を除いて20営業日、月末は金曜 5/30
+	daily := dailyBars([]string{"2025-04-30", "2025-05-01", "2025-05-07", "2025-05-30", "2025-06-02"}, []float64{50, 60, 70, 65, 66})
+	got := aggregatePriceBars(daily, PriceInterval1mo, tradingCalendar, "2025-06-02")
+	type summary struct {
+		Date, Start      string
+		Open, Close      float64
+		Days, TradingDay int
+		Partial          bool
+	}
+	var sums []summary
+	for _, b := range got {
+		sums = append(sums, summary{b.Date, b.PeriodStart, b.Open, b.Close, b.Days, b.TradingDays, b.Partial})
+	}
+	want := []summary{
+		{"2025-04-30", "2025-04-01", 50, 50, 1, 21, false},
+		{"2025-05-30", "2025-05-01", 60, 65, 3, 20, false},
+		{"2025-06-30", "2025-06-02", 66, 66, 1, 21, true},
+	}
+	if !reflect.DeepEqual(sums, want) {
+		t.Errorf("monthly = %+v, want %+v", sums, want)
+	}
+
+	// 日足はそのまま1本ずつ
+	days := aggregatePriceBars(daily[:2], PriceInterval1d, tradingCalendar, "2025-05-01")
+	if len(days) != 2 || days[1].Date != "2025-05-01" || days[1].PeriodStart != "2025-05-01" || days[1].TradingDays != 1 {
+		t.Errorf("daily = %+v", days)
+	}
+}
+
+func TestLoadPriceBars(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "prices.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE stock_prices (
+		code TEXT, date TEXT, open REAL, high REAL, low REAL, close REAL, volume INTEGER, source TEXT,
+		PRIMARY KEY (code, date))`); err != nil {
+		t.Fatal(err)
+	}
+	// 週の途中 (水曜) に 1:2 の分割
+	for _, p := range dailyBars(
+		[]string{"2025-05-12", "2025-05-13", "2025-05-14", "2025-05-15", "2025-05-16"},
+		[]float64{1000, 1010, 505, 510, 500},
+	) {
+		if _, err := savePricesToDB(db, p.Code, []StockPrice{p}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	adjuster := priceAdjuster{"7203": {{Code: "7203", ExDate: "2025-05-14", Ratio: 2}}}
+
+	// from が週の途中でも週の最初から集計する
+	bars, err := loadPriceBars(db, "", "7203", PriceInterval1w, "2025-05-14", "", adjuster, tradingCalendar)
+	if err != nil || len(bars) != 1 {
+		t.Fatalf("bars = %+v, err = %v", bars, err)
+	}
+	b := bars[0]
+	// 調整後: 月火は 1/2 (500, 505)、出来高は2倍。高値は木曜の 520
+	if b.Open != 500 || b.High != 520 || b.Low != 490 || b.Close != 500 || b.Volume != 200+200+100+100+100 || b.Days != 5 || b.Partial {
+		t.Errorf("adjusted weekly = %+v", b)
+	}
+
+	raw, _ := loadPriceBars(db, "", "7203", PriceInterval1w, "", "", nil, tradingCalendar)
+	if len(raw) != 1 || raw[0].High != 1020 || raw[0].Volume != 500 {
+		t.Errorf("raw weekly = %+v", raw)
+	}
+	if _, err := loadPriceBars(db, "", "7203", "1h", "", "", nil, tradingCalendar); err == nil {
+		t.Error("未対応の interval はエラー")
+	}
+}
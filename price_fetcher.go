@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 株価の並行取得とまとめ書き
+//
+// fetch-prices は銘柄ごとのジョブを priceSourceSet.concurrency() 本のワーカーで並行に取得する。
+// 取得元のホストごとの同時接続数とリクエスト間隔は hostLimiter が守り、全体の期限は -fetch-deadline の context で切る。
+// DB への書き込みは結果を受け取る1本のゴルーチンだけが priceBatchWriter でまとめて行う。
+
+const (
+	// defaultFetchDeadline は -fetch-deadline の既定値 (日次の更新が終わらないまま翌日に食い込まないように)
+	defaultFetchDeadline = 90 * time.Minute
+	// defaultProgressEvery は -progress-every の既定値
+	defaultProgressEvery = 200
+	// priceWriteBatchRows は1トランザクションにまとめる行数の目安
+	priceWriteBatchRows = 5000
+	// maxCooldownWait は全取得元がクールダウンに入ったときに明けるのを待つ上限 (待つのは1回だけ)
+	maxCooldownWait = 10 * time.Minute
+)
+
+// errPriceSourcesBlocked は全取得元のクールダウンが明けても再びブロックされたため打ち切ったことを表す
+var errPriceSourcesBlocked = errors.New("全ての取得元がブロックを継続")
+
+// hostLimiter は1つのホストへの同時接続数とリクエスト開始の間隔を制限する
+type hostLimiter struct {
+	slots    chan struct{}
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time // 次のリクエストを開始してよい時刻
+}
+
+func newHostLimiter(concurrency int, interval time.Duration) *hostLimiter {
+	return &hostLimiter{slots: make(chan struct{}, max(concurrency, 1)), interval: interval}
+}
+
+// acquire は接続枠を取り、前のリクエストから interval 経つまで待つ。ctx が終わったら枠を返してエラー
+func (l *hostLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	start := time.Now()
+	if l.next.After(start) {
+		start = l.next
+	}
+	l.next = start.Add(l.interval)
+	l.mu.Unlock()
+
+	if d := time.Until(start); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			<-l.slots
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// release は接続枠を返す
+func (l *hostLimiter) release() {
+	<-l.slots
+}
+
+// priceFetchJob は1銘柄の取得期間
+type priceFetchJob struct {
+	Code     string
+	From, To time.Time
+}
+
+// priceFetchResult は1銘柄の取得結果
+type priceFetchResult struct {
+	Job    priceFetchJob
+	Prices []StockPrice
+	Source string
+	Err    error
+}
+
+// cooldownWaiter は全取得元がクールダウンに入ったときの待機を1回分だけ許す。
+// 同じ時期に止まったワーカーは同じ期限まで待ち、明けた後に再びクールダウンに入ったら打ち切る
+type cooldownWaiter struct {
+	mu      sync.Mutex
+	maxWait time.Duration
+	until   time.Time
+}
+
+func (c *cooldownWaiter) wait(ctx context.Context, next time.Time) bool {
+	c.mu.Lock()
+	switch {
+	case c.until.IsZero():
+		if time.Until(next) > c.maxWait {
+			c.mu.Unlock()
+			return false
+		}
+		c.until = next
+		fmt.Printf("\n⏸️ 全ての取得元がクールダウン中。%s 待機して再開を試みます...\n", time.Until(next).Round(time.Second))
+	case next.After(c.until):
+		c.mu.Unlock()
+		return false
+	}
+	until := c.until
+	c.mu.Unlock()
+
+	if d := time.Until(until); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// runPriceFetchJobs は jobs を workers 本で並行に取得し、結果を1本のゴルーチン (呼び出し元) で handle に渡す。
+// ctx の期限切れ・全取得元のブロック継続で打ち切った場合は、結果を返せなかったジョブの数と理由を返す
+func runPriceFetchJobs(ctx context.Context, sources *priceSourceSet, jobs []priceFetchJob, workers int, handle func(priceFetchResult)) (remaining int, err error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	jobCh := make(chan priceFetchJob)
+	resCh := make(chan priceFetchResult, workers)
+	waiter := &cooldownWaiter{maxWait: maxCooldownWait}
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				for {
+					prices, source, err := sources.fetch(ctx, job.Code, job.From, job.To, time.Now())
+					if errors.Is(err, errAllSourcesCoolingDown) {
+						if waiter.wait(ctx, sources.nextAvailable()) {
+							continue // 同じ銘柄から再開
+						}
+						cancel(errPriceSourcesBlocked)
+						break
+					}
+					if ctx.Err() != nil {
+						break // 打ち切り。結果は返さず未処理に数える
+					}
+					resCh <- priceFetchResult{Job: job, Prices: prices, Source: source, Err: err}
+					break
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobCh)
+		for _, j := range jobs {
+			select {
+			case jobCh <- j:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(resCh)
+	}()
+
+	done := 0
+	for r := range resCh {
+		handle(r)
+		done++
+	}
+	if remaining = len(jobs) - done; remaining > 0 {
+		return remaining, context.Cause(ctx)
+	}
+	return 0, nil
+}
+
+// priceRow は書き込み待ちの1行
+type priceRow struct {
+	StockPrice
+	source string
+}
+
+// priceBatchWriter は株価を priceWriteBatchRows 行ずつ1トランザクションで stock_prices (指数は index_prices) に書き込む。
+// 行ごとの失敗を数え、1行でも失敗した銘柄を覚えておく
+type priceBatchWriter struct {
+	db        *sql.DB
+	table     string
+	batchRows int
+	rows      []priceRow
+
+	Saved       int              // 保存した行数
+	Failed      int              // 保存に失敗した行数
+	FailedCodes map[string]error // 1行でも保存に失敗した銘柄 → 最初のエラー
+}
+
+func newPriceBatchWriter(db *sql.DB, batchRows int) *priceBatchWriter {
+	return &priceBatchWriter{db: db, table: "stock_prices", batchRows: batchRows, FailedCodes: make(map[string]error)}
+}
+
+// add は1銘柄の株価を書き込み待ちに加え、batchRows を超えたら書き込む
+func (w *priceBatchWriter) add(code string, prices []StockPrice, source string) error {
+	for _, p := range prices {
+		p.Code = code
+		w.rows = append(w.rows, priceRow{StockPrice: p, source: source})
+	}
+	if len(w.rows) >= w.batchRows {
+		return w.flush()
+	}
+	return nil
+}
+
+// flush は書き込み待ちの行を1トランザクションで書き込む。トランザクション自体の失敗は全行を失敗に数えて返す
+func (w *priceBatchWriter) flush() error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	rows := w.rows
+	w.rows = nil
+
+	failAll := func(err error) error {
+		for _, r := range rows {
+			w.fail(r.Code, err)
+		}
+		return err
+	}
+
+	tx, err := w.db.Begin()
+	if err != nil {
+		return failAll(err)
+	}
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO ` + w.table + ` (code, date, open, high, low, close, volume, source)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))
+	`)
+	if err != nil {
+		tx.Rollback()
+		return failAll(err)
+	}
+	defer stmt.Close()
+
+	saved := 0
+	for _, r := range rows {
+		if _, err := stmt.Exec(r.Code, r.Date, r.Open, r.High, r.Low, r.Close, r.Volume, r.source); err != nil {
+			w.fail(r.Code, err)
+			continue
+		}
+		saved++
+	}
+	if err := tx.Commit(); err != nil {
+		w.Failed -= len(rows) - saved // 行ごとに数えた分は数え直す
+		return failAll(err)
+	}
+	w.Saved += saved
+	return nil
+}
+
+func (w *priceBatchWriter) fail(code string, err error) {
+	w.Failed++
+	if _, ok := w.FailedCodes[code]; !ok {
+		w.FailedCodes[code] = err
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostLimiter(t *testing.T) {
+	l := newHostLimiter(2, 10*time.Millisecond)
+	var inFlight, peak int32
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.acquire(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			l.release()
+		}()
+	}
+	wg.Wait()
+	if peak > 2 {
+		t.Errorf("同時接続数 %d, want <= 2", peak)
+	}
+	// 6件の開始が 10ms 間隔なので最後の開始は 50ms 以降
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("6件が %s で終わった (間隔が守られていない)", elapsed)
+	}
+
+	// 枠が埋まっている間に ctx が終われば待たずにエラー
+	full := newHostLimiter(1, 0)
+	full.acquire(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := full.acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("acquire on cancelled ctx = %v", err)
+	}
+}
+
+// scriptedSource は銘柄ごとに決めたエラーを返す並行安全な取得元。delay があれば ctx が終わるまで待つ
+type scriptedSource struct {
+	errs  map[string]error
+	delay time.Duration
+	calls atomic.Int32
+}
+
+func (s *scriptedSource) Name() string { return "scripted" }
+func (s *scriptedSource) Host() string { return "scripted.example" }
+func (s *scriptedSource) IsBlocked(err error) bool {
+	return err.Error() == "blocked"
+}
+
+func (s *scriptedSource) Fetch(ctx context.Context, code string, from, to time.Time) ([]StockPrice, error) {
+	s.calls.Add(1)
+	if s.delay > 0 {
+		select {
+		case <-time.After(s.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err := s.errs[code]; err != nil {
+		return nil, err
+	}
+	return []StockPrice{{Code: code, Date: "2026-01-05", Close: 100}}, nil
+}
+
+func newScriptedSet(src *scriptedSource, threshold int, cooldown time.Duration) *priceSourceSet {
+	l := newHostLimiter(4, 0)
+	return &priceSourceSet{
+		sources:  []*trackedSource{{PriceSource: src, blockThreshold: threshold, cooldown: cooldown, limiter: l}},
+		limiters: map[string]*hostLimiter{src.Host(): l},
+	}
+}
+
+func scriptedJobs(codes ...string) []priceFetchJob {
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	jobs := make([]priceFetchJob, len(codes))
+	for i, c := range codes {
+		jobs[i] = priceFetchJob{Code: c, From: day, To: day}
+	}
+	return jobs
+}
+
+func TestRunPriceFetchJobs(t *testing.T) {
+	t.Run("全件の結果を返す", func(t *testing.T) {
+		src := &scriptedSource{errs: map[string]error{"1002": errors.New("HTTP status: 500"), "1003": errNoPriceData}}
+		set := newScriptedSet(src, 5, time.Minute)
+		got := make(map[string]error)
+		remaining, err := runPriceFetchJobs(context.Background(), set, scriptedJobs("1001", "1002", "1003", "1004", "1005"), set.concurrency(),
+			func(r priceFetchResult) { got[r.Job.Code] = r.Err })
+		if remaining != 0 || err != nil {
+			t.Fatalf("remaining=%d err=%v", remaining, err)
+		}
+		if len(got) != 5 || got["1001"] != nil || got["1002"] == nil || !errors.Is(got["1003"], errNoPriceData) {
+			t.Errorf("results = %v", got)
+		}
+	})
+
+	t.Run("期限切れで打ち切る", func(t *testing.T) {
+		src := &scriptedSource{delay: time.Hour}
+		set := newScriptedSet(src, 5, time.Minute)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+		handled := 0
+		remaining, err := runPriceFetchJobs(ctx, set, scriptedJobs("1001", "1002", "1003"), 2, func(priceFetchResult) { handled++ })
+		if !errors.Is(err, context.DeadlineExceeded) || remaining != 3 || handled != 0 {
+			t.Errorf("remaining=%d handled=%d err=%v", remaining, handled, err)
+		}
+		// 中断した取得は取得元の失敗に数えない
+		if h := set.sources[0].health; h.Attempts != 0 {
+			t.Errorf("attempts = %d, want 0", h.Attempts)
+		}
+	})
+
+	t.Run("クールダウンが長ければ打ち切る", func(t *testing.T) {
+		blocked := errors.New("blocked")
+		src := &scriptedSource{errs: map[string]error{"1001": blocked, "1002": blocked, "1003": blocked, "1004": blocked}}
+		set := newScriptedSet(src, 1, time.Hour)
+		remaining, err := runPriceFetchJobs(context.Background(), set, scriptedJobs("1001", "1002", "1003", "1004"), 1, func(priceFetchResult) {})
+		if !errors.Is(err, errPriceSourcesBlocked) || remaining == 0 {
+			t.Errorf("remaining=%d err=%v", remaining, err)
+		}
+		if n := src.calls.Load(); n != 1 {
+			t.Errorf("calls = %d, want 1 (クールダウン後は取得しない)", n)
+		}
+	})
+}
+
+func TestPriceBatchWriter(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "prices.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// close が 0 以下の行は保存に失敗させる
+	if _, err := db.Exec(`CREATE TABLE stock_prices (
+		code TEXT, date TEXT, open REAL, high REAL, low REAL, close REAL CHECK (close > 0), volume INTEGER, source TEXT,
+		PRIMARY KEY (code, date))`); err != nil {
+		t.Fatal(err)
+	}
+
+	w := newPriceBatchWriter(db, 3)
+	w.add("1001", []StockPrice{{Date: "2026-01-05", Close: 100}, {Date: "2026-01-06", Close: 101}}, "stooq")
+	w.add("1002", []StockPrice{{Date: "2026-01-05", Close: 0}, {Date: "2026-01-06", Close: 50}}, "yahoo") // 3行を超えたので書き込み
+	w.add("1003", []StockPrice{{Date: "2026-01-05", Close: 10}}, "")
+	if err := w.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if w.Saved != 4 || w.Failed != 1 || len(w.FailedCodes) != 1 || w.FailedCodes["1002"] == nil {
+		t.Errorf("saved=%d failed=%d failedCodes=%v", w.Saved, w.Failed, w.FailedCodes)
+	}
+	var rows int
+	db.QueryRow(`SELECT COUNT(*) FROM stock_prices`).Scan(&rows)
+	if rows != 4 {
+		t.Errorf("rows = %d, want 4", rows)
+	}
+
+	// savePricesToDB は失敗行があればエラーを返す
+	if n, err := savePricesToDB(db, "1004", []StockPrice{{Date: "2026-01-05", Close: 1}, {Date: "2026-01-06", Close: -1}}, ""); err == nil || n != 1 {
+		t.Errorf("savePricesToDB = (%d, %v), want (1, error)", n, err)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+)
+
+// 全銘柄の終値を1回の走査で読み、日付 × 銘柄の表としてメモリに持つ
+//
+// calc-rs は銘柄ごとに基準日と各期間の終値を QueryRow で引いていたため、銘柄数 × 5回の問い合わせになっていた。
+// pricePanel は stock_prices を (code, date) の順に1回だけ読み、銘柄ごとに全営業日の列 (値が無い日は NaN) を作る。
+// 「ある日以降で最も近い終値」は日付の二分探索で引けるので、RS 以外の横断的な計算 (騰落率の分布など) にも使える。
+
+// pricePanel は銘柄 × 日付の調整済み終値
+type pricePanel struct {
+	Dates []string    // 昇順 (いずれかの銘柄に行がある日)
+	Codes []string    // 昇順
+	Close [][]float64 // Close[銘柄][日付]。行が無い日は NaN、close が NULL の行は 0
+	first []int       // 銘柄の最初の行の日付の位置
+	index map[string]int
+}
+
+// loadPricePanel は table (stock_prices / index_prices) の from〜to (空なら制限なし) の終値を読む。
+// schema は openServerDB の接続なら "price_db."、initPriceDB なら ""。adjuster が nil でなければ分割・併合を調整する
+func loadPricePanel(db *sql.DB, schema, table, from, to string, adjuster priceAdjuster) (*pricePanel, error) {
+	query := `SELECT code, date, COALESCE(close, 0) FROM ` + schema + table + ` WHERE 1 = 1`
+	var args []any
+	if from != "" {
+		query += ` AND date >= ?`
+		args = append(args, from)
+	}
+	if to != "" {
+		query += ` AND date <= ?`
+		args = append(args, to)
+	}
+	rows, err := db.Query(query+` ORDER BY code, date`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 銘柄ごとの (日付, 終値) を読み、最後に日付の列へ並べ直す
+	var codes []string
+	var series [][]panelPoint
+	for rows.Next() {
+		var code, date string
+		var close float64
+		if err := rows.Scan(&code, &date, &close); err != nil {
+			continue
+		}
+		if n := len(codes); n == 0 || codes[n-1] != code {
+			codes = append(codes, code)
+			series = append(series, nil)
+		}
+		if adjuster != nil {
+			close = adjuster.adjustClose(code, date, close)
+		}
+		last := len(series) - 1
+		series[last] = append(series[last], panelPoint{date, close})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return newPricePanel(codes, series), nil
+}
+
+// loadRSPricePanel は基準日 from〜to の RS の計算に要る終値を1回の走査で読む
+// (最初の基準日 from のプロファイルの最も古い開始日〜to)。日次の calc-rs は from = to
+func loadRSPricePanel(priceDB *sql.DB, from, to string, profiles []rsProfile, adjuster priceAdjuster) (*pricePanel, error) {
+	fromDate, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return nil, err
+	}
+	oldest := from
+	for _, prof := range profiles {
+		oldest = min(oldest, prof.oldestStart(fromDate))
+	}
+	return loadPricePanel(priceDB, "", "stock_prices", oldest, to, adjuster)
+}
+
+// panelPoint は1銘柄の1日の終値
+type panelPoint struct {
+	date  string
+	close float64
+}
+
+// newPricePanel は銘柄 (昇順) ごとの日付昇順の終値から pricePanel を作る
+func newPricePanel(codes []string, series [][]panelPoint) *pricePanel {
+	p := &pricePanel{Codes: codes, index: make(map[string]int, len(codes))}
+	dateSet := make(map[string]struct{})
+	for i, code := range codes {
+		p.index[code] = i
+		for _, pt := range series[i] {
+			dateSet[pt.date] = struct{}{}
+		}
+	}
+	p.Dates = make([]string, 0, len(dateSet))
+	for d := range dateSet {
+		p.Dates = append(p.Dates, d)
+	}
+	sort.Strings(p.Dates)
+
+	p.Close = make([][]float64, len(series))
+	p.first = make([]int, len(series))
+	for i, pts := range series {
+		col := make([]float64, len(p.Dates))
+		for j := range col {
+			col[j] = math.NaN()
+		}
+		// 銘柄の日付も昇順なので、全体の日付を前から進めながら埋める
+		j := 0
+		for k, pt := range pts {
+			for p.Dates[j] != pt.date {
+				j++
+			}
+			col[j] = pt.close
+			if k == 0 {
+				p.first[i] = j
+			}
+		}
+		p.Close[i] = col
+	}
+	return p
+}
+
+// codeIndex は code の行番号 (無ければ -1)
+func (p *pricePanel) codeIndex(code string) int {
+	if i, ok := p.index[code]; ok {
+		return i
+	}
+	return -1
+}
+
+// lastDate は最新の日付 (空なら "")
+func (p *pricePanel) lastDate() string {
+	if len(p.Dates) == 0 {
+		return ""
+	}
+	return p.Dates[len(p.Dates)-1]
+}
+
+// firstDate は銘柄 c の最初の行の日付
+func (p *pricePanel) firstDate(c int) string {
+	return p.Dates[p.first[c]]
+}
+
+// closeAt は銘柄 c の date ちょうどの終値
+func (p *pricePanel) closeAt(c int, date string) (float64, bool) {
+	j := sort.SearchStrings(p.Dates, date)
+	if j == len(p.Dates) || p.Dates[j] != date || math.IsNaN(p.Close[c][j]) {
+		return 0, false
+	}
+	return p.Close[c][j], true
+}
+
+// closeOnOrAfter は銘柄 c の date 以降で最も近い行の終値
+func (p *pricePanel) closeOnOrAfter(c int, date string) (float64, bool) {
+	return p.closeBetween(c, date, "")
+}
+
+// closeBetween は銘柄 c の from〜to (空なら制限なし) で最も古い行の終値
+func (p *pricePanel) closeBetween(c int, from, to string) (float64, bool) {
+	col := p.Close[c]
+	for j := sort.SearchStrings(p.Dates, from); j < len(col); j++ {
+		if to != "" && p.Dates[j] > to {
+			break
+		}
+		if !math.IsNaN(col[j]) {
+			return col[j], true
+		}
+	}
+	return 0, false
+}
+
+// rsPerf は1銘柄の加重パフォーマンススコア
+type rsPerf struct {
+	Code  string
+	Score float64
+}
+
+// rsPerformances は基準日 baseDate の終値と各期間の開始日 (以降で最も近い日) の終値から、プロファイル prof の式で
+// 全銘柄のスコアを計算し、スコアの昇順に並べて返す。universe が nil でなければその銘柄だけを対象にする。
+// 基準日の終値が無い銘柄、終値のある期間が prof.MinPeriods に満たない銘柄、株価の履歴が prof.MinHistoryDays に
+// 満たない銘柄は skipped に数える。
+// 基準日より後の行は見ない (過去の基準日でも、その日に分かっていた株価だけで計算する)
+func (p *pricePanel) rsPerformances(baseDate string, prof rsProfile, periodStarts []string, universe map[string]bool) (perfs []rsPerf, skipped int) {
+	past := make([]float64, len(periodStarts))
+	historyStart := ""
+	if base, err := time.Parse("2006-01-02", baseDate); err == nil {
+		historyStart = prof.historyStart(base)
+	}
+	for c, code := range p.Codes {
+		if universe != nil && !universe[code] {
+			continue
+		}
+		latest, ok := p.closeAt(c, baseDate)
+		if !ok || latest <= 0 || (historyStart != "" && p.firstDate(c) > historyStart) {
+			skipped++
+			continue
+		}
+		for i, d := range periodStarts {
+			past[i], _ = p.closeBetween(c, d, baseDate)
+		}
+		score, ok := prof.performance(latest, past)
+		if !ok {
+			skipped++
+			continue
+		}
+		perfs = append(perfs, rsPerf{Code: code, Score: score})
+	}
+	sort.Slice(perfs, func(i, j int) bool {
+		return perfs[i].Score < perfs[j].Score
+	})
+	return perfs, skipped
+}
+
+// rsRank は昇順に並べた n 銘柄の i 番目のパーセンタイルランク (1-99)
+func rsRank(i, n int) int {
+	return min(int(float64(i+1)/float64(n)*98)+1, 99)
+}
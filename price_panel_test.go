@@ -0,0 +1,243 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newPanelTestDB は stock_prices だけの一時DB
+func newPanelTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(tb.TempDir(), "prices.db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`CREATE TABLE stock_prices (
+		code TEXT, date TEXT, open REAL, high REAL, low REAL, close REAL, volume INTEGER, source TEXT,
+		PRIMARY KEY (code, date))`); err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+// seedRandomPrices は codes 銘柄 × days 営業日の乱数の終値を入れる (欠損・終値0・分割を混ぜる)。最終日を返す
+func seedRandomPrices(tb testing.TB, db *sql.DB, codes, days int) (string, priceAdjuster) {
+	tb.Helper()
+	rng := rand.New(rand.NewSource(1))
+	var dates []string
+	d := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for range days {
+		d = tradingCalendar.NextTradingDay(d)
+		dates = append(dates, d.Format("2006-01-02"))
+	}
+	adjuster := priceAdjuster{}
+	for c := range codes {
+		code := fmt.Sprintf("%d", 1300+c)
+		price := 500 + rng.Float64()*2000
+		var prices []StockPrice
+		for i, date := range dates {
+			price *= 1 + (rng.Float64()-0.5)*0.06
+			switch r := rng.Intn(50); {
+			case r == 0:
+				continue // 欠損
+			case r == 1 && i != len(dates)-1:
+				prices = append(prices, StockPrice{Code: code, Date: date})
+				continue // 終値0
+			}
+			prices = append(prices, StockPrice{Code: code, Date: date, Open: price, High: price, Low: price, Close: price, Volume: 100})
+		}
+		// 上場が遅い銘柄・途中で止まった銘柄
+		switch c % 10 {
+		case 1:
+			prices = prices[len(prices)*3/4:]
+		case 2:
+			prices = prices[:len(prices)/2]
+		}
+		if c%7 == 0 {
+			adjuster[code] = []corporateAction{{Code: code, ExDate: dates[len(dates)/2], Ratio: 2}}
+		}
+		if _, err := savePricesToDB(db, code, prices, ""); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return dates[len(dates)-1], adjuster
+}
+
+// testPeriodStarts は baseDate の各期間の開始日
+func testPeriodStarts(tb testing.TB, baseDate string) []string {
+	tb.Helper()
+	base, err := time.Parse("2006-01-02", baseDate)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return defaultRSProfile().periodStarts(base)
+}
+
+// rsPerformancesByQuery は以前の calculateRS と同じく銘柄ごとに QueryRow で終値を引く (比較用)
+func rsPerformancesByQuery(db *sql.DB, adjuster priceAdjuster, baseDate string, periodStarts []string) ([]rsPerf, int) {
+	rows, err := db.Query(`SELECT DISTINCT code FROM stock_prices ORDER BY code`)
+	if err != nil {
+		return nil, 0
+	}
+	var codes []string
+	for rows.Next() {
+		var code string
+		rows.Scan(&code)
+		codes = append(codes, code)
+	}
+	rows.Close()
+
+	var perfs []rsPerf
+	skipped := 0
+	for _, code := range codes {
+		var latest float64
+		if err := db.QueryRow(`SELECT close FROM stock_prices WHERE code = ? AND date = ?`, code, baseDate).Scan(&latest); err != nil || latest <= 0 {
+			skipped++
+			continue
+		}
+		latest = adjuster.adjustClose(code, baseDate, latest)
+		past := make([]float64, 4)
+		for i, target := range periodStarts {
+			var date string
+			var price float64
+			db.QueryRow(`SELECT date, close FROM stock_prices WHERE code = ? AND date >= ? ORDER BY date ASC LIMIT 1`,
+				code, target).Scan(&date, &price)
+			past[i] = adjuster.adjustClose(code, date, price)
+		}
+		score, valid := rsPerformance(latest, past, []float64{0.4, 0.2, 0.2, 0.2})
+		if valid < 2 {
+			skipped++
+			continue
+		}
+		perfs = append(perfs, rsPerf{Code: code, Score: score})
+	}
+	sort.Slice(perfs, func(i, j int) bool { return perfs[i].Score < perfs[j].Score })
+	return perfs, skipped
+}
+
+func TestLoadPricePanel(t *testing.T) {
+	db := newPanelTestDB(t)
+	for _, p := range []StockPrice{
+		{Code: "7203", Date: "2025-05-12", Close: 1000},
+		{Code: "7203", Date: "2025-05-14", Close: 505},
+		{Code: "6758", Date: "2025-05-09", Close: 3000},
+		{Code: "6758", Date: "2025-05-13", Close: 3100},
+		{Code: "6758", Date: "2025-05-14", Close: 3200},
+	} {
+		if _, err := savePricesToDB(db, p.Code, []StockPrice{p}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	adjuster := priceAdjuster{"7203": {{Code: "7203", ExDate: "2025-05-14", Ratio: 2}}}
+
+	p, err := loadPricePanel(db, "", "stock_prices", "2025-05-12", "", adjuster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2025-05-12", "2025-05-13", "2025-05-14"}; !reflect.DeepEqual(p.Dates, want) {
+		t.Errorf("Dates = %v, want %v", p.Dates, want)
+	}
+	if want := []string{"6758", "7203"}; !reflect.DeepEqual(p.Codes, want) {
+		t.Errorf("Codes = %v, want %v", p.Codes, want)
+	}
+	if p.lastDate() != "2025-05-14" {
+		t.Errorf("lastDate = %s", p.lastDate())
+	}
+
+	toyota := p.codeIndex("7203")
+	tests := []struct {
+		name   string
+		get    func(int, string) (float64, bool)
+		date   string
+		want   float64
+		wantOK bool
+	}{
+		{"調整済みの終値", p.closeAt, "2025-05-12", 500, true},
+		{"行が無い日", p.closeAt, "2025-05-13", 0, false},
+		{"範囲外", p.closeAt, "2025-05-09", 0, false},
+		{"以降で最も近い日", p.closeOnOrAfter, "2025-05-13", 505, true},
+		{"範囲より前", p.closeOnOrAfter, "2025-01-01", 500, true},
+		{"範囲より後", p.closeOnOrAfter, "2025-05-15", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.get(toyota, tt.date)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: %s = %v, %v, want %v, %v", tt.name, tt.date, got, ok, tt.want, tt.wantOK)
+		}
+	}
+	if p.codeIndex("9999") != -1 {
+		t.Error("無い銘柄は -1")
+	}
+}
+
+func TestRSPerformancesMatchQueries(t *testing.T) {
+	db := newPanelTestDB(t)
+	baseDate, adjuster := seedRandomPrices(t, db, 60, 300)
+	starts := testPeriodStarts(t, baseDate)
+
+	want, wantSkipped := rsPerformancesByQuery(db, adjuster, baseDate, starts)
+	panel, err := loadRSPricePanel(db, baseDate, baseDate, []rsProfile{defaultRSProfile()}, adjuster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := panel.rsPerformances(baseDate, defaultRSProfile(), starts, nil)
+	if len(want) == 0 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("panel =\n%v\nqueries =\n%v", got, want)
+	}
+	// 12ヶ月前より古い行しか無い銘柄は panel に入らないので、skipped はその分だけ少ない
+	var old int
+	db.QueryRow(`SELECT COUNT(DISTINCT code) FROM stock_prices WHERE code NOT IN
+		(SELECT code FROM stock_prices WHERE date >= ?)`, starts[3]).Scan(&old)
+	if _, skipped := panel.rsPerformances(baseDate, defaultRSProfile(), starts, nil); skipped+old != wantSkipped {
+		t.Errorf("skipped = %d + %d, want %d", skipped, old, wantSkipped)
+	}
+	for i := range got {
+		if rsRank(i, len(got)) < 1 || rsRank(i, len(got)) > 99 {
+			t.Errorf("rank(%d) = %d", i, rsRank(i, len(got)))
+		}
+	}
+}
+
+// BenchmarkRSPerformances は銘柄ごとの問い合わせと pricePanel を比べる (基準日1日 = 日次の calc-rs と、
+// 直近20営業日をまとめて計算する calc-rs -from -to の場合)。panel は calculateRS・backfillRS と同じ loadRSPricePanel で読む
+func BenchmarkRSPerformances(b *testing.B) {
+	db := newPanelTestDB(b)
+	// 約6年分 (stock_prices は過去分を遡って取得するので、12ヶ月より十分長い履歴がある)
+	baseDate, adjuster := seedRandomPrices(b, db, 300, 1500)
+	for _, days := range []int{1, 20} {
+		var bases []string
+		var starts [][]string
+		base, _ := time.Parse("2006-01-02", baseDate)
+		for range days {
+			bases = append(bases, base.Format("2006-01-02"))
+			starts = append(starts, testPeriodStarts(b, base.Format("2006-01-02")))
+			base = tradingCalendar.PrevTradingDay(base)
+		}
+
+		b.Run(fmt.Sprintf("query/%ddays", days), func(b *testing.B) {
+			for b.Loop() {
+				for i, d := range bases {
+					rsPerformancesByQuery(db, adjuster, d, starts[i])
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("panel/%ddays", days), func(b *testing.B) {
+			for b.Loop() {
+				panel, err := loadRSPricePanel(db, bases[len(bases)-1], baseDate, []rsProfile{defaultRSProfile()}, adjuster)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for i, d := range bases {
+					panel.rsPerformances(d, defaultRSProfile(), starts[i], nil)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,553 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 株価データの品質チェック (-mode=check-prices) と修復 (-fix)
+//
+// stock_price.db を銘柄ごとに読み、次の問題を price_quality_issues に記録する:
+//   - bad_ohlc:       四本値のどれかが 0 以下 (取得元の null・解析失敗が 0 で保存された行)
+//   - high_low:       高値 < 安値、または始値・終値が高値〜安値の範囲外
+//   - duplicate_date: 書式違いの日付 ("2025-05-16 00:00:00" など) の行。同じ日が二重に数えられる
+//   - gap:            営業日カレンダー上の欠損 (他の銘柄には株価がある日が priceGapMinDays 日以上続けて無い)
+//   - spike:          分割・併合の無い値幅制限超えの変動、または1日だけ大きく跳ねて翌日戻った足
+//
+// -fix は書式違いの日付を直し、それ以外は問題の前後を別の取得元から取り直す。
+// 取り直しても残った問題は open のまま、消えた問題は fixed にする。
+const (
+	PriceIssueBadOHLC   = "bad_ohlc"
+	PriceIssueHighLow   = "high_low"
+	PriceIssueDuplicate = "duplicate_date"
+	PriceIssueGap       = "gap"
+	PriceIssueSpike     = "spike"
+
+	PriceIssueStatusOpen  = "open"
+	PriceIssueStatusFixed = "fixed"
+
+	// priceIssueMarketWide は全銘柄に共通の欠損 (その日の株価が1件も無い) の code
+	priceIssueMarketWide = "*"
+
+	// priceGapMinDays は欠損として記録する連続営業日数 (売買の無い日を省く取得元があるため1〜2日は数えない)
+	priceGapMinDays = 3
+	// spikeMove / spikeRevert は「1日だけの跳ね」の判定 (前日比 30% 以上動き、翌日に前日比 10% 以内へ戻る)
+	spikeMove   = 0.3
+	spikeRevert = 0.1
+	// priceFixMarginDays は取り直す範囲を問題の前後に広げる日数
+	priceFixMarginDays = 5
+)
+
+// priceIssue は price_quality_issues の1行
+type priceIssue struct {
+	Code    string
+	Date    string
+	Kind    string
+	EndDate string // gap の最終日 (それ以外は Date と同じ)
+	Detail  string
+	Source  string // 問題の行の取得元 (gap は空)
+}
+
+// canonicalPriceDate は日付の先頭10文字が YYYY-MM-DD ならそれを返す
+func canonicalPriceDate(date string) (string, bool) {
+	if len(date) < 10 {
+		return "", false
+	}
+	d := date[:10]
+	if _, err := time.Parse("2006-01-02", d); err != nil {
+		return "", false
+	}
+	return d, true
+}
+
+// checkPriceSeries は1銘柄の株価 (日付の昇順) を調べる。
+// adjustDates は分割・併合で調整済みの権利落ち日、marketDays は1銘柄でも株価がある日
+func checkPriceSeries(code string, rows []priceRow, adjustDates, marketDays map[string]bool) []priceIssue {
+	var issues []priceIssue
+	add := func(r priceRow, date, kind, detail string) {
+		issues = append(issues, priceIssue{Code: code, Date: date, Kind: kind, EndDate: date, Detail: detail, Source: r.source})
+	}
+
+	// 日付の書式・重複
+	seen := make(map[string]bool)
+	var series []priceRow
+	for _, r := range rows {
+		d, ok := canonicalPriceDate(r.Date)
+		if !ok {
+			continue
+		}
+		if d != r.Date {
+			add(r, d, PriceIssueDuplicate, fmt.Sprintf("書式違いの日付 %q", r.Date))
+		}
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		r.Date = d
+		series = append(series, r)
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Date < series[j].Date })
+
+	// 1本ごとの四本値
+	var valid []priceRow
+	for _, r := range series {
+		if r.Open <= 0 || r.High <= 0 || r.Low <= 0 || r.Close <= 0 {
+			add(r, r.Date, PriceIssueBadOHLC, fmt.Sprintf("O=%g H=%g L=%g C=%g", r.Open, r.High, r.Low, r.Close))
+			continue
+		}
+		if r.High < r.Low || r.Close > r.High || r.Close < r.Low || r.Open > r.High || r.Open < r.Low {
+			add(r, r.Date, PriceIssueHighLow, fmt.Sprintf("O=%g H=%g L=%g C=%g", r.Open, r.High, r.Low, r.Close))
+		}
+		valid = append(valid, r)
+	}
+
+	// 跳ね・値幅制限超え
+	for i := 1; i < len(valid); i++ {
+		prev, cur := valid[i-1], valid[i]
+		if !withinGapWindow(prev.Date, cur.Date) || adjustDates[cur.Date] {
+			continue
+		}
+		move := cur.Close/prev.Close - 1
+		if math.Abs(cur.Close-prev.Close) > dailyPriceLimit(prev.Close) {
+			add(cur, cur.Date, PriceIssueSpike, fmt.Sprintf("値幅制限超え %g → %g (%+.1f%%)、分割・併合なし", prev.Close, cur.Close, move*100))
+			continue
+		}
+		if i+1 < len(valid) && math.Abs(move) >= spikeMove && math.Abs(valid[i+1].Close/prev.Close-1) <= spikeRevert {
+			add(cur, cur.Date, PriceIssueSpike, fmt.Sprintf("1日だけの跳ね %g → %g → %g", prev.Close, cur.Close, valid[i+1].Close))
+		}
+	}
+
+	// 営業日の欠損 (最初と最後の株価の間)
+	if len(series) > 1 {
+		first, _ := time.Parse("2006-01-02", series[0].Date)
+		last, _ := time.Parse("2006-01-02", series[len(series)-1].Date)
+		var missing []string
+		flush := func() {
+			if len(missing) >= priceGapMinDays {
+				issues = append(issues, priceIssue{
+					Code: code, Date: missing[0], Kind: PriceIssueGap, EndDate: missing[len(missing)-1],
+					Detail: fmt.Sprintf("%d営業日欠損 (%s〜%s)", len(missing), missing[0], missing[len(missing)-1]),
+				})
+			}
+			missing = nil
+		}
+		for d := tradingCalendar.NextTradingDay(first); d.Before(last); d = tradingCalendar.NextTradingDay(d) {
+			ds := d.Format("2006-01-02")
+			switch {
+			case seen[ds]:
+				flush()
+			case marketDays[ds]:
+				missing = append(missing, ds)
+			}
+			// 全銘柄に無い日は銘柄ごとの欠損に数えない (checkMarketDays で1件にまとめる)
+		}
+		flush()
+	}
+	return issues
+}
+
+// checkMarketDays は first〜last の営業日のうち、1銘柄も株価の無い日を1件の問題にまとめる
+func checkMarketDays(marketDays map[string]bool, first, last string) []priceIssue {
+	f, err1 := time.Parse("2006-01-02", first)
+	l, err2 := time.Parse("2006-01-02", last)
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+	var issues []priceIssue
+	for d := f; !d.After(l); d = tradingCalendar.NextTradingDay(d) {
+		ds := d.Format("2006-01-02")
+		if tradingCalendar.IsTradingDay(d) && !marketDays[ds] {
+			issues = append(issues, priceIssue{
+				Code: priceIssueMarketWide, Date: ds, Kind: PriceIssueGap, EndDate: ds,
+				Detail: "全銘柄の株価が無い営業日 (backfill-prices で取得)",
+			})
+		}
+	}
+	return issues
+}
+
+// forEachPriceSeries は銘柄ごとの全行 (日付順) を fn に渡す。codes が空なら全銘柄
+func forEachPriceSeries(db *sql.DB, codes []string, fn func(code string, rows []priceRow)) error {
+	query := `SELECT code, date, COALESCE(open, 0), COALESCE(high, 0), COALESCE(low, 0), COALESCE(close, 0),
+	                 COALESCE(volume, 0), COALESCE(source, '')
+	          FROM stock_prices`
+	var args []any
+	if len(codes) > 0 {
+		query += ` WHERE code IN (?` + strings.Repeat(",?", len(codes)-1) + `)`
+		for _, c := range codes {
+			args = append(args, c)
+		}
+	}
+	query += ` ORDER BY code, date`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var cur string
+	var series []priceRow
+	for rows.Next() {
+		var r priceRow
+		if err := rows.Scan(&r.Code, &r.Date, &r.Open, &r.High, &r.Low, &r.Close, &r.Volume, &r.source); err != nil {
+			continue
+		}
+		if r.Code != cur && len(series) > 0 {
+			fn(cur, series)
+			series = nil
+		}
+		cur = r.Code
+		series = append(series, r)
+	}
+	if len(series) > 0 {
+		fn(cur, series)
+	}
+	return rows.Err()
+}
+
+// loadMarketDays は1銘柄でも株価のある日と、全体の最初・最後の日
+func loadMarketDays(db *sql.DB) (days map[string]bool, first, last string) {
+	days = make(map[string]bool)
+	rows, err := db.Query(`SELECT DISTINCT substr(date, 1, 10) FROM stock_prices`)
+	if err != nil {
+		return days, "", ""
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d string
+		if rows.Scan(&d) != nil {
+			continue
+		}
+		days[d] = true
+		if first == "" || d < first {
+			first = d
+		}
+		if d > last {
+			last = d
+		}
+	}
+	return days, first, last
+}
+
+// loadAdjustDates は銘柄 → 調整に使う権利落ち日
+func loadAdjustDates(db *sql.DB) map[string]map[string]bool {
+	m := make(map[string]map[string]bool)
+	actions, err := loadCorporateActions(db, "", CorporateActionAdjust)
+	if err != nil {
+		return m
+	}
+	for code, as := range actions {
+		m[code] = make(map[string]bool, len(as))
+		for _, a := range as {
+			m[code][a.ExDate] = true
+		}
+	}
+	return m
+}
+
+// checkPrices は codes (空なら全銘柄) を調べ、銘柄 → 問題を返す。全銘柄のときは全体の欠損も含める
+func checkPrices(db *sql.DB, codes []string) (map[string][]priceIssue, error) {
+	marketDays, first, last := loadMarketDays(db)
+	adjust := loadAdjustDates(db)
+	found := make(map[string][]priceIssue)
+	err := forEachPriceSeries(db, codes, func(code string, rows []priceRow) {
+		found[code] = checkPriceSeries(code, rows, adjust[code], marketDays)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(codes) == 0 {
+		found[priceIssueMarketWide] = checkMarketDays(marketDays, first, last)
+	}
+	return found, nil
+}
+
+// savePriceIssues は銘柄ごとの問題を保存する。前回 open だった問題で今回見つからなかったものは fixed にする
+func savePriceIssues(db *sql.DB, found map[string][]priceIssue) (fixed int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	checkedAt := nowJST().Format("2006-01-02 15:04:05")
+	for code, issues := range found {
+		// 前回 open のうち今回見つからなかったものを数えてから、全て fixed にして今回の分を open に戻す
+		open := make(map[[2]string]bool)
+		rows, err := tx.Query(`SELECT date, kind FROM price_quality_issues WHERE code = ? AND status = ?`, code, PriceIssueStatusOpen)
+		if err != nil {
+			return 0, err
+		}
+		for rows.Next() {
+			var k [2]string
+			if rows.Scan(&k[0], &k[1]) == nil {
+				open[k] = true
+			}
+		}
+		rows.Close()
+		for _, is := range issues {
+			delete(open, [2]string{is.Date, is.Kind})
+		}
+		fixed += len(open)
+
+		if _, err := tx.Exec(`
+			UPDATE price_quality_issues SET status = ?, fixed_at = ?
+			WHERE code = ? AND status = ?`,
+			PriceIssueStatusFixed, checkedAt, code, PriceIssueStatusOpen); err != nil {
+			return 0, err
+		}
+		for _, is := range issues {
+			if _, err := tx.Exec(`
+				INSERT INTO price_quality_issues (code, date, kind, end_date, detail, source, status, checked_at, fixed_at)
+				VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, NULL)
+				ON CONFLICT(code, date, kind) DO UPDATE SET
+					end_date = excluded.end_date,
+					detail = excluded.detail,
+					source = excluded.source,
+					status = excluded.status,
+					checked_at = excluded.checked_at,
+					fixed_at = NULL`,
+				is.Code, is.Date, is.Kind, is.EndDate, is.Detail, is.Source, PriceIssueStatusOpen, checkedAt); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return fixed, tx.Commit()
+}
+
+// normalizePriceDates は書式違いの日付の行を YYYY-MM-DD にそろえる (同じ日の行が既にあればそちらを残す)
+func normalizePriceDates(db *sql.DB, code string) (int, error) {
+	res, err := db.Exec(`
+		DELETE FROM stock_prices
+		WHERE code = ? AND length(date) != 10
+		  AND substr(date, 1, 10) IN (SELECT date FROM stock_prices WHERE code = ? AND length(date) = 10)`, code, code)
+	if err != nil {
+		return 0, err
+	}
+	deleted, _ := res.RowsAffected()
+	res, err = db.Exec(`
+		UPDATE OR IGNORE stock_prices SET date = substr(date, 1, 10)
+		WHERE code = ? AND length(date) != 10`, code)
+	if err != nil {
+		return int(deleted), err
+	}
+	updated, _ := res.RowsAffected()
+	return int(deleted + updated), nil
+}
+
+// priceFixRange は取り直す期間と避ける取得元 (問題の行で多い取得元) を返す
+func priceFixRange(issues []priceIssue) (from, to time.Time, avoid string, ok bool) {
+	sources := make(map[string]int)
+	for _, is := range issues {
+		if is.Kind == PriceIssueDuplicate {
+			continue
+		}
+		f, err1 := time.Parse("2006-01-02", is.Date)
+		t, err2 := time.Parse("2006-01-02", is.EndDate)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if !ok || f.Before(from) {
+			from = f
+		}
+		if !ok || t.After(to) {
+			to = t
+		}
+		ok = true
+		if is.Source != "" {
+			sources[is.Source]++
+		}
+	}
+	for s, n := range sources {
+		if avoid == "" || n > sources[avoid] || (n == sources[avoid] && s < avoid) {
+			avoid = s
+		}
+	}
+	return from.AddDate(0, 0, -priceFixMarginDays), to.AddDate(0, 0, priceFixMarginDays), avoid, ok
+}
+
+// fixPriceIssues は問題のある銘柄を修復し、修復を試みた銘柄を返す
+func fixPriceIssues(db *sql.DB, sources *priceSourceSet, found map[string][]priceIssue) []string {
+	var codes []string
+	for code, issues := range found {
+		if code != priceIssueMarketWide && len(issues) > 0 {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	if len(codes) == 0 {
+		return nil
+	}
+	fmt.Printf("\n🔧 %d銘柄を修復...\n", len(codes))
+
+	var touched []string
+	for i, code := range codes {
+		issues := found[code]
+		for _, is := range issues {
+			if is.Kind == PriceIssueDuplicate {
+				if n, err := normalizePriceDates(db, code); err != nil {
+					fmt.Printf("  ❌ %s: 日付の正規化失敗 %v\n", code, err)
+				} else {
+					fmt.Printf("  🗓️ %s: 日付の書式を %d行修正\n", code, n)
+				}
+				touched = append(touched, code)
+				break
+			}
+		}
+
+		from, to, avoid, ok := priceFixRange(issues)
+		if !ok {
+			continue
+		}
+		prices, source, err := sources.fetchAvoiding(context.Background(), avoid, code, from, to, time.Now())
+		if errors.Is(err, errAllSourcesCoolingDown) {
+			fmt.Printf("  ⚠️ 全ての取得元がクールダウン中のため中止します (残り %d 銘柄)\n", len(codes)-i)
+			break
+		}
+		if err != nil {
+			fmt.Printf("  ❌ [%d/%d] %s: 取り直し失敗 %v\n", i+1, len(codes), code, err)
+			continue
+		}
+		n, err := savePricesToDB(db, code, prices, source)
+		if err != nil {
+			fmt.Printf("  ❌ %s: DB保存失敗 %v\n", code, err)
+		}
+
+		// 取り直しても四本値が壊れたままの行は削除する (0 の足より欠損のほうが扱いやすい)
+		got := make(map[string]bool, len(prices))
+		for _, p := range prices {
+			got[p.Date] = true
+		}
+		removed := 0
+		for _, is := range issues {
+			if is.Kind == PriceIssueBadOHLC && !got[is.Date] {
+				if res, err := db.Exec(`DELETE FROM stock_prices WHERE code = ? AND substr(date, 1, 10) = ?`, code, is.Date); err == nil {
+					k, _ := res.RowsAffected()
+					removed += int(k)
+				}
+			}
+		}
+		fmt.Printf("  ✅ [%d/%d] %s: %s〜%s を %s から %d件取り直し", i+1, len(codes), code,
+			from.Format("2006-01-02"), to.Format("2006-01-02"), source, n)
+		if removed > 0 {
+			fmt.Printf(", 壊れた行を %d件削除", removed)
+		}
+		fmt.Println()
+		touched = append(touched, code)
+	}
+	return touched
+}
+
+// runCheckPrices は -mode=check-prices の本体。code を指定すればその銘柄だけ、fix なら修復も行う
+func runCheckPrices(code string, fix bool, sourceNames, sourceConfigPath string) {
+	priceDB, err := initPriceDB()
+	if err != nil {
+		log.Fatalf("stock_price.db初期化失敗: %v", err)
+	}
+	defer priceDB.Close()
+
+	var codes []string
+	if code != "" {
+		codes = []string{code}
+	}
+	fmt.Println("🩺 株価データの品質チェック...")
+	found, err := checkPrices(priceDB, codes)
+	if err != nil {
+		log.Fatalf("チェック失敗: %v", err)
+	}
+	resolved, err := savePriceIssues(priceDB, found)
+	if err != nil {
+		log.Fatalf("price_quality_issues 保存失敗: %v", err)
+	}
+	printPriceIssueSummary(found)
+	if resolved > 0 {
+		fmt.Printf("✅ 前回から解消: %d件\n", resolved)
+	}
+
+	if !fix {
+		return
+	}
+	sources, err := newPriceSourceSetFromFlags(sourceNames, sourceConfigPath)
+	if err != nil {
+		log.Fatalf("株価取得元の設定エラー: %v", err)
+	}
+	sources.loadHealth(priceDB)
+	defer func() {
+		if err := sources.saveHealth(priceDB); err != nil {
+			log.Printf("⚠️ price_source_health 保存失敗: %v", err)
+		}
+	}()
+
+	touched := fixPriceIssues(priceDB, sources, found)
+	if len(touched) == 0 {
+		return
+	}
+	// 修復した銘柄を調べ直す (分割・併合も見直してから)
+	if _, _, err := refreshCorporateActions(priceDB, touched); err != nil {
+		log.Printf("⚠️ 株式分割・併合の更新失敗: %v", err)
+	}
+	after, err := checkPrices(priceDB, touched)
+	if err != nil {
+		log.Fatalf("再チェック失敗: %v", err)
+	}
+	fixed, err := savePriceIssues(priceDB, after)
+	if err != nil {
+		log.Fatalf("price_quality_issues 保存失敗: %v", err)
+	}
+	remaining := 0
+	for _, issues := range after {
+		remaining += len(issues)
+	}
+	fmt.Printf("\n📊 修復: 解消 %d件, 残り %d件 (%d銘柄を再チェック)\n", fixed, remaining, len(touched))
+}
+
+// printPriceIssueSummary は種類別の件数と問題の多い銘柄を表示する
+func printPriceIssueSummary(found map[string][]priceIssue) {
+	byKind := make(map[string]int)
+	type codeCount struct {
+		code string
+		n    int
+	}
+	var perCode []codeCount
+	total := 0
+	for code, issues := range found {
+		for _, is := range issues {
+			byKind[is.Kind]++
+		}
+		if len(issues) > 0 {
+			perCode = append(perCode, codeCount{code, len(issues)})
+		}
+		total += len(issues)
+	}
+	if total == 0 {
+		fmt.Printf("✅ 問題なし (%d銘柄)\n", len(found))
+		return
+	}
+	fmt.Printf("⚠️ %d件の問題 (%d銘柄):\n", total, len(perCode))
+	for _, k := range []string{PriceIssueBadOHLC, PriceIssueHighLow, PriceIssueDuplicate, PriceIssueGap, PriceIssueSpike} {
+		if byKind[k] > 0 {
+			fmt.Printf("  %-15s %d\n", k, byKind[k])
+		}
+	}
+	sort.Slice(perCode, func(i, j int) bool {
+		if perCode[i].n != perCode[j].n {
+			return perCode[i].n > perCode[j].n
+		}
+		return perCode[i].code < perCode[j].code
+	})
+	if len(perCode) > 10 {
+		perCode = perCode[:10]
+	}
+	for _, c := range perCode {
+		fmt.Printf("  %s: %d件 (先頭: %s)\n", c.code, c.n, found[c.code][0].Detail)
+	}
+	fmt.Println("   詳細: SELECT * FROM price_quality_issues WHERE status = 'open'")
+}
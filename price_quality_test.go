@@ -0,0 +1,133 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// qualityRows は priceSeries の終値を四本値にそろえた行にする
+func qualityRows(t *testing.T, start string, closes ...float64) []priceRow {
+	t.Helper()
+	var rows []priceRow
+	for _, p := range priceSeries(t, "7203", start, closes...) {
+		p.Open, p.High, p.Low = p.Close, p.Close, p.Close
+		rows = append(rows, priceRow{StockPrice: p, source: "stooq"})
+	}
+	return rows
+}
+
+// without は rows から dates の行を除く
+func without(rows []priceRow, dates ...string) []priceRow {
+	drop := make(map[string]bool)
+	for _, d := range dates {
+		drop[d] = true
+	}
+	var out []priceRow
+	for _, r := range rows {
+		if !drop[r.Date] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func TestCheckPriceSeries(t *testing.T) {
+	// 2025-05-12 (月) からの10営業日。どの日も他の銘柄には株価がある
+	flat := func() []priceRow {
+		return qualityRows(t, "2025-05-12", 1000, 1001, 1002, 1003, 1004, 1005, 1006, 1007, 1008, 1009)
+	}
+	market := make(map[string]bool)
+	for _, r := range flat() {
+		market[r.Date] = true
+	}
+
+	cases := []struct {
+		name   string
+		rows   func() []priceRow
+		adjust map[string]bool
+		market map[string]bool
+		want   [][2]string // {kind, date}
+	}{
+		{name: "問題なし", rows: flat},
+		{
+			name: "四本値が0",
+			rows: func() []priceRow { r := flat(); r[3].Close = 0; return r },
+			want: [][2]string{{PriceIssueBadOHLC, "2025-05-15"}},
+		},
+		{
+			name: "高値 < 安値",
+			rows: func() []priceRow { r := flat(); r[2].High, r[2].Low = 990, 1010; return r },
+			want: [][2]string{{PriceIssueHighLow, "2025-05-14"}},
+		},
+		{
+			name: "書式違いの日付",
+			rows: func() []priceRow {
+				r := flat()
+				dup := r[1]
+				dup.Date = "2025-05-13 00:00:00"
+				return append(r, dup)
+			},
+			want: [][2]string{{PriceIssueDuplicate, "2025-05-13"}},
+		},
+		{
+			name: "値幅制限超え",
+			rows: func() []priceRow { return qualityRows(t, "2025-05-12", 1000, 1000, 1400, 1400, 1400) },
+			want: [][2]string{{PriceIssueSpike, "2025-05-14"}},
+		},
+		{
+			name:   "分割・併合の日は値幅制限超えを除く",
+			rows:   func() []priceRow { return qualityRows(t, "2025-05-12", 1000, 1000, 500, 500, 500) },
+			adjust: map[string]bool{"2025-05-14": true},
+		},
+		{
+			name: "1日だけの跳ね (値幅制限内)",
+			rows: func() []priceRow { return qualityRows(t, "2025-05-12", 80, 80, 105, 81, 81) },
+			want: [][2]string{{PriceIssueSpike, "2025-05-14"}},
+		},
+		{
+			name: "3営業日の欠損",
+			rows: func() []priceRow { return without(flat(), "2025-05-14", "2025-05-15", "2025-05-16") },
+			want: [][2]string{{PriceIssueGap, "2025-05-14"}},
+		},
+		{
+			name: "2営業日の欠損は数えない",
+			rows: func() []priceRow { return without(flat(), "2025-05-14", "2025-05-15") },
+		},
+		{
+			name:   "全銘柄に無い日は銘柄の欠損に数えない",
+			rows:   func() []priceRow { return without(flat(), "2025-05-14", "2025-05-15", "2025-05-16") },
+			market: map[string]bool{"2025-05-12": true, "2025-05-13": true, "2025-05-19": true},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := market
+			if c.market != nil {
+				m = c.market
+			}
+			var got [][2]string
+			for _, is := range checkPriceSeries("7203", c.rows(), c.adjust, m) {
+				got = append(got, [2]string{is.Kind, is.Date})
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("issues = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestPriceFixRange(t *testing.T) {
+	issues := []priceIssue{
+		{Kind: PriceIssueDuplicate, Date: "2025-01-06", EndDate: "2025-01-06", Source: "yahoo"},
+		{Kind: PriceIssueBadOHLC, Date: "2025-05-15", EndDate: "2025-05-15", Source: "stooq"},
+		{Kind: PriceIssueGap, Date: "2025-06-02", EndDate: "2025-06-04"},
+		{Kind: PriceIssueSpike, Date: "2025-05-20", EndDate: "2025-05-20", Source: "stooq"},
+	}
+	from, to, avoid, ok := priceFixRange(issues)
+	if !ok || from.Format("2006-01-02") != "2025-05-10" || to.Format("2006-01-02") != "2025-06-09" || avoid != "stooq" {
+		t.Errorf("priceFixRange = %s〜%s avoid=%q ok=%v", from.Format("2006-01-02"), to.Format("2006-01-02"), avoid, ok)
+	}
+	if _, _, _, ok := priceFixRange(issues[:1]); ok {
+		t.Error("日付の書式だけなら取り直さない")
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 株価の取得元 (PriceSource) と取得元ごとの健全性
+//
+// fetch-prices は -price-sources (または -price-sources-config の JSON) で指定した順に取得元を試し、
+// ブロックが続いた取得元はクールダウンの間スキップする。試す順番は実行中の成功率で入れ替わる。
+// 健全性 (成功数・最後のブロック・クールダウン期限) は stock_price.db の price_source_health に残し、
+// 次回の実行でもクールダウン中の取得元を避ける。
+// 取得は並行に行い (price_fetcher.go)、同じホストへの同時接続数とリクエスト間隔はホストごとに制限する。
+
+// PriceSource は日足の取得元
+type PriceSource interface {
+	Name() string
+	// Host は接続先のホスト (同じホストの取得元はレート制限を共有する)
+	Host() string
+	// Fetch は from〜to (両端含む) の日足を返す
+	Fetch(ctx context.Context, code string, from, to time.Time) ([]StockPrice, error)
+	// IsBlocked はエラーがレート制限・ボット判定によるもの (時間をおけば回復する) かを返す
+	IsBlocked(err error) bool
+}
+
+type stooqSource struct{}
+
+func (stooqSource) Name() string { return "stooq" }
+func (stooqSource) Host() string { return "stooq.com" }
+func (stooqSource) Fetch(ctx context.Context, code string, from, to time.Time) ([]StockPrice, error) {
+	return fetchPricesFromStooq(ctx, code, from, to)
+}
+
+// IsBlocked: Stooq はブロック時に CSV の代わりに API キー取得の案内を返す
+func (stooqSource) IsBlocked(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "apikey") || strings.Contains(msg, "Get your")
+}
+
+type yahooSource struct{}
+
+func (yahooSource) Name() string { return "yahoo" }
+func (yahooSource) Host() string { return "query1.finance.yahoo.com" }
+func (yahooSource) Fetch(ctx context.Context, code string, from, to time.Time) ([]StockPrice, error) {
+	return fetchPricesFromYahoo(ctx, code, from, to)
+}
+
+// IsBlocked: Yahoo Finance はレート制限で 429、Cookie/crumb 要求で 401 を返す
+func (yahooSource) IsBlocked(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "HTTP status: 429") || strings.Contains(msg, "HTTP status: 401") ||
+		strings.Contains(msg, "Too Many Requests")
+}
+
+// priceSourceRegistry は -price-sources で指定できる取得元
+var priceSourceRegistry = map[string]func() PriceSource{
+	"stooq": func() PriceSource { return stooqSource{} },
+	"yahoo": func() PriceSource { return yahooSource{} },
+}
+
+// defaultPriceSources は -price-sources の既定値 (従来の Stooq → Yahoo の順)
+const defaultPriceSources = "stooq,yahoo"
+
+// priceSourceConfig は取得元1つの設定 (-price-sources-config の JSON の要素)
+type priceSourceConfig struct {
+	Name string `json:"name"`
+	// BlockThreshold 回ブロックが続いたら Cooldown の間その取得元を使わない
+	BlockThreshold int    `json:"block_threshold"`
+	Cooldown       string `json:"cooldown"` // time.ParseDuration 形式 ("60s", "10m")
+	// Concurrency はホストへの同時接続数、Interval はリクエスト開始の最小間隔 (同じホストの取得元では最初の設定を使う)
+	Concurrency int    `json:"concurrency"`
+	Interval    string `json:"interval"`
+}
+
+// defaultPriceSourceConfig は取得元ごとの既定の設定
+func defaultPriceSourceConfig(name string) priceSourceConfig {
+	switch name {
+	case "yahoo":
+		return priceSourceConfig{Name: name, BlockThreshold: 5, Cooldown: "5m", Concurrency: 2, Interval: "500ms"}
+	}
+	// Stooq は従来どおり 20 回連続のブロックで 60 秒休む。秒間 3 リクエストまで
+	return priceSourceConfig{Name: name, BlockThreshold: 20, Cooldown: "60s", Concurrency: 3, Interval: "333ms"}
+}
+
+// loadPriceSourceConfigs は -price-sources-config (JSON) があればそれを、無ければ -price-sources のカンマ区切りを読む。
+//
+//	{"sources": [{"name": "yahoo", "block_threshold": 5, "cooldown": "5m", "concurrency": 2, "interval": "500ms"}, {"name": "stooq"}]}
+func loadPriceSourceConfigs(names, configPath string) ([]priceSourceConfig, error) {
+	var configs []priceSourceConfig
+	if configPath != "" {
+		b, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+		var file struct {
+			Sources []priceSourceConfig `json:"sources"`
+		}
+		if err := json.Unmarshal(b, &file); err != nil {
+			return nil, fmt.Errorf("%s: %w", configPath, err)
+		}
+		for _, c := range file.Sources {
+			def := defaultPriceSourceConfig(c.Name)
+			if c.BlockThreshold <= 0 {
+				c.BlockThreshold = def.BlockThreshold
+			}
+			if c.Cooldown == "" {
+				c.Cooldown = def.Cooldown
+			}
+			if c.Concurrency <= 0 {
+				c.Concurrency = def.Concurrency
+			}
+			if c.Interval == "" {
+				c.Interval = def.Interval
+			}
+			configs = append(configs, c)
+		}
+	} else {
+		for _, name := range strings.Split(names, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				configs = append(configs, defaultPriceSourceConfig(name))
+			}
+		}
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("株価の取得元が指定されていません")
+	}
+	return configs, nil
+}
+
+// sourceHealth は取得元1つの健全性
+type sourceHealth struct {
+	Attempts          int
+	Successes         int
+	ConsecutiveBlocks int
+	LastBlock         time.Time
+	CooldownUntil     time.Time
+}
+
+// successRate は成功率 (試行が少ないうちは 0.5 に寄せる)
+func (h sourceHealth) successRate() float64 {
+	return float64(h.Successes+1) / float64(h.Attempts+2)
+}
+
+// trackedSource は取得元と設定・健全性
+type trackedSource struct {
+	PriceSource
+	order          int // 設定での順番 (成功率が同じなら設定順)
+	blockThreshold int
+	cooldown       time.Duration
+	limiter        *hostLimiter // nil なら制限なし
+	health         sourceHealth // 今回の実行分 (順番の入れ替えに使う)
+	total          sourceHealth // 過去の実行を含む累計 (price_source_health に保存)
+}
+
+// priceSourceSet は1回の fetch-prices で使う取得元の集合。並行に呼ばれる fetch の間で健全性を共有する
+type priceSourceSet struct {
+	mu       sync.Mutex // 各取得元の health / total を守る
+	sources  []*trackedSource
+	limiters map[string]*hostLimiter // ホスト → レート制限
+}
+
+var (
+	// errAllSourcesCoolingDown は全ての取得元がクールダウン中のエラー
+	errAllSourcesCoolingDown = errors.New("全ての株価取得元がクールダウン中")
+	// errNoPriceData は取得元に指定期間の株価が無い (上場前の期間など)。取得元の失敗には数えない
+	errNoPriceData = errors.New("no data")
+)
+
+// newPriceSourceSet は設定から取得元を組み立てる
+func newPriceSourceSet(configs []priceSourceConfig) (*priceSourceSet, error) {
+	set := &priceSourceSet{limiters: make(map[string]*hostLimiter)}
+	for i, c := range configs {
+		factory, ok := priceSourceRegistry[c.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown price source %q (stooq, yahoo)", c.Name)
+		}
+		cooldown, err := time.ParseDuration(c.Cooldown)
+		if err != nil {
+			return nil, fmt.Errorf("price source %s: cooldown: %w", c.Name, err)
+		}
+		interval, err := time.ParseDuration(c.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("price source %s: interval: %w", c.Name, err)
+		}
+		src := factory()
+		limiter, ok := set.limiters[src.Host()]
+		if !ok {
+			limiter = newHostLimiter(c.Concurrency, interval)
+			set.limiters[src.Host()] = limiter
+		}
+		set.sources = append(set.sources, &trackedSource{
+			PriceSource: src, order: i,
+			blockThreshold: c.BlockThreshold, cooldown: cooldown, limiter: limiter,
+		})
+	}
+	return set, nil
+}
+
+// newPriceSourceSetFromFlags は -price-sources / -price-sources-config から取得元を組み立てる
+func newPriceSourceSetFromFlags(names, configPath string) (*priceSourceSet, error) {
+	configs, err := loadPriceSourceConfigs(names, configPath)
+	if err != nil {
+		return nil, err
+	}
+	return newPriceSourceSet(configs)
+}
+
+// names は取得元の名前を設定順に返す
+func (set *priceSourceSet) names() []string {
+	names := make([]string, len(set.sources))
+	for i, s := range set.sources {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+// concurrency は全ホストの同時接続数の合計 (並行取得のワーカー数)
+func (set *priceSourceSet) concurrency() int {
+	n := 0
+	for _, l := range set.limiters {
+		n += cap(l.slots)
+	}
+	return max(n, 1)
+}
+
+// ordered はクールダウン中でない取得元を、今回の成功率の高い順 (同率は設定順) に返す
+func (set *priceSourceSet) ordered(now time.Time) []*trackedSource {
+	var out []*trackedSource
+	for _, s := range set.sources {
+		if now.Before(s.health.CooldownUntil) {
+			continue
+		}
+		out = append(out, s)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		ri, rj := out[i].health.successRate(), out[j].health.successRate()
+		if ri != rj {
+			return ri > rj
+		}
+		return out[i].order < out[j].order
+	})
+	return out
+}
+
+// nextAvailable は最も早くクールダウンが明ける時刻
+func (set *priceSourceSet) nextAvailable() time.Time {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	var next time.Time
+	for _, s := range set.sources {
+		if next.IsZero() || s.health.CooldownUntil.Before(next) {
+			next = s.health.CooldownUntil
+		}
+	}
+	return next
+}
+
+// fetch は取得元を順に試し、最初に取れた from〜to の株価と取得元の名前を返す。
+// 全ての取得元がクールダウン中なら errAllSourcesCoolingDown、ctx が終わったら ctx.Err() を返す
+func (set *priceSourceSet) fetch(ctx context.Context, code string, from, to, now time.Time) ([]StockPrice, string, error) {
+	set.mu.Lock()
+	sources := set.ordered(now)
+	set.mu.Unlock()
+	return set.fetchFrom(ctx, sources, now, func(s *trackedSource) ([]StockPrice, error) {
+		return s.Fetch(ctx, code, from, to)
+	})
+}
+
+// fetchAvoiding は avoid 以外の取得元を先に試す (check-prices -fix で、疑わしい行とは別の取得元から取り直す)
+func (set *priceSourceSet) fetchAvoiding(ctx context.Context, avoid, code string, from, to, now time.Time) ([]StockPrice, string, error) {
+	set.mu.Lock()
+	sources := set.ordered(now)
+	set.mu.Unlock()
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].Name() != avoid && sources[j].Name() == avoid
+	})
+	return set.fetchFrom(ctx, sources, now, func(s *trackedSource) ([]StockPrice, error) {
+		return s.Fetch(ctx, code, from, to)
+	})
+}
+
+// fetchFrom は sources を順に get で試す
+func (set *priceSourceSet) fetchFrom(ctx context.Context, sources []*trackedSource, now time.Time, get func(*trackedSource) ([]StockPrice, error)) ([]StockPrice, string, error) {
+	if len(sources) == 0 {
+		return nil, "", errAllSourcesCoolingDown
+	}
+
+	var errs []error
+	for _, s := range sources {
+		if s.limiter != nil {
+			if err := s.limiter.acquire(ctx); err != nil {
+				return nil, "", err
+			}
+		}
+		prices, err := get(s)
+		if s.limiter != nil {
+			s.limiter.release()
+		}
+		if ctx.Err() != nil {
+			// 期限切れで中断した取得は取得元の失敗に数えない
+			return nil, "", ctx.Err()
+		}
+		if err == nil && len(prices) == 0 {
+			err = errNoPriceData
+		}
+		set.mu.Lock()
+		s.record(err, now)
+		set.mu.Unlock()
+		if err == nil {
+			return prices, s.Name(), nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+	}
+	// どれかの取得元が「データなし」と答えていれば errors.Is(err, errNoPriceData) で判定できる
+	return nil, "", errors.Join(errs...)
+}
+
+// record は1回の取得結果を健全性に反映する。ブロックが blockThreshold 回続いたらクールダウンに入る
+func (s *trackedSource) record(err error, now time.Time) {
+	if errors.Is(err, errNoPriceData) {
+		return
+	}
+	for _, h := range []*sourceHealth{&s.health, &s.total} {
+		h.Attempts++
+		switch {
+		case err == nil:
+			h.Successes++
+			h.ConsecutiveBlocks = 0
+		case s.IsBlocked(err):
+			h.ConsecutiveBlocks++
+			h.LastBlock = now
+		default:
+			h.ConsecutiveBlocks = 0
+		}
+	}
+	if s.health.ConsecutiveBlocks >= s.blockThreshold {
+		s.health.CooldownUntil = now.Add(s.cooldown)
+		s.total.CooldownUntil = s.health.CooldownUntil
+		s.health.ConsecutiveBlocks = 0
+		fmt.Printf("\n⏸️ %s のブロック検出（%d回連続）。%s までクールダウン\n",
+			s.Name(), s.blockThreshold, s.health.CooldownUntil.Format("15:04:05"))
+	}
+}
+
+// loadHealth は前回までの健全性を読み込む (クールダウン中ならそれを引き継ぐ)
+func (set *priceSourceSet) loadHealth(db *sql.DB) {
+	for _, s := range set.sources {
+		var lastBlock, cooldownUntil string
+		err := db.QueryRow(`
+			SELECT attempts, successes, COALESCE(last_block_at, ''), COALESCE(cooldown_until, '')
+			FROM price_source_health WHERE name = ?`, s.Name()).Scan(
+			&s.total.Attempts, &s.total.Successes, &lastBlock, &cooldownUntil)
+		if err != nil {
+			continue
+		}
+		s.total.LastBlock, _ = time.Parse(time.RFC3339, lastBlock)
+		s.total.CooldownUntil, _ = time.Parse(time.RFC3339, cooldownUntil)
+		s.health.LastBlock, s.health.CooldownUntil = s.total.LastBlock, s.total.CooldownUntil
+	}
+}
+
+// saveHealth は健全性を price_source_health に保存する
+func (set *priceSourceSet) saveHealth(db *sql.DB) error {
+	formatTime := func(t time.Time) any {
+		if t.IsZero() {
+			return nil
+		}
+		return t.Format(time.RFC3339)
+	}
+	for _, s := range set.sources {
+		_, err := db.Exec(`
+			INSERT INTO price_source_health (name, attempts, successes, last_block_at, cooldown_until, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(name) DO UPDATE SET
+				attempts = excluded.attempts,
+				successes = excluded.successes,
+				last_block_at = excluded.last_block_at,
+				cooldown_until = excluded.cooldown_until,
+				updated_at = excluded.updated_at`,
+			s.Name(), s.total.Attempts, s.total.Successes, formatTime(s.total.LastBlock), formatTime(s.total.CooldownUntil),
+			nowJST().Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printSummary は取得元ごとの今回の成績を表示する
+func (set *priceSourceSet) printSummary() {
+	fmt.Println("📡 取得元別:")
+	for _, s := range set.sources {
+		h := s.health
+		line := fmt.Sprintf("  %-6s 成功 %d/%d", s.Name(), h.Successes, h.Attempts)
+		if !h.LastBlock.IsZero() {
+			line += " 最終ブロック " + h.LastBlock.Format("15:04:05")
+		}
+		if time.Now().Before(h.CooldownUntil) {
+			line += " (クールダウン中 〜" + h.CooldownUntil.Format("15:04:05") + ")"
+		}
+		fmt.Println(line)
+	}
+}
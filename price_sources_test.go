@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakePriceSource は決められた順にエラーを返す取得元 (nil なら成功)
+type fakePriceSource struct {
+	name  string
+	errs  []error
+	calls int
+}
+
+func (f *fakePriceSource) Name() string { return f.name }
+func (f *fakePriceSource) Host() string { return f.name + ".example" }
+
+func (f *fakePriceSource) Fetch(ctx context.Context, code string, from, to time.Time) ([]StockPrice, error) {
+	var err error
+	if f.calls < len(f.errs) {
+		err = f.errs[f.calls]
+	}
+	f.calls++
+	if err != nil {
+		return nil, err
+	}
+	return []StockPrice{{Code: code, Date: "2026-01-05", Close: 100}}, nil
+}
+
+func (f *fakePriceSource) IsBlocked(err error) bool { return err.Error() == "blocked" }
+
+func newFakeSourceSet(threshold int, sources ...*fakePriceSource) *priceSourceSet {
+	set := &priceSourceSet{}
+	for i, s := range sources {
+		set.sources = append(set.sources, &trackedSource{PriceSource: s, order: i, blockThreshold: threshold, cooldown: time.Minute})
+	}
+	return set
+}
+
+func TestPriceSourceSet_FailoverAndCooldown(t *testing.T) {
+	ctx := context.Background()
+	blocked := errors.New("blocked")
+	primary := &fakePriceSource{name: "primary", errs: []error{blocked, blocked, blocked}}
+	backup := &fakePriceSource{name: "backup"}
+	set := newFakeSourceSet(2, primary, backup)
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	day := now.Truncate(24 * time.Hour)
+
+	// 1回目: primary がブロック → backup から取得
+	if _, source, err := set.fetch(ctx, "7203", day, day, now); err != nil || source != "backup" {
+		t.Fatalf("fetch #1 = (%q, %v), want backup", source, err)
+	}
+	// 2回目: backup の成功率が上がったので backup を先に試す
+	if _, source, _ := set.fetch(ctx, "6758", day, day, now); source != "backup" || primary.calls != 1 {
+		t.Errorf("fetch #2 source=%q primary.calls=%d, want backup first", source, primary.calls)
+	}
+
+	// backup が失敗 (ブロックではない) すると primary に回り、2回連続ブロックでクールダウン
+	backup.errs = []error{nil, nil, fmt.Errorf("HTTP status: 500"), fmt.Errorf("HTTP status: 500")}
+	if _, _, err := set.fetch(ctx, "9984", day, day, now); err == nil {
+		t.Fatal("fetch #3 should fail")
+	}
+	if got := set.sources[0].health.CooldownUntil; !got.Equal(now.Add(time.Minute)) {
+		t.Errorf("primary CooldownUntil = %v, want %v", got, now.Add(time.Minute))
+	}
+
+	// クールダウン中の primary は試さない
+	calls := primary.calls
+	set.fetch(ctx, "8306", day, day, now.Add(30*time.Second))
+	if primary.calls != calls {
+		t.Errorf("primary was called during cooldown")
+	}
+	// クールダウンが明ければ再び候補に入る (成功率の低い primary は後ろ)
+	if got := set.ordered(now.Add(2 * time.Minute)); len(got) != 2 || got[0].Name() != "backup" || got[1].Name() != "primary" {
+		t.Errorf("ordered after cooldown = %v", got)
+	}
+}
+
+func TestPriceSourceSet_AllCoolingDown(t *testing.T) {
+	ctx := context.Background()
+	blocked := errors.New("blocked")
+	a := &fakePriceSource{name: "a", errs: []error{blocked}}
+	set := newFakeSourceSet(1, a)
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	day := now.Truncate(24 * time.Hour)
+
+	set.fetch(ctx, "7203", day, day, now)
+	if _, _, err := set.fetch(ctx, "6758", day, day, now); !errors.Is(err, errAllSourcesCoolingDown) {
+		t.Errorf("err = %v, want errAllSourcesCoolingDown", err)
+	}
+	if got := set.nextAvailable(); !got.Equal(now.Add(time.Minute)) {
+		t.Errorf("nextAvailable = %v, want %v", got, now.Add(time.Minute))
+	}
+}
+
+func TestLoadPriceSourceConfigs(t *testing.T) {
+	configs, err := loadPriceSourceConfigs(" yahoo, stooq ", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 || configs[0].Name != "yahoo" || configs[1].Name != "stooq" || configs[1].BlockThreshold != 20 {
+		t.Errorf("configs = %+v", configs)
+	}
+	if _, err := newPriceSourceSet([]priceSourceConfig{{Name: "kabutan", Cooldown: "1m"}}); err == nil {
+		t.Error("unknown source should be rejected")
+	}
+}
+
+func TestPriceSourceSet_FetchAvoiding(t *testing.T) {
+	primary := &fakePriceSource{name: "primary"}
+	backup := &fakePriceSource{name: "backup"}
+	set := newFakeSourceSet(2, primary, backup)
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	day := now.Truncate(24 * time.Hour)
+
+	if _, source, err := set.fetchAvoiding(context.Background(), "primary", "7203", day, day, now); err != nil || source != "backup" {
+		t.Errorf("fetchAvoiding = (%q, %v), want backup", source, err)
+	}
+	if primary.calls != 0 {
+		t.Errorf("primary.calls = %d, want 0", primary.calls)
+	}
+	// 避けた取得元も他が失敗すれば使う
+	backup.errs = []error{nil, fmt.Errorf("HTTP status: 500")}
+	if _, source, err := set.fetchAvoiding(context.Background(), "primary", "7203", day, day, now); err != nil || source != "primary" {
+		t.Errorf("fetchAvoiding (backup 失敗) = (%q, %v), want primary", source, err)
+	}
+}
@@ -1,20 +1,28 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// fetchStockPrices はStooqから株価データを取得してDBに保存する
-func fetchStockPrices() {
+// fetchStockPrices は取得元 (-price-sources、既定は Stooq → Yahoo) から直近 historyDays 日分の株価データを取得してDBに保存する
+// (より古い期間は -mode=backfill-prices で遡る)。取得は並行に行い、deadline を過ぎたら打ち切る。
+// 進捗は progressEvery 銘柄ごとに表示する
+func fetchStockPrices(sourceNames, sourceConfigPath string, historyDays, maxMB int, deadline time.Duration, progressEvery int) {
+	sources, err := newPriceSourceSetFromFlags(sourceNames, sourceConfigPath)
+	if err != nil {
+		log.Fatalf("株価取得元の設定エラー: %v", err)
+	}
+
 	// 銘柄一覧はxbrl.dbから取得
 	xbrlDB, err := initXbrlDB()
 	if err != nil {
@@ -29,6 +37,14 @@ func fetchStockPrices() {
 	}
 	defer priceDB.Close()
 
+	// 前回の実行でクールダウンに入った取得元は引き続き避ける
+	sources.loadHealth(priceDB)
+	defer func() {
+		if err := sources.saveHealth(priceDB); err != nil {
+			log.Printf("⚠️ price_source_health 保存失敗: %v", err)
+		}
+	}()
+
 	// xbrl.dbから証券コード一覧を取得
 	rows, err := xbrlDB.Query("SELECT code FROM stocks ORDER BY code")
 	if err != nil {
@@ -45,7 +61,7 @@ func fetchStockPrices() {
 	}
 
 	// 最近取得済みの銘柄は差分スキップ対象（3日以内の株価がある銘柄）
-	recentCutoff := time.Now().AddDate(0, 0, -3).Format("2006-01-02")
+	recentCutoff := nowJST().AddDate(0, 0, -3).Format("2006-01-02")
 	recentRows, _ := priceDB.Query(`SELECT DISTINCT code FROM stock_prices WHERE date >= ?`, recentCutoff)
 	recentMap := make(map[string]bool)
 	if recentRows != nil {
@@ -58,97 +74,103 @@ func fetchStockPrices() {
 		recentRows.Close()
 	}
 
-	fmt.Printf("📈 Fetching stock prices for %d stocks (skipping %d recent)...\n", len(codes), len(recentMap))
-
-	successCount := 0
-	errorCount := 0
-	skippedCount := 0
-	consecutiveBlocks := 0 // Stooq 側のブロック検出カウンタ
-	retryAttempted := false
-
-	isBlockError := func(err error) bool {
-		msg := err.Error()
-		return strings.Contains(msg, "apikey") || strings.Contains(msg, "Get your")
-	}
-
-	for i, code := range codes {
+	now := nowJST()
+	var jobs []priceFetchJob
+	for _, code := range codes {
 		// 最近取得済みの銘柄はスキップ（再実行時の差分更新）
-		if recentMap[code] {
-			skippedCount++
-			continue
+		if !recentMap[code] {
+			jobs = append(jobs, priceFetchJob{Code: code, From: now.AddDate(0, 0, -historyDays), To: now})
 		}
-
-		prices, err := fetchPricesFromStooq(code)
-		// Stooqがブロック・空データを返した場合、Yahoo Finance にフォールバック
-		if err != nil || len(prices) == 0 {
-			yahooPrices, yerr := fetchPricesFromYahoo(code)
-			if yerr == nil && len(yahooPrices) > 0 {
-				fmt.Printf("  🔁 %s: Stooq失敗→Yahoo成功 ", code)
-				prices = yahooPrices
-				err = nil
-				consecutiveBlocks = 0
-			}
-		}
-		if err != nil {
-			fmt.Printf("  ❌ %s: %v\n", code, err)
+	}
+	skippedCount := len(codes) - len(jobs)
+
+	names := sources.names()
+	workers := sources.concurrency()
+	fmt.Printf("📈 Fetching stock prices for %d stocks (skipping %d recent, %d days) from %s, %d workers, deadline %s...\n",
+		len(jobs), skippedCount, historyDays, strings.Join(names, " → "), workers, deadline)
+
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+
+	writer := newPriceBatchWriter(priceDB, priceWriteBatchRows)
+	fetched, errorCount, noDataCount, done := 0, 0, 0, 0
+	start := time.Now()
+	remaining, err := runPriceFetchJobs(ctx, sources, jobs, workers, func(r priceFetchResult) {
+		done++
+		switch {
+		case errors.Is(r.Err, errNoPriceData):
+			noDataCount++
+		case r.Err != nil:
+			fmt.Printf("  ❌ %s: %v\n", r.Job.Code, r.Err)
 			errorCount++
-
-			if isBlockError(err) {
-				consecutiveBlocks++
-				if consecutiveBlocks >= 20 {
-					if !retryAttempted {
-						fmt.Printf("\n⏸️ Stooq のブロック検出（%d回連続）。60秒待機して再開を試みます...\n", consecutiveBlocks)
-						time.Sleep(60 * time.Second)
-						retryAttempted = true
-						consecutiveBlocks = 0
-						continue
-					}
-					fmt.Printf("\n⚠️ リトライ後も Stooq+Yahoo がブロックを継続しています\n")
-					fmt.Printf("   株価取得を中止します。既存の stock_price.db は保持されます。\n")
-					fmt.Printf("   しばらく時間をおいてから再実行してください（差分スキップで続きから再開します）。\n")
-					break
-				}
-			} else {
-				consecutiveBlocks = 0
+		default:
+			if r.Source != names[0] {
+				fmt.Printf("  🔁 %s: %s から取得\n", r.Job.Code, r.Source)
 			}
-			continue
-		}
-		consecutiveBlocks = 0
-
-		// DBに保存
-		savedCount, err := savePricesToDB(priceDB, code, prices)
-		if err != nil {
-			fmt.Printf("  ❌ %s: DB保存失敗 %v\n", code, err)
-			errorCount++
-			continue
+			if err := writer.add(r.Job.Code, r.Prices, r.Source); err != nil {
+				fmt.Printf("  ❌ DB保存失敗: %v\n", err)
+			}
+			fetched++
 		}
-
-		if savedCount > 0 {
-			fmt.Printf("  ✅ [%d/%d] %s: %d件保存\n", i+1, len(codes), code, savedCount)
-			successCount++
-		} else {
-			fmt.Printf("  ⏭️ [%d/%d] %s: 新規データなし\n", i+1, len(codes), code)
+		if progressEvery > 0 && (done%progressEvery == 0 || done == len(jobs)) {
+			elapsed := time.Since(start)
+			rate := float64(done) / elapsed.Seconds()
+			eta := time.Duration(float64(len(jobs)-done)/rate) * time.Second
+			fmt.Printf("  ⏳ [%d/%d] 取得 %d, エラー %d, データなし %d (%.1f 銘柄/秒, 残り約 %s)\n",
+				done, len(jobs), fetched, errorCount, noDataCount, rate, eta.Round(time.Second))
 		}
+	})
+	if err := writer.flush(); err != nil {
+		fmt.Printf("  ❌ DB保存失敗: %v\n", err)
+	}
+	for code, err := range writer.FailedCodes {
+		fmt.Printf("  ❌ %s: DB保存失敗 %v\n", code, err)
+	}
 
-		// レート制限対策（1秒待機）
-		time.Sleep(1 * time.Second)
+	switch {
+	case errors.Is(err, errPriceSourcesBlocked):
+		fmt.Printf("\n⚠️ 全ての取得元がブロックを継続しています\n")
+		fmt.Printf("   株価取得を中止します。既存の stock_price.db は保持されます。\n")
+		fmt.Printf("   しばらく時間をおいてから再実行してください（差分スキップで続きから再開します）。\n")
+	case errors.Is(err, context.DeadlineExceeded):
+		fmt.Printf("\n⚠️ 期限 %s に達したため中止します (未処理 %d 銘柄、再実行で続きから再開します)\n", deadline, remaining)
 	}
 
-	fmt.Printf("\n📊 完了: 成功 %d, エラー %d, スキップ %d\n", successCount, errorCount, skippedCount)
+	successCount := fetched - len(writer.FailedCodes)
+	errorCount += len(writer.FailedCodes)
+	fmt.Printf("\n📊 完了: 成功 %d (%d行), エラー %d, データなし %d, スキップ %d, 未処理 %d (%s)\n",
+		successCount, writer.Saved, errorCount, noDataCount, skippedCount, remaining, time.Since(start).Round(time.Second))
+
+	// 指数は銘柄一覧に無いので別に取る
+	fetchIndexPrices(priceDB, sources, historyDays)
+
+	sources.printSummary()
+	printPriceDBUsage(priceDB, maxMB)
+
+	// 取り直した期間は取得元の分割調整の有無で段差が変わるため、分割・併合を見直す
+	if adjusted, detected, err := refreshCorporateActions(priceDB, nil); err != nil {
+		log.Printf("⚠️ 株式分割・併合の更新失敗: %v", err)
+	} else {
+		printCorporateActionSummary(priceDB, adjusted, detected)
+	}
 }
 
-// fetchPricesFromStooq はStooqから株価を取得
-func fetchPricesFromStooq(code string) ([]StockPrice, error) {
+// fetchPricesFromStooq はStooqから from〜to の日足を取得
+func fetchPricesFromStooq(ctx context.Context, code string, from, to time.Time) ([]StockPrice, error) {
 	// 証券コードの調整（4桁なら.jpを付ける）
 	stooqCode := code
 	if len(code) == 4 {
 		stooqCode = code + ".jp"
 	}
+	return fetchStooqSymbol(ctx, stooqCode, code, from, to)
+}
 
-	url := fmt.Sprintf("https://stooq.com/q/d/l/?s=%s&i=d", stooqCode)
+// fetchStooqSymbol は Stooq のシンボル (7203.jp, ^nkx) の日足を code として返す
+func fetchStooqSymbol(ctx context.Context, symbol, code string, from, to time.Time) ([]StockPrice, error) {
+	url := fmt.Sprintf("https://stooq.com/q/d/l/?s=%s&i=d&d1=%s&d2=%s", symbol, from.Format("20060102"), to.Format("20060102"))
 
 	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("request error: %w", err)
 	}
@@ -172,9 +194,15 @@ func fetchPricesFromStooq(code string) ([]StockPrice, error) {
 		return nil, fmt.Errorf("read error: %w", err)
 	}
 
+	return parseStooqCSV(code, body, from, to)
+}
+
+// parseStooqCSV は Stooq の CSV (Date,Open,High,Low,Close,Volume) を読む。
+// 四本値が数値にならない行は 0 として保存しないよう捨てる (出来高の欠損は 0)
+func parseStooqCSV(code string, body []byte, from, to time.Time) ([]StockPrice, error) {
 	lines := strings.Split(string(body), "\n")
 	if len(lines) < 2 {
-		return nil, fmt.Errorf("no data returned")
+		return nil, errNoPriceData
 	}
 
 	// ヘッダー確認
@@ -184,7 +212,7 @@ func fetchPricesFromStooq(code string) ([]StockPrice, error) {
 	}
 
 	var prices []StockPrice
-	oneYearAgo := time.Now().AddDate(-1, 0, 0).Format("2006-01-02")
+	fromStr, toStr := from.Format("2006-01-02"), to.Format("2006-01-02")
 
 	for _, line := range lines[1:] {
 		line = strings.TrimSpace(line)
@@ -197,25 +225,34 @@ func fetchPricesFromStooq(code string) ([]StockPrice, error) {
 			continue
 		}
 
-		// 日付をチェック（1年以内のデータのみ）
+		// 日付をチェック（d1/d2 が効かなかった場合に備えて範囲外は捨てる）
 		date := fields[0]
-		if date < oneYearAgo {
+		if date < fromStr || date > toStr {
 			continue
 		}
 
-		open, _ := strconv.ParseFloat(fields[1], 64)
-		high, _ := strconv.ParseFloat(fields[2], 64)
-		low, _ := strconv.ParseFloat(fields[3], 64)
-		closePrice, _ := strconv.ParseFloat(fields[4], 64)
-		volume, _ := strconv.ParseInt(fields[5], 10, 64)
+		var ohlc [4]float64
+		valid := true
+		for i := range ohlc {
+			v, err := strconv.ParseFloat(strings.TrimSpace(fields[i+1]), 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			ohlc[i] = v
+		}
+		if !valid {
+			continue
+		}
+		volume, _ := strconv.ParseInt(strings.TrimSpace(fields[5]), 10, 64)
 
 		prices = append(prices, StockPrice{
 			Code:   code,
 			Date:   date,
-			Open:   open,
-			High:   high,
-			Low:    low,
-			Close:  closePrice,
+			Open:   ohlc[0],
+			High:   ohlc[1],
+			Low:    ohlc[2],
+			Close:  ohlc[3],
 			Volume: volume,
 		})
 	}
@@ -223,21 +260,25 @@ func fetchPricesFromStooq(code string) ([]StockPrice, error) {
 	return prices, nil
 }
 
-// fetchPricesFromYahoo は Yahoo Finance から株価を取得（Stooqフォールバック用）
-// 4桁証券コード + .T で東証銘柄を指定。直近1年分の日足を返す
-func fetchPricesFromYahoo(code string) ([]StockPrice, error) {
+// fetchPricesFromYahoo は Yahoo Finance から from〜to の日足を取得（Stooqフォールバック用）
+// 4桁証券コード + .T で東証銘柄を指定
+func fetchPricesFromYahoo(ctx context.Context, code string, from, to time.Time) ([]StockPrice, error) {
 	if len(code) != 4 {
 		return nil, fmt.Errorf("yahoo: requires 4-digit code, got %s", code)
 	}
-	yahooSym := code + ".T"
-	end := time.Now().Unix()
-	start := end - 365*86400 // 1年前
+	return fetchYahooSymbol(ctx, code+".T", code, from, to)
+}
+
+// fetchYahooSymbol は Yahoo Finance のシンボル (7203.T, ^N225) の日足を code として返す
+func fetchYahooSymbol(ctx context.Context, yahooSym, code string, from, to time.Time) ([]StockPrice, error) {
+	start := from.Unix()
+	end := to.AddDate(0, 0, 1).Unix() // period2 は排他なので to の翌日まで
 
 	url := fmt.Sprintf("https://query1.finance.yahoo.com/v8/finance/chart/%s?period1=%d&period2=%d&interval=1d&events=history",
 		yahooSym, start, end)
 
 	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("request error: %w", err)
 	}
@@ -259,17 +300,23 @@ func fetchPricesFromYahoo(code string) ([]StockPrice, error) {
 		return nil, fmt.Errorf("read error: %w", err)
 	}
 
+	return parseYahooChart(code, body)
+}
+
+// parseYahooChart は Yahoo Finance の chart API の JSON を読む。
+// 取引の無い足は四本値が null で返るので、どれかが null の足は捨てる (0 として保存しない)
+func parseYahooChart(code string, body []byte) ([]StockPrice, error) {
 	var data struct {
 		Chart struct {
 			Result []struct {
 				Timestamp  []int64 `json:"timestamp"`
 				Indicators struct {
 					Quote []struct {
-						Open   []float64 `json:"open"`
-						High   []float64 `json:"high"`
-						Low    []float64 `json:"low"`
-						Close  []float64 `json:"close"`
-						Volume []int64   `json:"volume"`
+						Open   []*float64 `json:"open"`
+						High   []*float64 `json:"high"`
+						Low    []*float64 `json:"low"`
+						Close  []*float64 `json:"close"`
+						Volume []*int64   `json:"volume"`
 					} `json:"quote"`
 				} `json:"indicators"`
 			} `json:"result"`
@@ -283,73 +330,141 @@ func fetchPricesFromYahoo(code string) ([]StockPrice, error) {
 		return nil, fmt.Errorf("yahoo error: %v", data.Chart.Error)
 	}
 	if len(data.Chart.Result) == 0 || len(data.Chart.Result[0].Indicators.Quote) == 0 {
-		return nil, fmt.Errorf("no data")
+		return nil, errNoPriceData
 	}
 
 	r := data.Chart.Result[0]
 	q := r.Indicators.Quote[0]
+	at := func(vs []*float64, i int) (float64, bool) {
+		if i >= len(vs) || vs[i] == nil {
+			return 0, false
+		}
+		return *vs[i], true
+	}
 
 	var prices []StockPrice
 	for i, ts := range r.Timestamp {
-		if i >= len(q.Close) {
-			break
-		}
+		open, ok1 := at(q.Open, i)
+		high, ok2 := at(q.High, i)
+		low, ok3 := at(q.Low, i)
+		closePrice, ok4 := at(q.Close, i)
 		// null値（取引なし）はスキップ
-		if q.Close[i] == 0 {
+		if !ok1 || !ok2 || !ok3 || !ok4 || closePrice == 0 {
 			continue
 		}
+		var volume int64
+		if i < len(q.Volume) && q.Volume[i] != nil {
+			volume = *q.Volume[i]
+		}
 		prices = append(prices, StockPrice{
 			Code:   code,
-			Date:   time.Unix(ts, 0).Format("2006-01-02"),
-			Open:   q.Open[i],
-			High:   q.High[i],
-			Low:    q.Low[i],
-			Close:  q.Close[i],
-			Volume: q.Volume[i],
+			Date:   yahooBarDate(ts),
+			Open:   open,
+			High:   high,
+			Low:    low,
+			Close:  closePrice,
+			Volume: volume,
 		})
 	}
 
 	if len(prices) == 0 {
-		return nil, fmt.Errorf("no valid prices")
+		return nil, errNoPriceData
 	}
 	return prices, nil
 }
 
-// savePricesToDB は株価をDBに保存（UPSERT）
-func savePricesToDB(db *sql.DB, code string, prices []StockPrice) (int, error) {
-	stmt, err := db.Prepare(`
-		INSERT OR REPLACE INTO stock_prices (code, date, open, high, low, close, volume)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+// yahooBarDate は Yahoo の日足のタイムスタンプ (UTC の秒) を日本時間の日付にする。
+// 実行環境のタイムゾーンで変換すると米国時間などでは前日の日付になる
+func yahooBarDate(ts int64) string {
+	return time.Unix(ts, 0).In(jst).Format("2006-01-02")
+}
+
+// savePricesToDB は1銘柄の株価をDBに保存（UPSERT）。source は取得元の名前 (不明なら空)。
+// 1行でも保存に失敗したら保存できた行数とエラーを返す
+func savePricesToDB(db *sql.DB, code string, prices []StockPrice, source string) (int, error) {
+	w := newPriceBatchWriter(db, len(prices))
+	w.add(code, prices, source)
+	if err := w.flush(); err != nil {
+		return w.Saved, err
+	}
+	if w.Failed > 0 {
+		return w.Saved, fmt.Errorf("%d/%d行の保存失敗: %w", w.Failed, len(prices), w.FailedCodes[code])
+	}
+	return w.Saved, nil
+}
+
+// rsQuarterTradingDays は RS の1期間 (約3ヶ月) の営業日数
+const rsQuarterTradingDays = 63
+
+// rsPerformance は基準日の終値と各期間の開始日の終値から加重騰落率 (%) を返す (weights は past と同じ順)。
+// 終値の無い期間は除き、有効な期間の数も返す
+func rsPerformance(latest float64, past, weights []float64) (score float64, validPeriods int) {
+	for i, c := range past {
+		if c > 0 {
+			score += (latest/c - 1) * weights[i] * 100
+			validPeriods++
+		}
+	}
+	return score, validPeriods
+}
+
+// rsBenchmarkScore はベンチマーク指数の加重騰落率 (銘柄と同じ期間・同じ式)。benchmark が空か指数データが無ければ無効
+func rsBenchmarkScore(priceDB *sql.DB, benchmark, baseDate string, prof rsProfile, periodStarts []string) sql.NullFloat64 {
+	if benchmark == "" {
+		return sql.NullFloat64{}
+	}
+	score, ok := indexPerformance(priceDB, benchmark, baseDate, prof, periodStarts)
+	return sql.NullFloat64{Float64: score, Valid: ok}
+}
+
+// saveRSScores はプロファイル profile・基準日 date の順位 (perfs はスコアの昇順) を1トランザクションで保存する。
+// 途中で止まっても日付単位で全部あるか無いかになる
+func saveRSScores(rsDB *sql.DB, profile, date string, perfs []rsPerf, benchScore sql.NullFloat64) (int, error) {
+	tx, err := rsDB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO rs_scores (profile, code, date, rs_score, rs_rank, excess_score)
+		VALUES (?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return 0, err
 	}
 	defer stmt.Close()
 
-	count := 0
-	for _, p := range prices {
-		_, err := stmt.Exec(code, p.Date, p.Open, p.High, p.Low, p.Close, p.Volume)
-		if err == nil {
-			count++
+	for i, perf := range perfs {
+		var excess sql.NullFloat64
+		if benchScore.Valid {
+			excess = sql.NullFloat64{Float64: perf.Score - benchScore.Float64, Valid: true}
+		}
+		if _, err := stmt.Exec(profile, perf.Code, date, perf.Score, rsRank(i, len(perfs)), excess); err != nil {
+			return 0, err
 		}
 	}
-
-	return count, nil
+	return len(perfs), tx.Commit()
 }
 
 // calculateRS はリラティブストレングス(RS)を計算してrs.dbに保存する
 // RS = 各銘柄の株価パフォーマンスを全銘柄と比較したパーセンタイルランク(1-99)
-// パフォーマンス = 3ヶ月騰落率×40% + 6ヶ月×20% + 9ヶ月×20% + 12ヶ月×20%
-func calculateRS() {
+// パフォーマンスの期間・重みはプロファイル (rs_profiles.go) ごとに決まり、既定は
+// 3ヶ月騰落率×40% + 6ヶ月×20% + 9ヶ月×20% + 12ヶ月×20%
+// benchmark (指数のコード、空なら無し) のパフォーマンスとの差を excess_score に残す。
+// 過去の営業日をまとめて計算するのは calculateRSRange (rs_history.go)
+func calculateRS(benchmark string, profiles []rsProfile) {
 	fmt.Println("📊 Calculating Relative Strength (RS)...")
 
 	// 株価DBを開く
-	priceDB, err := sql.Open("sqlite", "./data/stock_price.db")
+	priceDB, err := initPriceDB()
 	if err != nil {
 		log.Fatalf("stock_price.db open failed: %v", err)
 	}
 	defer priceDB.Close()
 
+	// 騰落率は分割・併合を調整した終値で計算する (段差を暴落・急騰と誤認しない)
+	adjuster := loadPriceAdjuster(priceDB, "")
+
 	// RS DBを初期化
 	rsDB, err := initRsDB()
 	if err != nil {
@@ -357,22 +472,11 @@ func calculateRS() {
 	}
 	defer rsDB.Close()
 
-	// 株価データのある全銘柄を取得
-	codeRows, err := priceDB.Query(`SELECT DISTINCT code FROM stock_prices ORDER BY code`)
+	universes, err := loadRSUniverses(profiles)
 	if err != nil {
-		log.Fatalf("Failed to get codes: %v", err)
-	}
-	defer codeRows.Close()
-
-	var codes []string
-	for codeRows.Next() {
-		var code string
-		codeRows.Scan(&code)
-		codes = append(codes, code)
+		log.Fatalf("Failed to load RS universe: %v", err)
 	}
 
-	fmt.Printf("  📈 %d stocks with price data\n", len(codes))
-
 	// 基準日（最新の取引日）を取得
 	var baseDate string
 	priceDB.QueryRow(`SELECT MAX(date) FROM stock_prices`).Scan(&baseDate)
@@ -383,120 +487,50 @@ func calculateRS() {
 		log.Fatalf("Failed to parse base date: %v", err)
 	}
 
-	// 各期間の開始日を計算
-	date3m := baseDateParsed.AddDate(0, -3, 0).Format("2006-01-02")
-	date6m := baseDateParsed.AddDate(0, -6, 0).Format("2006-01-02")
-	date9m := baseDateParsed.AddDate(0, -9, 0).Format("2006-01-02")
-	date12m := baseDateParsed.AddDate(-1, 0, 0).Format("2006-01-02")
-
-	type stockPerf struct {
-		Code  string
-		Score float64 // 加重パフォーマンススコア
+	// 最も長い期間の開始日〜基準日の終値を1回の走査で読む (銘柄ごとの問い合わせはしない)
+	panel, err := loadRSPricePanel(priceDB, baseDate, baseDate, profiles, adjuster)
+	if err != nil {
+		log.Fatalf("Failed to load prices: %v", err)
 	}
+	fmt.Printf("  📈 %d stocks with price data\n", len(panel.Codes))
 
-	var performances []stockPerf
-	skippedCount := 0
+	for _, prof := range profiles {
+		fmt.Printf("\n📐 Profile %s (%s)\n", prof.ID, prof.Name)
+		periodStarts := prof.periodStarts(baseDateParsed)
 
-	for _, code := range codes {
-		// 各期間の始値と基準日の終値を取得
-		var latestClose float64
-		err := priceDB.QueryRow(`SELECT close FROM stock_prices WHERE code = ? AND date = ?`, code, baseDate).Scan(&latestClose)
-		if err != nil || latestClose <= 0 {
-			skippedCount++
-			continue
+		// ベンチマーク指数の加重騰落率。超過分を excess_score に残す
+		benchScore := rsBenchmarkScore(priceDB, benchmark, baseDate, prof, periodStarts)
+		if benchScore.Valid {
+			fmt.Printf("  📉 Benchmark %s: score %.1f%%\n", benchmark, benchScore.Float64)
+		} else if benchmark != "" {
+			fmt.Printf("  ⚠️ Benchmark %s の指数データがありません (fetch-indices で取得)\n", benchmark)
 		}
 
-		// 各期間のclose価格を取得（その日付以降で最も近い日）
-		getClose := func(targetDate string) float64 {
-			var price float64
-			priceDB.QueryRow(`
-				SELECT close FROM stock_prices
-				WHERE code = ? AND date >= ?
-				ORDER BY date ASC LIMIT 1`, code, targetDate).Scan(&price)
-			return price
-		}
-
-		close3m := getClose(date3m)
-		close6m := getClose(date6m)
-		close9m := getClose(date9m)
-		close12m := getClose(date12m)
+		performances, skippedCount := panel.rsPerformances(baseDate, prof, periodStarts, universes[prof.ID])
 
-		// 騰落率を計算（データがない期間は0%として扱う）
-		var score float64
-		var validPeriods int
-
-		if close3m > 0 {
-			score += (latestClose/close3m - 1) * 0.4 * 100
-			validPeriods++
-		}
-		if close6m > 0 {
-			score += (latestClose/close6m - 1) * 0.2 * 100
-			validPeriods++
-		}
-		if close9m > 0 {
-			score += (latestClose/close9m - 1) * 0.2 * 100
-			validPeriods++
-		}
-		if close12m > 0 {
-			score += (latestClose/close12m - 1) * 0.2 * 100
-			validPeriods++
-		}
+		fmt.Printf("  📊 Calculated performance for %d stocks (skipped %d)\n", len(performances), skippedCount)
 
-		// 最低2期間以上のデータが必要
-		if validPeriods < 2 {
-			skippedCount++
+		if len(performances) == 0 {
+			fmt.Println("⚠️ No performance data to rank")
 			continue
 		}
+		n := len(performances)
 
-		performances = append(performances, stockPerf{Code: code, Score: score})
-	}
-
-	fmt.Printf("  📊 Calculated performance for %d stocks (skipped %d)\n", len(performances), skippedCount)
-
-	if len(performances) == 0 {
-		fmt.Println("⚠️ No performance data to rank")
-		return
-	}
-
-	// パフォーマンスでソート（昇順）
-	sort.Slice(performances, func(i, j int) bool {
-		return performances[i].Score < performances[j].Score
-	})
-
-	// パーセンタイルランクを計算（1-99）
-	n := len(performances)
-	calcRank := func(i int) int {
-		rank := int(float64(i+1)/float64(n)*98) + 1
-		if rank > 99 {
-			rank = 99
+		savedCount, err := saveRSScores(rsDB, prof.ID, baseDate, performances, benchScore)
+		if err != nil {
+			log.Fatalf("Failed to save RS scores: %v", err)
+		}
+		if err := saveRSProfile(rsDB, prof); err != nil {
+			log.Printf("⚠️ rs_profiles 保存失敗: %v", err)
 		}
-		return rank
-	}
-
-	stmt, err := rsDB.Prepare(`
-		INSERT OR REPLACE INTO rs_scores (code, date, rs_score, rs_rank)
-		VALUES (?, ?, ?, ?)
-	`)
-	if err != nil {
-		log.Fatalf("Failed to prepare RS insert: %v", err)
-	}
-	defer stmt.Close()
 
-	savedCount := 0
-	for i, perf := range performances {
-		rank := calcRank(i)
-		_, err := stmt.Exec(perf.Code, baseDate, perf.Score, rank)
-		if err == nil {
-			savedCount++
+		// トップ10を表示
+		fmt.Println("\n🏆 Top 10 RS Stocks:")
+		for i := n - 1; i >= 0 && i >= n-10; i-- {
+			perf := performances[i]
+			fmt.Printf("  RS=%2d  %s  (score: %.1f%%)\n", rsRank(i, n), perf.Code, perf.Score)
 		}
-	}
 
-	// トップ10を表示
-	fmt.Println("\n🏆 Top 10 RS Stocks:")
-	for i := n - 1; i >= 0 && i >= n-10; i-- {
-		perf := performances[i]
-		fmt.Printf("  RS=%2d  %s  (score: %.1f%%)\n", calcRank(i), perf.Code, perf.Score)
+		fmt.Printf("\n✅ RS calculation complete! Saved %d scores to rs.db\n", savedCount)
 	}
-
-	fmt.Printf("\n✅ RS calculation complete! Saved %d scores to rs.db\n", savedCount)
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func readPriceFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile("testdata/prices/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// bars は日付・終値・出来高だけを比べる形にする
+func bars(prices []StockPrice) [][3]any {
+	var out [][3]any
+	for _, p := range prices {
+		out = append(out, [3]any{p.Date, p.Close, p.Volume})
+	}
+	return out
+}
+
+func TestParseStooqCSV(t *testing.T) {
+	prices, err := parseStooqCSV("7203", readPriceFixture(t, "stooq_bad_fields.csv"), mustDate(t, "2025-05-01"), mustDate(t, "2025-05-31"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 高値が空の行・N/D の行・列の足りない行は捨て、出来高の欠損は 0
+	want := [][3]any{
+		{"2025-05-12", 1510.0, int64(120000)},
+		{"2025-05-15", 1525.0, int64(0)},
+		{"2025-05-16", 1530.0, int64(110000)},
+	}
+	if got := bars(prices); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseStooqCSV = %v, want %v", got, want)
+	}
+
+	// 期間外は捨てる
+	prices, _ = parseStooqCSV("7203", readPriceFixture(t, "stooq_bad_fields.csv"), mustDate(t, "2025-05-16"), mustDate(t, "2025-05-31"))
+	if len(prices) != 1 || prices[0].Date != "2025-05-16" {
+		t.Errorf("期間指定 = %v", bars(prices))
+	}
+}
+
+func TestParseYahooChart(t *testing.T) {
+	prices, err := parseYahooChart("7203", readPriceFixture(t, "yahoo_nulls.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// null の足と終値 0 の足は捨て、出来高の null は 0
+	want := [][3]any{
+		{"2025-05-12", 1510.0, int64(120000)},
+		{"2025-05-15", 1525.0, int64(0)},
+		{"2025-05-16", 1530.0, int64(110000)},
+	}
+	if got := bars(prices); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseYahooChart = %v, want %v", got, want)
+	}
+
+	if _, err := parseYahooChart("7203", []byte(`{"chart":{"result":[],"error":null}}`)); !errors.Is(err, errNoPriceData) {
+		t.Errorf("空の result = %v, want errNoPriceData", err)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+// 決算短信 (SHORT_REPORT) と後から提出される EDINET の報告書の突合
+//
+// 同じ期の短信と報告書は stock_financials に約1か月ずれて2行並ぶ。突合で短信行に対応する
+// 報告書の提出日 (reconciled_date) を書き込み、成長指標は監査済みの報告書側を使う。
+// 項目ごとの差は financial_reconciliations に残し、短信パーサーの精度の指標にする。
+
+// defaultReconcileThreshold は差異として扱う乖離率 (%) の既定値。
+// 短信は百万円単位の丸めがあるので、完全一致ではなく 1% 以内を一致とみなす
+const defaultReconcileThreshold = 1.0
+
+// reconcileFields は突合する項目 (短信で取れるもの)
+var reconcileFields = []string{"NetSales", "OperatingIncome", "NetIncome", "TotalAssets", "NetAssets"}
+
+// reconRow は突合に使う stock_financials の1行
+type reconRow struct {
+	DocType        string
+	SubmissionDate time.Time
+	FiscalPeriod   string // 短信のみ (Q1 / Q2 / Q3 / FY、旧データは空)
+	Data           FinancialData
+}
+
+// reconDiff は突合した1項目の差
+type reconDiff struct {
+	Field       string
+	ShortValue  int64
+	ReportValue int64
+	DiffPct     float64 // (短信 - 報告書) / |報告書| * 100
+	Flagged     bool
+}
+
+// reconFieldStats は項目ごとの突合結果の集計
+type reconFieldStats struct {
+	Compared   int
+	Flagged    int
+	AbsDiffPct []float64
+}
+
+// reportMatchesPeriod は報告書の書類種別が短信の対象期間と合うか
+func reportMatchesPeriod(docType, fiscalPeriod string) bool {
+	switch fiscalPeriod {
+	case "FY":
+		return docType == "120" || docType == "130"
+	case "Q2":
+		return docType == "140" || docType == "160"
+	case "Q1", "Q3":
+		// 2024年4月以降は四半期報告書が廃止され、対応する報告書は無い
+		return docType == "140"
+	}
+	return docType == "120" || docType == "130" || docType == "140" || docType == "160"
+}
+
+// matchReportRow は短信の後に提出された同じ期の報告書を返す (rows は submission_date ASC)。
+// 有報は決算後3か月以内・短信は45日以内なので、通期は100日、四半期は60日以内の最初の報告書を採る。
+// 期間不明の旧データは種別を問わず75日以内
+func matchReportRow(short reconRow, rows []reconRow) *reconRow {
+	windowDays := 75
+	switch short.FiscalPeriod {
+	case "FY":
+		windowDays = 100
+	case "Q1", "Q2", "Q3":
+		windowDays = 60
+	}
+	limit := short.SubmissionDate.AddDate(0, 0, windowDays)
+	for i := range rows {
+		r := &rows[i]
+		if r.DocType == "SHORT_REPORT" || !r.SubmissionDate.After(short.SubmissionDate) || r.SubmissionDate.After(limit) {
+			continue
+		}
+		if reportMatchesPeriod(r.DocType, short.FiscalPeriod) {
+			return r
+		}
+	}
+	return nil
+}
+
+// diffFinancials は両方に値のある項目だけを比べ、乖離率が threshold (%) を超えるものに印を付ける
+func diffFinancials(short, report FinancialData, threshold float64) []reconDiff {
+	var diffs []reconDiff
+	for _, field := range reconcileFields {
+		s, r := *financialField(&short, field), *financialField(&report, field)
+		if s == 0 || r == 0 {
+			continue
+		}
+		pct := float64(s-r) / math.Abs(float64(r)) * 100
+		diffs = append(diffs, reconDiff{
+			Field: field, ShortValue: s, ReportValue: r,
+			DiffPct: pct, Flagged: math.Abs(pct) > threshold,
+		})
+	}
+	return diffs
+}
+
+// loadReconRows は stock_financials を銘柄ごとに submission_date ASC で読み込む
+func loadReconRows(db *sql.DB) (map[string][]reconRow, error) {
+	rows, err := db.Query(`
+		SELECT code, doc_type, submission_date, COALESCE(fiscal_period, ''),
+		       COALESCE(net_sales, 0), COALESCE(operating_income, 0), COALESCE(net_income, 0),
+		       COALESCE(total_assets, 0), COALESCE(net_assets, 0)
+		FROM stock_financials
+		ORDER BY code ASC, submission_date ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string][]reconRow)
+	for rows.Next() {
+		var code, dateStr string
+		var r reconRow
+		if err := rows.Scan(&code, &r.DocType, &dateStr, &r.FiscalPeriod,
+			&r.Data.NetSales, &r.Data.OperatingIncome, &r.Data.NetIncome,
+			&r.Data.TotalAssets, &r.Data.NetAssets); err != nil {
+			continue
+		}
+		if len(dateStr) < 10 {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", dateStr[:10])
+		if err != nil {
+			continue
+		}
+		r.SubmissionDate = t
+		result[code] = append(result[code], r)
+	}
+	return result, rows.Err()
+}
+
+// reconcileFinancials は全銘柄の短信行を報告書と突合して結果を保存し、項目別の集計を返す。
+// 何度実行しても同じ結果になる (突合済みの行も再計算する)
+func reconcileFinancials(db *sql.DB, threshold float64) (linked int, stats map[string]*reconFieldStats, flagged []string, err error) {
+	all, err := loadReconRows(db)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer tx.Rollback()
+
+	stats = make(map[string]*reconFieldStats)
+	for _, field := range reconcileFields {
+		stats[field] = &reconFieldStats{}
+	}
+
+	codes := make([]string, 0, len(all))
+	for code := range all {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		rows := all[code]
+		for _, s := range rows {
+			if s.DocType != "SHORT_REPORT" {
+				continue
+			}
+			shortDate := s.SubmissionDate.Format("2006-01-02")
+			report := matchReportRow(s, rows)
+			if report == nil {
+				continue
+			}
+			reportDate := report.SubmissionDate.Format("2006-01-02")
+			if _, err := tx.Exec(`UPDATE stock_financials SET reconciled_date = ? WHERE code = ? AND submission_date = ?`,
+				reportDate, code, shortDate); err != nil {
+				return 0, nil, nil, err
+			}
+			linked++
+
+			for _, d := range diffFinancials(s.Data, report.Data, threshold) {
+				st := stats[d.Field]
+				st.Compared++
+				st.AbsDiffPct = append(st.AbsDiffPct, math.Abs(d.DiffPct))
+				if d.Flagged {
+					st.Flagged++
+					flagged = append(flagged, fmt.Sprintf("%s %s %s %-15s 短信 %d / 報告書 %d (%+.1f%%)",
+						code, shortDate, s.FiscalPeriod, d.Field, d.ShortValue, d.ReportValue, d.DiffPct))
+				}
+				_, err := tx.Exec(`
+					INSERT INTO financial_reconciliations (
+						code, short_date, field, report_date, report_doc_type, fiscal_period,
+						short_value, report_value, diff_pct, flagged, reconciled_at
+					) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+					ON CONFLICT(code, short_date, field) DO UPDATE SET
+						report_date = excluded.report_date,
+						report_doc_type = excluded.report_doc_type,
+						fiscal_period = excluded.fiscal_period,
+						short_value = excluded.short_value,
+						report_value = excluded.report_value,
+						diff_pct = excluded.diff_pct,
+						flagged = excluded.flagged,
+						reconciled_at = excluded.reconciled_at`,
+					code, shortDate, d.Field, reportDate, report.DocType, s.FiscalPeriod,
+					d.ShortValue, d.ReportValue, d.DiffPct, d.Flagged, nowJST().Format("2006-01-02 15:04:05"))
+				if err != nil {
+					return 0, nil, nil, err
+				}
+			}
+		}
+	}
+	return linked, stats, flagged, tx.Commit()
+}
+
+// medianFloat はソート済みでないスライスの中央値を返す (空なら 0)
+func medianFloat(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+	if n := len(s); n%2 == 0 {
+		return (s[n/2-1] + s[n/2]) / 2
+	}
+	return s[len(s)/2]
+}
+
+// runReconcileFinancials は -mode=reconcile-financials の本体。突合結果と短信パーサーの精度を表示する
+func runReconcileFinancials(threshold float64) {
+	db, err := initXbrlDB()
+	if err != nil {
+		log.Fatalf("Critical Error: Database init failed: %v", err)
+	}
+	defer db.Close()
+
+	fmt.Printf("🔗 決算短信と報告書の突合 (差異の閾値 %.1f%%)\n", threshold)
+	linked, stats, flagged, err := reconcileFinancials(db, threshold)
+	if err != nil {
+		log.Fatalf("Critical Error: reconcile failed: %v", err)
+	}
+
+	fmt.Printf("\n✅ 突合済みの短信: %d件\n", linked)
+	fmt.Println("📊 項目別の一致率 (短信パーサーの精度):")
+	for _, field := range reconcileFields {
+		st := stats[field]
+		if st.Compared == 0 {
+			fmt.Printf("  %-16s -\n", field)
+			continue
+		}
+		match := float64(st.Compared-st.Flagged) / float64(st.Compared) * 100
+		fmt.Printf("  %-16s 一致 %d/%d (%.1f%%)  乖離率の中央値 %.2f%%\n",
+			field, st.Compared-st.Flagged, st.Compared, match, medianFloat(st.AbsDiffPct))
+	}
+
+	if len(flagged) > 0 {
+		fmt.Printf("\n⚠️ 閾値超の差異: %d件\n", len(flagged))
+		for i, line := range flagged {
+			if i >= 30 {
+				fmt.Printf("  ... 他 %d件 (financial_reconciliations WHERE flagged = 1)\n", len(flagged)-i)
+				break
+			}
+			fmt.Println("  " + line)
+		}
+	}
+
+	// 成長指標の元データが変わるのでキャッシュを破棄
+	cacheClear()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMatchReportRow(t *testing.T) {
+	rows := []reconRow{
+		{DocType: "SHORT_REPORT", FiscalPeriod: "FY", SubmissionDate: mustDate(t, "2025-05-12")},
+		{DocType: "120", SubmissionDate: mustDate(t, "2025-06-25")},
+		{DocType: "SHORT_REPORT", FiscalPeriod: "Q1", SubmissionDate: mustDate(t, "2025-08-05")},
+		{DocType: "SHORT_REPORT", FiscalPeriod: "Q2", SubmissionDate: mustDate(t, "2025-11-07")},
+		{DocType: "160", SubmissionDate: mustDate(t, "2025-11-13")},
+		{DocType: "SHORT_REPORT", FiscalPeriod: "Q3", SubmissionDate: mustDate(t, "2026-02-06")},
+		{DocType: "SHORT_REPORT", FiscalPeriod: "FY", SubmissionDate: mustDate(t, "2026-05-11")},
+		// 期間不明の旧データ
+		{DocType: "SHORT_REPORT", SubmissionDate: mustDate(t, "2026-05-11")},
+		{DocType: "130", SubmissionDate: mustDate(t, "2026-09-30")}, // 窓の外の訂正有報
+	}
+	cases := []struct {
+		short int
+		want  string // 報告書の提出日 ("" は対応なし)
+	}{
+		{0, "2025-06-25"},
+		// 四半期報告書の廃止後、第1・第3四半期は半期報告書と結び付けない
+		{2, ""},
+		{3, "2025-11-13"},
+		{5, ""},
+		{6, ""},
+		{7, ""},
+	}
+	for _, c := range cases {
+		got := ""
+		if r := matchReportRow(rows[c.short], rows); r != nil {
+			got = r.SubmissionDate.Format("2006-01-02")
+		}
+		if got != c.want {
+			t.Errorf("matchReportRow(%s %s) = %q, want %q",
+				rows[c.short].FiscalPeriod, rows[c.short].SubmissionDate.Format("2006-01-02"), got, c.want)
+		}
+	}
+}
+
+func TestDiffFinancials(t *testing.T) {
+	short := FinancialData{NetSales: 100_000_000_000, OperatingIncome: 5_000_000_000, NetIncome: 3_000_000, TotalAssets: 200_000_000_000}
+	report := FinancialData{NetSales: 100_400_000_000, OperatingIncome: 5_000_000_000, NetIncome: 3_000_000_000, NetAssets: 90_000_000_000}
+
+	diffs := diffFinancials(short, report, defaultReconcileThreshold)
+
+	// 片方にしか無い項目 (TotalAssets / NetAssets) は比べない
+	if len(diffs) != 3 {
+		t.Fatalf("len(diffs) = %d, want 3: %+v", len(diffs), diffs)
+	}
+	want := map[string]struct {
+		pct     float64
+		flagged bool
+	}{
+		"NetSales":        {-0.398, false}, // 百万円の丸め程度は一致
+		"OperatingIncome": {0, false},
+		"NetIncome":       {-99.9, true}, // 単位の誤読
+	}
+	for _, d := range diffs {
+		w, ok := want[d.Field]
+		if !ok {
+			t.Errorf("unexpected field %s", d.Field)
+			continue
+		}
+		if math.Abs(d.DiffPct-w.pct) > 0.01 || d.Flagged != w.flagged {
+			t.Errorf("%s: DiffPct=%.3f Flagged=%v, want %.3f %v", d.Field, d.DiffPct, d.Flagged, w.pct, w.flagged)
+		}
+	}
+}
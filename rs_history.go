@@ -0,0 +1,170 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// RS の過去分の計算 (-mode=calc-rs -from -to)
+//
+// calc-rs は最新の営業日 (MAX(date)) の順位しか残さないため、新しい環境では /api/rs/{code} のチャート、
+// /api/cycle-ranking の30日 RSMomentum、detectRSSurge の7日前との比較が空になる。
+// backfillRS は期間内の株価のある営業日ごとに、その日を基準日として calculateRS と同じくプロファイルごとに順位を付ける。
+// 休場日の株価 (取り込みの誤りなど) は期間の開始日以降の終値としては使うが、その日の順位は付けない。
+// 基準日より後の株価は使わない (その日に上場していた銘柄だけが対象になる)。分割・併合は後日のものも含めて調整するが、
+// 基準日と各期間の終値に同じ比率が掛かるだけなので騰落率は変わらない。
+// 日付・プロファイルごとに1トランザクションで保存し、rs_scores に既にある日付は飛ばすので、繰り返し実行しても結果は同じで、
+// 中断しても続きから再開できる (計算し直すときは rs_scores の該当日を消してから実行する)。
+
+// rsHistoryProgressEvery は途中経過を表示する間隔 (計算した日数)
+const rsHistoryProgressEvery = 20
+
+// rsHistoryResult は backfillRS の集計 (Computed / Done / Empty は日付 × プロファイルの数)
+type rsHistoryResult struct {
+	Days     int // 期間内の株価のある営業日
+	Closed   int // 株価はあるが休場日なので飛ばした日
+	Computed int // 今回計算した
+	Done     int // 計算済みで飛ばした
+	Empty    int // 順位を付けられる銘柄が無かった (株価の履歴が足りない・対象の市場区分の銘柄が無い)
+	Scores   int // 保存した行
+}
+
+// loadRSDates は rs_scores にプロファイル profile の from〜to の行がある日付
+func loadRSDates(rsDB *sql.DB, profile, from, to string) (map[string]bool, error) {
+	rows, err := rsDB.Query(`SELECT DISTINCT date FROM rs_scores WHERE profile = ? AND date >= ? AND date <= ?`, profile, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	done := make(map[string]bool)
+	for rows.Next() {
+		var d string
+		if rows.Scan(&d) == nil {
+			done[d] = true
+		}
+	}
+	return done, rows.Err()
+}
+
+// backfillRS は from〜to の株価のある営業日ごとに各プロファイルの RS を計算して rs_scores に保存する (計算済みの日は飛ばす)。
+// universes はプロファイル ID → 対象銘柄 (loadRSUniverses)
+func backfillRS(priceDB, rsDB *sql.DB, benchmark, from, to string, profiles []rsProfile, universes map[string]map[string]bool) (rsHistoryResult, error) {
+	var res rsHistoryResult
+	if _, err := time.Parse("2006-01-02", from); err != nil {
+		return res, fmt.Errorf("-from: %w", err)
+	}
+	done := make(map[string]map[string]bool)
+	for _, prof := range profiles {
+		var err error
+		if done[prof.ID], err = loadRSDates(rsDB, prof.ID, from, to); err != nil {
+			return res, err
+		}
+	}
+
+	// 最初の基準日の最も長い期間の開始日から最後の基準日までを1回で読む
+	adjuster := loadPriceAdjuster(priceDB, "")
+	panel, err := loadRSPricePanel(priceDB, from, to, profiles, adjuster)
+	if err != nil {
+		return res, err
+	}
+
+	computedDays := 0
+	for _, d := range panel.Dates {
+		if d < from {
+			continue
+		}
+		base, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			continue
+		}
+		if !tradingCalendar.IsTradingDay(base) {
+			res.Closed++
+			continue
+		}
+		res.Days++
+		computed := false
+		for _, prof := range profiles {
+			if done[prof.ID][d] {
+				res.Done++
+				continue
+			}
+			starts := prof.periodStarts(base)
+			perfs, _ := panel.rsPerformances(d, prof, starts, universes[prof.ID])
+			if len(perfs) == 0 {
+				res.Empty++
+				continue
+			}
+			n, err := saveRSScores(rsDB, prof.ID, d, perfs, rsBenchmarkScore(priceDB, benchmark, d, prof, starts))
+			if err != nil {
+				return res, fmt.Errorf("%s %s の保存失敗: %w", prof.ID, d, err)
+			}
+			res.Computed++
+			res.Scores += n
+			computed = true
+		}
+		if computed {
+			if computedDays++; computedDays%rsHistoryProgressEvery == 0 {
+				fmt.Printf("  ⏳ %s まで %d日計算 (%d件)\n", d, computedDays, res.Scores)
+			}
+		}
+	}
+	for _, prof := range profiles {
+		if err := saveRSProfile(rsDB, prof); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// calculateRSRange は -mode=calc-rs -from -to の本体。to が空なら株価の最新日まで
+func calculateRSRange(benchmark, from, to string, profiles []rsProfile) {
+	if from == "" {
+		log.Fatalf("-to を指定するときは -from も指定してください")
+	}
+	for _, d := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", d); d != "" && err != nil {
+			log.Fatalf("日付の形式が不正です (YYYY-MM-DD): %s", d)
+		}
+	}
+
+	priceDB, err := initPriceDB()
+	if err != nil {
+		log.Fatalf("stock_price.db open failed: %v", err)
+	}
+	defer priceDB.Close()
+	rsDB, err := initRsDB()
+	if err != nil {
+		log.Fatalf("rs.db init failed: %v", err)
+	}
+	defer rsDB.Close()
+
+	if to == "" {
+		var latest sql.NullString
+		priceDB.QueryRow(`SELECT MAX(date) FROM stock_prices`).Scan(&latest)
+		if !latest.Valid {
+			log.Fatalf("stock_prices にデータがありません (fetch-prices で取得)")
+		}
+		to = latest.String
+	}
+	if to < from {
+		log.Fatalf("-from (%s) は -to (%s) 以前の日付にしてください", from, to)
+	}
+
+	universes, err := loadRSUniverses(profiles)
+	if err != nil {
+		log.Fatalf("Failed to load RS universe: %v", err)
+	}
+
+	fmt.Printf("📊 RS を %s〜%s の営業日ごとに計算 (プロファイル %d個)...\n", from, to, len(profiles))
+	res, err := backfillRS(priceDB, rsDB, benchmark, from, to, profiles, universes)
+	if err != nil {
+		log.Fatalf("RS の計算を中断しました (もう一度実行すると続きから再開します): %v", err)
+	}
+	fmt.Printf("\n✅ 株価のある営業日 %d日 × プロファイル %d個: 計算 %d (%d件), 計算済み %d, 対象銘柄なし %d\n",
+		res.Days, len(profiles), res.Computed, res.Scores, res.Done, res.Empty)
+	if res.Closed > 0 {
+		fmt.Printf("⚠️ 休場日の株価がある日 %d日は順位を付けていません (check-prices で確認)\n", res.Closed)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// newRSTestDB は rs_scores・rs_profiles の一時DB
+func newRSTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "rs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`CREATE TABLE rs_scores (
+		profile TEXT NOT NULL DEFAULT 'default', code TEXT, date TEXT, rs_score REAL, rs_rank INTEGER, excess_score REAL,
+		PRIMARY KEY (profile, code, date))`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE rs_profiles (id TEXT PRIMARY KEY, name TEXT, definition TEXT, updated_at TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// savedRS は rs_scores の1行
+type savedRS struct {
+	Score float64
+	Rank  int
+}
+
+// loadSavedRS は date の rs_scores (銘柄 → スコア・順位)
+func loadSavedRS(t *testing.T, rsDB *sql.DB, date string) map[string]savedRS {
+	t.Helper()
+	rows, err := rsDB.Query(`SELECT code, rs_score, rs_rank FROM rs_scores WHERE date = ?`, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	m := make(map[string]savedRS)
+	for rows.Next() {
+		var code string
+		var s savedRS
+		rows.Scan(&code, &s.Score, &s.Rank)
+		m[code] = s
+	}
+	return m
+}
+
+func TestBackfillRS(t *testing.T) {
+	priceDB := newPanelTestDB(t)
+	rsDB := newRSTestDB(t)
+	lastDate, _ := seedRandomPrices(t, priceDB, 40, 320)
+
+	var dates []string
+	rows, _ := priceDB.Query(`SELECT DISTINCT date FROM stock_prices ORDER BY date DESC LIMIT 5`)
+	for rows.Next() {
+		var d string
+		rows.Scan(&d)
+		dates = append(dates, d)
+	}
+	rows.Close()
+	from, mid := dates[4], dates[2]
+
+	// 期間内の休場日に紛れ込んだ株価の行には順位を付けない
+	d := mustParseDate(from)
+	for tradingCalendar.IsTradingDay(d) {
+		d = d.AddDate(0, 0, 1)
+	}
+	stray := d.Format("2006-01-02")
+	to := max(lastDate, stray)
+	if _, err := savePricesToDB(priceDB, "1300", []StockPrice{{Code: "1300", Date: stray, Close: 1000}}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := backfillRS(priceDB, rsDB, "", from, to, []rsProfile{defaultRSProfile()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Days != 5 || res.Computed != 5 || res.Done != 0 || res.Scores == 0 {
+		t.Fatalf("first run = %+v", res)
+	}
+	if res.Closed != 1 || len(loadSavedRS(t, rsDB, stray)) != 0 {
+		t.Errorf("休場日 %s に順位を付けた: %+v", stray, res)
+	}
+
+	// 再実行は計算済みの日を飛ばす。1日分を消すとその日だけ計算し直す
+	if res, _ := backfillRS(priceDB, rsDB, "", from, to, []rsProfile{defaultRSProfile()}, nil); res.Computed != 0 || res.Done != 5 {
+		t.Errorf("rerun = %+v", res)
+	}
+	before := loadSavedRS(t, rsDB, mid)
+	rsDB.Exec(`DELETE FROM rs_scores WHERE date = ?`, mid)
+	if res, _ := backfillRS(priceDB, rsDB, "", from, to, []rsProfile{defaultRSProfile()}, nil); res.Computed != 1 || res.Done != 4 {
+		t.Errorf("resume = %+v", res)
+	}
+	if after := loadSavedRS(t, rsDB, mid); len(after) != len(before) || len(after) == 0 {
+		t.Errorf("resumed %s: %d rows, want %d", mid, len(after), len(before))
+	}
+
+	// 過去の基準日の順位は、その日より後の株価を消して最新日として計算した順位と同じ
+	priceDB.Exec(`DELETE FROM stock_prices WHERE date > ?`, mid)
+	want, _ := rsPerformancesByQuery(priceDB, priceAdjuster{}, mid, testPeriodStarts(t, mid))
+	got := loadSavedRS(t, rsDB, mid)
+	if len(got) != len(want) {
+		t.Fatalf("%s: %d scores, want %d", mid, len(got), len(want))
+	}
+	for i, w := range want {
+		if g, ws := got[w.Code], (savedRS{w.Score, rsRank(i, len(want))}); g != ws {
+			t.Errorf("%s %s = %+v, want %+v", mid, w.Code, g, ws)
+		}
+	}
+}
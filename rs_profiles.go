@@ -0,0 +1,244 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RS の計算方式 (プロファイル)
+//
+// 期間 (営業日)・重み・順位を付けるのに必要な期間の数と株価の履歴・対象の市場区分を JSON (-rs-profiles) で定義する。
+// calc-rs はプロファイルごとに順位を付け、rs_scores の profile 列に分けて保存する。
+// 既定の "default" は IBD 型 (3/6/9/12ヶ月 = 63営業日ずつ、40/20/20/20%、2期間以上、全銘柄) で、
+// ファイルに "default" が無ければ組み込みのものを使う。API は ?rs_profile= でプロファイルを選ぶ (省略時は default)。
+//
+// 例 (短期の1ヶ月 RS とプライム市場だけの IBD 型):
+//
+//	{"profiles": [
+//	  {"id": "1m", "name": "1ヶ月", "periods": [21], "weights": [1], "min_periods": 1},
+//	  {"id": "prime", "name": "プライム", "periods": [63, 126, 189, 252], "weights": [0.4, 0.2, 0.2, 0.2],
+//	   "min_history_days": 252, "markets": ["プライム"]}
+//	]}
+
+// defaultRSProfileID は rs_scores.profile の既定値 (プロファイル導入前の行もこれになる)
+const defaultRSProfileID = "default"
+
+// rsProfileIDPattern はプロファイル ID に使える文字 (URL の ?rs_profile= にそのまま書ける)
+var rsProfileIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// rsProfile は RS の計算方式
+type rsProfile struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Periods    []int     `json:"periods"`     // 各期間の営業日数 (基準日から遡る)
+	Weights    []float64 `json:"weights"`     // 各期間の重み (Periods と同じ数)
+	MinPeriods int       `json:"min_periods"` // 順位を付けるのに必要な終値のある期間の数。0 なら min(2, 期間の数)
+	// 基準日の何営業日前までに株価が必要か (上場・取引開始から日の浅い銘柄を外す)。0 なら問わない。
+	// 期間の開始日に株価が無い銘柄は開始日以降の最初の終値を使うので、MinPeriods だけでは履歴の短い銘柄は外れない
+	MinHistoryDays int      `json:"min_history_days,omitempty"`
+	Markets        []string `json:"markets,omitempty"` // 対象の市場区分 (stocks.market_segment に含む文字列のどれか)。空なら全銘柄
+}
+
+// defaultRSProfile は IBD 型の既定プロファイル (プロファイル導入前の calc-rs と同じ)
+func defaultRSProfile() rsProfile {
+	return rsProfile{
+		ID:         defaultRSProfileID,
+		Name:       "IBD型 (3/6/9/12ヶ月)",
+		Periods:    []int{rsQuarterTradingDays, 2 * rsQuarterTradingDays, 3 * rsQuarterTradingDays, 4 * rsQuarterTradingDays},
+		Weights:    []float64{0.4, 0.2, 0.2, 0.2},
+		MinPeriods: 2,
+	}
+}
+
+// normalize は MinPeriods の既定値を埋めて設定を検証する
+func (p *rsProfile) normalize() error {
+	if !rsProfileIDPattern.MatchString(p.ID) {
+		return fmt.Errorf("id %q は英数字・_・- の32文字以内にしてください", p.ID)
+	}
+	if len(p.Periods) == 0 || len(p.Periods) != len(p.Weights) {
+		return fmt.Errorf("%s: periods と weights は同じ数 (1つ以上) にしてください", p.ID)
+	}
+	for i, d := range p.Periods {
+		if d <= 0 || p.Weights[i] < 0 {
+			return fmt.Errorf("%s: periods は正の営業日数、weights は0以上にしてください", p.ID)
+		}
+	}
+	if p.MinPeriods == 0 {
+		p.MinPeriods = min(2, len(p.Periods))
+	}
+	if p.MinPeriods < 1 || p.MinPeriods > len(p.Periods) {
+		return fmt.Errorf("%s: min_periods は1〜%d にしてください", p.ID, len(p.Periods))
+	}
+	if p.MinHistoryDays < 0 {
+		return fmt.Errorf("%s: min_history_days は0以上にしてください", p.ID)
+	}
+	if p.Name == "" {
+		p.Name = p.ID
+	}
+	return nil
+}
+
+// periodStarts は基準日から各期間の開始日を営業日で数える。祝日の多い月でも期間の長さが揃う
+func (p rsProfile) periodStarts(base time.Time) []string {
+	starts := make([]string, len(p.Periods))
+	for i, d := range p.Periods {
+		starts[i] = tradingCalendar.AddTradingDays(base, -d).Format("2006-01-02")
+	}
+	return starts
+}
+
+// historyStart は基準日 base の時点で株価が必要な最も新しい日 (MinHistoryDays が0なら "")
+func (p rsProfile) historyStart(base time.Time) string {
+	if p.MinHistoryDays <= 0 {
+		return ""
+	}
+	return tradingCalendar.AddTradingDays(base, -p.MinHistoryDays).Format("2006-01-02")
+}
+
+// oldestStart は基準日 base で使う最も古い日 (期間の開始日と historyStart。株価を読み始める日)
+func (p rsProfile) oldestStart(base time.Time) string {
+	return tradingCalendar.AddTradingDays(base, -max(slices.Max(p.Periods), p.MinHistoryDays)).Format("2006-01-02")
+}
+
+// performance は基準日の終値と各期間の開始日の終値から加重騰落率 (%) を返す。
+// 終値のある期間が MinPeriods に満たなければ false
+func (p rsProfile) performance(latest float64, past []float64) (float64, bool) {
+	score, valid := rsPerformance(latest, past, p.Weights)
+	return score, valid >= p.MinPeriods
+}
+
+// loadRSProfiles は path (空なら組み込みの default だけ) のプロファイルを読む。default は必ず先頭に入る
+func loadRSProfiles(path string) ([]rsProfile, error) {
+	var file struct {
+		Profiles []rsProfile `json:"profiles"`
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &file); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	profiles := []rsProfile{defaultRSProfile()}
+	seen := map[string]bool{}
+	for _, p := range file.Profiles {
+		if err := p.normalize(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if seen[p.ID] {
+			return nil, fmt.Errorf("%s: id %q が重複しています", path, p.ID)
+		}
+		seen[p.ID] = true
+		if p.ID == defaultRSProfileID {
+			profiles[0] = p
+			continue
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// selectRSProfiles は ids (カンマ区切り、空なら全部) のプロファイルを返す
+func selectRSProfiles(profiles []rsProfile, ids string) ([]rsProfile, error) {
+	if ids == "" {
+		return profiles, nil
+	}
+	var selected []rsProfile
+	for _, id := range strings.Split(ids, ",") {
+		id = strings.TrimSpace(id)
+		found := false
+		for _, p := range profiles {
+			if p.ID == id {
+				selected = append(selected, p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("RS プロファイル %q がありません (-rs-profiles で定義)", id)
+		}
+	}
+	return selected, nil
+}
+
+// loadRSUniverse は市場区分が markets のどれかを含む銘柄。markets が空なら nil (全銘柄)
+func loadRSUniverse(xbrlDB *sql.DB, markets []string) (map[string]bool, error) {
+	if len(markets) == 0 {
+		return nil, nil
+	}
+	rows, err := xbrlDB.Query(`SELECT code, COALESCE(market_segment, '') FROM stocks`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	universe := make(map[string]bool)
+	for rows.Next() {
+		var code, segment string
+		if rows.Scan(&code, &segment) != nil {
+			continue
+		}
+		for _, m := range markets {
+			if strings.Contains(segment, m) {
+				universe[code] = true
+				break
+			}
+		}
+	}
+	return universe, rows.Err()
+}
+
+// loadRSUniverses は対象の市場区分を絞ったプロファイルの銘柄 (プロファイル ID → 銘柄)。絞らないプロファイルは入らない
+func loadRSUniverses(profiles []rsProfile) (map[string]map[string]bool, error) {
+	universes := make(map[string]map[string]bool)
+	var xbrlDB *sql.DB
+	for _, prof := range profiles {
+		if len(prof.Markets) == 0 {
+			continue
+		}
+		if xbrlDB == nil {
+			db, err := initXbrlDB()
+			if err != nil {
+				return nil, err
+			}
+			defer db.Close()
+			xbrlDB = db
+		}
+		u, err := loadRSUniverse(xbrlDB, prof.Markets)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", prof.ID, err)
+		}
+		universes[prof.ID] = u
+	}
+	return universes, nil
+}
+
+// saveRSProfile は計算に使ったプロファイルを rs_profiles に残す (/api/rs-profiles の一覧用)
+func saveRSProfile(rsDB *sql.DB, p rsProfile) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = rsDB.Exec(`
+		INSERT INTO rs_profiles (id, name, definition, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET name = excluded.name, definition = excluded.definition, updated_at = excluded.updated_at`,
+		p.ID, p.Name, string(b), nowJST().Format(time.RFC3339))
+	return err
+}
+
+// rsProfileParam は ?rs_profile= のプロファイル ID (省略・不正な値は default)
+func rsProfileParam(r *http.Request) string {
+	if id := r.URL.Query().Get("rs_profile"); rsProfileIDPattern.MatchString(id) {
+		return id
+	}
+	return defaultRSProfileID
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRSProfiles(t *testing.T) {
+	builtin, err := loadRSProfiles("")
+	if err != nil || len(builtin) != 1 || !reflect.DeepEqual(builtin[0], defaultRSProfile()) {
+		t.Fatalf("built-in = %+v, %v", builtin, err)
+	}
+
+	profiles, err := loadRSProfiles(filepath.Join("testdata", "rs", "profiles.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, p := range profiles {
+		ids = append(ids, p.ID)
+	}
+	if want := []string{"default", "1m", "prime"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("ids = %v, want %v", ids, want)
+	}
+	if p := profiles[1]; p.MinPeriods != 1 || p.Name != "1ヶ月" {
+		t.Errorf("1m = %+v (期間が1つなら min_periods の既定は1)", p)
+	}
+	if p := profiles[2]; p.MinPeriods != 3 || p.MinHistoryDays != 252 || !reflect.DeepEqual(p.Markets, []string{"プライム"}) {
+		t.Errorf("prime = %+v", p)
+	}
+
+	sel, err := selectRSProfiles(profiles, "prime, default")
+	if err != nil || len(sel) != 2 || sel[0].ID != "prime" || sel[1].ID != "default" {
+		t.Errorf("select = %+v, %v", sel, err)
+	}
+	if _, err := selectRSProfiles(profiles, "3m"); err == nil {
+		t.Error("未定義のプロファイルはエラー")
+	}
+
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{"重みの数が違う", `{"profiles": [{"id": "x", "periods": [21, 63], "weights": [1]}]}`, "同じ数"},
+		{"期間が無い", `{"profiles": [{"id": "x"}]}`, "同じ数"},
+		{"負の期間", `{"profiles": [{"id": "x", "periods": [-21], "weights": [1]}]}`, "正の営業日数"},
+		{"min_periods が多すぎる", `{"profiles": [{"id": "x", "periods": [21], "weights": [1], "min_periods": 2}]}`, "min_periods"},
+		{"URL に書けない ID", `{"profiles": [{"id": "短期", "periods": [21], "weights": [1]}]}`, "英数字"},
+		{"ID の重複", `{"profiles": [{"id": "x", "periods": [21], "weights": [1]}, {"id": "x", "periods": [63], "weights": [1]}]}`, "重複"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "profiles.json")
+		os.WriteFile(path, []byte(tt.json), 0o644)
+		if _, err := loadRSProfiles(path); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// default を上書きできる
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	os.WriteFile(path, []byte(`{"profiles": [{"id": "default", "periods": [63], "weights": [1]}]}`), 0o644)
+	if p, err := loadRSProfiles(path); err != nil || len(p) != 1 || !reflect.DeepEqual(p[0].Periods, []int{63}) {
+		t.Errorf("override default = %+v, %v", p, err)
+	}
+}
+
+func TestRSPerformancesProfiles(t *testing.T) {
+	db := newPanelTestDB(t)
+	baseDate, adjuster := seedRandomPrices(t, db, 30, 300)
+	panel, err := loadPricePanel(db, "", "stock_prices", "", "", adjuster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := time.Parse("2006-01-02", baseDate)
+
+	oneMonth := rsProfile{ID: "1m", Periods: []int{21}, Weights: []float64{1}, MinPeriods: 1}
+	starts := oneMonth.periodStarts(base)
+	perfs, _ := panel.rsPerformances(baseDate, oneMonth, starts, nil)
+	if len(perfs) == 0 {
+		t.Fatal("no scores")
+	}
+	for _, p := range perfs {
+		c := panel.codeIndex(p.Code)
+		latest, _ := panel.closeAt(c, baseDate)
+		past, _ := panel.closeBetween(c, starts[0], baseDate)
+		if want := (latest/past - 1) * 100; math.Abs(p.Score-want) > 1e-9 {
+			t.Errorf("%s: 1m score = %v, want %v", p.Code, p.Score, want)
+		}
+	}
+
+	// 対象銘柄を絞ると、その銘柄だけで順位を付ける
+	universe := map[string]bool{perfs[0].Code: true, perfs[len(perfs)-1].Code: true}
+	got, skipped := panel.rsPerformances(baseDate, oneMonth, starts, universe)
+	if len(got) != 2 || skipped != 0 || got[0].Code != perfs[0].Code || rsRank(1, len(got)) != 99 {
+		t.Errorf("universe = %+v (skipped %d)", got, skipped)
+	}
+
+	// 履歴の日数を求めると、上場が遅い銘柄 (seedRandomPrices の 1301, 1311, ...) が外れる
+	def := defaultRSProfile()
+	all, _ := panel.rsPerformances(baseDate, def, def.periodStarts(base), nil)
+	def.MinHistoryDays = 252
+	strict, _ := panel.rsPerformances(baseDate, def, def.periodStarts(base), nil)
+	if len(strict) != len(all)-3 {
+		t.Errorf("min_history_days 252: %d scores, want %d", len(strict), len(all)-3)
+	}
+	for _, p := range strict {
+		if p.Code == "1301" || p.Code == "1311" || p.Code == "1321" {
+			t.Errorf("%s は履歴が短い", p.Code)
+		}
+	}
+}
+
+func TestMigrateRSScoresProfile(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "rs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE rs_scores (
+		code TEXT, date TEXT, rs_score REAL, rs_rank INTEGER, excess_score REAL, PRIMARY KEY (code, date))`); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec(`INSERT INTO rs_scores VALUES ('7203', '2026-01-05', 10, 60, NULL), ('7203', '2026-01-06', 12, 70, 1.5)`)
+
+	if err := migrateRSScoresProfile(db); err != nil {
+		t.Fatal(err)
+	}
+	// 同じ銘柄・日付でもプロファイルが違えば別の行
+	if _, err := db.Exec(`INSERT INTO rs_scores (profile, code, date, rs_score, rs_rank) VALUES ('1m', '7203', '2026-01-06', 3, 20)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// 各 API と同じ形の「プロファイルごとの銘柄の最新日」の問い合わせ
+	latest := func(profile string) (rank int) {
+		db.QueryRow(`SELECT rs_rank FROM (
+			SELECT code, rs_rank, MAX(date) FROM rs_scores WHERE profile = ? GROUP BY code)`, profile).Scan(&rank)
+		return rank
+	}
+	if got := latest(defaultRSProfileID); got != 70 {
+		t.Errorf("default latest rank = %d, want 70", got)
+	}
+	if got := latest("1m"); got != 20 {
+		t.Errorf("1m latest rank = %d, want 20", got)
+	}
+	var excess float64
+	db.QueryRow(`SELECT excess_score FROM rs_scores WHERE profile = 'default' AND date = '2026-01-06'`).Scan(&excess)
+	if excess != 1.5 {
+		t.Errorf("excess_score = %v, want 1.5", excess)
+	}
+}
@@ -66,8 +66,9 @@ func startServer() {
 	fmt.Println("🌐 Dashboard starting at http://localhost:8080")
 	fmt.Println("📂 Serving static files from ./web/")
 	fmt.Println("📊 API endpoint: http://localhost:8080/api/stocks")
-	fmt.Println("📈 Price API: http://localhost:8080/api/prices/{code}")
+	fmt.Println("📈 Price API: http://localhost:8080/api/prices/{code}?interval=1d|1w|1mo&from=&to=")
 	fmt.Println("🚀 O'Neil Ranking API: http://localhost:8080/api/oneil-ranking")
-	fmt.Println("📉 Market Index API: http://localhost:8080/api/market-index/{code}")
+	fmt.Println("🏅 RS Profiles API: http://localhost:8080/api/rs-profiles (各 API の ?rs_profile=)")
+	fmt.Println("📉 Market Index API: http://localhost:8080/api/market-index (一覧) / api/market-index/{code}")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
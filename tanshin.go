@@ -7,23 +7,20 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// parseTanshinForDate は指定日のTDNET決算短信PDFを取得・パースしてstock_financialsに保存する
+// parseTanshinForDate は指定日のTDNET決算短信を取得・パースしてstock_financialsに保存する
 // 注意:
+// - サマリー XBRL (tdnet_xbrl.go) があればそれを優先し、PDF パースは XBRL が無い/読めない場合のフォールバック
 // - PDFは一時ファイルとして処理し、保存しない (著作権・容量考慮)
-// - poppler-utils (pdftotext) コマンドが必要
-// - 決算短信のフォーマット差異により抽出精度は完璧ではない
+// - PDF のテキスト抽出は -pdf-backend で選択 (pdftext.go)。pdftotext が無くても Go 実装で動く
+// - 決算短信PDFのフォーマット差異により、PDF 由来の抽出精度は完璧ではない
 func parseTanshinForDate(targetDate string) {
-	// pdftotext コマンドの存在確認
-	if _, err := exec.LookPath("pdftotext"); err != nil {
-		log.Fatalf("pdftotext が見つかりません。Dockerコンテナを再ビルドしてください: docker compose build")
-	}
+	log.Printf("📑 PDF テキスト抽出: %s", resolvePDFBackend())
 
 	db, err := initXbrlDB()
 	if err != nil {
@@ -31,28 +28,51 @@ func parseTanshinForDate(targetDate string) {
 	}
 	defer db.Close()
 
-	// 対象: 指定日に投稿された「決算短信」を含む開示
+	// 旧バージョンで取得した未分類の行にもカテゴリを付けてから抽出する
+	if _, err := classifyTdnetDisclosures(db, targetDate, false); err != nil {
+		log.Printf("⚠️ classify failed: %v", err)
+	}
+
+	// 対象: 指定日に投稿された決算短信 (訂正のお知らせは本文が差分のみなので除外)
 	rows, err := db.Query(`
-		SELECT code, name, disclosure_datetime, title, pdf_url
+		SELECT code, name, disclosure_datetime, title, COALESCE(pdf_url, ''), COALESCE(xbrl_url, ''),
+		       COALESCE(fiscal_year_end, ''), COALESCE(fiscal_period, '')
 		FROM tdnet_disclosures
 		WHERE disclosure_datetime LIKE ? || '%'
-		  AND title LIKE '%決算短信%'
-		  AND pdf_url != ''`, targetDate)
+		  AND doc_category = ?
+		  AND COALESCE(is_correction, 0) = 0
+		  AND (COALESCE(pdf_url, '') != '' OR COALESCE(xbrl_url, '') != '')`, targetDate, CategoryEarnings)
 	if err != nil {
 		log.Fatalf("Query failed: %v (先に task fetch-tdnet を実行してください)", err)
 	}
-	defer rows.Close()
 
 	type target struct {
-		code, name, dt, title, url string
+		code, name, dt, title, url, xbrlURL, fye, period string
 	}
 	var targets []target
 	for rows.Next() {
 		var t target
-		if err := rows.Scan(&t.code, &t.name, &t.dt, &t.title, &t.url); err == nil {
+		if err := rows.Scan(&t.code, &t.name, &t.dt, &t.title, &t.url, &t.xbrlURL, &t.fye, &t.period); err == nil {
 			targets = append(targets, t)
 		}
 	}
+	rows.Close()
+
+	// 業績予想の修正 (forecasts)・配当関連開示 (dividend_events)・自己株式取得 (buybacks)・株式分割 (corporate_actions) は決算短信の有無に関わらず処理する
+	defer func() {
+		if saved, failed := parseForecastRevisionsForDate(db, targetDate); saved+failed > 0 {
+			fmt.Printf("📈 業績予想の修正: 保存=%d, 失敗=%d\n", saved, failed)
+		}
+		if saved, failed := parseDividendDisclosuresForDate(db, targetDate); saved+failed > 0 {
+			fmt.Printf("💴 配当関連開示: 保存=%d, 失敗=%d\n", saved, failed)
+		}
+		if saved, failed := parseBuybackDisclosuresForDate(db, targetDate); saved+failed > 0 {
+			fmt.Printf("🔁 自己株式取得: 保存=%d, 失敗=%d\n", saved, failed)
+		}
+		if saved, failed := parseStockSplitDisclosuresForDate(db, targetDate); saved+failed > 0 {
+			fmt.Printf("✂️ 株式分割・併合: 保存=%d, 失敗=%d\n", saved, failed)
+		}
+	}()
 
 	if len(targets) == 0 {
 		fmt.Printf("⚠️ %s に決算短信の開示はありません (先に task fetch-tdnet DATE=%s で取得が必要)\n", targetDate, targetDate)
@@ -67,60 +87,59 @@ func parseTanshinForDate(targetDate string) {
 		"NetSales": 0, "OperatingIncome": 0, "NetIncome": 0, "TotalAssets": 0, "NetAssets": 0,
 	}
 	var partialFailures []string // 部分失敗 (売上はあるが利益0など) の銘柄リスト
+	sourceCount := map[string]int{}
+	reviewCount := 0 // 要確認キューに回した項目数
 
 	for i, t := range targets {
 		fmt.Printf("  [%d/%d] %s %s ... ", i+1, len(targets), t.code, t.name)
 
-		pdfPath, err := downloadPDF(t.url)
-		if err != nil {
-			fmt.Printf("DL失敗: %v\n", err)
-			failCount++
-			continue
-		}
-
-		text, err := extractPDFText(pdfPath)
-		os.Remove(pdfPath) // 一時ファイル削除
-		if err != nil {
-			fmt.Printf("テキスト抽出失敗: %v\n", err)
-			failCount++
-			continue
+		// 1. サマリー XBRL (単位が明示されているので補正不要)
+		var summary tanshinSummary
+		var evidence tanshinEvidence
+		source := ""
+		if t.xbrlURL != "" {
+			s, err := fetchTanshinXBRL(t.xbrlURL)
+			if err == nil && (s.Data.NetSales != 0 || s.Data.NetIncome != 0 || s.Data.OperatingIncome != 0) {
+				summary, evidence, source = s, xbrlEvidence(s.Data), "xbrl"
+			} else if err != nil {
+				fmt.Printf("XBRL失敗 (%v) → PDF ", err)
+			}
 		}
 
-		data := parseTanshinText(text)
-
-		// 既存 stocks テーブルの売上値と比較して妥当性チェック + 単位補正
-		// EDINET XBRL 由来の値が「正」なので、決算短信の値とズレてたら単位誤判定の可能性
-		var existingSales int64
-		db.QueryRow("SELECT COALESCE(net_sales, 0) FROM stocks WHERE code = ?", t.code).Scan(&existingSales)
-		if existingSales > 0 && data.NetSales > 0 {
-			ratio := float64(data.NetSales) / float64(existingSales)
-
-			// 比率がほぼ1000倍 (±10%) なら単位誤判定 → 1/1000 補正
-			if ratio > 900 && ratio < 1100 {
-				data.NetSales /= 1000
-				data.OperatingIncome /= 1000
-				data.NetIncome /= 1000
-				data.TotalAssets /= 1000
-				data.NetAssets /= 1000
-				fmt.Printf("🔧 単位補正 (1/1000): 比率%.1f → ", ratio)
-			}
-			// 比率がほぼ 1/1000 (0.0009〜0.0011) なら逆方向の単位誤判定 → 1000倍補正
-			if ratio < 0.0011 && ratio > 0.0009 {
-				data.NetSales *= 1000
-				data.OperatingIncome *= 1000
-				data.NetIncome *= 1000
-				data.TotalAssets *= 1000
-				data.NetAssets *= 1000
-				fmt.Printf("🔧 単位補正 (×1000): 比率%.4f → ", ratio)
+		// 2. PDF フォールバック
+		if source == "" {
+			if t.url == "" {
+				fmt.Println("XBRL・PDF とも利用不可")
+				failCount++
+				continue
 			}
-
-			// 補正後に再チェック
-			ratio = float64(data.NetSales) / float64(existingSales)
-			if ratio > 10 || ratio < 0.1 {
-				fmt.Printf("⚠️ 売上妥当性NG (既存%d vs 抽出%d, 比率%.2f) → スキップ\n", existingSales, data.NetSales, ratio)
+			s, ev, ok := parseTanshinPDF(db, t.code, t.url)
+			if !ok {
 				failCount++
 				continue
 			}
+			summary, evidence, source = s, ev, "pdf"
+		}
+
+		// 低信頼度の項目は保存せず要確認キューへ (既存値は上書きしない)
+		review := applyReviewThreshold(&summary.Data, evidence)
+		for field := range review {
+			delete(evidence, field)
+		}
+		if len(review) > 0 {
+			reviewCount += len(review)
+			if err := saveTanshinEvidence(db, t.code, t.dt, source, nil, review); err != nil {
+				fmt.Printf("要確認キュー保存失敗: %v ", err)
+			}
+		}
+		data := summary.Data
+
+		// 決算期・対象期間が本文から読めなければ、開示表題の分類結果 (tdnet_classify.go) を使う
+		if summary.FiscalYearEnd == "" {
+			summary.FiscalYearEnd = t.fye
+		}
+		if summary.FiscalPeriod == "" {
+			summary.FiscalPeriod = t.period
 		}
 
 		// 抽出統計
@@ -149,6 +168,15 @@ func parseTanshinForDate(targetDate string) {
 
 		// stock_financials に保存 (doc_type=SHORT_REPORT で区別)
 		err = saveStockFinancial(db, t.code, "SHORT_REPORT", t.dt, t.title, data)
+		if err == nil {
+			err = saveTanshinExtras(db, t.code, t.dt, source, summary)
+		}
+		if err == nil {
+			err = saveTanshinEvidence(db, t.code, t.dt, source, evidence, nil)
+		}
+		if err == nil {
+			err = saveEarningsForecast(db, t.code, t.dt, t.title, summary.FiscalYearEnd, summary)
+		}
 		if err != nil {
 			fmt.Printf("DB保存失敗: %v\n", err)
 			failCount++
@@ -160,14 +188,19 @@ func parseTanshinForDate(targetDate string) {
 			partialFailures = append(partialFailures, fmt.Sprintf("%s %s (純利益取得失敗)", t.code, t.name))
 		}
 
-		fmt.Printf("✅ 売上=%d 営利=%d 純利=%d\n", data.NetSales, data.OperatingIncome, data.NetIncome)
+		fmt.Printf("✅ [%s %s %s] 売上=%d 営利=%d 純利=%d\n", source, summary.FiscalYearEnd, summary.FiscalPeriod,
+			data.NetSales, data.OperatingIncome, data.NetIncome)
 		successCount++
+		sourceCount[source]++
 
 		// レート制限対策
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	fmt.Printf("\n✅ 完了: 成功=%d, 失敗=%d\n", successCount, failCount)
+	fmt.Printf("\n✅ 完了: 成功=%d (XBRL=%d, PDF=%d), 失敗=%d\n", successCount, sourceCount["xbrl"], sourceCount["pdf"], failCount)
+	if reviewCount > 0 {
+		fmt.Printf("🔍 低信頼度で要確認キュー (tanshin_review_queue) に回した項目: %d件\n", reviewCount)
+	}
 	fmt.Println("📊 抽出成功率:")
 	for _, key := range []string{"NetSales", "OperatingIncome", "NetIncome", "TotalAssets", "NetAssets"} {
 		rate := float64(parseStats[key]) / float64(len(targets)) * 100
@@ -183,6 +216,58 @@ func parseTanshinForDate(targetDate string) {
 	}
 }
 
+// parseTanshinPDF は決算短信PDFをダウンロード・テキスト化してパースする (XBRL が無い場合のフォールバック)。
+// 失敗 (DL・テキスト抽出) 時は理由を出力して ok=false を返す。
+func parseTanshinPDF(db *sql.DB, code, url string) (summary tanshinSummary, ev tanshinEvidence, ok bool) {
+	pdfPath, err := downloadPDF(url)
+	if err != nil {
+		fmt.Printf("DL失敗: %v\n", err)
+		return summary, nil, false
+	}
+
+	text, err := extractPDFText(pdfPath)
+	os.Remove(pdfPath) // 一時ファイル削除
+	if err != nil {
+		fmt.Printf("テキスト抽出失敗: %v\n", err)
+		return summary, nil, false
+	}
+
+	summary, ev = summarizeTanshinText(db, code, text)
+	return summary, ev, true
+}
+
+// summarizeTanshinText は決算短信のテキストから実績・対象期間・前年同期・業績予想を読み、項目ごとの根拠を返す。
+// 単位が推定のため、既存 stocks の値 (EDINET XBRL 由来で「正」) と項目ごとに比べて
+// ×1000 / ÷1000 の単位補正と妥当性チェックを行い、結果を信頼度に反映する (値は捨てない)
+func summarizeTanshinText(db *sql.DB, code, text string) (tanshinSummary, tanshinEvidence) {
+	var summary tanshinSummary
+	data, ev := parseTanshinTextEvidence(text)
+	summary.FiscalYearEnd, summary.FiscalPeriod = detectTanshinHeader(text)
+
+	var ref FinancialData
+	db.QueryRow(`
+		SELECT COALESCE(net_sales, 0), COALESCE(operating_income, 0), COALESCE(net_income, 0),
+		       COALESCE(total_assets, 0), COALESCE(net_assets, 0)
+		FROM stocks WHERE code = ?`, code).Scan(
+		&ref.NetSales, &ref.OperatingIncome, &ref.NetIncome, &ref.TotalAssets, &ref.NetAssets)
+	scale := checkTanshinUnits(&data, ev, ref)
+
+	if prior := extractPriorPeriodRow(text); prior != nil {
+		m := float64(tanshinUnitMultiplier(text)) * scale
+		summary.Prior = FinancialData{
+			NetSales:        int64(float64(prior.NetSales) * m),
+			OperatingIncome: int64(float64(prior.OperatingIncome) * m),
+			NetIncome:       int64(float64(prior.NetIncome) * m),
+		}
+	}
+	if v, fye, ok := parseTanshinForecastText(text); ok {
+		summary.ForecastNetSales, summary.ForecastOperatingIncome, summary.ForecastNetIncome = v.NetSales, v.OperatingIncome, v.NetIncome
+		summary.ForecastEPS, summary.ForecastFiscalYearEnd = v.EPS, fye
+	}
+	summary.Data = data
+	return summary, ev
+}
+
 // downloadPDF は URL から PDF をダウンロードして一時ファイルに保存し、パスを返す
 func downloadPDF(url string) (string, error) {
 	client := &http.Client{Timeout: 60 * time.Second}
@@ -209,166 +294,140 @@ func downloadPDF(url string) (string, error) {
 	return tmp.Name(), nil
 }
 
-// extractPDFText は pdftotext コマンドで PDF からテキストを抽出する
-func extractPDFText(pdfPath string) (string, error) {
-	cmd := exec.Command("pdftotext", "-layout", "-enc", "UTF-8", pdfPath, "-")
-	out, err := cmd.Output()
-	if err != nil {
-		return "", err
-	}
-	return string(out), nil
-}
-
 // parseTanshinText は決算短信のテキストから財務データを抽出する
 // 注意: 決算短信のフォーマットは企業・業種により異なるため、ベストエフォート
 func parseTanshinText(text string) FinancialData {
+	d, _ := parseTanshinTextEvidence(text)
+	return d
+}
+
+// tanshinFieldLabels は項目ごとの行頭ラベル (優先順) と、値として認める最小桁数
+var tanshinFieldLabels = []struct {
+	field     string
+	labels    []string
+	minDigits int
+}{
+	{"NetSales", []string{"売上高", "売上収益", "営業収益", "経常収益", "経常収入"}, 4},
+	{"OperatingIncome", []string{"営業利益", "調整後営業利益", "事業利益", "経常利益", "営業損失"}, 2},
+	{"NetIncome", []string{
+		"親会社株主に帰属する当期純利益", "親会社株主に帰属する四半期純利益",
+		"親会社の所有者に帰属する当期利益", "親会社の所有者に帰属する四半期利益",
+		"当期純利益", "四半期純利益",
+	}, 2},
+	{"TotalAssets", []string{"総資産", "資産合計"}, 4},
+	// 資本合計は IFRS
+	{"NetAssets", []string{"純資産", "純資産合計", "資本合計"}, 4},
+}
+
+// parseTanshinTextEvidence は parseTanshinText の本体。項目ごとに採用したルール・マッチした行・信頼度を返す。
+// 妥当性チェックで捨てた値も信頼度 0 で evidence に残す (要確認キューに回すため)
+func parseTanshinTextEvidence(text string) (FinancialData, tanshinEvidence) {
 	var d FinancialData
+	ev := tanshinEvidence{}
 
-	// 単位判定: 連結経営成績表のヘッダ範囲(先頭6000文字)で最初に見つかる単位を採用
-	multiplier := int64(1_000_000) // デフォルト百万円
-	headerLen := len(text)
-	if headerLen > 6000 {
-		headerLen = 6000
-	}
-	header := text[:headerLen]
-	yenIdx := regexp.MustCompile(`\(百万円\)`).FindStringIndex(header)
-	thouIdx := regexp.MustCompile(`\(千円\)`).FindStringIndex(header)
-	if yenIdx != nil && thouIdx != nil {
-		if thouIdx[0] < yenIdx[0] {
-			multiplier = 1_000
-		}
-	} else if thouIdx != nil {
-		multiplier = 1_000
-	}
+	multiplier := tanshinUnitMultiplier(text)
 
-	// 優先方式は項目名行頭マッチ (findFirst)。
+	// 優先方式は項目名行頭マッチ。
 	// extractFromPeriodRow は実験で精度悪化したため、純利益のみのフォールバックに後置する。
 
-	// 主要項目の抽出ヘルパー
-	// 行末まで or 改行までの数字を厳格にマッチ (隣接行混入を防ぐ)
-	findFirst := func(patterns []string) int64 {
-		for _, p := range patterns {
-			rx := regexp.MustCompile(p)
+	// 行頭の項目名 + 同一行内の最初の数値 を要求 (`[\s　]*` は半角/全角スペース)
+	// 行頭アンカー (?m) でマルチライン対応、行末まで or 改行までの数字を厳格にマッチ (隣接行混入を防ぐ)
+	for _, f := range tanshinFieldLabels {
+		for i, label := range f.labels {
+			rx := regexp.MustCompile(fmt.Sprintf(`(?m)^[\s　]*%s[^\n]*?[\s　]([0-9,△▲\-]{%d,})`, label, f.minDigits))
 			m := rx.FindStringSubmatch(text)
-			if len(m) >= 2 {
-				v := parseJPNumber(m[1])
-				if v != 0 {
-					return v
-				}
+			if len(m) < 2 {
+				continue
 			}
+			v := parseJPNumber(m[1])
+			if v == 0 {
+				continue
+			}
+			conf := confidenceLabelMatch
+			if i > 0 {
+				conf = confidenceLabelAlternate
+			}
+			ev.set(&d, f.field, fieldEvidence{
+				Value: v * multiplier, Confidence: conf,
+				Rule: "行頭ラベル:" + label, Span: strings.TrimSpace(m[0]),
+			})
+			break
 		}
-		return 0
-	}
-
-	// 行頭の項目名 + 同一行内の最初の数値 を要求 (`[\s　]*` は半角/全角スペース)
-	// 行頭アンカー (?m) でマルチライン対応
-	// 優先方式で取れなかった場合のフォールバック (項目名行頭マッチ)
-	if d.NetSales == 0 {
-		d.NetSales = findFirst([]string{
-			`(?m)^[\s　]*売上高[^\n]*?[\s　]([0-9,△▲\-]{4,})`,
-			`(?m)^[\s　]*売上収益[^\n]*?[\s　]([0-9,△▲\-]{4,})`,
-			`(?m)^[\s　]*営業収益[^\n]*?[\s　]([0-9,△▲\-]{4,})`,
-			`(?m)^[\s　]*経常収益[^\n]*?[\s　]([0-9,△▲\-]{4,})`,
-			`(?m)^[\s　]*経常収入[^\n]*?[\s　]([0-9,△▲\-]{4,})`,
-		}) * multiplier
-	}
-
-	if d.OperatingIncome == 0 {
-		d.OperatingIncome = findFirst([]string{
-			`(?m)^[\s　]*営業利益[^\n]*?[\s　]([0-9,△▲\-]{2,})`,
-			`(?m)^[\s　]*調整後営業利益[^\n]*?[\s　]([0-9,△▲\-]{2,})`,
-			`(?m)^[\s　]*事業利益[^\n]*?[\s　]([0-9,△▲\-]{2,})`,
-			`(?m)^[\s　]*経常利益[^\n]*?[\s　]([0-9,△▲\-]{2,})`,
-			`(?m)^[\s　]*営業損失[^\n]*?[\s　]([0-9,△▲\-]{2,})`,
-		}) * multiplier
-	}
-
-	if d.NetIncome == 0 {
-		d.NetIncome = findFirst([]string{
-			`(?m)^[\s　]*親会社株主に帰属する当期純利益[^\n]*?[\s　]([0-9,△▲\-]{2,})`,
-			`(?m)^[\s　]*親会社株主に帰属する四半期純利益[^\n]*?[\s　]([0-9,△▲\-]{2,})`,
-			`(?m)^[\s　]*親会社の所有者に帰属する当期利益[^\n]*?[\s　]([0-9,△▲\-]{2,})`,
-			`(?m)^[\s　]*親会社の所有者に帰属する四半期利益[^\n]*?[\s　]([0-9,△▲\-]{2,})`,
-			`(?m)^[\s　]*当期純利益[^\n]*?[\s　]([0-9,△▲\-]{2,})`,
-			`(?m)^[\s　]*四半期純利益[^\n]*?[\s　]([0-9,△▲\-]{2,})`,
-		}) * multiplier
 	}
 
 	// 最終フォールバック: 売上は取れたが純利益が0なら、期表示行から推定
 	// (改行越え対応で取れなかった項目名マッチをカバー)
 	if d.NetIncome == 0 && d.NetSales > 0 {
 		if pdata := extractFromPeriodRow(text); pdata != nil && pdata.NetIncome != 0 {
-			d.NetIncome = pdata.NetIncome * multiplier
+			ev.set(&d, "NetIncome", fieldEvidence{
+				Value: pdata.NetIncome * multiplier, Confidence: confidenceFallback,
+				Rule: "期表示行の列位置",
+			})
 		}
 	}
 
-	d.TotalAssets = findFirst([]string{
-		`(?m)^[\s　]*総資産[^\n]*?[\s　]([0-9,△▲\-]{4,})`,
-		`(?m)^[\s　]*資産合計[^\n]*?[\s　]([0-9,△▲\-]{4,})`,
-	}) * multiplier
-
-	d.NetAssets = findFirst([]string{
-		`(?m)^[\s　]*純資産[^\n]*?[\s　]([0-9,△▲\-]{4,})`,
-		`(?m)^[\s　]*純資産合計[^\n]*?[\s　]([0-9,△▲\-]{4,})`,
-		// IFRS
-		`(?m)^[\s　]*資本合計[^\n]*?[\s　]([0-9,△▲\-]{4,})`,
-	}) * multiplier
-
 	// 妥当性チェック: 異常値の除外
 	// 上限: 日本最大企業の年間売上 (Toyota 約45兆円) を考慮し 50兆円を上限
 	const maxSalesYen = 50_000_000_000_000
 
 	// 1. 売上が負の値は誤抽出 (前年比△XX% を誤読した典型例)
 	if d.NetSales < 0 {
-		return FinancialData{}
+		return FinancialData{}, ev.rejectAll("売上が負 (増減率の誤読)")
 	}
 	// 2. 売上が 50兆円超は誤抽出 (PDF表崩れによる別項目混入)
 	if d.NetSales > maxSalesYen {
-		return FinancialData{}
+		return FinancialData{}, ev.rejectAll("売上が50兆円超 (表崩れ)")
 	}
 	// 3. 総資産が 1000兆円超 (実質メガバンク級でも 400兆円) も同様
 	if d.TotalAssets > 1000_000_000_000_000 {
-		return FinancialData{}
+		return FinancialData{}, ev.rejectAll("総資産が1000兆円超 (表崩れ)")
 	}
 	// 3. 純利益の絶対値が売上の3倍を超える場合は誤抽出 (純資産混入等)
 	if d.NetSales > 0 && abs64(d.NetIncome) > d.NetSales*3 {
-		d.NetIncome = 0
+		ev.reject(&d, "NetIncome", "売上の3倍超 (純資産混入)")
 	}
 	// 4. 営業利益の絶対値が売上の2倍を超える場合も同様
 	if d.NetSales > 0 && abs64(d.OperatingIncome) > d.NetSales*2 {
-		d.OperatingIncome = 0
+		ev.reject(&d, "OperatingIncome", "売上の2倍超")
 	}
 	// 5. 純資産が総資産より大きい場合は誤抽出
 	if d.TotalAssets > 0 && d.NetAssets > d.TotalAssets {
-		d.NetAssets = 0
+		ev.reject(&d, "NetAssets", "総資産より大きい")
 	}
 
-	return d
+	return d, ev
 }
 
-// debugTanshin は単一銘柄の決算短信PDFを取得し、テキスト抽出 + パース結果を表示する
+// debugTanshin は単一銘柄の決算短信PDFを取得し、テキスト抽出 + パース結果を表示する (サマリー XBRL があれば併記)
 // 正規表現の調整やトラブルシュート用
 func debugTanshin(code, date string) {
-	if _, err := exec.LookPath("pdftotext"); err != nil {
-		log.Fatalf("pdftotext が必要です")
-	}
-
 	db, err := initXbrlDB()
 	if err != nil {
 		log.Fatalf("DB init: %v", err)
 	}
 	defer db.Close()
 
-	var url, title string
-	err = db.QueryRow(`
-		SELECT pdf_url, title FROM tdnet_disclosures
-		WHERE code = ? AND disclosure_datetime LIKE ? || '%' AND title LIKE '%決算短信%'
-		ORDER BY disclosure_datetime DESC LIMIT 1`, code, date).Scan(&url, &title)
+	url, xbrlURL, title, err := findTanshinDisclosure(db, code, date)
 	if err != nil {
 		log.Fatalf("該当する決算短信が tdnet_disclosures にありません: %v", err)
 	}
 
-	fmt.Printf("📄 %s %s\n   URL: %s\n", code, title, url)
+	fmt.Printf("📄 %s %s\n   URL: %s\n   PDF テキスト抽出: %s\n", code, title, url, resolvePDFBackend())
+
+	// サマリー XBRL があれば、PDF パース結果と見比べられるよう先に表示
+	if xbrlURL != "" {
+		fmt.Printf("   XBRL: %s\n\n--- サマリー XBRL ---\n", xbrlURL)
+		if s, err := fetchTanshinXBRL(xbrlURL); err != nil {
+			fmt.Printf("XBRL取得失敗: %v\n", err)
+		} else {
+			printFinancialSummary(s.Data)
+			fmt.Printf("EPS:          %.2f 円\n", s.EPS)
+			fmt.Printf("配当(年間):   %.2f 円\n", s.Data.DividendPerShare)
+			fmt.Printf("予想 売上高:  %d 円 / 営業利益: %d 円 / 純利益: %d 円\n",
+				s.ForecastNetSales, s.ForecastOperatingIncome, s.ForecastNetIncome)
+			fmt.Printf("予想 EPS:     %.2f 円 / 配当: %.2f 円\n", s.ForecastEPS, s.ForecastDividendPerShare)
+		}
+	}
 
 	pdfPath, err := downloadPDF(url)
 	if err != nil {
@@ -389,8 +448,31 @@ func debugTanshin(code, date string) {
 	}
 	fmt.Println(text[:limit])
 
+	// parse-tanshin と同じ単位補正・信頼度判定を通した結果を表示する
+	summary, ev := summarizeTanshinText(db, code, text)
 	fmt.Println("\n--- パース結果 ---")
-	d := parseTanshinText(text)
+	printFinancialSummary(summary.Data)
+	fmt.Printf("決算期:       %s %s\n", summary.FiscalYearEnd, summary.FiscalPeriod)
+	if summary.Prior.NetSales != 0 || summary.Prior.NetIncome != 0 {
+		fmt.Printf("前年同期:     売上高 %d 円 / 営業利益 %d 円 / 純利益 %d 円\n",
+			summary.Prior.NetSales, summary.Prior.OperatingIncome, summary.Prior.NetIncome)
+	}
+	fmt.Printf("\n--- 根拠 (信頼度 %.2f 未満は要確認キュー行き) ---\n", tanshinReviewThreshold)
+	printTanshinEvidence(ev)
+}
+
+// findTanshinDisclosure は tdnet_disclosures から指定銘柄・日付の決算短信 (同日に複数あれば最新) を探す
+func findTanshinDisclosure(db *sql.DB, code, date string) (pdfURL, xbrlURL, title string, err error) {
+	err = db.QueryRow(`
+		SELECT COALESCE(pdf_url, ''), COALESCE(xbrl_url, ''), title FROM tdnet_disclosures
+		WHERE code = ? AND disclosure_datetime LIKE ? || '%'
+		  AND (doc_category = ? OR title LIKE '%決算短信%')
+		ORDER BY disclosure_datetime DESC LIMIT 1`, code, date, CategoryEarnings).Scan(&pdfURL, &xbrlURL, &title)
+	return
+}
+
+// printFinancialSummary は debug-tanshin 用に主要5項目を表示する
+func printFinancialSummary(d FinancialData) {
 	fmt.Printf("売上高:       %d 円 (%.2f 億円)\n", d.NetSales, float64(d.NetSales)/1e8)
 	fmt.Printf("営業利益:     %d 円 (%.2f 億円)\n", d.OperatingIncome, float64(d.OperatingIncome)/1e8)
 	fmt.Printf("純利益:       %d 円 (%.2f 億円)\n", d.NetIncome, float64(d.NetIncome)/1e8)
@@ -405,6 +487,89 @@ func abs64(v int64) int64 {
 	return v
 }
 
+// tanshinUnitMultiplier は連結経営成績表のヘッダ範囲(先頭6000文字)で最初に見つかる単位を円への倍率で返す
+func tanshinUnitMultiplier(text string) int64 {
+	multiplier := int64(1_000_000) // デフォルト百万円
+	headerLen := len(text)
+	if headerLen > 6000 {
+		headerLen = 6000
+	}
+	header := text[:headerLen]
+	yenIdx := regexp.MustCompile(`\(百万円\)`).FindStringIndex(header)
+	thouIdx := regexp.MustCompile(`\(千円\)`).FindStringIndex(header)
+	if yenIdx != nil && thouIdx != nil {
+		if thouIdx[0] < yenIdx[0] {
+			multiplier = 1_000
+		}
+	} else if thouIdx != nil {
+		multiplier = 1_000
+	}
+	return multiplier
+}
+
+var (
+	// 経営成績表の期表示: 「2025年3月期」「2026年3月期第1四半期」「2026年3月期中間期」
+	periodRowLabelRegex = regexp.MustCompile(`^[\s　]*(\d{4})年[\s　]*(\d{1,2})月期[\s　]*((?:第[1-4]四半期|中間期?)?)`)
+	periodRowNumRegex   = regexp.MustCompile(`[△▲\-]?[\d,]+(?:\.\d+)?`)
+)
+
+// detectTanshinHeader は決算短信の表題行 (「2026年3月期 第1四半期決算短信〔日本基準〕(連結)」) から
+// 決算期 (YYYY-MM) と対象期間 (Q1 / Q2 / Q3 / FY) を判定する。
+// 本文には通期予想の「通期」が出てくるので、表題行だけを見る
+func detectTanshinHeader(text string) (fiscalYearEnd, fiscalPeriod string) {
+	for _, line := range strings.Split(fullWidthDigits.Replace(text), "\n") {
+		if !strings.Contains(line, "決算短信") {
+			continue
+		}
+		if fye := detectFiscalYearEnd(line); fye != "" {
+			return fye, detectFiscalPeriod(line)
+		}
+	}
+	return "", ""
+}
+
+// extractPriorPeriodRow は経営成績表の当期行の直後にある前年同期の行 (百万円等の表示単位のまま) を返す。
+// 当期「2026年3月期第1四半期」に対して「2025年3月期第1四半期」のように、
+// 1年前の同じ期間の行が続いている場合だけ採用する
+func extractPriorPeriodRow(text string) *FinancialData {
+	type row struct {
+		year, month int
+		suffix      string
+		ints        []int64
+	}
+	var rows []row
+	for _, line := range strings.Split(fullWidthDigits.Replace(text), "\n") {
+		m := periodRowLabelRegex.FindStringSubmatch(line)
+		if m == nil || strings.Contains(line, "決算短信") {
+			continue
+		}
+		var ints []int64
+		rest := dividendDateRegex.ReplaceAllString(line[len(m[0]):], "")
+		for _, tok := range periodRowNumRegex.FindAllString(rest, -1) {
+			if !strings.Contains(tok, ".") { // 増減率 (%) は除外
+				ints = append(ints, parseJPNumber(tok))
+			}
+		}
+		if len(ints) < 2 {
+			continue // 「2025年3月期の業績予想」など数値の無い行
+		}
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		rows = append(rows, row{year, month, m[3], ints})
+		if len(rows) == 2 {
+			break
+		}
+	}
+	if len(rows) < 2 {
+		return nil
+	}
+	cur, prior := rows[0], rows[1]
+	if prior.year != cur.year-1 || prior.month != cur.month || prior.suffix != cur.suffix {
+		return nil
+	}
+	return periodRowData(prior.ints)
+}
+
 // extractFromPeriodRow は「YYYY年X月期 数値 % 数値 % ...」形式の連結業績表から当期データを抽出する
 // IFRS/日本基準の主要4列パターン (売上, 営利, 経常/税引前, 純利益) に対応
 // 戻り値の単位は「百万円」(乗算前)
@@ -427,7 +592,8 @@ func extractFromPeriodRow(text string) *FinancialData {
 	if m := nextRx.FindStringIndex(rest); m != nil && m[0] < end {
 		end = m[0]
 	}
-	region := text[loc[0] : loc[1]+end]
+	// 期表示の年 (2025 等) を数値として拾わないよう、期表示の後ろから
+	region := text[loc[1] : loc[1]+end]
 
 	// 数値群を抽出
 	numRx := regexp.MustCompile(`[△▲\-]?[\d,]+(?:\.\d+)?`)
@@ -447,6 +613,11 @@ func extractFromPeriodRow(text string) *FinancialData {
 		ints = append(ints, v)
 	}
 
+	return periodRowData(ints)
+}
+
+// periodRowData は経営成績表の1行の金額列を FinancialData に割り当てる
+func periodRowData(ints []int64) *FinancialData {
 	if len(ints) == 0 {
 		return nil
 	}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// 決算短信パーサーの回帰テスト用コーパス
+//
+// testdata/tanshin_corpus/<code>_<date>.txt に抽出済みテキスト、同名の .json に正解値を置く
+// (テキストの代わりに .pdf を置けばテスト時に go バックエンドで抽出する)。
+// tanshin_corpus_test.go がコーパス全体で項目ごとの精度を集計し、baseline.json より下がったら失敗する。
+// 実際の短信は -mode=tanshin-corpus-add -code=XXXX -date=YYYY-MM-DD で追加する
+// (日本基準・IFRS・四半期を最低1件ずつ。追加したら go test -run TestTanshinCorpus -update で baseline.json を作り直す)。
+// examples/ は作成した見本 (実際の開示ではない) で、書式の例として置くだけで精度の集計には入れない。
+const (
+	tanshinCorpusDir        = "testdata/tanshin_corpus"
+	tanshinCorpusExampleDir = "testdata/tanshin_corpus/examples"
+)
+
+// tanshinCorpusCase はコーパス1件の正解 (.json)
+type tanshinCorpusCase struct {
+	Code    string `json:"code"`
+	Date    string `json:"date"`
+	Title   string `json:"title"`
+	Backend string `json:"backend"` // テキスト抽出に使ったバックエンド (go / pdftotext / manual)
+	Note    string `json:"note,omitempty"`
+
+	// Expected は項目名 (tanshinEvidenceFields) → 円。0 は「短信にその項目が無い」
+	Expected map[string]int64 `json:"expected"`
+	// ExpectedSource は正解値の出所。xbrl (サマリー XBRL) / manual (目視) / parser (未確認の仮値)
+	ExpectedSource string `json:"expected_source"`
+	// Verified が false の間は精度の集計に入れない (parser の仮値を目視で直したら true にする)
+	Verified bool `json:"verified"`
+}
+
+// financialDataToExpected は FinancialData の対象項目を正解マップにする
+func financialDataToExpected(d FinancialData) map[string]int64 {
+	m := make(map[string]int64, len(tanshinEvidenceFields))
+	for _, field := range tanshinEvidenceFields {
+		m[field] = *financialField(&d, field)
+	}
+	return m
+}
+
+// addTanshinCorpusCase は -mode=tanshin-corpus-add の本体。実際の決算短信のテキストをコーパスに保存する。
+// サマリー XBRL があればその値を正解とし、無ければパーサーの出力を未確認の仮値として書く
+func addTanshinCorpusCase(code, date string) {
+	if code == "" {
+		log.Fatalf("tanshin-corpus-add requires -code. Example: -mode=tanshin-corpus-add -code=7203 -date=2025-05-08")
+	}
+
+	db, err := initXbrlDB()
+	if err != nil {
+		log.Fatalf("DB init: %v", err)
+	}
+	defer db.Close()
+
+	url, xbrlURL, title, err := findTanshinDisclosure(db, code, date)
+	if err != nil {
+		log.Fatalf("該当する決算短信が tdnet_disclosures にありません: %v", err)
+	}
+
+	name := fmt.Sprintf("%s_%s", code, date)
+	txtPath := filepath.Join(tanshinCorpusDir, name+".txt")
+	jsonPath := filepath.Join(tanshinCorpusDir, name+".json")
+	if _, err := os.Stat(jsonPath); err == nil {
+		log.Fatalf("%s は既にコーパスにあります (作り直す場合は削除してから実行)", jsonPath)
+	}
+
+	pdfPath, err := downloadPDF(url)
+	if err != nil {
+		log.Fatalf("DL失敗: %v", err)
+	}
+	defer os.Remove(pdfPath)
+	text, err := extractPDFText(pdfPath)
+	if err != nil {
+		log.Fatalf("抽出失敗: %v", err)
+	}
+
+	c := tanshinCorpusCase{Code: code, Date: date, Title: title, Backend: resolvePDFBackend()}
+	if xbrlURL != "" {
+		if s, err := fetchTanshinXBRL(xbrlURL); err == nil {
+			c.Expected, c.ExpectedSource, c.Verified = financialDataToExpected(s.Data), "xbrl", true
+		} else {
+			fmt.Printf("⚠️ XBRL取得失敗 (パーサーの出力を仮値にします): %v\n", err)
+		}
+	}
+	if c.Expected == nil {
+		c.Expected, c.ExpectedSource = financialDataToExpected(parseTanshinText(text)), "parser"
+	}
+
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		log.Fatalf("JSON 変換失敗: %v", err)
+	}
+	if err := os.MkdirAll(tanshinCorpusDir, 0755); err != nil {
+		log.Fatalf("ディレクトリ作成失敗: %v", err)
+	}
+	if err := os.WriteFile(txtPath, []byte(text), 0644); err != nil {
+		log.Fatalf("書き込み失敗: %v", err)
+	}
+	if err := os.WriteFile(jsonPath, append(b, '\n'), 0644); err != nil {
+		log.Fatalf("書き込み失敗: %v", err)
+	}
+
+	fmt.Printf("✅ コーパスに追加: %s (%s)\n", name, title)
+	fmt.Printf("   %s\n   %s\n", txtPath, jsonPath)
+	if c.Verified {
+		fmt.Println("   正解値: サマリー XBRL")
+	} else {
+		fmt.Println("⚠️ 正解値はパーサーの出力 (未確認)。PDF と見比べて直し、\"verified\": true にしてください")
+	}
+	fmt.Println("   精度の確認: go test -run TestTanshinCorpus -v (改善したら -update で baseline.json を更新)")
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// corpusFieldScore は1項目のコーパス全体での成績
+type corpusFieldScore struct {
+	Extracted int `json:"-"` // パーサーが値を出した件数
+	Expected  int `json:"-"` // 正解に値がある件数
+	Correct   int `json:"-"` // 値を出して正解と一致した件数
+
+	Precision float64 `json:"precision"` // Correct / Extracted
+	Recall    float64 `json:"recall"`    // Correct / Expected
+}
+
+// corpusValueMatches は丸め (千円・百万円未満の切捨て/四捨五入) を許して正解と比べる
+func corpusValueMatches(got, want int64) bool {
+	if want == 0 {
+		return got == 0
+	}
+	return math.Abs(float64(got-want)) <= math.Abs(float64(want))*0.001
+}
+
+// loadTanshinCorpus は dir のコーパスの正解とテキストを読み込む (未確認の仮値は除く)
+func loadTanshinCorpus(t *testing.T, dir string) (cases []tanshinCorpusCase, texts map[string]string) {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts = make(map[string]string)
+	for _, p := range paths {
+		if filepath.Base(p) == "baseline.json" {
+			continue
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var c tanshinCorpusCase
+		if err := json.Unmarshal(b, &c); err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		if !c.Verified {
+			t.Logf("skip %s: 正解値が未確認 (expected_source=%s)", filepath.Base(p), c.ExpectedSource)
+			continue
+		}
+
+		base := strings.TrimSuffix(p, ".json")
+		var text string
+		if b, err := os.ReadFile(base + ".txt"); err == nil {
+			text = string(b)
+		} else if text, err = extractPDFTextGo(base + ".pdf"); err != nil {
+			t.Fatalf("%s: テキスト (.txt) も PDF (.pdf) も読めません: %v", base, err)
+		}
+		texts[filepath.Base(base)] = text
+		cases = append(cases, c)
+	}
+	return cases, texts
+}
+
+// missingCorpusLayouts はコーパスに1件も無い様式 (日本基準の通期・IFRS・四半期) を表題から判定して返す
+func missingCorpusLayouts(cases []tanshinCorpusCase) []string {
+	var jgaap, ifrs, quarterly bool
+	for _, c := range cases {
+		title := fullWidthDigits.Replace(c.Title)
+		switch {
+		case detectFiscalPeriod(title) != "FY":
+			quarterly = true
+		case strings.Contains(title, "IFRS"), strings.Contains(title, "ＩＦＲＳ"):
+			ifrs = true
+		case strings.Contains(title, "日本基準"):
+			jgaap = true
+		}
+	}
+	var missing []string
+	for _, l := range []struct {
+		name string
+		ok   bool
+	}{{"日本基準", jgaap}, {"IFRS", ifrs}, {"四半期", quarterly}} {
+		if !l.ok {
+			missing = append(missing, l.name)
+		}
+	}
+	return missing
+}
+
+// scoreTanshinCorpus はパーサーの出力 (parsed、<code>_<date> → 抽出結果) の項目別の精度・再現率を集計する。
+// 2つ目の戻り値は正解と合わなかった項目 (ソート済み)
+func scoreTanshinCorpus(cases []tanshinCorpusCase, parsed map[string]FinancialData) (map[string]*corpusFieldScore, []string) {
+	scores := make(map[string]*corpusFieldScore)
+	for _, field := range tanshinEvidenceFields {
+		scores[field] = &corpusFieldScore{}
+	}
+	var misses []string
+	for _, c := range cases {
+		name := c.Code + "_" + c.Date
+		d := parsed[name]
+		for _, field := range tanshinEvidenceFields {
+			got, want := *financialField(&d, field), c.Expected[field]
+			s := scores[field]
+			if got != 0 {
+				s.Extracted++
+			}
+			if want != 0 {
+				s.Expected++
+			}
+			switch {
+			case got != 0 && corpusValueMatches(got, want):
+				s.Correct++
+			case got != 0 || want != 0:
+				misses = append(misses, fmt.Sprintf("%s %-16s got %d, want %d", name, field, got, want))
+			}
+		}
+	}
+	sort.Strings(misses)
+	for _, s := range scores {
+		if s.Extracted > 0 {
+			s.Precision = float64(s.Correct) / float64(s.Extracted)
+		}
+		if s.Expected > 0 {
+			s.Recall = float64(s.Correct) / float64(s.Expected)
+		}
+	}
+	return scores, misses
+}
+
+// corpusRegressions は baseline より精度・再現率が下がった項目を返す
+func corpusRegressions(scores map[string]*corpusFieldScore, baseline map[string]corpusFieldScore) []string {
+	const eps = 1e-9
+	var regressions []string
+	for _, field := range tanshinEvidenceFields {
+		s, base := scores[field], baseline[field]
+		if s.Precision < base.Precision-eps {
+			regressions = append(regressions, fmt.Sprintf("%s: precision %.3f < baseline %.3f", field, s.Precision, base.Precision))
+		}
+		if s.Recall < base.Recall-eps {
+			regressions = append(regressions, fmt.Sprintf("%s: recall %.3f < baseline %.3f", field, s.Recall, base.Recall))
+		}
+	}
+	return regressions
+}
+
+// TestTanshinCorpusExamples は見本 (examples/) が正解とテキストの揃った形式になっていることだけを確認する
+func TestTanshinCorpusExamples(t *testing.T) {
+	cases, texts := loadTanshinCorpus(t, tanshinCorpusExampleDir)
+	if len(cases) == 0 {
+		t.Fatal("見本がありません")
+	}
+	for _, c := range cases {
+		if len(c.Expected) == 0 || texts[c.Code+"_"+c.Date] == "" {
+			t.Errorf("%s_%s: 正解またはテキストが空", c.Code, c.Date)
+		}
+	}
+}
+
+// TestTanshinCorpus はコーパス全体で parseTanshinText の項目別の精度・再現率を集計し、
+// baseline.json を下回ったら失敗する。集計は go test -run TestTanshinCorpus -v で表示、
+// パーサーを改善したら go test -run TestTanshinCorpus -update で baseline.json を更新する
+func TestTanshinCorpus(t *testing.T) {
+	cases, texts := loadTanshinCorpus(t, tanshinCorpusDir)
+	if len(cases) == 0 {
+		t.Skip("コーパスが空 (実際の短信を -mode=tanshin-corpus-add で追加し、-update で baseline.json を作る)")
+	}
+	if missing := missingCorpusLayouts(cases); len(missing) > 0 {
+		t.Errorf("コーパスに %v の短信がありません (-mode=tanshin-corpus-add で追加する)", missing)
+	}
+
+	parsed := make(map[string]FinancialData, len(texts))
+	for name, text := range texts {
+		parsed[name] = parseTanshinText(text)
+	}
+	scores, misses := scoreTanshinCorpus(cases, parsed)
+	t.Logf("決算短信コーパス: %d件", len(cases))
+	for _, field := range tanshinEvidenceFields {
+		s := scores[field]
+		t.Logf("  %-16s precision %d/%d (%.0f%%)  recall %d/%d (%.0f%%)",
+			field, s.Correct, s.Extracted, s.Precision*100, s.Correct, s.Expected, s.Recall*100)
+	}
+	for _, m := range misses {
+		t.Logf("  ✗ %s", m)
+	}
+
+	baselinePath := filepath.Join(tanshinCorpusDir, "baseline.json")
+	if *updateGolden {
+		b, err := json.MarshalIndent(scores, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(baselinePath, append(b, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	b, err := os.ReadFile(baselinePath)
+	if err != nil {
+		t.Fatalf("read baseline (go test -run TestTanshinCorpus -update で生成): %v", err)
+	}
+	var baseline map[string]corpusFieldScore
+	if err := json.Unmarshal(b, &baseline); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range corpusRegressions(scores, baseline) {
+		t.Error(r)
+	}
+}
+
+func TestMissingCorpusLayouts(t *testing.T) {
+	cases := []tanshinCorpusCase{
+		{Title: "2025年3月期　決算短信〔日本基準〕(連結)"},
+		{Title: "２０２６年３月期　第１四半期決算短信〔ＩＦＲＳ〕(連結)"},
+	}
+	if got := missingCorpusLayouts(cases); len(got) != 1 || got[0] != "IFRS" {
+		t.Errorf("missingCorpusLayouts = %v, want [IFRS]", got)
+	}
+	cases = append(cases, tanshinCorpusCase{Title: "2025年12月期 決算短信〔IFRS〕(連結)"})
+	if got := missingCorpusLayouts(cases); len(got) != 0 {
+		t.Errorf("missingCorpusLayouts = %v, want []", got)
+	}
+}
+
+// TestScoreTanshinCorpus は集計と baseline 比較そのものを手で作った抽出結果と正解で確かめる
+// (パーサーの出来には依存しない。実際の短信が無くても CI で動く)
+func TestScoreTanshinCorpus(t *testing.T) {
+	cases := []tanshinCorpusCase{
+		{Code: "1001", Date: "2025-05-08", Expected: map[string]int64{ // 貸借対照表の無い短信 (TotalAssets は 0)
+			"NetSales": 100_000_000_000, "OperatingIncome": 10_000_000_000, "NetIncome": 6_000_000_000, "NetAssets": 50_000_000_000}},
+		{Code: "1002", Date: "2025-08-07", Expected: map[string]int64{
+			"NetSales": 50_000_000_000, "OperatingIncome": 5_000_000_000, "NetIncome": 3_000_000_000,
+			"TotalAssets": 80_000_000_000, "NetAssets": 40_000_000_000}},
+	}
+	parsed := map[string]FinancialData{
+		"1001_2025-05-08": {
+			NetSales:        100_000_000_000,
+			OperatingIncome: 10_004_000_000,  // 丸めの範囲 (0.1%) のずれは正解
+			NetIncome:       0,               // 取れなかった
+			TotalAssets:     300_000_000_000, // 無い項目を出した
+			NetAssets:       45_000_000_000,  // 違う値
+		},
+		"1002_2025-08-07": {
+			NetSales:        50_000_000_000,
+			OperatingIncome: 4_000_000_000, // 前期の列
+			NetIncome:       3_000_000_000,
+			TotalAssets:     80_000_000_000,
+			NetAssets:       40_000_000_000,
+		},
+	}
+
+	scores, misses := scoreTanshinCorpus(cases, parsed)
+	want := map[string]struct{ precision, recall float64 }{
+		"NetSales":        {1, 1},
+		"OperatingIncome": {0.5, 0.5},
+		"NetIncome":       {1, 0.5},
+		"TotalAssets":     {0.5, 1},
+		"NetAssets":       {0.5, 0.5},
+	}
+	for field, w := range want {
+		if s := scores[field]; s.Precision != w.precision || s.Recall != w.recall {
+			t.Errorf("%s: precision %.2f recall %.2f, want %.2f %.2f", field, s.Precision, s.Recall, w.precision, w.recall)
+		}
+	}
+	if len(misses) != 4 {
+		t.Errorf("misses = %v, want 4件", misses)
+	}
+
+	// baseline.json と同じ形に書き出して読み戻すと回帰なし
+	b, err := json.Marshal(scores)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var baseline map[string]corpusFieldScore
+	if err := json.Unmarshal(b, &baseline); err != nil {
+		t.Fatal(err)
+	}
+	if r := corpusRegressions(scores, baseline); len(r) != 0 {
+		t.Errorf("同じ成績で回帰: %v", r)
+	}
+
+	// 1002 の純資産も外すと、その項目の精度と再現率だけが baseline を下回る
+	d := parsed["1002_2025-08-07"]
+	d.NetAssets = 20_000_000_000
+	parsed["1002_2025-08-07"] = d
+	scores, _ = scoreTanshinCorpus(cases, parsed)
+	r := corpusRegressions(scores, baseline)
+	if len(r) != 2 || !strings.HasPrefix(r[0], "NetAssets: precision") || !strings.HasPrefix(r[1], "NetAssets: recall") {
+		t.Errorf("regressions = %v", r)
+	}
+}
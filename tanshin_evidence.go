@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 決算短信の抽出値ごとの信頼度と根拠
+//
+// PDF 由来の値は項目ごとに「どのルールで・どの行から取ったか」と信頼度 (0〜1) を持つ。
+// 信頼度が tanshinReviewThreshold 未満の値は stock_financials に書かず tanshin_review_queue に回す
+// (既存値を上書きしない・黙って捨てない)。
+const (
+	confidenceXBRL           = 1.0  // サマリー XBRL (単位・符号が明示されている)
+	confidenceLabelMatch     = 0.9  // 行頭ラベルの第一候補 (売上高・営業利益 など)
+	confidenceLabelAlternate = 0.75 // 行頭ラベルの代替候補 (経常収益・資産合計 など)
+	confidenceFallback       = 0.5  // 期表示行の列位置から推定
+
+	confidenceUnitFixed    = 0.7 // 単位誤判定を既存値との比較で補正した (乗数)
+	confidenceUnitInferred = 0.6 // 既存値が無く、売上の補正に合わせた (乗数)
+	confidenceMismatch     = 0.2 // 単位補正後も既存値と10倍以上ずれる (上限)
+
+	tanshinReviewThreshold = 0.5
+)
+
+// tanshinEvidenceFields は信頼度を付ける項目 (FinancialData のフィールド名)
+var tanshinEvidenceFields = []string{"NetSales", "OperatingIncome", "NetIncome", "TotalAssets", "NetAssets"}
+
+// fieldEvidence は抽出した1項目の値 (円) と根拠
+type fieldEvidence struct {
+	Value      int64   `json:"value"`
+	Confidence float64 `json:"confidence"`
+	Rule       string  `json:"rule"`           // 採用したルールと補正内容
+	Span       string  `json:"span,omitempty"` // マッチしたテキスト
+}
+
+// tanshinEvidence は項目名 → 根拠
+type tanshinEvidence map[string]fieldEvidence
+
+// financialField は FinancialData の信頼度対象フィールドへのポインタを返す
+func financialField(d *FinancialData, field string) *int64 {
+	switch field {
+	case "NetSales":
+		return &d.NetSales
+	case "OperatingIncome":
+		return &d.OperatingIncome
+	case "NetIncome":
+		return &d.NetIncome
+	case "TotalAssets":
+		return &d.TotalAssets
+	case "NetAssets":
+		return &d.NetAssets
+	}
+	return nil
+}
+
+// set は値を d に書き込み、根拠を記録する
+func (ev tanshinEvidence) set(d *FinancialData, field string, e fieldEvidence) {
+	*financialField(d, field) = e.Value
+	ev[field] = e
+}
+
+// reject は妥当性チェックで捨てた値を信頼度 0 で残し、d からは消す
+func (ev tanshinEvidence) reject(d *FinancialData, field, reason string) {
+	if e, ok := ev[field]; ok {
+		e.Confidence = 0
+		e.Rule += " → 却下: " + reason
+		ev[field] = e
+	}
+	*financialField(d, field) = 0
+}
+
+// rejectAll は抽出全体が誤りと判断した場合に、全項目を信頼度 0 にする
+func (ev tanshinEvidence) rejectAll(reason string) tanshinEvidence {
+	var zero FinancialData
+	for field := range ev {
+		ev.reject(&zero, field, reason)
+	}
+	return ev
+}
+
+// xbrlEvidence はサマリー XBRL の値にまとめて根拠を付ける
+func xbrlEvidence(d FinancialData) tanshinEvidence {
+	ev := tanshinEvidence{}
+	for _, field := range tanshinEvidenceFields {
+		if v := *financialField(&d, field); v != 0 {
+			ev[field] = fieldEvidence{Value: v, Confidence: confidenceXBRL, Rule: "サマリーXBRL"}
+		}
+	}
+	return ev
+}
+
+// checkTanshinUnits は EDINET 由来の stocks の値 (ref) と項目ごとに比べ、
+// 比率がほぼ 1000 倍 / 1/1000 の項目だけ単位を補正して信頼度を下げる。
+// 既存値の無い項目は売上の補正に合わせる。補正後も 10 倍以上ずれる売上・資産は信頼度を上限まで落とす
+// (利益は前期比で大きく振れるので比率では判定しない)。
+// 返り値は売上に適用した倍率 (前年同期の値の補正用、補正なしは 1)
+func checkTanshinUnits(d *FinancialData, ev tanshinEvidence, ref FinancialData) float64 {
+	salesScale := 1.0
+	for _, field := range tanshinEvidenceFields {
+		p, refV := financialField(d, field), *financialField(&ref, field)
+		e, ok := ev[field]
+		if !ok || *p == 0 || refV == 0 {
+			continue
+		}
+		ratio := float64(*p) / float64(refV)
+		switch {
+		case ratio > 900 && ratio < 1100:
+			e.Value /= 1000
+			e.Confidence *= confidenceUnitFixed
+			e.Rule += fmt.Sprintf(" → 単位補正÷1000 (既存比%.0f)", ratio)
+		case ratio > 0.0009 && ratio < 0.0011:
+			e.Value *= 1000
+			e.Confidence *= confidenceUnitFixed
+			e.Rule += fmt.Sprintf(" → 単位補正×1000 (既存比%.4f)", ratio)
+		}
+		scale := float64(e.Value) / float64(*p)
+		if field == "NetSales" {
+			salesScale = scale
+		}
+
+		if field == "NetSales" || field == "TotalAssets" || field == "NetAssets" {
+			if r := float64(e.Value) / float64(refV); r > 10 || r < 0.1 {
+				e.Confidence = min(e.Confidence, confidenceMismatch)
+				e.Rule += fmt.Sprintf(" → 既存値と不一致 (既存%d, 比率%.2f)", refV, r)
+			}
+		}
+		ev.set(d, field, e)
+	}
+
+	// 既存値の無い項目は売上と同じ単位誤りとみなす
+	if salesScale != 1 {
+		for _, field := range tanshinEvidenceFields {
+			p := financialField(d, field)
+			e, ok := ev[field]
+			if !ok || *p == 0 || *financialField(&ref, field) != 0 {
+				continue
+			}
+			e.Value = int64(float64(e.Value) * salesScale)
+			e.Confidence *= confidenceUnitInferred
+			e.Rule += fmt.Sprintf(" → 売上に合わせて単位補正×%g", salesScale)
+			ev.set(d, field, e)
+		}
+	}
+	return salesScale
+}
+
+// applyReviewThreshold は信頼度が閾値未満の項目を d から外し、要確認として返す
+func applyReviewThreshold(d *FinancialData, ev tanshinEvidence) (review tanshinEvidence) {
+	review = tanshinEvidence{}
+	for _, field := range tanshinEvidenceFields {
+		e, ok := ev[field]
+		if !ok || e.Confidence >= tanshinReviewThreshold {
+			continue
+		}
+		review[field] = e
+		*financialField(d, field) = 0
+	}
+	return review
+}
+
+// saveTanshinEvidence は採用した項目の根拠を stock_financials.evidence (JSON) に、
+// 要確認の項目を tanshin_review_queue に保存する。
+// 要確認キューは stock_financials の行が無くても (全項目が低信頼度でも) 保存する
+func saveTanshinEvidence(db *sql.DB, code, submissionDate, source string, accepted, review tanshinEvidence) error {
+	for field, e := range review {
+		_, err := db.Exec(`
+			INSERT INTO tanshin_review_queue (code, submission_date, field, value, confidence, rule, span, source, status, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'pending', ?)
+			ON CONFLICT(code, submission_date, field) DO UPDATE SET
+				value = excluded.value,
+				confidence = excluded.confidence,
+				rule = excluded.rule,
+				span = excluded.span,
+				source = excluded.source,
+				status = 'pending'`,
+			code, submissionDate, field, e.Value, e.Confidence, e.Rule, e.Span, source, nowJST().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(accepted) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(accepted)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE stock_financials SET evidence = ? WHERE code = ? AND submission_date = ?`,
+		string(b), code, submissionDate)
+	return err
+}
+
+// printTanshinEvidence は debug-tanshin 用に項目ごとの値・信頼度・根拠を表示する
+func printTanshinEvidence(ev tanshinEvidence) {
+	for _, field := range tanshinEvidenceFields {
+		e, ok := ev[field]
+		if !ok {
+			fmt.Printf("  %-16s -\n", field)
+			continue
+		}
+		mark := "✅"
+		if e.Confidence < tanshinReviewThreshold {
+			mark = "⚠️ 要確認"
+		}
+		fmt.Printf("  %-16s %18d  信頼度 %.2f %s\n", field, e.Value, e.Confidence, mark)
+		fmt.Printf("  %-16s ルール: %s\n", "", e.Rule)
+		if e.Span != "" {
+			fmt.Printf("  %-16s 行: %s\n", "", strings.Join(strings.Fields(e.Span), " "))
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import "testing"
+
+func TestCheckTanshinUnits(t *testing.T) {
+	newEvidence := func(d FinancialData) tanshinEvidence {
+		ev := tanshinEvidence{}
+		for _, field := range tanshinEvidenceFields {
+			if v := *financialField(&d, field); v != 0 {
+				ev[field] = fieldEvidence{Value: v, Confidence: confidenceLabelMatch, Rule: "行頭ラベル"}
+			}
+		}
+		return ev
+	}
+
+	cases := []struct {
+		name      string
+		data, ref FinancialData
+		want      FinancialData
+		wantScale float64
+		wantConf  map[string]float64
+	}{
+		{
+			name:      "単位一致はそのまま",
+			data:      FinancialData{NetSales: 110_000, NetIncome: 5_000},
+			ref:       FinancialData{NetSales: 100_000, NetIncome: 4_000},
+			want:      FinancialData{NetSales: 110_000, NetIncome: 5_000},
+			wantScale: 1,
+			wantConf:  map[string]float64{"NetSales": confidenceLabelMatch, "NetIncome": confidenceLabelMatch},
+		},
+		{
+			// 千円を百万円と誤判定 → 項目ごとに ÷1000、既存値の無い総資産は売上に合わせる
+			name:      "千円の誤判定",
+			data:      FinancialData{NetSales: 100_000_000, OperatingIncome: 8_000_000, TotalAssets: 300_000_000},
+			ref:       FinancialData{NetSales: 100_000, OperatingIncome: 8_500},
+			want:      FinancialData{NetSales: 100_000, OperatingIncome: 8_000, TotalAssets: 300_000},
+			wantScale: 0.001,
+			wantConf: map[string]float64{
+				"NetSales":        confidenceLabelMatch * confidenceUnitFixed,
+				"OperatingIncome": confidenceLabelMatch * confidenceUnitFixed,
+				"TotalAssets":     confidenceLabelMatch * confidenceUnitInferred,
+			},
+		},
+		{
+			// 補正できない10倍超のずれは値を残して信頼度だけ落とす
+			name:      "既存値と不一致",
+			data:      FinancialData{NetSales: 5_000_000, NetAssets: 40_000},
+			ref:       FinancialData{NetSales: 100_000, NetAssets: 50_000},
+			want:      FinancialData{NetSales: 5_000_000, NetAssets: 40_000},
+			wantScale: 1,
+			wantConf:  map[string]float64{"NetSales": confidenceMismatch, "NetAssets": confidenceLabelMatch},
+		},
+	}
+	for _, c := range cases {
+		d := c.data
+		ev := newEvidence(d)
+		scale := checkTanshinUnits(&d, ev, c.ref)
+		if d != c.want {
+			t.Errorf("%s: data = %+v, want %+v", c.name, d, c.want)
+		}
+		if scale != c.wantScale {
+			t.Errorf("%s: scale = %g, want %g", c.name, scale, c.wantScale)
+		}
+		for field, want := range c.wantConf {
+			if got := ev[field].Confidence; got < want-1e-9 || got > want+1e-9 {
+				t.Errorf("%s: %s confidence = %g, want %g (%s)", c.name, field, got, want, ev[field].Rule)
+			}
+			if ev[field].Value != *financialField(&d, field) {
+				t.Errorf("%s: %s evidence value %d != data %d", c.name, field, ev[field].Value, *financialField(&d, field))
+			}
+		}
+	}
+}
+
+func TestApplyReviewThreshold(t *testing.T) {
+	d := FinancialData{NetSales: 100, OperatingIncome: 10, NetIncome: 5}
+	ev := tanshinEvidence{
+		"NetSales":        {Value: 100, Confidence: confidenceLabelMatch},
+		"OperatingIncome": {Value: 10, Confidence: confidenceMismatch},
+		"NetIncome":       {Value: 5, Confidence: confidenceFallback}, // 閾値ちょうどは採用
+		"NetAssets":       {Value: 999, Confidence: 0},                // 却下済み (d には無い)
+	}
+	review := applyReviewThreshold(&d, ev)
+
+	want := FinancialData{NetSales: 100, NetIncome: 5}
+	if d != want {
+		t.Errorf("data = %+v, want %+v", d, want)
+	}
+	if len(review) != 2 || review["OperatingIncome"].Value != 10 || review["NetAssets"].Value != 999 {
+		t.Errorf("review = %+v, want OperatingIncome and NetAssets", review)
+	}
+}
@@ -120,3 +120,77 @@ func TestParseTanshinText_NetIncomeValidationDropsHugePureProfit(t *testing.T) {
 		t.Errorf("crazy NetIncome should be reset to 0, got %d", d.NetIncome)
 	}
 }
+
+func TestDetectTanshinHeader(t *testing.T) {
+	cases := []struct {
+		text       string
+		fye, phase string
+	}{
+		{"2025年3月期　決算短信〔日本基準〕(連結)\n通期の業績予想", "2025-03", "FY"},
+		// 本文の「通期」に引きずられないこと
+		{"  ２０２６年３月期　第１四半期決算短信〔ＩＦＲＳ〕（連結）\n3．2026年3月期の連結業績予想 (通期)", "2026-03", "Q1"},
+		{"2025年12月期 中間期決算短信〔日本基準〕(非連結)", "2025-12", "Q2"},
+		{"2026年2月期 第3四半期決算短信", "2026-02", "Q3"},
+		{"決算説明会資料", "", ""},
+	}
+	for _, c := range cases {
+		fye, period := detectTanshinHeader(c.text)
+		if fye != c.fye || period != c.phase {
+			t.Errorf("detectTanshinHeader(%q) = (%q, %q), want (%q, %q)", c.text, fye, period, c.fye, c.phase)
+		}
+	}
+}
+
+func TestExtractPriorPeriodRow(t *testing.T) {
+	// 四半期: 表題行は読み飛ばし、当期の次の前年同期行を使う
+	text := `2026年3月期　第1四半期決算短信〔日本基準〕(連結)
+(1)連結経営成績(累計)                               (％表示は、対前年同四半期増減率)
+                     売上高            営業利益           経常利益        親会社株主に帰属する
+                                                                          四半期純利益
+                   百万円     ％     百万円     ％     百万円     ％     百万円     ％
+2026年3月期第1四半期  32,100   7.0     2,500   25.0     2,600  18.2     1,700   13.3
+2025年3月期第1四半期  30,000   3.1     2,000  △4.8     2,200   1.0     1,500  △2.0
+`
+	got := extractPriorPeriodRow(text)
+	want := FinancialData{NetSales: 30000, OperatingIncome: 2000, NetIncome: 1500}
+	if got == nil || *got != want {
+		t.Errorf("extractPriorPeriodRow = %+v, want %+v", got, want)
+	}
+
+	// 次の行が前年同期でなければ (財政状態の表など) 採用しない
+	text = `2025年3月期第1四半期  32,100   7.0     2,500   25.0     2,600  18.2     1,700   13.3
+2025年3月期            123,456   5.0    10,000    3.0    11,000   2.0     7,000    1.0
+`
+	if got := extractPriorPeriodRow(text); got != nil {
+		t.Errorf("extractPriorPeriodRow = %+v, want nil", got)
+	}
+}
+
+func TestParseTanshinTextEvidence(t *testing.T) {
+	text := `
+(百万円)
+売上収益              50,000   45,000
+営業利益              1,000    △500
+親会社株主に帰属する当期純利益   200,000   90,000
+`
+	d, ev := parseTanshinTextEvidence(text)
+
+	// 代替ラベルは第一候補より信頼度が低い
+	if e := ev["NetSales"]; e.Value != 50_000_000_000 || e.Confidence != confidenceLabelAlternate ||
+		e.Rule != "行頭ラベル:売上収益" || e.Span != "売上収益              50,000" {
+		t.Errorf("NetSales evidence = %+v", e)
+	}
+	if e := ev["OperatingIncome"]; e.Confidence != confidenceLabelMatch || e.Rule != "行頭ラベル:営業利益" {
+		t.Errorf("OperatingIncome evidence = %+v", e)
+	}
+	// 妥当性チェックで捨てた値は d からは消え、evidence に信頼度 0 で残る
+	if d.NetIncome != 0 {
+		t.Errorf("NetIncome = %d, want 0", d.NetIncome)
+	}
+	if e := ev["NetIncome"]; e.Value != 200_000_000_000 || e.Confidence != 0 {
+		t.Errorf("rejected NetIncome evidence = %+v, want value kept with confidence 0", e)
+	}
+	if _, ok := ev["TotalAssets"]; ok {
+		t.Errorf("TotalAssets evidence should be absent: %+v", ev["TotalAssets"])
+	}
+}
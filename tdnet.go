@@ -7,8 +7,11 @@ import (
 	"log"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/net/html"
 )
 
 // TdnetDisclosure は適時開示の1件分
@@ -17,18 +20,19 @@ type TdnetDisclosure struct {
 	DisclosureDateTime string // YYYY-MM-DD HH:MM
 	Name               string // 会社名
 	Title              string // 開示表題
-	DocCategory        string // 書類種別
+	DocCategory        string // 書類種別 (一覧には列が無いため保存時に classifyDisclosure で付与)
 	PdfURL             string // PDF URL
+	XbrlURL            string // XBRL ZIP URL (決算短信などXBRL添付がある開示のみ)
+	Exchange           string // 上場取引所 (東, 東名 など)
+	History            string // 更新履歴列の表示 (ファイルを差し替えた開示で非空。訂正とは限らない)
 }
 
 // fetchTdnet は指定日のTDNET開示情報をスクレイピングしてDBに保存する
 // 注意: TDNETは過去31日分のみ取得可能。それより古い日付は404になる
 func fetchTdnet(targetDate string) {
-	t, err := time.Parse("2006-01-02", targetDate)
-	if err != nil {
+	if _, err := time.Parse("2006-01-02", targetDate); err != nil {
 		log.Fatalf("Invalid date format: %v (expected YYYY-MM-DD)", err)
 	}
-	dateStr := t.Format("20060102") // TDNETのURL形式
 
 	fmt.Printf("📥 Fetching TDNET disclosures for %s...\n", targetDate)
 
@@ -38,156 +42,467 @@ func fetchTdnet(targetDate string) {
 	}
 	defer db.Close()
 
-	totalSaved := 0
-	totalSkipped := 0
-	page := 1
+	added, skipped, err := fetchTdnetDate(db, targetDate, true)
+	if err != nil {
+		log.Printf("⚠️ Failed to fetch first page: %v (もしかすると土日祝で開示なし、または31日より古い日付)", err)
+		return
+	}
 
-	for {
-		url := fmt.Sprintf("https://www.release.tdnet.info/inbs/I_list_%03d_%s.html", page, dateStr)
-		disclosures, hasMore, err := fetchTdnetPage(url, targetDate)
+	fmt.Printf("\n✅ TDNET 取得完了: 新規=%d件, 既存=%d件\n", len(added), skipped)
+}
+
+// fetchTdnetRange は from〜to の開示を1日ずつ取得する (TDNET は直近31日分のみ公開)。to が空なら今日まで。
+// 公開期間外の日付は取得を試みずにスキップする。
+func fetchTdnetRange(fromStr, toStr string) {
+	fromDate, err := time.Parse("2006-01-02", fromStr)
+	if err != nil {
+		log.Fatalf("Invalid -from date: %v", err)
+	}
+	if toStr == "" {
+		toStr = todayJST()
+	}
+	toDate, err := time.Parse("2006-01-02", toStr)
+	if err != nil {
+		log.Fatalf("Invalid -to date: %v", err)
+	}
+	if fromDate.After(toDate) {
+		log.Fatalf("-from date must be before -to date")
+	}
+
+	// 公開期間 (今日を含む直近 tdnetRetentionDays 日) に切り詰める
+	today, _ := time.Parse("2006-01-02", todayJST())
+	oldest := today.AddDate(0, 0, -tdnetRetentionDays)
+	if fromDate.Before(oldest) {
+		fmt.Printf("⚠️ TDNET は直近%d日分のみ公開のため、%s → %s に切り詰めます\n",
+			tdnetRetentionDays, fromStr, oldest.Format("2006-01-02"))
+		fromDate = oldest
+	}
+	if toDate.After(today) {
+		toDate = today
+	}
+	if fromDate.After(toDate) {
+		log.Fatalf("指定期間は TDNET の公開期間外です (%s 〜 %s)", oldest.Format("2006-01-02"), today.Format("2006-01-02"))
+	}
+
+	db, err := initXbrlDB()
+	if err != nil {
+		log.Fatalf("DB init failed: %v", err)
+	}
+	defer db.Close()
+
+	fmt.Printf("📥 TDNET 一括取得: %s 〜 %s\n\n", fromDate.Format("2006-01-02"), toDate.Format("2006-01-02"))
+
+	totalAdded, totalSkipped, failedDays := 0, 0, 0
+	for d := fromDate; !d.After(toDate); d = d.AddDate(0, 0, 1) {
+		dateStr := d.Format("2006-01-02")
+		// 土日・祝日・年末年始は開示なし (システム障害などで売買だけ止まった日は TDNET が動くので取得する)
+		if reason, closed := tradingCalendar.HolidayReason(d); closed {
+			fmt.Printf("⏭️ %s (%s) スキップ（%s）\n", dateStr, d.Weekday(), reason)
+			continue
+		}
+
+		added, skipped, err := fetchTdnetDate(db, dateStr, false)
 		if err != nil {
-			if page == 1 {
-				log.Printf("⚠️ Failed to fetch first page: %v (もしかすると土日祝で開示なし、または31日より古い日付)", err)
-				return
+			// 祝日は一覧ページ自体が存在しないので、失敗しても次の日へ進む
+			fmt.Printf("⚠️ %s 取得失敗: %v\n", dateStr, err)
+			failedDays++
+			continue
+		}
+		fmt.Printf("📅 %s: 新規=%d件, 既存=%d件\n", dateStr, len(added), skipped)
+		totalAdded += len(added)
+		totalSkipped += skipped
+		time.Sleep(1 * time.Second) // レート制限対策
+	}
+
+	fmt.Printf("\n✅ TDNET 一括取得完了: 新規=%d件, 既存=%d件, 取得失敗=%d日\n", totalAdded, totalSkipped, failedDays)
+}
+
+// tdnetRetentionDays は TDNET が一覧を公開している日数
+const tdnetRetentionDays = 31
+
+// fetchTdnetDate は指定日の一覧ページをページャーに沿って全て取得し、未保存の開示だけを保存する。
+// 戻り値は新規保存した開示と既存 (INSERT OR IGNORE で無視) 件数。
+// 1ページ目の取得に失敗した場合のみエラーを返す (2ページ目以降の失敗はそこで打ち切り)。
+func fetchTdnetDate(db *sql.DB, targetDate string, verbose bool) ([]TdnetDisclosure, int, error) {
+	t, err := time.Parse("2006-01-02", targetDate)
+	if err != nil {
+		return nil, 0, err
+	}
+	dateStr := t.Format("20060102") // TDNETのURL形式
+
+	var added []TdnetDisclosure
+	skipped := 0
+	pageNum := 1
+	url := fmt.Sprintf("%sI_list_001_%s.html", tdnetBaseURL, dateStr)
+	visited := make(map[string]bool)
+
+	for url != "" && !visited[url] {
+		visited[url] = true
+		page, err := fetchTdnetPage(url, targetDate)
+		if err != nil {
+			if pageNum == 1 {
+				return nil, 0, err
 			}
-			break // 後続ページの404は終端
+			log.Printf("⚠️ Page %d fetch failed: %v", pageNum, err)
+			break
 		}
 
-		if len(disclosures) == 0 {
+		if len(page.Disclosures) == 0 {
 			break
 		}
 
-		for _, d := range disclosures {
+		for _, d := range page.Disclosures {
 			saved, err := saveTdnetDisclosure(db, d)
 			if err != nil {
 				log.Printf("⚠️ Save failed for %s: %v", d.Code, err)
 				continue
 			}
 			if saved {
-				totalSaved++
+				added = append(added, d)
 			} else {
-				totalSkipped++
+				skipped++
 			}
 		}
 
-		fmt.Printf("  📄 Page %d: %d件取得\n", page, len(disclosures))
+		if verbose {
+			fmt.Printf("  📄 Page %d: %d件取得\n", pageNum, len(page.Disclosures))
+		}
 
-		if !hasMore {
-			break
+		// ページャーに次ページへのリンクが無ければ終端
+		url = page.nextPageURL(url)
+		pageNum++
+		if url != "" {
+			time.Sleep(1 * time.Second) // レート制限対策
 		}
-		page++
-		time.Sleep(1 * time.Second) // レート制限対策
 	}
 
-	fmt.Printf("\n✅ TDNET 取得完了: 新規=%d件, 既存=%d件\n", totalSaved, totalSkipped)
+	return added, skipped, nil
+}
+
+// tdnetBaseURL は TDNET 一覧ページ・PDF・XBRL の相対パス解決に使うベースURL
+const tdnetBaseURL = "https://www.release.tdnet.info/inbs/"
+
+// tdnetPage は一覧1ページ分のパース結果
+type tdnetPage struct {
+	Disclosures []TdnetDisclosure
+	PageLinks   []string // ページャーに並ぶ I_list_NNN_YYYYMMDD.html (相対パス)
 }
 
 // fetchTdnetPage は1ページ分のHTMLを取得して開示一覧をパースする
-func fetchTdnetPage(url, dateStr string) ([]TdnetDisclosure, bool, error) {
+func fetchTdnetPage(url, dateStr string) (tdnetPage, error) {
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Get(url)
 	if err != nil {
-		return nil, false, fmt.Errorf("HTTP error: %w", err)
+		return tdnetPage{}, fmt.Errorf("HTTP error: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, false, fmt.Errorf("HTTP status: %d", resp.StatusCode)
+		return tdnetPage{}, fmt.Errorf("HTTP status: %d", resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, false, err
-	}
+	return parseTdnetHTML(resp.Body, dateStr)
+}
+
+// tdnetCell は一覧テーブルの1セル
+type tdnetCell struct {
+	classes []string
+	text    strings.Builder
+	hrefs   []string
+}
+
+func (c *tdnetCell) Text() string {
+	// 改行や &nbsp; (U+00A0) の連続を半角スペース1つに畳む
+	// 全角スペースは表題の一部 (主キーに含まれる) なのでそのまま残す
+	fields := strings.FieldsFunc(c.text.String(), func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\u00a0'
+	})
+	return strings.TrimSpace(strings.Join(fields, " "))
+}
 
-	html := string(body)
-	disclosures := parseTdnetHTML(html, dateStr)
+func (c *tdnetCell) hasClass(name string) bool {
+	for _, cl := range c.classes {
+		if cl == name {
+			return true
+		}
+	}
+	return false
+}
 
-	// 「次へ」リンクの有無で次ページ判定（簡易）
-	hasMore := strings.Contains(html, "次へ") || strings.Contains(html, "next")
+// tdnetTable はトークナイズ中に組み立てる <table> 1つ分
+// ネストしたテーブルはスタックで管理し、セル内容は最内のテーブルにのみ入る
+type tdnetTable struct {
+	id   string
+	rows [][]*tdnetCell
+	cur  *tdnetCell // 現在テキストを受け付けているセル
+}
 
-	return disclosures, hasMore, nil
+// TDNET 一覧の列は class 属性 (kjTime, kjCode, ...) で識別する
+// 注: 更新履歴列は TDNET 側の綴りが "kjHistroy" なので両方受け付ける
+var tdnetColumnClasses = map[string]string{
+	"kjTime":    "time",
+	"kjCode":    "code",
+	"kjName":    "name",
+	"kjTitle":   "title",
+	"kjXbrl":    "xbrl",
+	"kjPlace":   "place",
+	"kjHistroy": "history",
+	"kjHistory": "history",
 }
 
-// parseTdnetHTML はTDNETのHTMLから開示行を抽出する
-// TDNET形式: <td>HH:MM</td><td>NNNNN</td><td>会社名</td><td><a>表題</a></td><td>種別</td><td>...PDFリンク...</td>
-func parseTdnetHTML(html, dateStr string) []TdnetDisclosure {
-	// 各 <tr>...</tr> ブロックを抽出
-	rowRegex := regexp.MustCompile(`(?s)<tr[^>]*>(.*?)</tr>`)
-	cellRegex := regexp.MustCompile(`(?s)<td[^>]*>(.*?)</td>`)
-	pdfRegex := regexp.MustCompile(`href="([^"]+\.pdf)"`)
-	timeRegex := regexp.MustCompile(`^\d{1,2}:\d{2}$`)
-	tagStripRegex := regexp.MustCompile(`<[^>]+>`)
+// class 属性が無い場合の列順 (TDNET 一覧の表示順)
+var tdnetDefaultColumns = []string{"time", "code", "name", "title", "xbrl", "place", "history"}
 
+var (
+	tdnetTimeRegex     = regexp.MustCompile(`^\d{1,2}:\d{2}$`)
+	tdnetPagerRegex    = regexp.MustCompile(`pagerLink\('([^']+)'\)`)
+	tdnetPageFileRegex = regexp.MustCompile(`I_list_(\d{3})_(\d{8})\.html`)
+)
+
+// parseTdnetHTML はTDNETの一覧HTMLをトークナイズし、開示テーブルとページャーを抽出する
+// 開示テーブルは id="main-list-table" を優先し、無ければ「時刻セルで始まる行」を最も多く持つテーブルを採用する
+func parseTdnetHTML(r io.Reader, dateStr string) (tdnetPage, error) {
+	var page tdnetPage
+	var stack []*tdnetTable
+	var tables []*tdnetTable
+	seenLinks := make(map[string]bool)
+
+	addPageLink := func(link string) {
+		if tdnetPageFileRegex.MatchString(link) && !seenLinks[link] {
+			seenLinks[link] = true
+			page.PageLinks = append(page.PageLinks, link)
+		}
+	}
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				break
+			}
+			return page, fmt.Errorf("html tokenize: %w", z.Err())
+		}
+
+		var top *tdnetTable
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := make(map[string]string)
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[string(k)] = string(v)
+			}
+			// ページャーは <div onclick="pagerLink('I_list_002_...')"> 形式
+			if m := tdnetPagerRegex.FindStringSubmatch(attrs["onclick"]); m != nil {
+				addPageLink(m[1])
+			}
+
+			switch string(name) {
+			case "table":
+				stack = append(stack, &tdnetTable{id: attrs["id"]})
+			case "tr":
+				if top != nil {
+					top.rows = append(top.rows, nil)
+					top.cur = nil
+				}
+			case "td", "th":
+				if top != nil {
+					if len(top.rows) == 0 {
+						top.rows = append(top.rows, nil) // <tr> 省略
+					}
+					c := &tdnetCell{classes: strings.Fields(attrs["class"])}
+					top.rows[len(top.rows)-1] = append(top.rows[len(top.rows)-1], c)
+					top.cur = c
+				}
+			case "a":
+				href := attrs["href"]
+				if top != nil && top.cur != nil && href != "" {
+					top.cur.hrefs = append(top.cur.hrefs, href)
+				}
+				addPageLink(href)
+			case "br":
+				if top != nil && top.cur != nil {
+					top.cur.text.WriteString(" ")
+				}
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "table":
+				if top != nil {
+					stack = stack[:len(stack)-1]
+					tables = append(tables, top)
+				}
+			case "td", "th":
+				if top != nil {
+					top.cur = nil
+				}
+			}
+
+		case html.TextToken:
+			if top != nil && top.cur != nil {
+				top.cur.text.Write(z.Text())
+			}
+		}
+	}
+	// 閉じ忘れのテーブルも対象に含める
+	tables = append(tables, stack...)
+
+	var best []TdnetDisclosure
+	for _, t := range tables {
+		rows := tdnetRowsFromTable(t, dateStr)
+		if t.id == "main-list-table" {
+			best = rows
+			break
+		}
+		if len(rows) > len(best) {
+			best = rows
+		}
+	}
+	page.Disclosures = best
+	return page, nil
+}
+
+// tdnetRowsFromTable はテーブルの各行を列名で引けるようにして開示行に変換する
+// 時刻列が HH:MM でない行 (ヘッダ・空行・レイアウト用) は読み飛ばす
+func tdnetRowsFromTable(t *tdnetTable, dateStr string) []TdnetDisclosure {
 	var results []TdnetDisclosure
-	rows := rowRegex.FindAllStringSubmatch(html, -1)
-	for _, row := range rows {
-		cells := cellRegex.FindAllStringSubmatch(row[1], -1)
-		if len(cells) < 5 {
+	for _, row := range t.rows {
+		if len(row) < 4 {
 			continue
 		}
 
-		// セル内容をテキスト化
-		extract := func(s string) string {
-			s = tagStripRegex.ReplaceAllString(s, "")
-			return strings.TrimSpace(strings.ReplaceAll(s, "&nbsp;", " "))
+		cols := make(map[string]*tdnetCell)
+		for _, c := range row {
+			for _, cl := range c.classes {
+				if col, ok := tdnetColumnClasses[cl]; ok {
+					cols[col] = c
+				}
+			}
+		}
+		if cols["time"] == nil || cols["code"] == nil || cols["title"] == nil {
+			// class が無いレイアウトは表示順で割り当てる
+			cols = make(map[string]*tdnetCell)
+			for i, c := range row {
+				if i < len(tdnetDefaultColumns) {
+					cols[tdnetDefaultColumns[i]] = c
+				}
+			}
+		}
+
+		cellText := func(col string) string {
+			if c := cols[col]; c != nil {
+				return c.Text()
+			}
+			return ""
 		}
 
-		timeStr := extract(cells[0][1])
-		if !timeRegex.MatchString(timeStr) {
+		timeStr := cellText("time")
+		if !tdnetTimeRegex.MatchString(timeStr) {
 			continue // 時刻でなければデータ行ではない
 		}
+		if len(timeStr) == 4 {
+			timeStr = "0" + timeStr // 9:15 → 09:15 (文字列ソートで時刻順になるように。以前の行は migrateTdnetTimes で揃える)
+		}
 
-		codeRaw := extract(cells[1][1])
 		// 5桁の場合は末尾0を落として4桁にする (JPX旧仕様)
-		code := codeRaw
+		code := cellText("code")
 		if len(code) == 5 {
 			code = code[:4]
 		}
 
-		name := extract(cells[2][1])
-		title := extract(cells[3][1])
-
-		var docCat string
-		if len(cells) >= 5 {
-			docCat = extract(cells[4][1])
+		d := TdnetDisclosure{
+			Code:               code,
+			DisclosureDateTime: dateStr + " " + timeStr,
+			Name:               cellText("name"),
+			Title:              cellText("title"),
+			Exchange:           cellText("place"),
+			History:            cellText("history"),
 		}
-
-		// PDF URL は cells[3] か cells[5] に含まれることが多い
-		var pdfURL string
-		for _, c := range cells {
-			m := pdfRegex.FindStringSubmatch(c[1])
-			if len(m) >= 2 {
-				pdfURL = m[1]
-				if !strings.HasPrefix(pdfURL, "http") {
-					pdfURL = "https://www.release.tdnet.info/inbs/" + pdfURL
+		if c := cols["title"]; c != nil {
+			d.PdfURL = tdnetFindLink(c.hrefs, ".pdf")
+		}
+		if c := cols["xbrl"]; c != nil {
+			d.XbrlURL = tdnetFindLink(c.hrefs, ".zip")
+		}
+		// PDF リンクが表題セル以外にある旧レイアウトへのフォールバック
+		if d.PdfURL == "" {
+			for _, c := range row {
+				if u := tdnetFindLink(c.hrefs, ".pdf"); u != "" {
+					d.PdfURL = u
+					break
 				}
-				break
 			}
 		}
-
-		results = append(results, TdnetDisclosure{
-			Code:               code,
-			DisclosureDateTime: dateStr + " " + timeStr,
-			Name:               name,
-			Title:              title,
-			DocCategory:        docCat,
-			PdfURL:             pdfURL,
-		})
+		results = append(results, d)
 	}
 	return results
 }
 
-// saveTdnetDisclosure は開示情報をDBに保存する。新規ならtrueを返す
+// tdnetFindLink は hrefs から指定拡張子の最初のリンクを絶対URLにして返す
+func tdnetFindLink(hrefs []string, ext string) string {
+	for _, h := range hrefs {
+		if strings.HasSuffix(strings.ToLower(h), ext) {
+			return tdnetAbsURL(h)
+		}
+	}
+	return ""
+}
+
+func tdnetAbsURL(href string) string {
+	if strings.HasPrefix(href, "http") {
+		return href
+	}
+	return tdnetBaseURL + strings.TrimPrefix(href, "./")
+}
+
+// nextPageURL はページャーのリンクから currentURL の次ページURLを返す (最終ページなら "")
+// 「次へ」の文言ではなく、同日付で現在のページ番号+1 のリンクが存在するかで判定する
+func (p tdnetPage) nextPageURL(currentURL string) string {
+	cur := tdnetPageFileRegex.FindStringSubmatch(currentURL)
+	if cur == nil {
+		return ""
+	}
+	curNum, _ := strconv.Atoi(cur[1])
+	for _, link := range p.PageLinks {
+		m := tdnetPageFileRegex.FindStringSubmatch(link)
+		if m == nil || m[2] != cur[2] {
+			continue
+		}
+		if n, _ := strconv.Atoi(m[1]); n == curNum+1 {
+			return tdnetAbsURL(link)
+		}
+	}
+	return ""
+}
+
+// saveTdnetDisclosure は開示情報を分類してDBに保存する。新規ならtrueを返す
 func saveTdnetDisclosure(db *sql.DB, d TdnetDisclosure) (bool, error) {
+	c := classifyDisclosure(d.Title)
 	res, err := db.Exec(`
 		INSERT OR IGNORE INTO tdnet_disclosures (
-			code, disclosure_datetime, name, title, doc_category, pdf_url
-		) VALUES (?, ?, ?, ?, ?, ?)`,
-		d.Code, d.DisclosureDateTime, d.Name, d.Title, d.DocCategory, d.PdfURL)
+			code, disclosure_datetime, name, title, doc_category, pdf_url, xbrl_url,
+			history, fiscal_year_end, fiscal_period, is_correction
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.Code, d.DisclosureDateTime, d.Name, d.Title, c.Category, d.PdfURL, d.XbrlURL,
+		d.History, c.FiscalYearEnd, c.FiscalPeriod, c.IsCorrection)
 	if err != nil {
 		return false, err
 	}
 	rows, _ := res.RowsAffected()
+	if rows == 0 && d.XbrlURL != "" {
+		// xbrl_url カラム追加前に保存した行へ XBRL リンクを補完 (新規件数には数えない)
+		db.Exec(`
+			UPDATE tdnet_disclosures SET xbrl_url = ?
+			WHERE code = ? AND disclosure_datetime = ? AND title = ? AND COALESCE(xbrl_url, '') = ''`,
+			d.XbrlURL, d.Code, d.DisclosureDateTime, d.Title)
+	}
 	return rows > 0, nil
 }
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// 適時開示のカテゴリ (tdnet_disclosures.doc_category に保存する)
+// 表題のキーワードで判定する。複数に該当する場合は disclosureRules の先頭を優先
+const (
+	CategoryEarnings         = "earnings"          // 決算短信
+	CategoryForecastUp       = "forecast_up"       // 業績予想の上方修正
+	CategoryForecastDown     = "forecast_down"     // 業績予想の下方修正
+	CategoryForecastRevision = "forecast_revision" // 業績予想の修正 (表題から方向が読めないもの)
+	CategoryDividend         = "dividend"          // 配当予想の修正・剰余金の配当
+	CategoryBuyback          = "buyback"           // 自己株式の取得 (決定・取得状況)
+	CategoryStockSplit       = "stock_split"       // 株式分割・株式併合
+	CategoryMnA              = "mna"               // M&A・TOB・組織再編
+	CategoryNewShares        = "new_shares"        // 新株発行・新株予約権・第三者割当
+	CategoryOther            = "other"
+)
+
+// disclosureCategoryLabels は API / アラート表示用の日本語ラベル
+var disclosureCategoryLabels = map[string]string{
+	CategoryEarnings:         "決算短信",
+	CategoryForecastUp:       "業績予想 上方修正",
+	CategoryForecastDown:     "業績予想 下方修正",
+	CategoryForecastRevision: "業績予想 修正",
+	CategoryDividend:         "配当",
+	CategoryBuyback:          "自社株買い",
+	CategoryStockSplit:       "株式分割・併合",
+	CategoryMnA:              "M&A・TOB",
+	CategoryNewShares:        "新株・新株予約権",
+	CategoryOther:            "その他",
+}
+
+// forecastCategories は業績予想修正系のカテゴリ (アラート・予想取込の対象)
+var forecastCategories = []string{CategoryForecastUp, CategoryForecastDown, CategoryForecastRevision}
+
+type disclosureRule struct {
+	category string
+	keywords []string // いずれかを含めば該当
+}
+
+// 判定順が重要: 「業績予想及び配当予想の修正」は業績予想側、「配当予想の上方修正」は配当側 (配当を汎用の上方・下方修正より先に見る)、
+// 「第三者割当による自己株式の処分」は新株側 (自己株式取得ではない) に倒す
+var disclosureRules = []disclosureRule{
+	{CategoryEarnings, []string{"決算短信"}},
+	{CategoryForecastRevision, []string{"業績予想の修正", "業績予想値の修正", "業績予想及び配当予想の修正", "業績予想並びに配当予想の修正", "業績見通しの修正"}},
+	{CategoryDividend, []string{"配当予想の修正", "配当予想の上方修正", "配当予想の下方修正", "剰余金の配当", "増配", "減配", "復配", "無配", "記念配当", "特別配当", "期末配当", "中間配当"}},
+	{CategoryForecastUp, []string{"上方修正"}},
+	{CategoryForecastDown, []string{"下方修正"}},
+	{CategoryNewShares, []string{"新株予約権", "第三者割当", "募集株式", "新株式発行", "新株発行", "ストック・オプション", "ストックオプション", "株式報酬"}},
+	{CategoryBuyback, []string{"自己株式の取得", "自己株式取得", "自己株式の買付", "自己株式立会外買付"}},
+	{CategoryStockSplit, []string{"株式分割", "株式の分割", "株式併合", "株式の併合"}},
+	{CategoryMnA, []string{"公開買付", "ＴＯＢ", "TOB", "株式交換", "株式移転", "合併", "吸収分割", "会社分割", "事業譲渡", "事業譲受", "子会社化", "子会社の異動", "株式の取得", "資本業務提携"}},
+}
+
+// forecastDirectionRules は「業績予想の修正」の方向を補足判定するキーワード
+// 例: 「業績予想の修正（増益）」「業績予想の修正（上方修正）」「通期業績予想の修正及び増配」
+var (
+	forecastUpHints   = []string{"上方修正", "増額", "増益", "上振れ"}
+	forecastDownHints = []string{"下方修正", "減額", "減益", "下振れ", "損失計上"}
+)
+
+var (
+	fiscalYearEndRegex = regexp.MustCompile(`(\d{4})年\s*(\d{1,2})月期`)
+	fullWidthDigits    = strings.NewReplacer("０", "0", "１", "1", "２", "2", "３", "3", "４", "4", "５", "5", "６", "6", "７", "7", "８", "8", "９", "9")
+)
+
+// disclosureClass は表題から判定した分類結果
+type disclosureClass struct {
+	Category      string
+	FiscalYearEnd string // YYYY-MM (例: 2025年3月期 → 2025-03)。不明なら空
+	FiscalPeriod  string // Q1 / Q2 / Q3 / FY。決算短信・業績予想以外や不明なら空
+	IsCorrection  bool   // 訂正・差替の開示
+}
+
+// classifyDisclosure は開示表題からカテゴリ・決算期・訂正フラグを判定する。
+// 更新履歴列はファイルを差し替えただけの原本にも付くので、訂正の判定には使わない
+func classifyDisclosure(title string) disclosureClass {
+	t := fullWidthDigits.Replace(title)
+	c := disclosureClass{Category: CategoryOther}
+
+	for _, rule := range disclosureRules {
+		if containsAny(t, rule.keywords) {
+			c.Category = rule.category
+			break
+		}
+	}
+	if c.Category == CategoryForecastRevision {
+		switch {
+		case containsAny(t, forecastUpHints):
+			c.Category = CategoryForecastUp
+		case containsAny(t, forecastDownHints):
+			c.Category = CategoryForecastDown
+		}
+	}
+
+	c.IsCorrection = strings.Contains(t, "訂正") || strings.Contains(t, "差替")
+
+	c.FiscalYearEnd = detectFiscalYearEnd(t)
+	if c.Category == CategoryEarnings || isForecastCategory(c.Category) {
+		c.FiscalPeriod = detectFiscalPeriod(t)
+	}
+	return c
+}
+
+// detectFiscalYearEnd は「2025年3月期」形式の最初の表記を YYYY-MM で返す (見つからなければ空)
+func detectFiscalYearEnd(text string) string {
+	m := fiscalYearEndRegex.FindStringSubmatch(fullWidthDigits.Replace(text))
+	if m == nil {
+		return ""
+	}
+	month := m[2]
+	if len(month) == 1 {
+		month = "0" + month
+	}
+	return m[1] + "-" + month
+}
+
+// detectFiscalPeriod は表題・本文の「第N四半期」「中間」から対象期間を判定する (該当なしは通期)
+// 「第2四半期累計及び通期業績予想の修正」のように通期を含むものは通期扱い
+func detectFiscalPeriod(text string) string {
+	text = fullWidthDigits.Replace(text)
+	switch {
+	case strings.Contains(text, "通期"):
+		return "FY"
+	case strings.Contains(text, "第1四半期"):
+		return "Q1"
+	case strings.Contains(text, "第2四半期"), strings.Contains(text, "中間"):
+		return "Q2"
+	case strings.Contains(text, "第3四半期"):
+		return "Q3"
+	}
+	return "FY"
+}
+
+func isForecastCategory(category string) bool {
+	for _, c := range forecastCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(s string, keywords []string) bool {
+	for _, k := range keywords {
+		if strings.Contains(s, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyTdnetDisclosures は保存済みの開示を分類する
+// datePrefix が空なら全件、"YYYY-MM-DD" ならその日の開示のみ。reclassify が false ならカテゴリ未設定の行だけ
+// (取得時に分類済みの行は触らない)、true なら分類済みの行も判定し直す (判定ルールを変えたとき)。更新件数を返す
+func classifyTdnetDisclosures(db *sql.DB, datePrefix string, reclassify bool) (int, error) {
+	query := `
+		SELECT code, disclosure_datetime, COALESCE(title, '')
+		FROM tdnet_disclosures
+		WHERE disclosure_datetime LIKE ? || '%'`
+	args := []interface{}{datePrefix}
+	if !reclassify {
+		query += ` AND COALESCE(doc_category, '') NOT IN (` + strings.Repeat("?, ", len(disclosureCategoryLabels)-1) + `?)`
+		for cat := range disclosureCategoryLabels {
+			args = append(args, cat)
+		}
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	type target struct {
+		code, dt, title string
+		class           disclosureClass
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if err := rows.Scan(&t.code, &t.dt, &t.title); err != nil {
+			continue
+		}
+		t.class = classifyDisclosure(t.title)
+		targets = append(targets, t)
+	}
+	rows.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(`
+		UPDATE tdnet_disclosures
+		SET doc_category = ?, fiscal_year_end = ?, fiscal_period = ?, is_correction = ?
+		WHERE code = ? AND disclosure_datetime = ? AND title = ?`)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+
+	updated := 0
+	for _, t := range targets {
+		if _, err := stmt.Exec(t.class.Category, t.class.FiscalYearEnd, t.class.FiscalPeriod, t.class.IsCorrection,
+			t.code, t.dt, t.title); err != nil {
+			log.Printf("⚠️ classify %s %s: %v", t.code, t.dt, err)
+			continue
+		}
+		updated++
+	}
+	return updated, tx.Commit()
+}
+
+// runClassifyTdnet は -mode=classify-tdnet の本体。既存の開示を全件再分類してカテゴリ別件数を表示する
+func runClassifyTdnet() {
+	db, err := initXbrlDB()
+	if err != nil {
+		log.Fatalf("DB init failed: %v", err)
+	}
+	defer db.Close()
+
+	n, err := classifyTdnetDisclosures(db, "", true)
+	if err != nil {
+		log.Fatalf("classify failed: %v", err)
+	}
+	fmt.Printf("✅ %d件の開示を分類しました\n", n)
+
+	rows, err := db.Query(`SELECT doc_category, COUNT(*) FROM tdnet_disclosures GROUP BY doc_category ORDER BY COUNT(*) DESC`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	fmt.Println("📊 カテゴリ別件数:")
+	for rows.Next() {
+		var cat string
+		var cnt int
+		if rows.Scan(&cat, &cnt) == nil {
+			fmt.Printf("  %s (%s): %d件\n", disclosureCategoryLabels[cat], cat, cnt)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassifyDisclosure(t *testing.T) {
+	cases := []struct {
+		title string
+		want  disclosureClass
+	}{
+		{"2025年3月期　決算短信〔IFRS〕（連結）",
+			disclosureClass{Category: CategoryEarnings, FiscalYearEnd: "2025-03", FiscalPeriod: "FY"}},
+		{"2025年12月期　第1四半期決算短信〔日本基準〕（非連結）",
+			disclosureClass{Category: CategoryEarnings, FiscalYearEnd: "2025-12", FiscalPeriod: "Q1"}},
+		{"２０２６年３月期　中間決算短信〔日本基準〕（連結）",
+			disclosureClass{Category: CategoryEarnings, FiscalYearEnd: "2026-03", FiscalPeriod: "Q2"}},
+		{"2025年9月期 第3四半期決算短信",
+			disclosureClass{Category: CategoryEarnings, FiscalYearEnd: "2025-09", FiscalPeriod: "Q3"}},
+		{"（訂正）「2025年3月期　決算短信〔IFRS〕（連結）」の一部訂正について",
+			disclosureClass{Category: CategoryEarnings, FiscalYearEnd: "2025-03", FiscalPeriod: "FY", IsCorrection: true}},
+		{"通期業績予想の上方修正に関するお知らせ",
+			disclosureClass{Category: CategoryForecastUp, FiscalPeriod: "FY"}},
+		{"2025年3月期 第2四半期累計期間業績予想の下方修正に関するお知らせ",
+			disclosureClass{Category: CategoryForecastDown, FiscalYearEnd: "2025-03", FiscalPeriod: "Q2"}},
+		{"業績予想の修正に関するお知らせ",
+			disclosureClass{Category: CategoryForecastRevision, FiscalPeriod: "FY"}},
+		{"業績予想の修正（増益）に関するお知らせ",
+			disclosureClass{Category: CategoryForecastUp, FiscalPeriod: "FY"}},
+		{"業績予想及び配当予想の修正に関するお知らせ",
+			disclosureClass{Category: CategoryForecastRevision, FiscalPeriod: "FY"}},
+		{"業績予想の修正（上方修正）に関するお知らせ",
+			disclosureClass{Category: CategoryForecastUp, FiscalPeriod: "FY"}},
+		{"業績予想及び配当予想の修正（下方修正）に関するお知らせ",
+			disclosureClass{Category: CategoryForecastDown, FiscalPeriod: "FY"}},
+		{"配当予想の修正（増配）に関するお知らせ",
+			disclosureClass{Category: CategoryDividend}},
+		{"配当予想の上方修正に関するお知らせ",
+			disclosureClass{Category: CategoryDividend}},
+		{"期末配当予想の下方修正に関するお知らせ",
+			disclosureClass{Category: CategoryDividend}},
+		{"剰余金の配当に関するお知らせ",
+			disclosureClass{Category: CategoryDividend}},
+		{"自己株式取得に係る事項の決定に関するお知らせ",
+			disclosureClass{Category: CategoryBuyback}},
+		{"自己株式の取得状況に関するお知らせ",
+			disclosureClass{Category: CategoryBuyback}},
+		{"（差替）自己株式の取得状況に関するお知らせ",
+			disclosureClass{Category: CategoryBuyback, IsCorrection: true}},
+		{"第三者割当による自己株式の処分に関するお知らせ",
+			disclosureClass{Category: CategoryNewShares}},
+		{"株式分割及び株式分割に伴う定款の一部変更に関するお知らせ",
+			disclosureClass{Category: CategoryStockSplit}},
+		{"株式会社〇〇株式に対する公開買付けの開始に関するお知らせ",
+			disclosureClass{Category: CategoryMnA}},
+		{"第5回新株予約権（有償ストック・オプション）の発行に関するお知らせ",
+			disclosureClass{Category: CategoryNewShares}},
+		{"代表取締役の異動に関するお知らせ",
+			disclosureClass{Category: CategoryOther}},
+	}
+	for _, c := range cases {
+		got := classifyDisclosure(c.title)
+		if got != c.want {
+			t.Errorf("classifyDisclosure(%q) = %+v, want %+v", c.title, got, c.want)
+		}
+	}
+}
+
+func TestClassifyTdnetDisclosures(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "xbrl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE tdnet_disclosures (
+		code TEXT, disclosure_datetime TEXT, title TEXT, doc_category TEXT, history TEXT,
+		fiscal_year_end TEXT, fiscal_period TEXT, is_correction INTEGER,
+		PRIMARY KEY (code, disclosure_datetime, title))`); err != nil {
+		t.Fatal(err)
+	}
+	// 分類済み (手で直したカテゴリも含む) と、旧バージョンで取得した未分類の行
+	// (旧パーサーは XBRL 列の "XBRL" を doc_category に入れていた)。8306 はファイルを差し替えただけの原本 (更新履歴あり)
+	db.Exec(`INSERT INTO tdnet_disclosures (code, disclosure_datetime, title, doc_category, history) VALUES
+		('7203', '2025-05-08 15:00', '配当予想の上方修正に関するお知らせ', 'other', ''),
+		('6758', '2025-05-08 15:30', '業績予想の上方修正に関するお知らせ', NULL, ''),
+		('9984', '2025-05-08 16:00', '自己株式の取得状況に関するお知らせ', '', ''),
+		('8306', '2025-05-08 16:30', '2025年3月期 決算短信〔日本基準〕(連結)', 'XBRL', '更新履歴'),
+		('9432', '2025-05-09 15:00', '剰余金の配当に関するお知らせ', NULL, '')`)
+
+	category := func(code string) string {
+		var c sql.NullString
+		db.QueryRow(`SELECT doc_category FROM tdnet_disclosures WHERE code = ?`, code).Scan(&c)
+		return c.String
+	}
+	n, err := classifyTdnetDisclosures(db, "2025-05-08", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || category("7203") != CategoryOther || category("6758") != CategoryForecastUp ||
+		category("9984") != CategoryBuyback || category("8306") != CategoryEarnings || category("9432") != "" {
+		t.Errorf("未分類だけ: %d件, 7203=%s 6758=%s 9984=%s 8306=%s 9432=%s", n,
+			category("7203"), category("6758"), category("9984"), category("8306"), category("9432"))
+	}
+	var correction bool
+	db.QueryRow(`SELECT is_correction FROM tdnet_disclosures WHERE code = '8306'`).Scan(&correction)
+	if correction {
+		t.Error("更新履歴があるだけの原本を訂正扱いにした")
+	}
+
+	if n, err = classifyTdnetDisclosures(db, "", true); err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || category("7203") != CategoryDividend || category("9432") != CategoryDividend {
+		t.Errorf("全件の再分類: %d件, 7203=%s 9432=%s", n, category("7203"), category("9432"))
+	}
+}
+
+func TestMigrateTdnetCorrections(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "xbrl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE tdnet_disclosures (code TEXT, title TEXT, history TEXT, is_correction INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec(`INSERT INTO tdnet_disclosures VALUES
+		('7203', '2025年3月期 決算短信〔IFRS〕(連結)', '更新履歴', 1),  -- 差し替えただけの原本
+		('7203', '（訂正）「2025年3月期 決算短信〔IFRS〕(連結)」の一部訂正について', '', 1)`)
+	db.Exec(`PRAGMA user_version = 1`)
+
+	if err := migrateTdnetCorrections(db); err != nil {
+		t.Fatal(err)
+	}
+	var corrections int
+	db.QueryRow(`SELECT COUNT(*) FROM tdnet_disclosures WHERE is_correction = 1`).Scan(&corrections)
+	var version int
+	db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	if corrections != 1 || version != xbrlSchemaTdnetCorrections {
+		t.Errorf("訂正 %d件 (want 1), user_version = %d", corrections, version)
+	}
+}
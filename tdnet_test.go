@@ -0,0 +1,182 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// go test -run TestParseTdnetHTML_Golden -update で golden ファイルを再生成する
+var updateGolden = flag.Bool("update", false, "testdata の golden ファイルを更新する")
+
+func parseTdnetFixture(t *testing.T, name, date string) tdnetPage {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "tdnet", name))
+	if err != nil {
+		t.Fatalf("open fixture: %v", err)
+	}
+	defer f.Close()
+	page, err := parseTdnetHTML(f, date)
+	if err != nil {
+		t.Fatalf("parseTdnetHTML(%s): %v", name, err)
+	}
+	return page
+}
+
+func TestParseTdnetHTML_Golden(t *testing.T) {
+	fixtures := []string{
+		"I_list_001_20250515.html",
+		"I_list_003_20250515.html",
+		"legacy_layout.html",
+	}
+	for _, name := range fixtures {
+		t.Run(name, func(t *testing.T) {
+			page := parseTdnetFixture(t, name, "2025-05-15")
+			got, err := json.MarshalIndent(page.Disclosures, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", "tdnet", strings.TrimSuffix(name, ".html")+".golden.json")
+			if *updateGolden {
+				if err := os.WriteFile(golden, append(got, '\n'), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("read golden (go test -update で生成): %v", err)
+			}
+			if strings.TrimSpace(string(got)) != strings.TrimSpace(string(want)) {
+				t.Errorf("parse result mismatch for %s\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+			}
+		})
+	}
+}
+
+func TestParseTdnetHTML_Columns(t *testing.T) {
+	page := parseTdnetFixture(t, "I_list_001_20250515.html", "2025-05-15")
+	if len(page.Disclosures) != 4 {
+		t.Fatalf("got %d disclosures, want 4 (ヘッダ行・ページャーを除く)", len(page.Disclosures))
+	}
+
+	toyota := page.Disclosures[0]
+	if toyota.Code != "7203" || toyota.DisclosureDateTime != "2025-05-15 15:30" {
+		t.Errorf("first row = %+v", toyota)
+	}
+	if toyota.PdfURL != "https://www.release.tdnet.info/inbs/140120250508512345.pdf" {
+		t.Errorf("PdfURL = %q", toyota.PdfURL)
+	}
+	if toyota.XbrlURL != "https://www.release.tdnet.info/inbs/081220250508512345.zip" {
+		t.Errorf("XbrlURL = %q", toyota.XbrlURL)
+	}
+	if toyota.Name != "トヨタ自動車" || toyota.Exchange != "東名" || toyota.History != "" {
+		t.Errorf("name/exchange/history = %q/%q/%q", toyota.Name, toyota.Exchange, toyota.History)
+	}
+
+	// 英字入りの新コード形式 (130A0 → 130A)
+	if got := page.Disclosures[1].Code; got != "130A" {
+		t.Errorf("alphanumeric code = %q, want 130A", got)
+	}
+
+	// 更新履歴マーカー
+	corrected := page.Disclosures[2]
+	if corrected.History != "更新履歴" {
+		t.Errorf("History = %q, want 更新履歴", corrected.History)
+	}
+	if corrected.XbrlURL != "" {
+		t.Errorf("XbrlURL should be empty for non-XBRL disclosure, got %q", corrected.XbrlURL)
+	}
+
+	// <br> で折り返された表題は1行に畳む
+	if got := page.Disclosures[3].Title; got != "自己株式取得に係る事項の決定に関する お知らせ" {
+		t.Errorf("Title = %q", got)
+	}
+}
+
+func TestTdnetPage_NextPageURL(t *testing.T) {
+	first := parseTdnetFixture(t, "I_list_001_20250515.html", "2025-05-15")
+	next := first.nextPageURL("https://www.release.tdnet.info/inbs/I_list_001_20250515.html")
+	if next != "https://www.release.tdnet.info/inbs/I_list_002_20250515.html" {
+		t.Errorf("next page = %q", next)
+	}
+
+	// 最終ページ: フッターに「次へ」の文字があってもページャーに後続が無ければ終端
+	last := parseTdnetFixture(t, "I_list_003_20250515.html", "2025-05-15")
+	if next := last.nextPageURL("https://www.release.tdnet.info/inbs/I_list_003_20250515.html"); next != "" {
+		t.Errorf("last page should have no next, got %q", next)
+	}
+
+	// ページャー自体が無いレイアウト
+	legacy := parseTdnetFixture(t, "legacy_layout.html", "2025-05-15")
+	if next := legacy.nextPageURL("https://www.release.tdnet.info/inbs/I_list_001_20250515.html"); next != "" {
+		t.Errorf("page without pager should have no next, got %q", next)
+	}
+}
+
+func TestMigrateTdnetTimes(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "xbrl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, c := range tdnetTimeColumns {
+		if _, err := db.Exec(`CREATE TABLE ` + c.table + ` (code TEXT, ` + c.column + ` TEXT, title TEXT,
+			PRIMARY KEY (code, ` + c.column + `, title))`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Exec(`INSERT INTO tdnet_disclosures VALUES
+		('7203', '2025-05-08 9:15', '決算短信'),   -- 以前の形式
+		('7203', '2025-05-08 9:15', '配当予想'),   -- 以前の形式 (再取得で 09:15 も入っている)
+		('7203', '2025-05-08 09:15', '配当予想'),
+		('6758', '2025-05-08 15:00', '決算短信')`)
+	db.Exec(`INSERT INTO stock_financials VALUES ('7203', '2025-05-08', 'EDINET')`)
+
+	if err := migrateTdnetTimes(db); err != nil {
+		t.Fatal(err)
+	}
+	// 2回目以降は user_version を見て何もしない
+	db.Exec(`INSERT INTO buybacks VALUES ('9984', '2025-05-13 9:30', '自己株式の取得')`)
+	if err := migrateTdnetTimes(db); err != nil {
+		t.Fatal(err)
+	}
+	var version int
+	db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	if version != xbrlSchemaTdnetTimes {
+		t.Errorf("user_version = %d, want %d", version, xbrlSchemaTdnetTimes)
+	}
+	var announced string
+	db.QueryRow(`SELECT announced_at FROM buybacks`).Scan(&announced)
+	if announced != "2025-05-13 9:30" {
+		t.Errorf("移行済みの DB で再度移行した: %s", announced)
+	}
+
+	var got []string
+	rows, err := db.Query(`SELECT code || ' ' || disclosure_datetime || ' ' || title FROM tdnet_disclosures ORDER BY 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var s string
+		rows.Scan(&s)
+		got = append(got, s)
+	}
+	rows.Close()
+	want := []string{
+		"6758 2025-05-08 15:00 決算短信",
+		"7203 2025-05-08 09:15 決算短信",
+		"7203 2025-05-08 09:15 配当予想",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("tdnet_disclosures =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	var date string
+	db.QueryRow(`SELECT submission_date FROM stock_financials`).Scan(&date)
+	if date != "2025-05-08" {
+		t.Errorf("日付だけの提出日が変わった: %s", date)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// watch-tdnet のポーリング時間帯 (JST, 分単位)。
+// 場中に加え、決算短信が集中する引け後 (15:00〜17:00 台) までをカバーする
+const (
+	tdnetWatchStartMin = 8 * 60     // 08:00
+	tdnetWatchEndMin   = 18*60 + 30 // 18:30
+)
+
+// isTdnetWatchHours は t (JST) がポーリング対象の時間帯か判定する。
+// 取引所だけの休場日 (システム障害による売買停止など) も TDNET は動くので監視する
+func isTdnetWatchHours(t time.Time) bool {
+	t = t.In(jst)
+	if _, holiday := tradingCalendar.HolidayReason(t); holiday {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	return m >= tdnetWatchStartMin && m < tdnetWatchEndMin
+}
+
+// nextTdnetPoll は次にポーリングする時刻を返す。
+// 時間帯内なら interval 後、時間帯外なら次の平日の開始時刻。
+func nextTdnetPoll(now time.Time, interval time.Duration) time.Time {
+	now = now.In(jst)
+	if next := now.Add(interval); isTdnetWatchHours(now) && isTdnetWatchHours(next) {
+		return next
+	}
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, jst)
+	start := day.Add(tdnetWatchStartMin * time.Minute)
+	if !now.Before(start) {
+		start = start.AddDate(0, 0, 1)
+	}
+	for !isTdnetWatchHours(start) {
+		start = start.AddDate(0, 0, 1)
+	}
+	return start
+}
+
+// watchTdnet は当日の TDNET 一覧を interval ごとに取得し、新規の開示だけを保存する。
+// 新規があれば API キャッシュを破棄し、業績修正・配当修正・自社株買いの決定は即時に通知する。
+// キャッシュはプロセス内のものなので、破棄が効くのは serve -watch-tdnet のときだけ。
+// 単独の -mode=watch-tdnet では別プロセスの serve のキャッシュは残り、TTL (60秒) で切れるまで古い一覧を返す。
+// serve モードでは goroutine として起動されるため、DB を開けないときはエラーを返すだけでサーバーは止めない。
+// 起動後は終了しない。
+func watchTdnet(interval time.Duration) error {
+	if interval < time.Minute {
+		log.Printf("⚠️ -interval %s は短すぎるため 1m に切り上げます", interval)
+		interval = time.Minute
+	}
+
+	db, err := initXbrlDB()
+	if err != nil {
+		return fmt.Errorf("DB init failed: %w", err)
+	}
+	defer db.Close()
+
+	log.Printf("👀 TDNET 監視開始 (間隔 %s, %02d:%02d〜%02d:%02d JST 平日)", interval,
+		tdnetWatchStartMin/60, tdnetWatchStartMin%60, tdnetWatchEndMin/60, tdnetWatchEndMin%60)
+
+	for {
+		now := nowJST()
+		if isTdnetWatchHours(now) {
+			today := now.Format("2006-01-02")
+			added, _, err := fetchTdnetDate(db, today, false)
+			if err != nil {
+				// 開示0件の朝は一覧ページが未生成のことがある
+				log.Printf("⚠️ TDNET poll failed: %v", err)
+			} else if len(added) > 0 {
+				cacheClear()
+				log.Printf("📥 TDNET 新規 %d件 (%s)", len(added), now.Format("15:04"))
+				for _, d := range added {
+					c := classifyDisclosure(d.Title)
+					notify := slices.Contains(revisionAlertCategories, c.Category) ||
+						(c.Category == CategoryBuyback && isBuybackAuthorization(d.Title))
+					if c.IsCorrection || !notify {
+						continue
+					}
+					fmt.Printf("🔔 %s %s %s [%s] %s %s\n",
+						d.DisclosureDateTime, d.Code, d.Name,
+						disclosureCategoryLabels[c.Category], d.Title, d.PdfURL)
+				}
+			}
+		}
+
+		next := nextTdnetPoll(nowJST(), interval)
+		if !isTdnetWatchHours(now) {
+			log.Printf("💤 時間帯外のため %s まで待機", next.Format("2006-01-02 15:04"))
+		}
+		time.Sleep(time.Until(next))
+	}
+}
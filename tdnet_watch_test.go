@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextTdnetPoll(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, jst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	cases := []struct {
+		now, want string
+	}{
+		{"2025-05-15 15:00", "2025-05-15 15:05"}, // 木曜の場中
+		{"2025-05-15 07:10", "2025-05-15 08:00"}, // 開始前
+		{"2025-05-15 18:28", "2025-05-16 08:00"}, // 終了間際は翌営業日へ
+		{"2025-05-16 19:00", "2025-05-19 08:00"}, // 金曜夜 → 月曜
+		{"2025-05-17 12:00", "2025-05-19 08:00"}, // 土曜
+		{"2020-09-30 19:00", "2020-10-01 08:00"}, // 売買停止の日も TDNET は動く
+		{"2025-05-05 12:00", "2025-05-07 08:00"}, // 祝日・振替休日
+	}
+	for _, c := range cases {
+		got := nextTdnetPoll(at(c.now), 5*time.Minute)
+		if !got.Equal(at(c.want)) {
+			t.Errorf("nextTdnetPoll(%s) = %s, want %s", c.now, got.Format("2006-01-02 15:04"), c.want)
+		}
+	}
+}
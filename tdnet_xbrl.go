@@ -0,0 +1,431 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 決算短信サマリー XBRL (TDNET の XBRL ZIP に含まれる Inline XBRL) のパーサ
+//
+// ZIP 構成 (例):
+//   XBRLData/Summary/tse-acedjpsm-72030-20250508372030-ixbrl.htm  ← サマリー (これを読む)
+//   XBRLData/Attachment/0101010-acbs01-tse-acedjpfr-...-ixbrl.htm ← 添付財務諸表 (読まない)
+//
+// サマリーの値は <ix:nonFraction name="tse-ed-t:NetSales" contextRef="..." scale="6" sign="-"> で
+// 単位が明示されるため、PDF パーサのような百万円/千円の推定や ×1000 補正は不要。
+//
+// contextRef は "期間_メンバー_メンバー..." 形式:
+//   CurrentYearDuration_ConsolidatedMember_ResultMember        通期実績 (連結)
+//   CurrentAccumulatedQ2Duration_ConsolidatedMember_ResultMember 中間累計実績
+//   CurrentYearInstant_NonConsolidatedMember_ResultMember       期末時点 (非連結)
+//   NextYearDuration_ConsolidatedMember_ForecastMember          来期予想 (通期決算短信)
+//   CurrentYearDuration_ConsolidatedMember_ForecastMember       今期予想 (四半期決算短信)
+//   CurrentYearDuration_AnnualMember_ResultMember               年間配当実績
+
+// tanshinFact は Inline XBRL の数値ファクト1件
+type tanshinFact struct {
+	Name    string  // 要素名 (プレフィックス除去済み。例: NetSales)
+	Context string  // contextRef
+	Value   float64 // scale・sign 適用後の値 (円、円/株)
+}
+
+// tanshinSummary は決算短信サマリーから取り出した実績・予想
+type tanshinSummary struct {
+	Data FinancialData // 実績 (円単位。DividendPerShare は年間配当実績)
+	EPS  float64       // 1株当たり当期純利益 (実績)
+
+	ForecastNextYear         bool // true: 予想は来期分 (通期決算短信)、false: 今期分 (四半期決算短信)
+	ForecastNetSales         int64
+	ForecastOperatingIncome  int64
+	ForecastNetIncome        int64
+	ForecastEPS              float64
+	ForecastDividendPerShare float64 // 年間配当予想
+	ForecastFiscalYearEnd    string  // 予想対象の決算期 (YYYY-MM)。PDF の見出しから読めたときだけ入る
+
+	FiscalYearEnd string        // 決算期 (YYYY-MM)。XBRL には無いので表題・本文から補う
+	FiscalPeriod  string        // Q1 / Q2 / Q3 / FY。四半期の実績は期首からの累計
+	Prior         FinancialData // 前年同期の実績 (売上・営業利益・純利益のみ)
+}
+
+// 項目ごとの要素名 (優先順)。日本基準 → IFRS → 米国基準、業種別 (BK=銀行, IN=保険) の順
+var tanshinElementNames = map[string][]string{
+	"NetSales": {
+		"NetSales", "OperatingRevenues", "OrdinaryRevenuesBK", "OrdinaryRevenuesIN", "GrossOperatingRevenues",
+		"NetSalesIFRS", "OperatingRevenuesIFRS", "RevenueIFRS",
+		"NetSalesUS", "OperatingRevenuesUS", "TotalRevenuesUS",
+	},
+	"OperatingIncome": {
+		"OperatingIncome", "OperatingIncomeIFRS", "OperatingIncomeUS",
+		// 営業利益の無い業種 (銀行・保険) は経常利益で代替 (PDF パーサと同じ扱い)
+		"OrdinaryIncome",
+	},
+	"NetIncome": {
+		"ProfitAttributableToOwnersOfParent", "NetIncome",
+		"ProfitAttributableToOwnersOfParentIFRS", "NetIncomeAttributableToOwnersOfParentUS",
+	},
+	"TotalAssets": {"TotalAssets", "TotalAssetsIFRS", "TotalAssetsUS"},
+	"NetAssets": {
+		"NetAssets", "TotalEquityIFRS", "EquityAttributableToOwnersOfParentIFRS", "TotalEquityUS",
+	},
+	"EPS": {
+		"NetIncomePerShare", "BasicEarningsPerShareIFRS", "NetIncomePerShareUS", "BasicNetIncomePerShareUS",
+	},
+	"DividendPerShare": {"DividendPerShare"},
+}
+
+// parseTanshinIXBRL は Inline XBRL (XHTML) から ix:nonFraction の数値ファクトを抜き出す。
+// xsi:nil のファクトや数値として読めないファクトは除外する。
+func parseTanshinIXBRL(r io.Reader) ([]tanshinFact, error) {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	var facts []tanshinFact
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return facts, fmt.Errorf("iXBRL parse: %w", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "nonFraction" {
+			continue
+		}
+
+		var name, ctx, scale, sign, format string
+		isNil := false
+		for _, a := range se.Attr {
+			switch a.Name.Local {
+			case "name":
+				name = a.Value
+			case "contextRef":
+				ctx = a.Value
+			case "scale":
+				scale = a.Value
+			case "sign":
+				sign = a.Value
+			case "format":
+				format = a.Value
+			case "nil":
+				isNil = a.Value == "true"
+			}
+		}
+
+		// ix:nonFraction の中身は文字列のみ (入れ子タグがあっても文字だけ拾う)
+		text, err := tanshinElementText(dec)
+		if err != nil {
+			return facts, fmt.Errorf("iXBRL parse: %w", err)
+		}
+		if isNil || name == "" || ctx == "" {
+			continue
+		}
+		v, ok := parseIXBRLNumber(text, format, scale, sign)
+		if !ok {
+			continue
+		}
+		if i := strings.LastIndex(name, ":"); i >= 0 {
+			name = name[i+1:]
+		}
+		facts = append(facts, tanshinFact{Name: name, Context: ctx, Value: v})
+	}
+	return facts, nil
+}
+
+// tanshinElementText は現在の要素の終了タグまでの文字データを連結して返す
+func tanshinElementText(dec *xml.Decoder) (string, error) {
+	var sb strings.Builder
+	depth := 1
+	for depth > 0 {
+		tok, err := dec.Token()
+		if err != nil {
+			return sb.String(), err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			sb.Write(t)
+		}
+	}
+	return sb.String(), nil
+}
+
+// parseIXBRLNumber は ix:nonFraction の表示値を数値に変換する。
+// format が ixt:fixed-zero / zerodash の場合は "－" 等の表示でも 0 とみなす。
+func parseIXBRLNumber(text, format, scale, sign string) (float64, bool) {
+	text = strings.TrimSpace(text)
+	if strings.Contains(format, "zero") {
+		return 0, true
+	}
+	text = strings.NewReplacer("，", ",", " ", "", "\u00a0", "").Replace(fullWidthDigits.Replace(text))
+	if strings.Contains(format, "numcommadecimal") || strings.Contains(format, "num-comma-decimal") {
+		// 1.234,5 形式 (桁区切りがピリオド)
+		text = strings.Replace(strings.ReplaceAll(text, ".", ""), ",", ".", 1)
+	} else {
+		text = strings.ReplaceAll(text, ",", "")
+	}
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, false
+	}
+	if scale != "" {
+		n, err := strconv.Atoi(scale)
+		if err != nil {
+			return 0, false
+		}
+		v *= math.Pow10(n)
+	}
+	if sign == "-" {
+		v = -v
+	}
+	return v, true
+}
+
+// tanshinContext は contextRef を期間と種別に分解したもの
+type tanshinContext struct {
+	Period   string // CurrentYearDuration, CurrentAccumulatedQ2Instant, NextYearDuration 等
+	Forecast bool
+	Range    bool // 予想のレンジ上限・下限
+	Annual   bool // 配当の年間合計
+	Consol   int  // 連結の優先度: 連結=2, 指定なし=1, 非連結=0
+}
+
+func parseTanshinContext(ctx string) tanshinContext {
+	parts := strings.Split(ctx, "_")
+	c := tanshinContext{Period: parts[0], Consol: 1}
+	for _, m := range parts[1:] {
+		switch m {
+		case "ForecastMember":
+			c.Forecast = true
+		case "UpperMember", "LowerMember":
+			c.Range = true
+		case "AnnualMember":
+			c.Annual = true
+		case "ConsolidatedMember":
+			c.Consol = 2
+		case "NonConsolidatedMember":
+			c.Consol = 0
+		}
+	}
+	return c
+}
+
+// summarizeTanshinFacts はファクト群から当期実績と業績予想を組み立てる。
+// 同じ項目が複数あれば、要素名の優先順 → 連結優先 の順で採用する。
+func summarizeTanshinFacts(facts []tanshinFact) tanshinSummary {
+	// 予想は通期決算短信なら来期 (NextYear)、四半期決算短信なら今期 (CurrentYear)
+	forecastPeriod := "CurrentYearDuration"
+	for _, f := range facts {
+		if c := parseTanshinContext(f.Context); c.Forecast && strings.HasPrefix(c.Period, "NextYear") {
+			forecastPeriod = "NextYearDuration"
+			break
+		}
+	}
+
+	const (
+		scopeCurrent  = iota // 当期実績
+		scopePrior           // 前年同期実績 (PriorYearDuration / PriorAccumulatedQnDuration)
+		scopeForecast        // 業績予想
+	)
+	pick := func(field string, scope int) (float64, bool) {
+		for _, name := range tanshinElementNames[field] {
+			best, bestConsol, found := 0.0, -1, false
+			for _, f := range facts {
+				if f.Name != name {
+					continue
+				}
+				c := parseTanshinContext(f.Context)
+				if c.Forecast != (scope == scopeForecast) || c.Range {
+					continue
+				}
+				if field == "DividendPerShare" && !c.Annual {
+					continue // 四半期ごとの配当は除外、年間合計のみ
+				}
+				switch scope {
+				case scopeForecast:
+					if c.Period != forecastPeriod {
+						continue
+					}
+				case scopeCurrent:
+					if !strings.HasPrefix(c.Period, "Current") {
+						continue // 前期 (Prior...) の比較値は除外
+					}
+				case scopePrior:
+					if !strings.HasPrefix(c.Period, "Prior") || !strings.HasSuffix(c.Period, "Duration") {
+						continue
+					}
+				}
+				if c.Consol > bestConsol {
+					best, bestConsol, found = f.Value, c.Consol, true
+				}
+			}
+			if found {
+				return best, true
+			}
+		}
+		return 0, false
+	}
+	amount := func(field string, scope int) int64 {
+		v, _ := pick(field, scope)
+		return int64(math.Round(v))
+	}
+	perShare := func(field string, scope int) float64 {
+		v, _ := pick(field, scope)
+		return v
+	}
+
+	var s tanshinSummary
+	s.ForecastNextYear = forecastPeriod == "NextYearDuration"
+	s.FiscalPeriod = tanshinFiscalPeriod(facts)
+	s.Data.NetSales = amount("NetSales", scopeCurrent)
+	s.Data.OperatingIncome = amount("OperatingIncome", scopeCurrent)
+	s.Data.NetIncome = amount("NetIncome", scopeCurrent)
+	s.Data.TotalAssets = amount("TotalAssets", scopeCurrent)
+	s.Data.NetAssets = amount("NetAssets", scopeCurrent)
+	s.Data.DividendPerShare = perShare("DividendPerShare", scopeCurrent)
+	s.EPS = perShare("EPS", scopeCurrent)
+
+	s.Prior.NetSales = amount("NetSales", scopePrior)
+	s.Prior.OperatingIncome = amount("OperatingIncome", scopePrior)
+	s.Prior.NetIncome = amount("NetIncome", scopePrior)
+
+	s.ForecastNetSales = amount("NetSales", scopeForecast)
+	s.ForecastOperatingIncome = amount("OperatingIncome", scopeForecast)
+	s.ForecastNetIncome = amount("NetIncome", scopeForecast)
+	s.ForecastEPS = perShare("EPS", scopeForecast)
+	s.ForecastDividendPerShare = perShare("DividendPerShare", scopeForecast)
+	return s
+}
+
+// tanshinFiscalPeriod は実績のコンテキスト (CurrentAccumulatedQ1Duration 等) から対象期間を判定する。
+// 四半期の累計期間が無ければ通期 (CurrentYearDuration) とみなす
+func tanshinFiscalPeriod(facts []tanshinFact) string {
+	for _, f := range facts {
+		c := parseTanshinContext(f.Context)
+		if c.Forecast {
+			continue
+		}
+		for _, q := range []string{"Q1", "Q2", "Q3"} {
+			if c.Period == "CurrentAccumulated"+q+"Duration" {
+				return q
+			}
+		}
+	}
+	return "FY"
+}
+
+// isTanshinSummaryFile は ZIP 内のファイルが決算短信サマリーの Inline XBRL か判定する
+func isTanshinSummaryFile(name string) bool {
+	if !strings.HasSuffix(name, "-ixbrl.htm") {
+		return false
+	}
+	return strings.Contains(name, "/Summary/") || strings.Contains(path.Base(name), "sm-")
+}
+
+// readTanshinXBRLZip は XBRL ZIP を展開し、サマリーの全ファクトから実績・予想を返す
+func readTanshinXBRLZip(data []byte) (tanshinSummary, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return tanshinSummary{}, fmt.Errorf("zip: %w", err)
+	}
+
+	var facts []tanshinFact
+	files := 0
+	for _, f := range zr.File {
+		if !isTanshinSummaryFile(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return tanshinSummary{}, err
+		}
+		fs, err := parseTanshinIXBRL(rc)
+		rc.Close()
+		if err != nil {
+			return tanshinSummary{}, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		facts = append(facts, fs...)
+		files++
+	}
+	if files == 0 {
+		return tanshinSummary{}, fmt.Errorf("サマリー iXBRL が ZIP 内にありません")
+	}
+	if len(facts) == 0 {
+		return tanshinSummary{}, fmt.Errorf("サマリーに数値ファクトがありません")
+	}
+	return summarizeTanshinFacts(facts), nil
+}
+
+// fetchTanshinXBRL は TDNET の XBRL ZIP をメモリ上に取得してサマリーをパースする
+func fetchTanshinXBRL(url string) (tanshinSummary, error) {
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return tanshinSummary{}, fmt.Errorf("HTTP error: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return tanshinSummary{}, fmt.Errorf("HTTP status: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return tanshinSummary{}, err
+	}
+	return readTanshinXBRLZip(data)
+}
+
+// saveTanshinExtras は stock_financials の決算短信行に EPS・業績予想・対象期間・前年同期・取得元を書き込む
+// (saveStockFinancial の後に呼ぶ。FinancialData に無い項目だけを扱う)
+func saveTanshinExtras(db *sql.DB, code, submissionDate, source string, s tanshinSummary) error {
+	_, err := db.Exec(`
+		UPDATE stock_financials SET
+			source = ?,
+			eps = ?,
+			forecast_net_sales = ?,
+			forecast_operating_income = ?,
+			forecast_net_income = ?,
+			forecast_eps = ?,
+			forecast_dividend_per_share = ?,
+			fiscal_year_end = ?,
+			fiscal_period = ?,
+			prior_net_sales = ?,
+			prior_operating_income = ?,
+			prior_net_income = ?
+		WHERE code = ? AND submission_date = ?`,
+		source, nullIfZeroFloat(s.EPS),
+		nullIfZero(s.ForecastNetSales), nullIfZero(s.ForecastOperatingIncome), nullIfZero(s.ForecastNetIncome),
+		nullIfZeroFloat(s.ForecastEPS), nullIfZeroFloat(s.ForecastDividendPerShare),
+		s.FiscalYearEnd, s.FiscalPeriod,
+		nullIfZero(s.Prior.NetSales), nullIfZero(s.Prior.OperatingIncome), nullIfZero(s.Prior.NetIncome),
+		code, submissionDate)
+	return err
+}
+
+func nullIfZero(v int64) any {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
+
+func nullIfZeroFloat(v float64) any {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
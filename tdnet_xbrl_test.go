@@ -0,0 +1,118 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSummarizeTanshinFacts(t *testing.T) {
+	cases := []struct {
+		file string
+		want tanshinSummary
+	}{
+		{
+			// 通期 (日本基準・連結): 純損失は sign="-"、予想は来期、配当は年間合計
+			file: "tse-acedjpsm-99990-20250515499990-ixbrl.htm",
+			want: tanshinSummary{
+				Data: FinancialData{
+					NetSales:         123_456_000_000,
+					OperatingIncome:  10_987_000_000,
+					NetIncome:        -1_234_000_000,
+					TotalAssets:      250_000_000_000,
+					NetAssets:        98_765_000_000,
+					DividendPerShare: 35,
+				},
+				EPS:                      -24.68,
+				ForecastNextYear:         true,
+				ForecastNetSales:         130_000_000_000,
+				ForecastOperatingIncome:  12_000_000_000,
+				ForecastNetIncome:        7_500_000_000,
+				ForecastEPS:              150,
+				ForecastDividendPerShare: 40,
+				FiscalPeriod:             "FY",
+				Prior: FinancialData{
+					NetSales:        117_355_000_000,
+					OperatingIncome: 9_800_000_000,
+					NetIncome:       5_010_000_000,
+				},
+			},
+		},
+		{
+			// 第1四半期 (IFRS・千円単位): 予想は今期、レンジ予想は採用しない、前年同期は累計期間
+			file: "tse-qcediffrssm-99980-20250515499980-ixbrl.htm",
+			want: tanshinSummary{
+				Data: FinancialData{
+					NetSales:        4_567_890_000,
+					OperatingIncome: 345_678_000,
+					NetIncome:       234_567_000,
+					TotalAssets:     9_876_543_000,
+					NetAssets:       5_432_100_000,
+				},
+				EPS:                      12.34,
+				ForecastNetSales:         19_000_000_000,
+				ForecastDividendPerShare: 50,
+				FiscalPeriod:             "Q1",
+				Prior: FinancialData{
+					NetSales:        4_100_000_000,
+					OperatingIncome: 300_000_000,
+					NetIncome:       250_000_000,
+				},
+			},
+		},
+	}
+	for _, c := range cases {
+		f, err := os.Open(filepath.Join("testdata", "tanshin_xbrl", c.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		facts, err := parseTanshinIXBRL(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", c.file, err)
+		}
+		if got := summarizeTanshinFacts(facts); got != c.want {
+			t.Errorf("%s:\n got  %+v\n want %+v", c.file, got, c.want)
+		}
+	}
+}
+
+func TestReadTanshinXBRLZip(t *testing.T) {
+	summary, err := os.ReadFile(filepath.Join("testdata", "tanshin_xbrl", "tse-acedjpsm-99990-20250515499990-ixbrl.htm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 添付財務諸表 (Attachment) は読まないこと
+	attachment := []byte(`<html xmlns:ix="http://www.xbrl.org/2013/inlineXBRL"><body>
+<ix:nonFraction name="jppfs_cor:NetSales" contextRef="CurrentYearDuration" scale="6">999,999</ix:nonFraction>
+</body></html>`)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range map[string][]byte{
+		"XBRLData/Summary/tse-acedjpsm-99990-20250515499990-ixbrl.htm":                  summary,
+		"XBRLData/Attachment/0101010-acbs01-tse-acedjpfr-99990-2025-03-31-01-ixbrl.htm": attachment,
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(body)
+	}
+	zw.Close()
+
+	got, err := readTanshinXBRLZip(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Data.NetSales != 123_456_000_000 {
+		t.Errorf("NetSales = %d, want 123456000000", got.Data.NetSales)
+	}
+
+	if _, err := readTanshinXBRLZip([]byte("not a zip")); err == nil {
+		t.Error("expected error for invalid zip")
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"stock-analyzer/tradingcal"
+)
+
+// defaultTradingCalendarPath は -trading-calendar の既定値。ファイルが無ければ埋め込みの表だけを使う
+const defaultTradingCalendarPath = "./data/trading_calendar.csv"
+
+// tradingCalendar は東証の営業日カレンダー。バッチの日付送り・アラートや RS の期間は営業日で数える
+var tradingCalendar = tradingcal.Default()
+
+// loadTradingCalendar は埋め込みの休場日に path の CSV (日付,名称) を重ねる
+func loadTradingCalendar(path string) {
+	cal, err := tradingcal.Default().WithOverrideFile(path)
+	if err != nil {
+		log.Fatalf("営業日カレンダーの読み込み失敗: %v", err)
+	}
+	tradingCalendar = cal
+	if now := nowJST(); !cal.Covers(now) {
+		first, last := cal.Range()
+		fmt.Printf("⚠️ 営業日カレンダーは %d〜%d 年分のみです。%s に %d 年の祝日を追加してください\n", first, last, path, now.Year())
+	}
+}
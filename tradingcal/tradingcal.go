@@ -0,0 +1,240 @@
+// Package tradingcal は東京証券取引所の営業日カレンダー。
+//
+// 土日・国民の祝日・休日と年末年始の休業日 (12/31〜1/3) を休場とする。休場日の表は holidays.csv を埋め込んで持ち、
+// 内閣府の「国民の祝日」CSV (syukujitsu.csv を UTF-8 にしたもの) と同じ「日付,名称」の形式の CSV で上書きできる。
+// 上書きの CSV で名称を "open" にした日は営業日に戻す (臨時の取引日など)。
+// 名称に "売買停止" を含む日は取引所だけの休場 (システム障害による終日売買停止など) として扱い、
+// 株価・RS では休場日、EDINET・TDNET の開示の取得 (HolidayReason) では稼働日とする。
+//
+// 日付は time.Time の年月日だけを見る (タイムゾーンは呼び出し側で揃える)。
+package tradingcal
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed holidays.csv
+var embeddedHolidays string
+
+// OpenMarker は上書きの CSV で休場日を営業日に戻すときの名称
+const OpenMarker = "open"
+
+// HaltMarker は取引所だけの休場 (土日・祝日・年末年始ではない日の売買停止) の名称に含める語
+const HaltMarker = "売買停止"
+
+// Calendar は休場日の表
+type Calendar struct {
+	closed    map[string]string // YYYY-MM-DD → 休場の理由
+	firstYear int               // 表が揃っている年の範囲 (範囲外は土日だけで判定)
+	lastYear  int
+}
+
+var (
+	defaultOnce sync.Once
+	defaultCal  *Calendar
+)
+
+// Default は埋め込みの表から作ったカレンダーを返す
+func Default() *Calendar {
+	defaultOnce.Do(func() {
+		c, err := Load(strings.NewReader(embeddedHolidays))
+		if err != nil {
+			panic(fmt.Sprintf("tradingcal: embedded holidays.csv: %v", err))
+		}
+		defaultCal = c
+	})
+	return defaultCal
+}
+
+// Load は「日付,名称」の CSV からカレンダーを作る。日付は 2006-01-02 か 2006/1/2、解釈できない行 (見出し) は飛ばす
+func Load(r io.Reader) (*Calendar, error) {
+	c := &Calendar{closed: make(map[string]string)}
+	if err := c.apply(r); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// WithOverride は c に CSV の休場日を重ねた新しいカレンダーを返す (c は変更しない)
+func (c *Calendar) WithOverride(r io.Reader) (*Calendar, error) {
+	out := &Calendar{closed: make(map[string]string, len(c.closed)), firstYear: c.firstYear, lastYear: c.lastYear}
+	for k, v := range c.closed {
+		out.closed[k] = v
+	}
+	if err := out.apply(r); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WithOverrideFile は path の CSV を重ねる。ファイルが無ければ c をそのまま返す
+func (c *Calendar) WithOverrideFile(path string) (*Calendar, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out, err := c.WithOverride(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return out, nil
+}
+
+func (c *Calendar) apply(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(rec) == 0 {
+			continue
+		}
+		d, ok := parseDate(strings.TrimPrefix(rec[0], "\ufeff"))
+		if !ok {
+			continue
+		}
+		name := ""
+		if len(rec) > 1 {
+			name = strings.TrimSpace(rec[1])
+		}
+		key := d.Format("2006-01-02")
+		if name == OpenMarker {
+			delete(c.closed, key)
+		} else {
+			c.closed[key] = name
+		}
+		if c.firstYear == 0 || d.Year() < c.firstYear {
+			c.firstYear = d.Year()
+		}
+		if d.Year() > c.lastYear {
+			c.lastYear = d.Year()
+		}
+	}
+}
+
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02", "2006/1/2"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func key(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// day は t の年月日 (時刻を落とし、タイムゾーンはそのまま)
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Covers は t の年の休場日が表に入っているか (範囲外の年は土日以外を営業日とみなしている)
+func (c *Calendar) Covers(t time.Time) bool {
+	return t.Year() >= c.firstYear && t.Year() <= c.lastYear
+}
+
+// Range は表に入っている年の範囲
+func (c *Calendar) Range() (firstYear, lastYear int) {
+	return c.firstYear, c.lastYear
+}
+
+// IsTradingDay は t が営業日か
+func (c *Calendar) IsTradingDay(t time.Time) bool {
+	if wd := t.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false
+	}
+	_, closed := c.closed[key(t)]
+	return !closed
+}
+
+// ClosedReason は休場日ならその理由 (祝日名・年末年始休業・土曜日/日曜日) を返す
+func (c *Calendar) ClosedReason(t time.Time) (string, bool) {
+	if name, ok := c.closed[key(t)]; ok {
+		return name, true
+	}
+	switch t.Weekday() {
+	case time.Saturday:
+		return "土曜日", true
+	case time.Sunday:
+		return "日曜日", true
+	}
+	return "", false
+}
+
+// HolidayReason は土日・祝日・休日・年末年始ならその理由を返す。ClosedReason と違い、取引所だけの休場
+// (名称に HaltMarker を含む日) は休みとしない。取引所が止まっても EDINET・TDNET は開示を受け付けるので、
+// 開示の取得で飛ばす日はこちらで判定する
+func (c *Calendar) HolidayReason(t time.Time) (string, bool) {
+	reason, closed := c.ClosedReason(t)
+	if closed && strings.Contains(reason, HaltMarker) {
+		return "", false
+	}
+	return reason, closed
+}
+
+// PrevTradingDay は t より前の直近の営業日 (t 自身は含まない)
+func (c *Calendar) PrevTradingDay(t time.Time) time.Time {
+	d := day(t).AddDate(0, 0, -1)
+	for !c.IsTradingDay(d) {
+		d = d.AddDate(0, 0, -1)
+	}
+	return d
+}
+
+// NextTradingDay は t より後の直近の営業日 (t 自身は含まない)
+func (c *Calendar) NextTradingDay(t time.Time) time.Time {
+	d := day(t).AddDate(0, 0, 1)
+	for !c.IsTradingDay(d) {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+// AddTradingDays は t から n 営業日後 (n < 0 なら前) の日付。t が休場日でも t を起点に数える
+func (c *Calendar) AddTradingDays(t time.Time, n int) time.Time {
+	d := day(t)
+	for ; n > 0; n-- {
+		d = c.NextTradingDay(d)
+	}
+	for ; n < 0; n++ {
+		d = c.PrevTradingDay(d)
+	}
+	return d
+}
+
+// TradingDaysBetween は from より後・to 以前 (from, to] の営業日の数。to が from より前なら負の数
+func (c *Calendar) TradingDaysBetween(from, to time.Time) int {
+	from, to = day(from), day(to)
+	sign := 1
+	if to.Before(from) {
+		from, to, sign = to, from, -1
+	}
+	n := 0
+	for d := from.AddDate(0, 0, 1); !d.After(to); d = d.AddDate(0, 0, 1) {
+		if c.IsTradingDay(d) {
+			n++
+		}
+	}
+	return sign * n
+}
@@ -0,0 +1,136 @@
+package tradingcal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestIsTradingDay(t *testing.T) {
+	cal := Default()
+	cases := map[string]bool{
+		"2025-01-01": false, // 元日
+		"2025-01-02": false, // 年始休業
+		"2025-01-06": true,  // 大発会
+		"2025-02-24": false, // 振替休日
+		"2025-03-20": false, // 春分の日
+		"2025-05-06": false, // 振替休日
+		"2025-09-23": false, // 秋分の日
+		"2025-12-30": true,  // 大納会
+		"2025-12-31": false, // 年末休業
+		"2026-09-22": false, // 国民の休日 (敬老の日と秋分の日に挟まれた日)
+		"2019-05-01": false, // 即位の日
+		"2020-07-24": false, // 東京五輪の特例 (スポーツの日)
+		"2020-10-12": true,  // 2020年は10月にスポーツの日が無い
+		"2020-10-01": false, // システム障害による終日売買停止
+		"2025-10-18": false, // 土曜日
+		"2025-10-20": true,
+	}
+	for s, want := range cases {
+		if got := cal.IsTradingDay(date(t, s)); got != want {
+			reason, _ := cal.ClosedReason(date(t, s))
+			t.Errorf("IsTradingDay(%s) = %v, want %v (%s)", s, got, want, reason)
+		}
+	}
+}
+
+func TestPrevNextAndAdd(t *testing.T) {
+	cal := Default()
+	cases := []struct {
+		name string
+		got  time.Time
+		want string
+	}{
+		{"GW 明けの前営業日", cal.PrevTradingDay(date(t, "2025-05-07")), "2025-05-02"},
+		{"大発会の前営業日は大納会", cal.PrevTradingDay(date(t, "2026-01-05")), "2025-12-30"},
+		{"休場日の翌営業日", cal.NextTradingDay(date(t, "2025-12-31")), "2026-01-05"},
+		{"5営業日前 (祝日をまたぐ)", cal.AddTradingDays(date(t, "2025-09-26"), -5), "2025-09-18"},
+		{"0営業日", cal.AddTradingDays(date(t, "2025-09-23"), 0), "2025-09-23"},
+		{"3営業日後", cal.AddTradingDays(date(t, "2025-12-29"), 3), "2026-01-06"},
+	}
+	for _, c := range cases {
+		if got := c.got.Format("2006-01-02"); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestTradingDaysBetween(t *testing.T) {
+	cal := Default()
+	cases := []struct {
+		from, to string
+		want     int
+	}{
+		{"2025-09-19", "2025-09-26", 4}, // 9/22, 9/24, 9/25, 9/26 (9/23 は祝日)
+		{"2025-09-26", "2025-09-19", -4},
+		{"2025-12-30", "2026-01-05", 1},
+		{"2025-10-20", "2025-10-20", 0},
+	}
+	for _, c := range cases {
+		if got := cal.TradingDaysBetween(date(t, c.from), date(t, c.to)); got != c.want {
+			t.Errorf("TradingDaysBetween(%s, %s) = %d, want %d", c.from, c.to, got, c.want)
+		}
+	}
+	// 年間の営業日数はおおむね 240〜248 日
+	if n := cal.TradingDaysBetween(date(t, "2024-12-31"), date(t, "2025-12-31")); n < 240 || n > 248 {
+		t.Errorf("2025年の営業日数 = %d", n)
+	}
+}
+
+func TestHolidayReason(t *testing.T) {
+	cal := Default()
+	cases := map[string]bool{
+		"2020-10-01": false, // システム障害による終日売買停止 (開示は受け付けた)
+		"2020-10-02": false,
+		"2025-01-01": true, // 元日
+		"2025-01-02": true, // 年始休業
+		"2025-12-31": true, // 年末休業
+		"2025-02-24": true, // 振替休日
+		"2025-10-18": true, // 土曜日
+	}
+	for s, want := range cases {
+		if reason, got := cal.HolidayReason(date(t, s)); got != want {
+			t.Errorf("HolidayReason(%s) = %q, %v, want %v", s, reason, got, want)
+		}
+	}
+
+	// 上書きの CSV で追加した売買停止も同じ扱い
+	override, err := cal.WithOverride(strings.NewReader("2027-03-03,システム障害による売買停止\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, closed := override.HolidayReason(date(t, "2027-03-03")); closed || override.IsTradingDay(date(t, "2027-03-03")) {
+		t.Error("売買停止の日は休場だが開示の取得は休みではない")
+	}
+}
+
+func TestWithOverride(t *testing.T) {
+	base := Default()
+	// 内閣府の CSV と同じ形式 (見出し・スラッシュ区切り) と、臨時の営業日
+	override := "国民の祝日・休日月日,国民の祝日・休日名称\n2028/1/1,元日\n2028/1/10,成人の日\n2025-12-31,open\n"
+	cal, err := base.WithOverride(strings.NewReader(override))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cal.IsTradingDay(date(t, "2028-01-10")) {
+		t.Error("上書きで追加した祝日が営業日になっている")
+	}
+	if !cal.IsTradingDay(date(t, "2025-12-31")) {
+		t.Error("open で戻した日が休場のまま")
+	}
+	if !base.IsTradingDay(date(t, "2028-01-10")) || base.IsTradingDay(date(t, "2025-12-31")) {
+		t.Error("元のカレンダーが変更された")
+	}
+	if _, last := cal.Range(); last != 2028 || !cal.Covers(date(t, "2028-06-01")) {
+		t.Errorf("Range last = %d, want 2028", last)
+	}
+}